@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// killClients is the clients --kill flag
+var killClients bool
+
+var clientsCmd = &cobra.Command{
+	Use:   "clients <port...>",
+	Short: "List the local processes connected to a port, or kill them with --kill",
+	Long: `Lists the local processes with established TCP connections to the given
+ports, whether the server is on this host or another one: a test runner
+holding a database connection, a hung worker on redis, a client attached
+to a forwarded port. --kill terminates them instead of the server:
+
+  tsunami clients 5432
+  tsunami clients 6379 --kill
+  tsunami clients 5432 --kill --dry-run --json`,
+	Args: cobra.MinimumNArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyConfig(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		sig, err := killer.ParseSignal(signal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := setupPolicy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := runClients(args, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addKillFlags(clientsCmd)
+	clientsCmd.Flags().BoolVar(&killClients, "kill", false, "Kill the connected processes instead of listing them")
+	rootCmd.AddCommand(clientsCmd)
+}
+
+// runClients lists, or with --kill kills, the clients of the ports in args
+func runClients(args []string, sig killer.Signal) error {
+	portList, err := expandPortArgs(args)
+	if err != nil {
+		return err
+	}
+	if killClients {
+		if err := checkMachineKill(" with --kill"); err != nil {
+			return err
+		}
+	}
+	clients, err := findClients(portList)
+	if err != nil {
+		return err
+	}
+
+	if !killClients {
+		opts, err := outputOptions()
+		if err != nil {
+			return err
+		}
+		return clientPrinter.Print(os.Stdout, clients, opts)
+	}
+	if len(clients) == 0 {
+		return fmt.Errorf("no local process is connected to %s", describePorts(portList))
+	}
+	return killTargets(groupClients(clients), sig)
+}
+
+// findClients lists the clients of portList in the network namespaces
+// chosen with --netns or --all-netns, else in tsunami's own. ctrl+c
+// interrupts the search.
+func findClients(portList []int) ([]ports.Client, error) {
+	ctx, stop := interruptible()
+	defer stop()
+	clients, err := findClientsContext(ctx, portList)
+	return clients, interruptErr(ctx, err)
+}
+
+// findClientsContext is findClients with cancellation
+func findClientsContext(ctx context.Context, portList []int) ([]ports.Client, error) {
+	if netns == "" && !allNetns {
+		return ports.FindClients(ctx, portList)
+	}
+	nsList, err := selectedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	return ports.FindClientsNetns(ctx, nsList, portList)
+}
+
+// groupClients collects clients into one target per process, in the order
+// each process is first seen
+func groupClients(clients []ports.Client) []target {
+	var targets []target
+	index := make(map[int]int)
+	for _, c := range clients {
+		i, ok := index[c.PID]
+		if !ok {
+			i = len(targets)
+			index[c.PID] = i
+			targets = append(targets, target{PID: c.PID, Process: c.Process, User: c.User, Cmdline: c.Cmdline})
+		}
+		targets[i].Clients = append(targets[i].Clients, c)
+	}
+	return targets
+}
+
+// clientProcessRecord is a client as printed by the structured formats
+type clientProcessRecord struct {
+	PID     int    `json:"pid" yaml:"pid"`
+	Process string `json:"process" yaml:"process"`
+	User    string `json:"user" yaml:"user"`
+	Port    int    `json:"port" yaml:"port"`
+	Local   string `json:"local" yaml:"local"`
+	Remote  string `json:"remote" yaml:"remote"`
+	Cmdline string `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`
+	Netns   string `json:"netns,omitempty" yaml:"netns,omitempty"`
+}
+
+// clientPrinter renders the clients of a port
+var clientPrinter = output.Printer[ports.Client]{
+	Columns: []output.Column[ports.Client]{
+		{Key: "pid", Header: "PID", Value: func(c ports.Client) string { return strconv.Itoa(c.PID) }},
+		{Key: "process", Header: "PROCESS", Flex: true, Min: 8, Value: func(c ports.Client) string { return c.Process }},
+		{Key: "user", Header: "USER", Flex: true, Min: 6, Value: func(c ports.Client) string { return c.User }},
+		{Key: "local", Header: "LOCAL", Value: func(c ports.Client) string { return c.Local }},
+		{Key: "remote", Header: "REMOTE", Value: func(c ports.Client) string { return c.Remote }},
+		{Key: "cmdline", Header: "COMMAND", Flex: true, Min: 10, Value: func(c ports.Client) string { return cols.Printable(c.Cmdline) }},
+	},
+	Record: func(c ports.Client) any {
+		return clientProcessRecord{PID: c.PID, Process: c.Process, User: c.User, Port: c.Port,
+			Local: c.Local, Remote: c.Remote, Cmdline: c.Cmdline, Netns: c.Netns}
+	},
+	Empty: "No connected clients found",
+}
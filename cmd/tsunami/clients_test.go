@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var clientTestClients = []ports.Client{
+	{PID: 9000100, Process: "psql", User: "alice", Local: "127.0.0.1:51000", Remote: "127.0.0.1:5432", Port: 5432},
+	{PID: 9000200, Process: "node", User: "alice", Local: "127.0.0.1:51001", Remote: "127.0.0.1:5432", Port: 5432, Cmdline: "node worker.js"},
+	{PID: 9000100, Process: "psql", User: "alice", Local: "127.0.0.1:51002", Remote: "127.0.0.1:6379", Port: 6379},
+	{PID: 9000100, Process: "psql", User: "alice", Local: "127.0.0.1:51003", Remote: "127.0.0.1:5432", Port: 5432},
+}
+
+func TestGroupClients(t *testing.T) {
+	targets := groupClients(clientTestClients)
+	if len(targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(targets))
+	}
+	if targets[0].PID != 9000100 || len(targets[0].Clients) != 3 {
+		t.Errorf("targets[0] = %+v", targets[0])
+	}
+	if targets[1].PID != 9000200 || targets[1].Cmdline != "node worker.js" {
+		t.Errorf("targets[1] = %+v", targets[1])
+	}
+	if got := targets[0].ConnectedTo(); !reflect.DeepEqual(got, []int{5432, 6379}) {
+		t.Errorf("ConnectedTo() = %v, want [5432 6379]", got)
+	}
+	if got := targets[1].ConnectedTo(); !reflect.DeepEqual(got, []int{5432}) {
+		t.Errorf("ConnectedTo() = %v, want [5432]", got)
+	}
+}
+
+func TestClientPrinter(t *testing.T) {
+	var sb strings.Builder
+	if err := clientPrinter.Print(&sb, clientTestClients[:2], output.Options{Format: output.CSV}); err != nil {
+		t.Fatalf("Print error: %v", err)
+	}
+	want := "pid,process,user,local,remote,cmdline\n" +
+		"9000100,psql,alice,127.0.0.1:51000,127.0.0.1:5432,\n" +
+		"9000200,node,alice,127.0.0.1:51001,127.0.0.1:5432,node worker.js\n"
+	if sb.String() != want {
+		t.Errorf("csv output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+
+	sb.Reset()
+	if err := clientPrinter.Print(&sb, nil, output.Options{Format: output.Table}); err != nil {
+		t.Fatalf("Print error: %v", err)
+	}
+	if !strings.Contains(sb.String(), "No connected clients found") {
+		t.Errorf("empty output = %q", sb.String())
+	}
+}
+
+func TestClientPrinterMultiLineCmdline(t *testing.T) {
+	client := ports.Client{PID: 9000300, Process: "python3", User: "alice", Local: "127.0.0.1:51004",
+		Remote: "127.0.0.1:5432", Port: 5432, Cmdline: "python3 -c import socket\nsocket.create_connection(('127.0.0.1', 5432))"}
+
+	var sb strings.Builder
+	if err := clientPrinter.Print(&sb, []ports.Client{client}, output.Options{Format: output.Table}); err != nil {
+		t.Fatalf("Print error: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(sb.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("table has %d lines, want a header, a rule and one row:\n%s", len(lines), sb.String())
+	}
+	if !strings.Contains(lines[2], "python3 -c import socket socket.create_connection") {
+		t.Errorf("row = %q, want the newline replaced by a space", lines[2])
+	}
+}
+
+func TestKillTargetsClientsDryRunJSON(t *testing.T) {
+	setKillFlags(t, true, false, true, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	out := captureStdout(t, func() {
+		err = killTargets(groupClients(clientTestClients), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets dry run error: %v", err)
+	}
+
+	var results []targetResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Status != "would_kill" || !reflect.DeepEqual(results[0].ConnectedTo, []int{5432, 6379}) {
+		t.Errorf("results[0] = %+v", results[0])
+	}
+}
+
+func TestRunClientsErrors(t *testing.T) {
+	setKillFlags(t, false, false, true, false)
+	orig := killClients
+	t.Cleanup(func() { killClients = orig })
+	sig, _ := killer.ParseSignal("TERM")
+
+	killClients = true
+	if err := runClients([]string{"5432"}, sig); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("runClients --kill --json without --force error = %v", err)
+	}
+
+	if err := runClients([]string{"nope"}, sig); err == nil {
+		t.Error("runClients with an invalid port: expected error")
+	}
+}
+
+func TestRunClientsLive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scan test in short mode")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	setKillFlags(t, true, false, true, false)
+	orig := killClients
+	t.Cleanup(func() { killClients = orig })
+	sig, _ := killer.ParseSignal("TERM")
+
+	// The only client is this test, which tsunami refuses to kill
+	killClients = true
+	out := captureStdout(t, func() {
+		err = runClients([]string{port}, sig)
+	})
+	var results []targetResult
+	if jerr := json.Unmarshal([]byte(out), &results); jerr != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s (err %v)", jerr, out, err)
+	}
+	if len(results) != 1 || results[0].Status != "protected" || results[0].ConnectedTo[0] != ln.Addr().(*net.TCPAddr).Port {
+		t.Errorf("results = %+v", results)
+	}
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	freePort := strconv.Itoa(free.Addr().(*net.TCPAddr).Port)
+	free.Close()
+	setKillFlags(t, false, true, false, false)
+	if err := runClients([]string{freePort}, sig); err == nil || !strings.Contains(err.Error(), "no local process is connected") {
+		t.Errorf("runClients on an unused port error = %v", err)
+	}
+}
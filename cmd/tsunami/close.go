@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var (
+	closeRemote []string
+	closeState  string
+)
+
+var closeCmd = &cobra.Command{
+	Use:   "close [address...]",
+	Short: "Close single TCP sockets without killing the process that holds them",
+	Long: `Closes TCP sockets in the kernel, as ss -K does, and leaves the processes
+holding them running: drop one stuck connection, or stop a listener on one
+port of a server that also serves others. Each address selects the
+sockets' own end: a port (8080), an address (127.0.0.1) or both
+(127.0.0.1:8080, [::1]:8080). --remote selects the peer's end the same
+way, and --state the TCP states (every state but time-wait by default):
+
+  tsunami close 8080 --state listen
+  tsunami close 5432 --remote 10.0.0.7 --dry-run
+  tsunami close --remote :6379 --state established -f
+
+Linux only. Closing sockets needs CAP_NET_ADMIN and a kernel built with
+CONFIG_INET_DIAG_DESTROY.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyConfig(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setupPolicy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := runClose(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	f := closeCmd.Flags()
+	f.StringArrayVar(&closeRemote, "remote", nil, "Only close connections to this peer address, port or both (can be repeated)")
+	f.StringVar(&closeState, "state", "", "Only close sockets in these states, e.g. listen,established,close-wait or connected")
+	f.BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
+	f.BoolVarP(&dryRun, "dry-run", "n", false, "Show what would be closed without closing")
+	f.BoolVarP(&quiet, "quiet", "q", false, "Suppress output except errors")
+	f.BoolVar(&overrideProtection, "override-protection", false, "Allow closing sockets of protected and forbidden processes")
+	f.StringArrayVar(&protectRules, "protect", nil, "Also protect processes matching name=, port=, user= or path= (can be repeated)")
+	addOutputFlags(closeCmd, "Output format for results: "+formatNames()+" (machine formats require --force or --dry-run)")
+	rootCmd.AddCommand(closeCmd)
+}
+
+// socketQuery builds the sockets to close from the address arguments,
+// --remote and --state
+func socketQuery(args []string) (ports.SocketQuery, error) {
+	var q ports.SocketQuery
+	if len(args) == 0 && len(closeRemote) == 0 {
+		return q, errors.New("give an address to close, or --remote")
+	}
+	for _, arg := range args {
+		e, err := ports.ParseEndpoint(arg)
+		if err != nil {
+			return q, err
+		}
+		q.Local = append(q.Local, e)
+	}
+	for _, spec := range closeRemote {
+		e, err := ports.ParseEndpoint(spec)
+		if err != nil {
+			return q, fmt.Errorf("--remote: %w", err)
+		}
+		q.Remote = append(q.Remote, e)
+	}
+	states, err := ports.ParseSocketStates(closeState)
+	if err != nil {
+		return q, fmt.Errorf("--state: %w", err)
+	}
+	q.States = states
+	return q, nil
+}
+
+// describeQuery summarizes q for error messages
+func describeQuery(q ports.SocketQuery) string {
+	var parts []string
+	for _, e := range q.Local {
+		parts = append(parts, e.String())
+	}
+	s := strings.Join(parts, ", ")
+	if len(q.Remote) > 0 {
+		var remotes []string
+		for _, e := range q.Remote {
+			remotes = append(remotes, e.String())
+		}
+		if s != "" {
+			s += " "
+		}
+		s += "connected to " + strings.Join(remotes, ", ")
+	}
+	if closeState != "" {
+		s += " in state " + closeState
+	}
+	return s
+}
+
+// runClose closes the sockets the arguments select, after showing them
+// and asking for one confirmation. It honors --dry-run, --force, --output
+// and --quiet.
+func runClose(args []string) error {
+	q, err := socketQuery(args)
+	if err != nil {
+		return err
+	}
+	if err := checkMachineKill(""); err != nil {
+		return err
+	}
+	ctx, stop := interruptible()
+	sockets, err := ports.FindSockets(ctx, q)
+	err = interruptErr(ctx, err)
+	stop()
+	if err != nil {
+		return err
+	}
+	if len(sockets) == 0 {
+		return fmt.Errorf("no socket matches %s", describeQuery(q))
+	}
+
+	machine := machineOutput()
+	if showMatches() {
+		_ = socketPrinter.Print(os.Stdout, sockets, output.Options{Format: output.Table, Width: terminalWidth()})
+		fmt.Println()
+	}
+
+	errs := make([]error, len(sockets))
+	allowed := 0
+	for i, s := range sockets {
+		if errs[i] = checkSocket(s); errs[i] != nil {
+			if !machine {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", errs[i])
+			}
+			continue
+		}
+		allowed++
+	}
+
+	if dryRun {
+		if machine {
+			return printCloseResults(sockets, errs, false)
+		}
+		fmt.Printf("Would close %s\n", plural(allowed, "socket"))
+		return nil
+	}
+	if allowed == 0 {
+		if machine {
+			if err := printCloseResults(sockets, errs, true); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("every matched socket belongs to a protected process")
+	}
+	if !force && !confirm(fmt.Sprintf("Close %s?", plural(allowed, "socket"))) {
+		return nil // User cancelled
+	}
+
+	var failures []string
+	var fatal error
+	for i, s := range sockets {
+		if errs[i] != nil {
+			var perr *killer.ProtectedError
+			if !errors.As(errs[i], &perr) {
+				failures = append(failures, errs[i].Error())
+			}
+			continue
+		}
+		if fatal != nil {
+			errs[i] = fatal
+			continue
+		}
+		errs[i] = ports.CloseSocket(s)
+		switch {
+		case errors.Is(errs[i], ports.ErrCloseUnsupported), errors.Is(errs[i], ports.ErrClosePermission):
+			// Every other socket would fail the same way
+			fatal = errs[i]
+		case errs[i] == nil || errors.Is(errs[i], ports.ErrSocketGone):
+			if !quiet && !machine {
+				fmt.Printf("Closed %s\n", describeSocket(s))
+			}
+		default:
+			failures = append(failures, fmt.Sprintf("%s: %v", describeSocket(s), errs[i]))
+		}
+	}
+
+	if machine {
+		if err := printCloseResults(sockets, errs, true); err != nil {
+			return err
+		}
+	}
+	if fatal != nil {
+		return fmt.Errorf("cannot close sockets: %w; to free the port, kill the process with tsunami <port> instead", fatal)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to close: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// checkSocket applies the protection policy to the process holding s
+func checkSocket(s ports.Socket) error {
+	if s.PID == 0 {
+		return nil // orphaned, or held by a process tsunami cannot see
+	}
+	if err := policy.Check(killer.Target{PID: s.PID, Port: s.LocalPort, Name: s.Process, User: s.User}); err != nil {
+		return refuse(err, "close a socket of", "close")
+	}
+	return nil
+}
+
+// describeSocket formats s as "LISTEN 127.0.0.1:8080 (node, PID 4242)" or
+// "ESTABLISHED 127.0.0.1:5432 <-> 127.0.0.1:51234 (postgres, PID 4243)"
+func describeSocket(s ports.Socket) string {
+	d := s.State + " " + s.Local
+	if s.Remote != "" {
+		d += " <-> " + s.Remote
+	}
+	if s.PID > 0 {
+		d += fmt.Sprintf(" (%s, PID %d)", s.Process, s.PID)
+	}
+	return d
+}
+
+// closeResult is the machine-readable record for one socket
+type closeResult struct {
+	Proto   string `json:"proto" yaml:"proto"`
+	State   string `json:"state" yaml:"state"`
+	Local   string `json:"local" yaml:"local"`
+	Remote  string `json:"remote,omitempty" yaml:"remote,omitempty"`
+	PID     int    `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Process string `json:"process,omitempty" yaml:"process,omitempty"`
+	User    string `json:"user,omitempty" yaml:"user,omitempty"`
+	Status  string `json:"status" yaml:"status"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// printCloseResults writes sockets in the selected output format. errs[i]
+// is the outcome for sockets[i]. When closed is false (a dry run) the
+// other sockets are reported as would_close.
+func printCloseResults(sockets []ports.Socket, errs []error, closed bool) error {
+	results := make([]closeResult, len(sockets))
+	for i, s := range sockets {
+		results[i] = closeResult{
+			Proto:   s.Proto,
+			State:   s.State,
+			Local:   s.Local,
+			Remote:  s.Remote,
+			PID:     s.PID,
+			Process: s.Process,
+			User:    s.User,
+			Status:  "would_close",
+		}
+		var perr *killer.ProtectedError
+		switch {
+		case errors.As(errs[i], &perr):
+			results[i].Status = "protected"
+			results[i].Error = perr.Reason
+		case errors.Is(errs[i], ports.ErrSocketGone):
+			results[i].Status = "already_closed"
+		case errs[i] != nil:
+			results[i].Status = "failed"
+			results[i].Error = errs[i].Error()
+		case closed:
+			results[i].Status = "closed"
+		}
+	}
+
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+	return closeResultPrinter.Print(os.Stdout, results, opts)
+}
+
+// socketPrinter renders the sockets a close matched
+var socketPrinter = output.Printer[ports.Socket]{
+	Columns: []output.Column[ports.Socket]{
+		{Key: "proto", Header: "PROTO", Value: func(s ports.Socket) string { return s.Proto }},
+		{Key: "state", Header: "STATE", Value: func(s ports.Socket) string { return s.State }},
+		{Key: "local", Header: "LOCAL", Value: func(s ports.Socket) string { return s.Local }},
+		{Key: "remote", Header: "REMOTE", Value: func(s ports.Socket) string { return s.Remote }},
+		{Key: "pid", Header: "PID", Value: func(s ports.Socket) string { return pidText(s.PID) }},
+		{Key: "process", Header: "PROCESS", Flex: true, Min: 8, Value: func(s ports.Socket) string { return s.Process }},
+	},
+}
+
+// closeResultPrinter renders the outcome of a close
+var closeResultPrinter = output.Printer[closeResult]{
+	Columns: []output.Column[closeResult]{
+		{Key: "state", Header: "STATE", Value: func(r closeResult) string { return r.State }},
+		{Key: "local", Header: "LOCAL", Value: func(r closeResult) string { return r.Local }},
+		{Key: "remote", Header: "REMOTE", Value: func(r closeResult) string { return r.Remote }},
+		{Key: "pid", Header: "PID", Value: func(r closeResult) string { return pidText(r.PID) }},
+		{Key: "process", Header: "PROCESS", Flex: true, Min: 8, Value: func(r closeResult) string { return r.Process }},
+		{Key: "status", Header: "STATUS", Value: func(r closeResult) string { return r.Status }},
+		{Key: "error", Header: "ERROR", Flex: true, Min: 10, Value: func(r closeResult) string { return r.Error }},
+	},
+}
+
+// pidText formats pid, or "-" for a socket no visible process holds
+func pidText(pid int) string {
+	if pid == 0 {
+		return "-"
+	}
+	return strconv.Itoa(pid)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// setCloseFlags sets the close flags for one test
+func setCloseFlags(t *testing.T, remote []string, state string) {
+	t.Helper()
+	origRemote, origState := closeRemote, closeState
+	closeRemote, closeState = remote, state
+	t.Cleanup(func() { closeRemote, closeState = origRemote, origState })
+}
+
+func TestSocketQuery(t *testing.T) {
+	setCloseFlags(t, []string{"10.0.0.7", ":6379"}, "listen,established")
+	q, err := socketQuery([]string{"8080", "127.0.0.1:5432"})
+	if err != nil {
+		t.Fatalf("socketQuery error: %v", err)
+	}
+	if len(q.Local) != 2 || q.Local[0].Port != 8080 || q.Local[1].IP.String() != "127.0.0.1" {
+		t.Errorf("Local = %+v", q.Local)
+	}
+	if len(q.Remote) != 2 || q.Remote[1].Port != 6379 || len(q.States) != 2 {
+		t.Errorf("query = %+v", q)
+	}
+	if got := describeQuery(q); got != "*:8080, 127.0.0.1:5432 connected to 10.0.0.7:*, *:6379 in state listen,established" {
+		t.Errorf("describeQuery = %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		remote []string
+		state  string
+		want   string
+	}{
+		{"nothing", nil, nil, "", "give an address"},
+		{"bad address", []string{"localhost:80"}, nil, "", "invalid address"},
+		{"bad remote", []string{"80"}, []string{"99999"}, "", "--remote"},
+		{"bad state", []string{"80"}, nil, "time-wait", "--state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCloseFlags(t, tt.remote, tt.state)
+			if _, err := socketQuery(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("socketQuery error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeSocket(t *testing.T) {
+	tests := []struct {
+		s    ports.Socket
+		want string
+	}{
+		{ports.Socket{State: "LISTEN", Local: "127.0.0.1:8080", PID: 42, Process: "node"}, "LISTEN 127.0.0.1:8080 (node, PID 42)"},
+		{ports.Socket{State: "ESTABLISHED", Local: "127.0.0.1:5432", Remote: "127.0.0.1:51234"}, "ESTABLISHED 127.0.0.1:5432 <-> 127.0.0.1:51234"},
+	}
+	for _, tt := range tests {
+		if got := describeSocket(tt.s); got != tt.want {
+			t.Errorf("describeSocket = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPrintCloseResults(t *testing.T) {
+	setKillFlags(t, false, true, true, false)
+	sockets := []ports.Socket{
+		{Proto: "tcp", State: "LISTEN", Local: "0.0.0.0:22", PID: 1, Process: "sshd"},
+		{Proto: "tcp", State: "ESTABLISHED", Local: "127.0.0.1:8080", Remote: "127.0.0.1:5000", PID: 9000100},
+		{Proto: "tcp", State: "CLOSE_WAIT", Local: "127.0.0.1:8080", Remote: "127.0.0.1:5001"},
+		{Proto: "tcp", State: "ESTABLISHED", Local: "127.0.0.1:8080", Remote: "127.0.0.1:5002"},
+	}
+	errs := []error{
+		&killer.ProtectedError{PID: 1, Name: "sshd", Reason: "remote access"},
+		nil,
+		ports.ErrSocketGone,
+		ports.ErrClosePermission,
+	}
+
+	var err error
+	out := captureStdout(t, func() {
+		err = printCloseResults(sockets, errs, true)
+	})
+	if err != nil {
+		t.Fatalf("printCloseResults error: %v", err)
+	}
+	var results []closeResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	want := []string{"protected", "closed", "already_closed", "failed"}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("results[%d].Status = %q, want %q", i, r.Status, want[i])
+		}
+	}
+	if results[0].Error != "remote access" || results[3].Error != ports.ErrClosePermission.Error() {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestRunCloseLive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping socket test in short mode")
+	}
+	// Go listens with MPTCP where it can, whose sockets cannot be closed
+	var lc net.ListenConfig
+	lc.SetMultipathTCP(false)
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	// tsunami refuses to touch its own sockets
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, true, false, true, false)
+	setCloseFlags(t, nil, "listen")
+	var results []closeResult
+	out := captureStdout(t, func() { err = runClose([]string{addr}) })
+	if jerr := json.Unmarshal([]byte(out), &results); jerr != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s (err %v)", jerr, out, err)
+	}
+	if len(results) != 1 || results[0].Status != "protected" {
+		t.Errorf("dry-run results = %+v", results)
+	}
+
+	withPolicy(t, nil)
+	setKillFlags(t, false, true, true, false)
+	out = captureStdout(t, func() { err = runClose([]string{addr}) })
+	if errors.Is(err, ports.ErrCloseUnsupported) || errors.Is(err, ports.ErrClosePermission) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("runClose error: %v\n%s", err, out)
+	}
+	results = nil
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if len(results) != 1 || results[0].Status != "closed" || results[0].Local != addr {
+		t.Errorf("results = %+v", results)
+	}
+
+	if err := runClose([]string{addr}); err == nil || !strings.Contains(err.Error(), "no socket matches") {
+		t.Errorf("closing it again: error = %v", err)
+	}
+}
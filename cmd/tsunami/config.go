@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wusher/tsunami/internal/config"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/labels"
+)
+
+var (
+	configPath  string
+	profileName string
+
+	// appConfig is the loaded config file (empty if there is none)
+	appConfig = &config.Config{}
+	// configSettings are the flag defaults applyConfig took from the
+	// environment, profile or file, keyed by flag
+	configSettings map[string]config.Setting
+	// portGroups are the config's [groups] and the project's named ports,
+	// usable as @name arguments
+	portGroups map[string][]string
+	// configRules are the config's [protect] rules
+	configRules []killer.Rule
+	// appLabels labels listeners with the config's rules and the built-in ones
+	appLabels = labels.New(nil)
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the config file",
+	Long: `Tsunami reads defaults from $XDG_CONFIG_HOME/tsunami/config.toml (or
+config.yaml), falling back to ~/.config/tsunami. Set TSUNAMI_CONFIG or
+--config to use another file.
+
+Precedence, highest first: command-line flags, TSUNAMI_* environment
+variables (e.g. TSUNAMI_TIMEOUT=5s), the selected profile (--profile or
+TSUNAMI_PROFILE), the rest of the config file, built-in defaults.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective settings and where each comes from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the config file path",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, found, err := config.Path(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(path)
+		if !found {
+			fmt.Fprintln(os.Stderr, "(file does not exist)")
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for errors",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default $XDG_CONFIG_HOME/tsunami/config.toml)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Config profile to apply")
+
+	configCmd.AddCommand(configShowCmd, configPathCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+// loadConfig finds, loads and validates the config file
+func loadConfig() (*config.Config, error) {
+	path, _, err := config.Path(configPath)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyConfig loads the config file and fills in every flag not given on
+// the command line from the environment, profile or file
+func applyConfig(cmd *cobra.Command) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	profile, err := cfg.ActiveProfile(profileName, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	configSettings = make(map[string]config.Setting)
+	for _, s := range cfg.Settings(profile, os.Getenv) {
+		flag := cmd.Flags().Lookup(s.Flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(s.Flag, s.Value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %w", s.Flag, s.Source, err)
+		}
+		// Changed means given on the command line; this is still a default
+		flag.Changed = false
+		configSettings[s.Flag] = s
+	}
+
+	if n, ok := cfg.MaxKill(profile); ok {
+		killCap = n
+	}
+	// Validate has already checked these
+	portGroups, _ = cfg.PortGroups()
+	configRules, _ = cfg.Rules()
+	labelRules, _ := cfg.LabelRules()
+	appLabels = labels.New(labelRules)
+	appConfig = cfg
+
+	project, err = findProject()
+	if err != nil {
+		return err
+	}
+	if project != nil {
+		// Project names are more specific than the user's groups
+		groups, _ := project.PortGroups()
+		for name, specs := range groups {
+			portGroups[name] = specs
+		}
+	}
+	return nil
+}
+
+// settingOrigin describes where a config setting came from for messages,
+// e.g. "profile ci in the config file" or "TSUNAMI_JSON"
+func settingOrigin(s config.Setting) string {
+	switch {
+	case s.Source == "file":
+		return "the config file"
+	case strings.HasPrefix(s.Source, "profile "):
+		return s.Source + " in the config file"
+	}
+	return s.Source
+}
+
+// showConfig writes the effective settings and their sources to w
+func showConfig(w io.Writer) error {
+	path, found, err := config.Path(configPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	profile, err := cfg.ActiveProfile(profileName, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	status := ""
+	if !found {
+		status = " (not found)"
+	}
+	fmt.Fprintf(w, "Config file: %s%s\n", path, status)
+	if profile != "" {
+		fmt.Fprintf(w, "Profile:     %s\n", profile)
+	}
+
+	fmt.Fprintln(w, "\nFlag defaults:")
+	settings := make(map[string]config.Setting)
+	for _, s := range cfg.Settings(profile, os.Getenv) {
+		settings[s.Flag] = s
+	}
+	for _, flag := range config.Flags {
+		s, ok := settings[flag]
+		if !ok {
+			s = config.Setting{Flag: flag, Value: rootCmd.Flags().Lookup(flag).DefValue, Source: "default"}
+		}
+		fmt.Fprintf(w, "  %-8s = %-20s (%s)\n", flag, s.Value, s.Source)
+	}
+	maxKill, ok := cfg.MaxKill(profile)
+	maxKillSource := "file"
+	if !ok {
+		maxKill, maxKillSource = killCap, "default"
+	}
+	fmt.Fprintf(w, "  %-8s = %-20d (%s)\n", "max_kill", maxKill, maxKillSource)
+
+	if groups, err := cfg.PortGroups(); err == nil && len(groups) > 0 {
+		fmt.Fprintln(w, "\nPort groups:")
+		for _, name := range sortedGroupNames(groups) {
+			fmt.Fprintf(w, "  @%s = %s\n", name, strings.Join(groups[name], ", "))
+		}
+	}
+
+	if rules, err := cfg.Rules(); err == nil && len(rules) > 0 {
+		fmt.Fprintln(w, "\nProtected (in addition to built-ins):")
+		for _, r := range rules {
+			fmt.Fprintf(w, "  %s\n", r)
+		}
+	}
+
+	if theme, err := cfg.Theme(); err == nil {
+		fmt.Fprintf(w, "\nTUI theme: %s\n", theme.Name)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(w, "\nProblems:\n%v\n", err)
+	}
+	return nil
+}
+
+// validateConfig checks the config file and reports the result on w
+func validateConfig(w io.Writer) error {
+	path, found, err := config.Path(configPath)
+	if err != nil {
+		return err
+	}
+	if !found {
+		fmt.Fprintf(w, "No config file at %s; using built-in defaults\n", path)
+		return nil
+	}
+	if _, err := loadConfig(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s is valid\n", path)
+	return nil
+}
+
+// expandGroup returns the port specs of an @name argument
+func expandGroup(arg string) ([]string, error) {
+	name := strings.TrimPrefix(arg, "@")
+	specs, ok := portGroups[name]
+	if !ok {
+		if len(portGroups) == 0 {
+			return nil, fmt.Errorf("unknown port group: %s (no [groups] in the config file or ports in %s)", arg, config.ProjectFileName)
+		}
+		return nil, fmt.Errorf("unknown port group: %s (defined: @%s)", arg,
+			strings.Join(sortedGroupNames(portGroups), ", @"))
+	}
+	return specs, nil
+}
+
+// sortedGroupNames returns the group names in sorted order
+func sortedGroupNames(groups map[string][]string) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
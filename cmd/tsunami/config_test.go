@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wusher/tsunami/internal/config"
+)
+
+// withConfigFile points --config at a file containing data and restores
+// the config globals afterwards
+func withConfigFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	origPath, origProfile := configPath, profileName
+	origConfig, origGroups, origRules, origCap, origLabels := appConfig, portGroups, configRules, killCap, appLabels
+	origSettings := configSettings
+	t.Cleanup(func() {
+		configPath, profileName = origPath, origProfile
+		appConfig, portGroups, configRules, killCap, appLabels = origConfig, origGroups, origRules, origCap, origLabels
+		configSettings = origSettings
+	})
+	configPath = path
+	profileName = ""
+	t.Setenv(config.EnvProfile, "")
+	for _, flag := range config.Flags {
+		t.Setenv(config.EnvVar(flag), "")
+	}
+	return path
+}
+
+// configTestCmd returns a command with its own copies of the flags the
+// config file can set
+func configTestCmd(timeout *time.Duration, sig *string, force *bool) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().DurationVarP(timeout, "timeout", "t", 2*time.Second, "")
+	cmd.Flags().StringVarP(sig, "signal", "s", "TERM", "")
+	cmd.Flags().BoolVarP(force, "force", "f", false, "")
+	return cmd
+}
+
+const groupsConfig = `
+[escalation]
+signal = "INT"
+timeout = "5s"
+max_kill = 4
+
+[defaults]
+force = true
+
+[protect]
+names = ["redis-server"]
+
+[groups]
+web = [3000, 5173, 8080]
+range = ["9000-9002"]
+
+[profiles.fast.escalation]
+timeout = "100ms"
+`
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		profile     string
+		wantTimeout time.Duration
+		wantSignal  string
+	}{
+		{"file", nil, nil, "", 5 * time.Second, "INT"},
+		{"profile", nil, nil, "fast", 100 * time.Millisecond, "INT"},
+		{"env profile", nil, map[string]string{"TSUNAMI_PROFILE": "fast"}, "", 100 * time.Millisecond, "INT"},
+		{"env over profile", nil, map[string]string{"TSUNAMI_TIMEOUT": "7s"}, "fast", 7 * time.Second, "INT"},
+		{"flag over env", []string{"--timeout", "9s", "-s", "HUP"}, map[string]string{"TSUNAMI_TIMEOUT": "7s"}, "fast", 9 * time.Second, "HUP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfigFile(t, "config.toml", groupsConfig)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			profileName = tt.profile
+
+			var timeout time.Duration
+			var sig string
+			var force bool
+			cmd := configTestCmd(&timeout, &sig, &force)
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd); err != nil {
+				t.Fatalf("applyConfig: %v", err)
+			}
+			if timeout != tt.wantTimeout {
+				t.Errorf("timeout = %v, want %v", timeout, tt.wantTimeout)
+			}
+			if sig != tt.wantSignal {
+				t.Errorf("signal = %q, want %q", sig, tt.wantSignal)
+			}
+			if !force {
+				t.Error("force should be set from the file")
+			}
+			if cmd.Flags().Changed("force") {
+				t.Error("a config default should not mark the flag as changed")
+			}
+			if killCap != 4 {
+				t.Errorf("killCap = %d, want 4", killCap)
+			}
+			if len(configRules) != 1 || configRules[0].String() != "name=redis-server" {
+				t.Errorf("configRules = %v", configRules)
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"invalid value", "[escalation]\ntimeout = \"soon\"\n", "escalation.timeout"},
+		{"unknown key", "[escalation]\ntimout = \"5s\"\n", "unknown keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfigFile(t, "config.toml", tt.data)
+			var timeout time.Duration
+			var sig string
+			var force bool
+			err := applyConfig(configTestCmd(&timeout, &sig, &force))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown profile", func(t *testing.T) {
+		withConfigFile(t, "config.toml", groupsConfig)
+		profileName = "slow"
+		var timeout time.Duration
+		var sig string
+		var force bool
+		err := applyConfig(configTestCmd(&timeout, &sig, &force))
+		if err == nil || !strings.Contains(err.Error(), "unknown profile") {
+			t.Errorf("applyConfig() error = %v", err)
+		}
+	})
+
+	t.Run("bad env value", func(t *testing.T) {
+		withConfigFile(t, "config.toml", "")
+		t.Setenv("TSUNAMI_TIMEOUT", "soon")
+		var timeout time.Duration
+		var sig string
+		var force bool
+		err := applyConfig(configTestCmd(&timeout, &sig, &force))
+		if err == nil || !strings.Contains(err.Error(), "TSUNAMI_TIMEOUT") {
+			t.Errorf("applyConfig() error = %v, want it to name TSUNAMI_TIMEOUT", err)
+		}
+	})
+}
+
+func TestConfigJSONKillRefusal(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		data string
+		want string
+	}{
+		{"file", nil, nil, "[defaults]\njson = true\n", "json = true from the config file requires --force or --dry-run; pass --json=false"},
+		{"profile", nil, nil, "profile = \"ci\"\n[profiles.ci.defaults]\njson = true\n", "json = true from profile ci in the config file requires"},
+		{"env", nil, map[string]string{"TSUNAMI_JSON": "true"}, "", "json = true from TSUNAMI_JSON requires"},
+		{"flag", []string{"--json"}, nil, "[defaults]\njson = true\n", "--json requires --force or --dry-run"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfigFile(t, "config.toml", tt.data)
+			setKillFlags(t, false, false, false, false)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolVar(&jsonOut, "json", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(cmd); err != nil {
+				t.Fatalf("applyConfig: %v", err)
+			}
+			if err := checkMachineKill(""); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("checkMachineKill() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandPortGroups(t *testing.T) {
+	withConfigFile(t, "config.toml", groupsConfig)
+	var timeout time.Duration
+	var sig string
+	var force bool
+	if err := applyConfig(configTestCmd(&timeout, &sig, &force)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := expandPortArgs([]string{"@web", "22", "@range"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{3000, 5173, 8080, 22, 9000, 9001, 9002}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandPortArgs = %v, want %v", got, want)
+	}
+
+	_, err = expandPortArgs([]string{"@db"})
+	if err == nil || !strings.Contains(err.Error(), "defined: @range, @web") {
+		t.Errorf("unknown group error = %v", err)
+	}
+
+	portGroups = nil
+	_, err = expandPortArgs([]string{"@web"})
+	if err == nil || !strings.Contains(err.Error(), "no [groups] in the config file or ports in") {
+		t.Errorf("no groups error = %v", err)
+	}
+}
+
+func TestShowConfig(t *testing.T) {
+	withConfigFile(t, "config.toml", groupsConfig)
+	profileName = "fast"
+	t.Setenv("TSUNAMI_VERBOSE", "true")
+
+	var buf bytes.Buffer
+	if err := showConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Config file: " + configPath,
+		"Profile:     fast",
+		"(profile fast)",
+		"(TSUNAMI_VERBOSE)",
+		"(file)",
+		"(default)",
+		"@web = 3000, 5173, 8080",
+		"name=redis-server",
+		"TUI theme: default",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Problems") {
+		t.Errorf("valid config reported problems:\n%s", out)
+	}
+}
+
+func TestShowConfigProblems(t *testing.T) {
+	withConfigFile(t, "config.yaml", "escalation:\n  signal: BOGUS\n")
+	var buf bytes.Buffer
+	if err := showConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Problems") || !strings.Contains(buf.String(), "escalation.signal") {
+		t.Errorf("expected problems in output:\n%s", buf.String())
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	path := withConfigFile(t, "config.yaml", "groups:\n  web: [3000]\n")
+	var buf bytes.Buffer
+	if err := validateConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), path+" is valid") {
+		t.Errorf("output = %q", buf.String())
+	}
+
+	withConfigFile(t, "config.yaml", "groups:\n  web: [0]\n")
+	if err := validateConfig(&buf); err == nil || !strings.Contains(err.Error(), "invalid port") {
+		t.Errorf("validateConfig() error = %v", err)
+	}
+
+	configPath = filepath.Join(t.TempDir(), "missing.toml")
+	buf.Reset()
+	if err := validateConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "No config file") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	var names []string
+	for _, c := range configCmd.Commands() {
+		names = append(names, c.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"path", "show", "validate"}) {
+		t.Errorf("config subcommands = %v", names)
+	}
+	for _, flag := range []string{"config", "profile"} {
+		if rootCmd.PersistentFlags().Lookup(flag) == nil {
+			t.Errorf("missing --%s flag", flag)
+		}
+	}
+}
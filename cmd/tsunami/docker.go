@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/wusher/tsunami/internal/docker"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// dockerErr is why the Docker daemon could not name the containers of the
+// listeners last annotated, which is reported when killing a proxy is
+// refused
+var dockerErr error
+
+// targetContainers returns the containers published by t when it is a
+// docker-proxy, or nil when it is an ordinary process. Killing a proxy
+// breaks Docker networking and leaves the container running, so it is an
+// error if the container behind any of its ports is unknown.
+func targetContainers(t target) ([]ports.Container, error) {
+	if len(t.Listeners) == 0 || !docker.IsProxy(t.Listeners[0]) {
+		return nil, nil
+	}
+	var result []ports.Container
+	seen := make(map[string]bool)
+	for _, l := range t.Listeners {
+		if err := docker.CheckProxy(l, dockerErr); err != nil {
+			return nil, err
+		}
+		if !seen[l.Container.ID] {
+			seen[l.Container.ID] = true
+			result = append(result, *l.Container)
+		}
+	}
+	return result, nil
+}
+
+// oneProxyPerContainer drops all but the first listener forwarding to each
+// container, since Docker runs one docker-proxy for IPv4 and one for IPv6
+func oneProxyPerContainer(list []ports.PortInfo) []ports.PortInfo {
+	var result []ports.PortInfo
+	seen := make(map[string]bool)
+	for _, p := range list {
+		if c := docker.Published(p); c != nil {
+			if seen[c.ID] {
+				continue
+			}
+			seen[c.ID] = true
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// stopContainer stops c through the Docker API, waiting up to --timeout
+// before the daemon kills it. Signals other than TERM are sent to the
+// container as they are.
+func stopContainer(c ports.Container, sig killer.Signal) error {
+	ctx, stop := interruptible()
+	defer stop()
+	client := docker.NewClient(docker.SocketPath())
+	var err error
+	if sig == killer.SIGTERM {
+		err = client.Stop(ctx, c.ID, timeout)
+	} else {
+		err = client.Kill(ctx, c.ID, string(sig))
+	}
+	return interruptErr(ctx, err)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// dbContainer is published on port 5432 by a docker-proxy for each of
+// IPv4 and IPv6
+var dbContainer = &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b6c7d", Name: "db", Image: "postgres:16"}
+
+var proxyTestPorts = []ports.PortInfo{
+	{Port: 5432, PID: 9000500, Process: "docker-proxy", User: "root", Proto: "tcp", Container: dbContainer,
+		Cmdline: "/usr/bin/docker-proxy -proto tcp -host-ip 0.0.0.0 -host-port 5432 -container-ip 172.17.0.2 -container-port 5432"},
+	{Port: 5432, PID: 9000501, Process: "docker-proxy", User: "root", Proto: "tcp6", Container: dbContainer,
+		Cmdline: "/usr/bin/docker-proxy -proto tcp -host-ip :: -host-port 5432 -container-ip 172.17.0.2 -container-port 5432"},
+}
+
+// startFakeDocker serves the container stop and kill endpoints on a Unix
+// socket named by DOCKER_HOST, recording each request
+func startFakeDocker(t *testing.T) func() []string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "tsdock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("cannot listen on a Unix socket: %v", err)
+	}
+
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	t.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestKillTargetsStopsContainer(t *testing.T) {
+	requests := startFakeDocker(t)
+	setKillFlags(t, false, true, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(proxyTestPorts), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets error: %v", err)
+	}
+	if !strings.Contains(output, "Stopped container db (postgres:16) on port 5432") {
+		t.Errorf("output missing the stopped container:\n%s", output)
+	}
+	if strings.Contains(output, "Killed") {
+		t.Errorf("the proxies should not be killed:\n%s", output)
+	}
+	want := []string{"POST /containers/4f1c2d3e4a5b6c7d/stop?t=" + strconv.Itoa(int(timeout.Seconds()))}
+	if got := requests(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+}
+
+func TestKillTargetsContainerDryRun(t *testing.T) {
+	setKillFlags(t, true, false, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	targets := groupByPID(append([]ports.PortInfo{targetTestPorts[0]}, proxyTestPorts...))
+	output := captureStdout(t, func() {
+		if err := killTargets(targets, sig); err != nil {
+			t.Errorf("killTargets error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Would stop 1 container and kill 1 process with signal TERM") {
+		t.Errorf("dry-run output:\n%s", output)
+	}
+
+	setKillFlags(t, true, false, true, false)
+	output = captureStdout(t, func() {
+		_ = killTargets(targets, sig)
+	})
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 3 || results[1].Status != "would_stop" || len(results[1].Containers) != 1 || results[1].Containers[0] != "db" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestKillTargetsRefusesUnidentifiedProxy(t *testing.T) {
+	setKillFlags(t, false, true, false, false)
+
+	proxy := proxyTestPorts[0]
+	proxy.Container = nil
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	captureStdout(t, func() {
+		err = killTargets(groupByPID([]ports.PortInfo{proxy}), sig)
+	})
+	if err == nil || !strings.Contains(err.Error(), "could not be identified") {
+		t.Errorf("error = %v, expected the proxy to be refused", err)
+	}
+
+	// The refusal says why the daemon could not name the container
+	dockerErr = errors.New("docker: permission denied")
+	t.Cleanup(func() { dockerErr = nil })
+	captureStdout(t, func() {
+		err = killTargets(groupByPID([]ports.PortInfo{proxy}), sig)
+	})
+	if err == nil || !strings.Contains(err.Error(), "(docker: permission denied)") {
+		t.Errorf("error = %v, expected the daemon error", err)
+	}
+}
+
+func TestOneProxyPerContainer(t *testing.T) {
+	list := append([]ports.PortInfo{targetTestPorts[0]}, proxyTestPorts...)
+	got := oneProxyPerContainer(list)
+	if len(got) != 2 || got[0].PID != 9000100 || got[1].PID != 9000500 {
+		t.Errorf("oneProxyPerContainer = %+v", got)
+	}
+}
+
+func TestPortRecordContainer(t *testing.T) {
+	data, err := json.Marshal(newPortRecord(proxyTestPorts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"container":{"runtime":"docker","id":"4f1c2d3e4a5b6c7d","name":"db","image":"postgres:16"}`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("record = %s, want it to contain %s", data, want)
+	}
+	if data, _ := json.Marshal(newPortRecord(targetTestPorts[0])); strings.Contains(string(data), "container") {
+		t.Errorf("a plain process should have no container: %s", data)
+	}
+
+	pod := targetTestPorts[0]
+	pod.Slice = "kubepods-besteffort.slice"
+	pod.Container = &ports.Container{Runtime: "containerd", ID: "9a8b7c6d5e4f", Pod: "0d3c6f2a-7b1e"}
+	data, _ = json.Marshal(newPortRecord(pod))
+	for _, want := range []string{
+		`"slice":"kubepods-besteffort.slice"`,
+		`"container":{"runtime":"containerd","id":"9a8b7c6d5e4f","pod":"0d3c6f2a-7b1e"}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("record = %s, want it to contain %s", data, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	ossignal "os/signal"
+	"syscall"
+
+	"github.com/wusher/tsunami/internal/docker"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// errInterrupted is returned when ctrl+c or SIGTERM cuts a scan or a wait
+// for a process to exit short
+var errInterrupted = errors.New("interrupted")
+
+// interruptible returns a context that ctrl+c and SIGTERM cancel until stop
+// is called. Outside of it the signals keep their default effect, so a
+// confirmation prompt can still be left with ctrl+c.
+func interruptible() (context.Context, context.CancelFunc) {
+	return ossignal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// interruptErr reports err as errInterrupted when ctx was cancelled
+func interruptErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return errInterrupted
+	}
+	return err
+}
+
+// scanPorts lists the listening ports, in the namespaces chosen with
+// --netns or --all-netns, with their containers and systemd units. ctrl+c
+// abandons a scan that is stuck, such as lsof on a hung NFS mount.
+func scanPorts() ([]ports.PortInfo, error) {
+	ctx, stop := interruptible()
+	defer stop()
+	p, err := scanContext(ctx)
+	if err == nil {
+		annotateListeners(ctx, p)
+	}
+	return p, interruptErr(ctx, err)
+}
+
+// findByPort returns the listeners on port, like scanPorts
+func findByPort(port int) ([]ports.PortInfo, error) {
+	return findListeners(func(l ports.PortInfo) bool { return !l.Unix() && l.Port == port })
+}
+
+// findBySocket returns the listeners on the Unix socket path, like
+// scanPorts
+func findBySocket(path string) ([]ports.PortInfo, error) {
+	return findListeners(func(l ports.PortInfo) bool { return l.Unix() && l.Address == path })
+}
+
+// findListeners scans for the listeners that match, annotating only those
+func findListeners(match func(ports.PortInfo) bool) ([]ports.PortInfo, error) {
+	ctx, stop := interruptible()
+	defer stop()
+	all, err := scanContext(ctx)
+	if err != nil {
+		return nil, interruptErr(ctx, err)
+	}
+	var p []ports.PortInfo
+	for _, l := range all {
+		if match(l) {
+			p = append(p, l)
+		}
+	}
+	annotateListeners(ctx, p)
+	return p, interruptErr(ctx, nil)
+}
+
+// annotateListeners adds what the Docker daemon and systemctl know about
+// the listeners in list, and labels their apps and projects. It is best
+// effort: without a reachable daemon the proxies are listed as they are,
+// and killing them is refused.
+func annotateListeners(ctx context.Context, list []ports.PortInfo) {
+	dockerErr = docker.Annotate(ctx, list)
+	annotateUnits(ctx, list)
+	appLabels.Annotate(list)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestInterruptErr(t *testing.T) {
+	boom := errors.New("boom")
+	live := context.Background()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := interruptErr(live, boom); err != boom {
+		t.Errorf("live context: %v, want boom", err)
+	}
+	if err := interruptErr(cancelled, boom); err != errInterrupted {
+		t.Errorf("cancelled context: %v, want errInterrupted", err)
+	}
+	if err := interruptErr(cancelled, nil); err != nil {
+		t.Errorf("cancelled context without an error: %v, want nil", err)
+	}
+}
+
+func TestScanPortsLabels(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scan test in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("reads the executable from /proc")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	withConfigFile(t, "config.toml", "[[labels]]\nname = \"go test\"\nexe = '\\.test$'\n")
+	var timeout time.Duration
+	var sig string
+	var force bool
+	if err := applyConfig(configTestCmd(&timeout, &sig, &force)); err != nil {
+		t.Fatal(err)
+	}
+	setNetnsFlags(t, "", false)
+
+	list, err := scanPorts()
+	if err != nil {
+		t.Fatalf("scanPorts error: %v", err)
+	}
+	for _, p := range list {
+		if p.Port == port {
+			// The test runs from cmd/tsunami in the tsunami module
+			if p.Label() != "go test · tsunami" {
+				t.Errorf("Label() = %q, want \"go test · tsunami\"", p.Label())
+			}
+			return
+		}
+	}
+	t.Errorf("scanPorts missed port %d", port)
+}
@@ -5,17 +5,25 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/x/term"
 	"github.com/spf13/cobra"
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/docker"
 	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
 	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/query"
+	"github.com/wusher/tsunami/internal/systemd"
 	"github.com/wusher/tsunami/internal/tui"
 )
 
@@ -31,10 +39,34 @@ var (
 	all     bool
 	jsonOut bool
 	filter  string
+	idle    bool
 	timeout time.Duration
 	pids    []int
+	verbose bool
+	sortBy  string
+	reverse bool
+	columns string
+
+	nameTarget  string
+	userTarget  string
+	matchTarget string
+	yesReally   bool
+
+	overrideProtection bool
+	protectRules       []string
+
+	readStdin  bool
+	cleanStale bool
+	showStale  bool
+
+	respawnWindow    time.Duration
+	respawnWindowSet bool // given on the command line or in the config file
 )
 
+// policy protects system processes from being killed. run() adds --protect
+// rules, or clears it for --override-protection.
+var policy = killer.NewPolicy()
+
 var rootCmd = &cobra.Command{
 	Use:     "tsunami [port...]",
 	Short:   "Kill processes listening on ports",
@@ -53,16 +85,39 @@ Examples:
   tsunami 3000 8080          # Kill processes on multiple ports
   tsunami 3000-3010          # Kill processes on ports 3000 through 3010
   tsunami 3000,8080,9000     # Comma-separated ports
+  tsunami /run/app.sock      # Kill the process listening on a Unix socket
+  tsunami ./app.sock --clean-stale
+                             # ...or remove the socket file if it is stale
+  tsunami @web               # Kill a port group from the config file
+  tsunami @api               # Kill a named port from .tsunami.yaml
+  tsunami project down       # Free every port declared in .tsunami.yaml
   tsunami -l                 # List all listening ports
   tsunami -l --json          # List ports as JSON
   tsunami -l --filter node   # List only node processes
+  tsunami -l --filter 'port:3000-3999 age>1h'
+  tsunami -l --idle          # List listeners nothing is connected to
+  tsunami -l --sort memory   # List ports, largest processes first
+  tsunami -l --watch 5s      # Redraw the list every 5s (NDJSON events when piped)
+  tsunami -l --columns port,process,uptime,cmdline
   tsunami 3000 -s KILL       # Send SIGKILL immediately
   tsunami 3000 --timeout 5s  # Wait 5s before escalating to SIGKILL
+  tsunami 3000 -f --verbose  # Show escalation progress while killing
   tsunami --pid 1234         # Kill process by PID directly
+  tsunami --name node        # Kill every node process that is listening
+  tsunami --user ci -f       # Kill everything listening owned by user ci
+  tsunami --match 'cmd:vite' --dry-run
   tsunami 3000 --dry-run     # Show what would be killed
-  tsunami 3000 --all         # Kill all processes on port (when multiple)`,
+  tsunami 3000 --all         # Kill all processes on port (when multiple)
+  tsunami -l --json | jq '[.[] | select(.user == "ci")]' | tsunami -
+                             # Kill targets read from stdin`,
 	Args: cobra.ArbitraryArgs,
-	Run:  run,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyConfig(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+	Run: run,
 }
 
 func init() {
@@ -72,10 +127,30 @@ func init() {
 	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Suppress output except errors")
 	rootCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Show what would be killed without killing")
 	rootCmd.Flags().BoolVarP(&all, "all", "a", false, "Kill all processes on port (when multiple)")
-	rootCmd.Flags().BoolVar(&jsonOut, "json", false, "Output in JSON format (for --list)")
-	rootCmd.Flags().StringVar(&filter, "filter", "", "Filter by process name, user, or user=<name> (for --list)")
+	rootCmd.Flags().BoolVar(&processOnly, "process-only", false, "Kill the process itself instead of stopping the systemd unit it belongs to")
+	addOutputFlags(rootCmd, "Output format: "+formatNames()+" (for --list and kill results)")
+	rootCmd.Flags().StringVar(&filter, "filter", "", "Filter query, e.g. node, user=alice, 'port>=3000 and not proc=java' (for --list)")
+	rootCmd.Flags().BoolVar(&idle, "idle", false, "Only show listeners with no open connections (for --list and the TUI)")
 	rootCmd.Flags().DurationVarP(&timeout, "timeout", "t", 2*time.Second, "Time to wait before escalating SIGTERM to SIGKILL")
+	addRespawnWindowFlag(rootCmd)
 	rootCmd.Flags().IntSliceVarP(&pids, "pid", "p", nil, "Kill processes by PID directly (can be repeated)")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show progress while waiting for processes to exit")
+	rootCmd.Flags().StringVar(&sortBy, "sort", "port", "Sort by port, pid, process, user, proto, age, memory or conns (for --list)")
+	rootCmd.Flags().BoolVarP(&reverse, "reverse", "r", false, "Reverse the sort order (for --list)")
+	rootCmd.Flags().StringVar(&nameTarget, "name", "", "Kill listening processes with this process name")
+	rootCmd.Flags().StringVar(&userTarget, "user", "", "Kill listening processes owned by this user")
+	rootCmd.Flags().StringVar(&matchTarget, "match", "", "Kill listening processes matching a filter query")
+	rootCmd.Flags().BoolVar(&yesReally, "yes-really", false, fmt.Sprintf("Allow killing more than %d processes at once", killCap))
+	rootCmd.Flags().BoolVar(&overrideProtection, "override-protection", false, "Allow killing protected processes (init, sshd, your shell, ...)")
+	rootCmd.Flags().StringArrayVar(&protectRules, "protect", nil, "Also protect processes matching name=, port=, user= or path= (can be repeated)")
+	rootCmd.Flags().BoolVar(&readStdin, "stdin", false, "Read ports, host:port, socket paths, pid:N or --list --json output from stdin (same as -)")
+	rootCmd.Flags().BoolVar(&cleanStale, "clean-stale", false, "Remove socket files given as targets that nothing listens on, and those a kill leaves behind")
+	rootCmd.Flags().BoolVar(&showStale, "stale", false, "Also report socket files nothing listens on in /run, /tmp, $XDG_RUNTIME_DIR and the working directory (for --list)")
+	rootCmd.Flags().DurationVar(&watchInterval, "watch", 0, "Keep listing every interval; NDJSON opened/closed events when not a terminal (for --list)")
+	rootCmd.Flags().Lookup("watch").NoOptDefVal = defaultWatchInterval.String()
+	rootCmd.Flags().StringVar(&netns, "netns", "", "Scan the network namespace with this ip netns name, path or member PID instead of tsunami's own")
+	rootCmd.Flags().BoolVar(&allNetns, "all-netns", false, "Scan every network namespace, including those of containers")
+	rootCmd.Flags().StringVar(&columns, "columns", "", "Comma-separated columns to show: "+strings.Join(cols.Keys(), ", ")+" (for --list)")
 }
 
 func main() {
@@ -87,6 +162,23 @@ func main() {
 // run is the main command handler that dispatches to list, kill, or TUI mode
 // based on the provided flags and arguments.
 func run(cmd *cobra.Command, args []string) {
+	// Watch mode
+	if watchInterval != 0 {
+		if !list {
+			fmt.Fprintln(os.Stderr, "Error: --watch requires --list")
+			os.Exit(1)
+		}
+		if err := watchArgs(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := watchPorts(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// List mode
 	if list {
 		if err := listPorts(); err != nil {
@@ -96,6 +188,12 @@ func run(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// Validate the output flags early to fail fast
+	if _, err := outputOptions(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Parse signal early to fail fast
 	sig, err := killer.ParseSignal(signal)
 	if err != nil {
@@ -103,6 +201,52 @@ func run(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if err := setupPolicy(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Name, user or filter targeting
+	if hasMatchTargeting() {
+		if len(args) > 0 || len(pids) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --name, --user and --match cannot be combined with ports or --pid")
+			os.Exit(1)
+		}
+		if err := killMatching(sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Targets piped in on stdin
+	if usesStdin(args) {
+		if err := killFromStdin(args, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Machine-readable results for port arguments and --pid are printed
+	// once for every target, so those kills go through the target path
+	if machineOutput() && (len(args) > 0 || len(pids) > 0) {
+		if err := killArguments(args, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Unix socket paths are resolved against a single scan
+	if hasSocketArgs(args) {
+		if err := killArguments(args, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// PID mode
 	if len(pids) > 0 {
 		if err := killPIDs(pids, sig); err != nil {
@@ -114,7 +258,8 @@ func run(cmd *cobra.Command, args []string) {
 
 	// No args = interactive TUI mode
 	if len(args) == 0 {
-		if force {
+		// A force default from the config file does not count
+		if force && cmd.Flags().Changed("force") {
 			fmt.Fprintln(os.Stderr, "Error: --force requires port argument")
 			os.Exit(1)
 		}
@@ -122,7 +267,12 @@ func run(cmd *cobra.Command, args []string) {
 			fmt.Fprintln(os.Stderr, "Error: --dry-run requires port argument")
 			os.Exit(1)
 		}
-		if err := tui.Run(); err != nil {
+		opts, err := tuiOptions()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := tui.Run(opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -152,12 +302,128 @@ func run(cmd *cobra.Command, args []string) {
 	}
 }
 
+// tuiOptions builds TUI options from the --sort, --reverse and --columns flags
+func tuiOptions() (tui.Options, error) {
+	key, err := ports.ParseSortKey(sortBy)
+	if err != nil {
+		return tui.Options{}, err
+	}
+	tableCols, err := cols.Parse(columns)
+	if err != nil {
+		return tui.Options{}, err
+	}
+	theme, err := appConfig.Theme()
+	if err != nil {
+		return tui.Options{}, err
+	}
+	keymap, err := appConfig.Keymap()
+	if err != nil {
+		return tui.Options{}, err
+	}
+	opts := tui.Options{
+		Columns: tableCols,
+		SortKey: key,
+		Reverse: reverse,
+		Policy:  policy,
+		Theme:   theme,
+		Keymap:  keymap,
+	}
+	opts.RespawnWindow = respawnWindow
+	opts.RespawnUnsupervised = respawnWindowSet
+	opts.Signal, err = killer.ParseSignal(signal)
+	if err != nil {
+		return tui.Options{}, err
+	}
+	opts.Timeout = timeout
+	if netns != "" || allNetns {
+		if _, err := selectedNamespaces(); err != nil {
+			return tui.Options{}, err
+		}
+		opts.Scan = scanContext
+	}
+	opts.Labels = appLabels
+	if project != nil {
+		opts.Filter = project.Filter()
+	}
+	opts.Filter = idleFilter(opts.Filter, idle)
+	return opts, nil
+}
+
+// setupPolicy applies the config's protect rules, the project's allow and
+// forbid lists, --protect and --override-protection to policy
+func setupPolicy() error {
+	if overrideProtection {
+		policy = nil
+		return nil
+	}
+	policy.Add(configRules...)
+	if err := projectPolicy(); err != nil {
+		return err
+	}
+	for _, spec := range protectRules {
+		rule, err := killer.ParseRule(spec)
+		if err != nil {
+			return err
+		}
+		policy.Add(rule)
+	}
+	return nil
+}
+
+// checkProtected returns an error if policy refuses to kill t
+func checkProtected(t killer.Target) error {
+	if err := policy.Check(t); err != nil {
+		return refuse(err, "kill", "kill")
+	}
+	return nil
+}
+
+// refusedError explains why the protection policy refused an action. It
+// unwraps to the *killer.ProtectedError.
+type refusedError struct {
+	msg string
+	err *killer.ProtectedError
+}
+
+func (e *refusedError) Error() string { return e.msg }
+func (e *refusedError) Unwrap() error { return e.err }
+
+// refuse turns an error from policy.Check into "refusing to <action>
+// sshd (PID 812): <reason> (use --override-protection to <verb> it
+// anyway)"
+func refuse(err error, action, verb string) error {
+	var perr *killer.ProtectedError
+	if !errors.As(err, &perr) {
+		return err
+	}
+	who := fmt.Sprintf("PID %d", perr.PID)
+	if perr.Name != "" {
+		who = fmt.Sprintf("%s (PID %d)", perr.Name, perr.PID)
+	}
+	msg := fmt.Sprintf("refusing to %s %s: %s (use --override-protection to %s it anyway)", action, who, perr.Reason, verb)
+	return &refusedError{msg: msg, err: perr}
+}
+
 // expandPortArgs expands port arguments supporting ranges (3000-3005) and comma-separated (3000,8080,9000)
 func expandPortArgs(args []string) ([]int, error) {
 	var result []int
 	rangePattern := regexp.MustCompile(`^(\d+)-(\d+)$`)
 
 	for _, arg := range args {
+		// Named port group from the config file
+		if strings.HasPrefix(arg, "@") {
+			specs, err := expandGroup(arg)
+			if err != nil {
+				return nil, err
+			}
+			ports, err := expandPortArgs(specs)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, ports...)
+			continue
+		}
+
 		// Check for comma-separated values
 		if strings.Contains(arg, ",") {
 			parts := strings.Split(arg, ",")
@@ -204,6 +470,16 @@ func expandPortArgs(args []string) ([]int, error) {
 	return result, nil
 }
 
+// hasSocketArgs reports whether any argument is a Unix socket path
+func hasSocketArgs(args []string) bool {
+	for _, arg := range args {
+		if isSocketArg(arg) {
+			return true
+		}
+	}
+	return false
+}
+
 // parsePort parses and validates a single port string
 func parsePort(s string) (int, error) {
 	port, err := strconv.Atoi(s)
@@ -213,103 +489,129 @@ func parsePort(s string) (int, error) {
 	return port, nil
 }
 
-// listPorts displays all listening TCP ports in either table or JSON format.
-// It respects the --filter and --json flags.
+// listPorts displays all listening TCP ports in the selected output format.
+// It respects the --filter, --sort, --reverse, --columns and output flags.
+// With --stale, table listings end with the stale socket files found.
 func listPorts() error {
-	p, err := ports.Scan()
+	tableCols, err := cols.Parse(columns)
 	if err != nil {
 		return err
 	}
+	ctx, stop := interruptible()
+	defer stop()
+	p, err := scanListing(ctx)
+	if err != nil {
+		return interruptErr(ctx, err)
+	}
 
-	// Apply filter if specified
-	if filter != "" {
-		p = filterPorts(p, filter)
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+	if err := printPorts(p, tableCols, opts); err != nil {
+		return err
 	}
 
-	if jsonOut {
-		if len(p) == 0 {
-			fmt.Println("[]")
-			return nil
-		}
-		return printJSON(p)
+	// Finding stale sockets connects to every socket file, so it is only
+	// done when asked for, and they have no listener to filter on
+	if showStale && opts.Format.Human() {
+		printStaleSockets(os.Stdout, ports.StaleSockets(ctx, staleSocketDirs(), p))
 	}
+	return nil
+}
 
-	// Always print header in table mode
-	fmt.Printf("%-8s %-10s %-20s %-15s %s\n", "PORT", "PID", "PROCESS", "USER", "PROTO")
-	fmt.Println(strings.Repeat("-", 65))
+// staleSocketDirs are the directories a listing searches for stale
+// sockets
+var staleSocketDirs = ports.SocketDirs
 
-	if len(p) == 0 {
-		fmt.Println("No listening ports found")
-		return nil
+// printStaleSockets lists the stale socket files in paths, if any, and how
+// to remove them
+func printStaleSockets(w io.Writer, paths []string) {
+	if len(paths) == 0 {
+		return
 	}
-
-	for _, port := range p {
-		process := port.Process
-		if len(process) > 20 {
-			process = process[:17] + "..."
-		}
-		fmt.Printf("%-8d %-10d %-20s %-15s %s\n",
-			port.Port, port.PID, process, port.User, port.Proto)
+	fmt.Fprintln(w, "\nStale sockets (nothing listens on them; remove with `tsunami <path> --clean-stale`):")
+	for _, path := range paths {
+		fmt.Fprintf(w, "  %s\n", path)
 	}
-
-	return nil
 }
 
-// filterPorts filters ports by process name or user
-func filterPorts(portList []ports.PortInfo, f string) []ports.PortInfo {
-	var result []ports.PortInfo
+// listingCPU measures CPU usage between the listings --watch redraws
+var listingCPU ports.CPUSampler
 
-	// Check for user=<name> syntax
-	if strings.HasPrefix(f, "user=") {
-		userName := strings.TrimPrefix(f, "user=")
-		for _, p := range portList {
-			if strings.EqualFold(p.User, userName) {
-				result = append(result, p)
-			}
-		}
-		return result
+// scanListing scans for listening ports and applies --filter, --sort and
+// --reverse. CPU usage is the average since each process started, or the
+// rate since the previous listing. The scan stops early when ctx is done.
+func scanListing(ctx context.Context) ([]ports.PortInfo, error) {
+	key, err := ports.ParseSortKey(sortBy)
+	if err != nil {
+		return nil, err
 	}
 
-	// Default: filter by process name (case-insensitive substring match)
-	fLower := strings.ToLower(f)
-	for _, p := range portList {
-		if strings.Contains(strings.ToLower(p.Process), fLower) {
-			result = append(result, p)
-		}
+	p, err := scanContext(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return result
+	annotateListeners(ctx, p)
+	listingCPU.Sample(p, time.Now())
+
+	p, err = filterPorts(p, listFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	ports.Sort(p, key, reverse)
+	return p, nil
 }
 
-// printJSON outputs port list as JSON
-func printJSON(portList []ports.PortInfo) error {
-	type jsonPort struct {
-		Port    int    `json:"port"`
-		PID     int    `json:"pid"`
-		Process string `json:"process"`
-		User    string `json:"user"`
-		Proto   string `json:"proto"`
+// printTable prints portList as a table with the given columns, fitted to
+// width (no limit if width is 0)
+func printTable(portList []ports.PortInfo, tableCols []cols.Column, width int) error {
+	return printPorts(portList, tableCols, output.Options{Format: output.Table, Width: width})
+}
+
+// terminalWidth returns the width of the terminal on stdout, or 0 if
+// stdout is not a terminal
+func terminalWidth() int {
+	w, _, err := term.GetSize(os.Stdout.Fd())
+	if err != nil {
+		return 0
 	}
+	return w
+}
 
-	output := make([]jsonPort, len(portList))
-	for i, p := range portList {
-		output[i] = jsonPort{
-			Port:    p.Port,
-			PID:     p.PID,
-			Process: p.Process,
-			User:    p.User,
-			Proto:   p.Proto,
-		}
+// listFilter returns the --filter query, narrowed to listeners without
+// connections for --idle
+func listFilter() string {
+	return idleFilter(filter, idle)
+}
+
+// idleFilter narrows the query f to listeners without connections if idle
+// is set
+func idleFilter(f string, idle bool) string {
+	switch {
+	case !idle:
+		return f
+	case strings.TrimSpace(f) == "":
+		return "conns=0"
 	}
+	return "(" + f + ") and conns=0"
+}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	return enc.Encode(output)
+// filterPorts returns the ports matching the filter query f (see the
+// query package for the syntax)
+func filterPorts(portList []ports.PortInfo, f string) ([]ports.PortInfo, error) {
+	q, err := query.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return q.Filter(portList), nil
 }
 
 // killPort finds and kills processes listening on the specified port.
 // It handles confirmation prompts, dry-run mode, and multiple processes.
 func killPort(port int, sig killer.Signal) error {
-	matches, err := ports.FindByPort(port)
+	matches, err := findByPort(port)
 	if err != nil {
 		return err
 	}
@@ -317,6 +619,7 @@ func killPort(port int, sig killer.Signal) error {
 	if len(matches) == 0 {
 		return fmt.Errorf("no process listening on port %d", port)
 	}
+	matches = oneListenerPerUnit(oneProxyPerContainer(matches))
 
 	// Multiple processes on same port
 	if len(matches) > 1 && !all {
@@ -338,8 +641,27 @@ func killPort(port int, sig killer.Signal) error {
 	return nil
 }
 
-// killProcess handles the actual killing of a single process
+// killProcess handles the actual killing of a single process. A
+// docker-proxy's container, or the systemd unit the process belongs to, is
+// stopped instead.
 func killProcess(p ports.PortInfo, port int, sig killer.Signal) error {
+	if err := checkProtected(killer.Target{PID: p.PID, Port: port, Name: p.Process, User: p.User, Unit: systemd.HeldSocket(p)}); err != nil {
+		return err
+	}
+	t := target{PID: p.PID, Process: p.Process, Listeners: []ports.PortInfo{p}}
+	containers, err := targetContainers(t)
+	if err != nil {
+		return err
+	}
+	if len(containers) > 0 {
+		c := containers[0]
+		return stopPort(docker.Describe(c), port, sig, func() error { return stopContainer(c, sig) })
+	}
+	if units := targetUnits(t); len(units) > 0 {
+		u := units[0]
+		return stopPort(describeUnit(u), port, sig, func() error { return stopUnit(u, sig) })
+	}
+
 	// Dry run mode
 	if dryRun {
 		fmt.Printf("Would kill: %s (PID %d) on port %d with signal %s\n", p.Process, p.PID, port, sig)
@@ -348,27 +670,51 @@ func killProcess(p ports.PortInfo, port int, sig killer.Signal) error {
 
 	// Confirmation
 	if !force {
-		if !confirm(fmt.Sprintf("Kill %s (PID %d) on port %d?", p.Process, p.PID, port)) {
+		if !confirm(fmt.Sprintf("Kill %s (PID %d) on port %d%s?", p.Process, p.PID, port, openConnections(len(p.Connections)))) {
 			return nil // User cancelled
 		}
 	}
 
 	// Kill the process
-	var killErr error
-	if sig == killer.SIGTERM {
-		killErr = killer.KillWithEscalationTimeout(p.PID, timeout)
-	} else {
-		killErr = killer.Kill(p.PID, sig)
+	released := func() bool {
+		matches, err := findByPort(port)
+		return err == nil && !containsPID(matches, p.PID)
 	}
-
-	if killErr != nil {
-		return killErr
+	watch := watchesRespawn(p)
+	since := time.Now()
+	if err := sendSignal(p.PID, sig, released); err != nil {
+		return err
 	}
 
 	if !quiet {
 		fmt.Printf("Killed %s (PID %d) on port %d\n", p.Process, p.PID, port)
 	}
 
+	// A supervisor may bring it straight back
+	if !watch {
+		return nil
+	}
+	return respawnError(watchRespawn([]int{p.PID}, []int{port}, sig, since))
+}
+
+// stopPort stops the container or unit desc holding port with stop, with
+// the same dry-run and confirmation handling as killProcess
+func stopPort(desc string, port int, sig killer.Signal, stop func() error) error {
+	if dryRun {
+		fmt.Printf("Would stop: %s on port %d with signal %s\n", desc, port, sig)
+		return nil
+	}
+	if !force {
+		if !confirm(fmt.Sprintf("Stop %s on port %d?", desc, port)) {
+			return nil // User cancelled
+		}
+	}
+	if err := stop(); err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Printf("Stopped %s on port %d\n", desc, port)
+	}
 	return nil
 }
 
@@ -377,31 +723,37 @@ func killPIDs(pidList []int, sig killer.Signal) error {
 	var failures []string
 
 	for _, pid := range pidList {
+		if err := checkProtected(killer.Target{PID: pid}); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+
+		desc := fmt.Sprintf("PID %d", pid)
+		if info, err := killer.ReadProcInfo(pid); err == nil && info.Name != "" {
+			desc = fmt.Sprintf("%s (PID %d)", info.Name, pid)
+		}
+
 		if dryRun {
-			fmt.Printf("Would kill: PID %d with signal %s\n", pid, sig)
+			fmt.Printf("Would kill: %s with signal %s\n", desc, sig)
 			continue
 		}
 
 		if !force {
-			if !confirm(fmt.Sprintf("Kill PID %d?", pid)) {
+			if !confirm(fmt.Sprintf("Kill %s?", desc)) {
 				continue // User cancelled
 			}
 		}
 
-		var killErr error
-		if sig == killer.SIGTERM {
-			killErr = killer.KillWithEscalationTimeout(pid, timeout)
-		} else {
-			killErr = killer.Kill(pid, sig)
-		}
-
-		if killErr != nil {
+		if killErr := sendSignal(pid, sig, nil); killErr != nil {
 			failures = append(failures, fmt.Sprintf("PID %d: %v", pid, killErr))
+			if errors.Is(killErr, errInterrupted) {
+				break // leave the remaining PIDs alone
+			}
 			continue
 		}
 
 		if !quiet {
-			fmt.Printf("Killed PID %d\n", pid)
+			fmt.Printf("Killed %s\n", desc)
 		}
 	}
 
@@ -411,10 +763,79 @@ func killPIDs(pidList []int, sig killer.Signal) error {
 	return nil
 }
 
+// sendSignal delivers sig to pid. SIGTERM is escalated to SIGKILL after
+// --timeout. With --verbose, progress is reported on stderr, including the
+// port being released when released is non-nil.
+func sendSignal(pid int, sig killer.Signal, released func() bool) error {
+	if sig != killer.SIGTERM {
+		if err := killer.Kill(pid, sig); err != nil {
+			return err
+		}
+		if verbose {
+			printProgress(killer.Event{Kind: killer.EventSignalSent, PID: pid, Signal: sig})
+		}
+		return nil
+	}
+
+	esc := killer.NewEscalation(pid, timeout)
+	if verbose {
+		esc.OnEvent = printProgress
+		esc.Released = released
+	}
+	ctx, stop := interruptible()
+	defer stop()
+	err := esc.RunContext(ctx)
+	if verbose && stderrIsTerminal() {
+		// Terminate a progress line left open by the last waiting event
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	return interruptErr(ctx, err)
+}
+
+// printProgress renders an escalation event for --verbose. On a terminal,
+// waiting events redraw a single line in place; elsewhere they are skipped
+// so logs only get one line per step.
+func printProgress(e killer.Event) {
+	tty := stderrIsTerminal()
+	if e.Kind == killer.EventWaiting {
+		if tty {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s", e)
+		}
+		return
+	}
+	if tty {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	fmt.Fprintln(os.Stderr, e)
+}
+
+// stderrIsTerminal reports whether stderr is attached to a terminal
+func stderrIsTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// containsPID reports whether any entry in portList belongs to pid
+func containsPID(portList []ports.PortInfo, pid int) bool {
+	for _, p := range portList {
+		if p.PID == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmInput is where confirm reads answers; nil means os.Stdin
+var confirmInput io.Reader
+
 // confirm prompts the user for confirmation and returns true if they respond
 // with "y" or "yes" (case-insensitive). Default is "no" on empty input.
 func confirm(msg string) bool {
-	reader := bufio.NewReader(os.Stdin)
+	input := confirmInput
+	if input == nil {
+		input = os.Stdin
+	}
+	reader := bufio.NewReader(input)
 	fmt.Printf("%s [y/N] ", msg)
 	response, err := reader.ReadString('\n')
 	if err != nil {
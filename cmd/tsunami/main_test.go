@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	cols "github.com/wusher/tsunami/internal/columns"
 	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
 	"github.com/wusher/tsunami/internal/ports"
 )
 
@@ -38,6 +43,45 @@ func TestListPorts(t *testing.T) {
 	}
 }
 
+func TestListPortsReportsStaleSockets(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.sock")
+	staleSocket(t, stale)
+
+	origDirs, origShow, origJSON := staleSocketDirs, showStale, jsonOut
+	staleSocketDirs = func() []string { return []string{dir} }
+	defer func() { staleSocketDirs, showStale, jsonOut = origDirs, origShow, origJSON }()
+
+	list := func() string {
+		t.Helper()
+		old := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+		err := listPorts()
+		w.Close()
+		os.Stdout = old
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		if err != nil {
+			t.Fatalf("listPorts() returned error: %v", err)
+		}
+		return buf.String()
+	}
+
+	showStale, jsonOut = false, false
+	if out := list(); strings.Contains(out, stale) {
+		t.Errorf("a listing without --stale should not look for stale sockets:\n%s", out)
+	}
+	showStale = true
+	if out := list(); !strings.Contains(out, "Stale sockets") || !strings.Contains(out, "  "+stale+"\n") {
+		t.Errorf("--stale should report %s as stale:\n%s", stale, out)
+	}
+	jsonOut = true
+	if out := list(); strings.Contains(out, stale) {
+		t.Errorf("JSON listing should not report stale sockets:\n%s", out)
+	}
+}
+
 func TestKillPortNotListening(t *testing.T) {
 	sig, _ := killer.ParseSignal("TERM")
 	err := killPort(99999, sig)
@@ -431,11 +475,18 @@ func TestFilterPorts(t *testing.T) {
 		{"filter by user case insensitive", "user=ALICE", 2},
 		{"filter no match", "nginx", 0},
 		{"filter user no match", "user=root", 0},
+		{"filter by port range", "port:3000-8999", 3},
+		{"filter with or", "proc=python or user=postgres", 2},
+		{"filter with not", "not node", 2},
+		{"filter empty query", "", 4},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := filterPorts(portList, tt.filter)
+			result, err := filterPorts(portList, tt.filter)
+			if err != nil {
+				t.Fatalf("filterPorts(%q) error: %v", tt.filter, err)
+			}
 			if len(result) != tt.want {
 				t.Errorf("filterPorts() returned %d results, want %d", len(result), tt.want)
 			}
@@ -443,6 +494,42 @@ func TestFilterPorts(t *testing.T) {
 	}
 }
 
+func TestIdleFilter(t *testing.T) {
+	portList := []ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", Proto: "tcp"},
+		{Port: 5432, PID: 400, Process: "postgres", Proto: "tcp", Connections: []ports.Connection{{State: "ESTABLISHED"}}},
+		{Port: 8080, PID: 200, Process: "python", Proto: "tcp"},
+	}
+	tests := []struct {
+		filter string
+		idle   bool
+		want   string
+		ports  []int
+	}{
+		{"", false, "", []int{3000, 5432, 8080}},
+		{"", true, "conns=0", []int{3000, 8080}},
+		{"node or postgres", true, "(node or postgres) and conns=0", []int{3000}},
+	}
+	for _, tt := range tests {
+		got := idleFilter(tt.filter, tt.idle)
+		if got != tt.want {
+			t.Errorf("idleFilter(%q, %v) = %q, want %q", tt.filter, tt.idle, got, tt.want)
+		}
+		result, err := filterPorts(portList, got)
+		if err != nil {
+			t.Fatalf("filterPorts(%q) error: %v", got, err)
+		}
+		if len(result) != len(tt.ports) {
+			t.Fatalf("filterPorts(%q) = %+v, want ports %v", got, result, tt.ports)
+		}
+		for i, port := range tt.ports {
+			if result[i].Port != port {
+				t.Errorf("filterPorts(%q)[%d].Port = %d, want %d", got, i, result[i].Port, port)
+			}
+		}
+	}
+}
+
 // Tests for JSON output
 func TestPrintJSON(t *testing.T) {
 	portList := []ports.PortInfo{
@@ -454,13 +541,13 @@ func TestPrintJSON(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	err := printJSON(portList)
+	err := printPorts(portList, nil, output.Options{Format: output.JSON})
 
 	w.Close()
 	os.Stdout = old
 
 	if err != nil {
-		t.Fatalf("printJSON() returned error: %v", err)
+		t.Fatalf("printPorts(JSON) returned error: %v", err)
 	}
 
 	var buf bytes.Buffer
@@ -470,7 +557,7 @@ func TestPrintJSON(t *testing.T) {
 	// Validate it's valid JSON
 	var result []map[string]interface{}
 	if err := json.Unmarshal([]byte(output), &result); err != nil {
-		t.Errorf("printJSON() output is not valid JSON: %v", err)
+		t.Errorf("printPorts(JSON) output is not valid JSON: %v", err)
 	}
 
 	if len(result) != 1 {
@@ -842,8 +929,8 @@ func TestExpandPortArgsEmpty(t *testing.T) {
 }
 
 func TestFilterPortsEmpty(t *testing.T) {
-	result := filterPorts([]ports.PortInfo{}, "test")
-	if len(result) != 0 {
+	result, err := filterPorts([]ports.PortInfo{}, "test")
+	if err != nil || len(result) != 0 {
 		t.Error("filterPorts with empty list should return empty list")
 	}
 }
@@ -853,13 +940,13 @@ func TestPrintJSONEmpty(t *testing.T) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	err := printJSON([]ports.PortInfo{})
+	err := printPorts([]ports.PortInfo{}, nil, output.Options{Format: output.JSON})
 
 	w.Close()
 	os.Stdout = old
 
 	if err != nil {
-		t.Fatalf("printJSON([]) returned error: %v", err)
+		t.Fatalf("printPorts(JSON, []) returned error: %v", err)
 	}
 
 	var buf bytes.Buffer
@@ -867,7 +954,7 @@ func TestPrintJSONEmpty(t *testing.T) {
 	output := buf.String()
 
 	if !strings.Contains(output, "[]") {
-		t.Error("printJSON([]) should output empty array")
+		t.Error("printPorts(JSON, []) should output empty array")
 	}
 }
 
@@ -1062,3 +1149,193 @@ func TestRunListModeJSON(t *testing.T) {
 		t.Error("run in list+json mode should output JSON array")
 	}
 }
+
+func TestVerboseFlag(t *testing.T) {
+	if rootCmd.Flags().Lookup("verbose") == nil {
+		t.Error("--verbose flag should exist")
+	}
+	if rootCmd.Flags().ShorthandLookup("v") == nil {
+		t.Error("-v shorthand should exist")
+	}
+}
+
+func TestSendSignalVerbose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	origVerbose := verbose
+	origTimeout := timeout
+	verbose = true
+	timeout = time.Second
+	defer func() {
+		verbose = origVerbose
+		timeout = origTimeout
+	}()
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start test process: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	err := sendSignal(cmd.Process.Pid, killer.SIGTERM, func() bool { return true })
+
+	w.Close()
+	os.Stderr = oldStderr
+
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	output := buf.String()
+
+	if err != nil {
+		t.Fatalf("sendSignal returned error: %v", err)
+	}
+	for _, want := range []string{"Sent SIGTERM", "exited", "Port released"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("verbose output should contain %q, got %q", want, output)
+		}
+	}
+	// Waiting events are only drawn on terminals
+	if strings.Contains(output, "Waiting") {
+		t.Errorf("non-terminal output should skip waiting events, got %q", output)
+	}
+}
+
+func TestSendSignalNonTermVerbose(t *testing.T) {
+	origVerbose := verbose
+	verbose = true
+	defer func() { verbose = origVerbose }()
+
+	if err := sendSignal(999999999, killer.SIGKILL, nil); err == nil {
+		t.Error("sendSignal should error for nonexistent process")
+	}
+}
+
+func TestContainsPID(t *testing.T) {
+	portList := []ports.PortInfo{{Port: 3000, PID: 100}, {Port: 3000, PID: 200}}
+
+	if !containsPID(portList, 200) {
+		t.Error("containsPID should find PID 200")
+	}
+	if containsPID(portList, 300) {
+		t.Error("containsPID should not find PID 300")
+	}
+	if containsPID(nil, 100) {
+		t.Error("containsPID on empty list should be false")
+	}
+}
+
+func TestSortAndColumnFlags(t *testing.T) {
+	for _, name := range []string{"sort", "reverse", "columns"} {
+		if rootCmd.Flags().Lookup(name) == nil {
+			t.Errorf("--%s flag should exist", name)
+		}
+	}
+	if rootCmd.Flags().ShorthandLookup("r") == nil {
+		t.Error("-r shorthand should exist")
+	}
+}
+
+func TestListPortsInvalidSort(t *testing.T) {
+	origSort := sortBy
+	sortBy = "size"
+	defer func() { sortBy = origSort }()
+
+	if err := listPorts(); err == nil || !strings.Contains(err.Error(), "unknown sort key") {
+		t.Errorf("listPorts should reject unknown sort key, got %v", err)
+	}
+}
+
+func TestListPortsInvalidColumns(t *testing.T) {
+	origColumns := columns
+	columns = "port,nope"
+	defer func() { columns = origColumns }()
+
+	if err := listPorts(); err == nil || !strings.Contains(err.Error(), "unknown column") {
+		t.Errorf("listPorts should reject unknown column, got %v", err)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	portList := []ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "a-really-long-process-name-here", User: "alice", Proto: "tcp", Cmdline: "node server.js"},
+		{Port: 8080, PID: 200, Process: "python", User: "bob", Proto: "tcp6"},
+	}
+	tableCols, _ := cols.Parse("port,process,cmdline")
+
+	capture := func(width int) string {
+		old := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+		_ = printTable(portList, tableCols, width)
+		w.Close()
+		os.Stdout = old
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		return buf.String()
+	}
+
+	// Unlimited width keeps full values
+	output := capture(0)
+	for _, want := range []string{"PORT", "PROCESS", "COMMAND", "a-really-long-process-name-here", "node server.js", "-"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("table should contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "USER") {
+		t.Error("table should only show selected columns")
+	}
+
+	// A narrow terminal shrinks flexible columns
+	output = capture(30)
+	if strings.Contains(output, "a-really-long-process-name-here") {
+		t.Errorf("narrow table should truncate long values, got:\n%s", output)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if len(line) > 30 {
+			t.Errorf("line %q is wider than 30", line)
+		}
+	}
+}
+
+func TestTuiOptions(t *testing.T) {
+	origSort, origColumns, origReverse := sortBy, columns, reverse
+	origSignal, origTimeout := signal, timeout
+	defer func() {
+		sortBy, columns, reverse = origSort, origColumns, origReverse
+		signal, timeout = origSignal, origTimeout
+	}()
+
+	sortBy, columns, reverse = "memory", "port,uptime", true
+	signal, timeout = "int", 7*time.Second
+	opts, err := tuiOptions()
+	if err != nil {
+		t.Fatalf("tuiOptions() error: %v", err)
+	}
+	if opts.SortKey != ports.SortByMemory || !opts.Reverse || len(opts.Columns) != 2 {
+		t.Errorf("tuiOptions() = %+v", opts)
+	}
+	if opts.Signal != killer.SIGINT || opts.Timeout != 7*time.Second {
+		t.Errorf("tuiOptions() signal = %s timeout = %v, want INT and 7s", opts.Signal, opts.Timeout)
+	}
+
+	signal = "TERM"
+
+	sortBy = "nope"
+	if _, err := tuiOptions(); err == nil {
+		t.Error("tuiOptions() should reject unknown sort key")
+	}
+
+	sortBy, columns = "port", "nope"
+	if _, err := tuiOptions(); err == nil {
+		t.Error("tuiOptions() should reject unknown column")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var (
+	netns    string
+	allNetns bool
+)
+
+// scanContext lists the listeners in the network namespace chosen with
+// --netns, or in every namespace with --all-netns, else in tsunami's own
+func scanContext(ctx context.Context) ([]ports.PortInfo, error) {
+	if netns == "" && !allNetns {
+		return ports.ScanContext(ctx)
+	}
+	nsList, err := selectedNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	return ports.ScanNetns(ctx, nsList)
+}
+
+// selectedNamespaces resolves --netns and --all-netns
+func selectedNamespaces() ([]ports.Netns, error) {
+	if netns != "" && allNetns {
+		return nil, errors.New("--netns and --all-netns cannot be combined")
+	}
+	if allNetns {
+		return ports.Namespaces()
+	}
+	ns, err := ports.LookupNetns(netns)
+	if err != nil {
+		return nil, err
+	}
+	return []ports.Netns{ns}, nil
+}
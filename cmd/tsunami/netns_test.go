@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func setNetnsFlags(t *testing.T, name string, all bool) {
+	t.Helper()
+	origName, origAll := netns, allNetns
+	netns, allNetns = name, all
+	t.Cleanup(func() { netns, allNetns = origName, origAll })
+}
+
+func TestScanContextConflictingFlags(t *testing.T) {
+	setNetnsFlags(t, "blue", true)
+	if _, err := scanContext(context.Background()); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("scanContext error = %v, want a conflict", err)
+	}
+	if _, err := tuiOptions(); err == nil {
+		t.Error("tuiOptions accepted --netns with --all-netns")
+	}
+}
+
+func TestScanContextUnknownNetns(t *testing.T) {
+	setNetnsFlags(t, "tsunami-no-such-netns", false)
+	if _, err := scanContext(context.Background()); err == nil {
+		t.Error("scanContext accepted a missing namespace")
+	}
+}
+
+func TestScanContextOwnNetns(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces are Linux only")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	setNetnsFlags(t, strconv.Itoa(os.Getpid()), false)
+	list, err := scanContext(context.Background())
+	if err != nil {
+		t.Fatalf("scanContext error: %v", err)
+	}
+	for _, p := range list {
+		if p.Port == port {
+			if p.Netns != "" {
+				t.Errorf("own namespace tagged %q", p.Netns)
+			}
+			return
+		}
+	}
+	t.Errorf("scanContext missed port %d", port)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var (
+	outputFormat string
+	templateText string
+	noHeaders    bool
+)
+
+// addOutputFlags binds --output, --template, --no-headers and --json to a
+// subcommand. usage describes --output.
+func addOutputFlags(cmd *cobra.Command, usage string) {
+	f := cmd.Flags()
+	f.StringVarP(&outputFormat, "output", "o", "", usage)
+	f.StringVar(&templateText, "template", "", "Go template applied to each row (implies --output template)")
+	f.BoolVar(&noHeaders, "no-headers", false, "Omit table and csv/tsv headers")
+	f.BoolVar(&jsonOut, "json", false, "Shorthand for --output json")
+}
+
+// formatNames lists the output formats for flag help
+func formatNames() string {
+	names := make([]string, len(output.Formats))
+	for i, f := range output.Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// portRecord is a port as printed by the json, ndjson and yaml formats
+type portRecord struct {
+	Port      int              `json:"port" yaml:"port"`
+	PID       int              `json:"pid" yaml:"pid"`
+	Process   string           `json:"process" yaml:"process"`
+	User      string           `json:"user" yaml:"user"`
+	Proto     string           `json:"proto" yaml:"proto"`
+	Address   string           `json:"address,omitempty" yaml:"address,omitempty"`
+	Cmdline   string           `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`
+	App       string           `json:"app,omitempty" yaml:"app,omitempty"`
+	Project   string           `json:"project,omitempty" yaml:"project,omitempty"`
+	StartTime *time.Time       `json:"start_time,omitempty" yaml:"start_time,omitempty"`
+	Memory    uint64           `json:"memory,omitempty" yaml:"memory,omitempty"`
+	CPU       float64          `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	Threads   int              `json:"threads,omitempty" yaml:"threads,omitempty"`
+	FDs       int              `json:"fds,omitempty" yaml:"fds,omitempty"`
+	State     string           `json:"state,omitempty" yaml:"state,omitempty"`
+	Slice     string           `json:"slice,omitempty" yaml:"slice,omitempty"`
+	Netns     string           `json:"netns,omitempty" yaml:"netns,omitempty"`
+	Container *containerRecord `json:"container,omitempty" yaml:"container,omitempty"`
+	Unit      *unitRecord      `json:"unit,omitempty" yaml:"unit,omitempty"`
+
+	Connections int            `json:"connections" yaml:"connections"`
+	Clients     []clientRecord `json:"clients,omitempty" yaml:"clients,omitempty"`
+}
+
+// clientRecord is an open connection to a port
+type clientRecord struct {
+	Remote  string `json:"remote,omitempty" yaml:"remote,omitempty"`
+	State   string `json:"state" yaml:"state"`
+	PID     int    `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Process string `json:"process,omitempty" yaml:"process,omitempty"`
+}
+
+// unitRecord is the systemd unit behind a port
+type unitRecord struct {
+	Name    string `json:"name" yaml:"name"`
+	User    bool   `json:"user,omitempty" yaml:"user,omitempty"`
+	Restart string `json:"restart,omitempty" yaml:"restart,omitempty"`
+}
+
+// containerRecord is the container behind a port
+type containerRecord struct {
+	Runtime string `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	ID      string `json:"id" yaml:"id"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Image   string `json:"image,omitempty" yaml:"image,omitempty"`
+	Pod     string `json:"pod,omitempty" yaml:"pod,omitempty"`
+}
+
+// newPortRecord converts p for the structured formats
+func newPortRecord(p ports.PortInfo) portRecord {
+	r := portRecord{
+		Port:    p.Port,
+		PID:     p.PID,
+		Process: p.Process,
+		User:    p.User,
+		Proto:   p.Proto,
+		Address: p.Address,
+		Cmdline: p.Cmdline,
+		App:     p.App,
+		Project: p.Project,
+		Memory:  p.Memory,
+		CPU:     math.Round(p.CPU*10) / 10,
+		Threads: p.Threads,
+		FDs:     p.FDs,
+		State:   p.State,
+		Slice:   p.Slice,
+		Netns:   p.Netns,
+
+		Connections: len(p.Connections),
+	}
+	for _, c := range p.Connections {
+		r.Clients = append(r.Clients, clientRecord{Remote: c.Remote, State: c.State, PID: c.PID, Process: c.Process})
+	}
+	if !p.StartTime.IsZero() {
+		start := p.StartTime
+		r.StartTime = &start
+	}
+	if c := p.Container; c != nil {
+		r.Container = &containerRecord{Runtime: c.Runtime, ID: c.ID, Name: c.Name, Image: c.Image, Pod: c.Pod}
+	}
+	if u := p.Unit; u != nil {
+		r.Unit = &unitRecord{Name: u.Name, User: u.User, Restart: u.Restart}
+	}
+	return r
+}
+
+// outputOptions resolves --output, --template, --no-headers and --json.
+// --json is shorthand for --output json.
+func outputOptions() (output.Options, error) {
+	format := outputFormat
+	if jsonOut {
+		if format != "" && !strings.EqualFold(format, string(output.Table)) && !strings.EqualFold(format, string(output.JSON)) {
+			return output.Options{}, fmt.Errorf("--json conflicts with --output %s", format)
+		}
+		format = string(output.JSON)
+	}
+	opts, err := output.NewOptions(format, templateText, noHeaders)
+	if err != nil {
+		return output.Options{}, err
+	}
+	opts.Width = terminalWidth()
+	return opts, nil
+}
+
+// machineOutput reports whether results are printed for programs rather
+// than narrated. The flags have already been validated by run.
+func machineOutput() bool {
+	opts, err := outputOptions()
+	return err == nil && !opts.Format.Human()
+}
+
+// checkMachineKill refuses machine-readable kill output when the kill would
+// need an interactive confirmation. when describes the kill for the error.
+func checkMachineKill(when string) error {
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+	if opts.Format.Human() || force || dryRun {
+		return nil
+	}
+	flag := "--output " + string(opts.Format)
+	if jsonOut {
+		flag = "--json"
+		if s, ok := configSettings["json"]; ok {
+			return fmt.Errorf("json = %s from %s requires --force or --dry-run%s; pass --json=false to confirm interactively",
+				s.Value, settingOrigin(s), when)
+		}
+	}
+	return fmt.Errorf("%s requires --force or --dry-run%s", flag, when)
+}
+
+// portPrinter renders ports with tableCols in table, csv and tsv formats
+// and every column in the wide format
+func portPrinter(tableCols []cols.Column) output.Printer[ports.PortInfo] {
+	allCols, _ := cols.Parse(strings.Join(cols.Keys(), ","))
+	return output.Printer[ports.PortInfo]{
+		Columns:     cols.Output(tableCols),
+		WideColumns: cols.Output(allCols),
+		Record:      func(p ports.PortInfo) any { return newPortRecord(p) },
+		Empty:       "No listening ports found",
+	}
+}
+
+// resultPrinter renders kill results
+var resultPrinter = output.Printer[targetResult]{
+	Columns: []output.Column[targetResult]{
+		{Key: "pid", Header: "PID", Value: func(r targetResult) string { return strconv.Itoa(r.PID) }},
+		{Key: "process", Header: "PROCESS", Flex: true, Min: 8, Value: func(r targetResult) string { return r.Process }},
+		{Key: "user", Header: "USER", Flex: true, Min: 6, Value: func(r targetResult) string { return r.User }},
+		{Key: "ports", Header: "PORTS", Value: func(r targetResult) string { return joinInts(r.Ports, ",") }},
+		{Key: "status", Header: "STATUS", Value: func(r targetResult) string { return r.Status }},
+		{Key: "error", Header: "ERROR", Flex: true, Min: 10, Value: func(r targetResult) string { return r.Error }},
+	},
+}
+
+// printPorts writes portList in the selected output format
+func printPorts(portList []ports.PortInfo, tableCols []cols.Column, opts output.Options) error {
+	return portPrinter(tableCols).Print(os.Stdout, portList, opts)
+}
+
+// joinInts formats a list of integers separated by sep
+func joinInts(list []int, sep string) string {
+	strs := make([]string, len(list))
+	for i, n := range list {
+		strs[i] = strconv.Itoa(n)
+	}
+	return strings.Join(strs, sep)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// setOutputFlags sets --output, --template and --no-headers and restores
+// them when the test ends
+func setOutputFlags(t *testing.T, format, tmpl string, headers bool) {
+	t.Helper()
+	origFormat, origTmpl, origNoHeaders := outputFormat, templateText, noHeaders
+	outputFormat, templateText, noHeaders = format, tmpl, !headers
+	t.Cleanup(func() {
+		outputFormat, templateText, noHeaders = origFormat, origTmpl, origNoHeaders
+	})
+}
+
+func TestOutputOptions(t *testing.T) {
+	tests := []struct {
+		format  string
+		tmpl    string
+		json    bool
+		want    output.Format
+		wantErr string
+	}{
+		{"", "", false, output.Table, ""},
+		{"", "", true, output.JSON, ""},
+		{"json", "", true, output.JSON, ""},
+		{"ndjson", "", false, output.NDJSON, ""},
+		{"", "{{.Port}}", false, output.Template, ""},
+		{"csv", "", true, "", "--json conflicts with --output csv"},
+		{"bogus", "", false, "", "unknown output format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+tt.tmpl, func(t *testing.T) {
+			setOutputFlags(t, tt.format, tt.tmpl, true)
+			origJSON := jsonOut
+			jsonOut = tt.json
+			defer func() { jsonOut = origJSON }()
+
+			opts, err := outputOptions()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opts.Format != tt.want {
+				t.Errorf("format = %s, want %s", opts.Format, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintPortsFormats(t *testing.T) {
+	tableCols, _ := cols.Parse("port,pid,process")
+	tests := []struct {
+		format  string
+		tmpl    string
+		headers bool
+		want    string
+	}{
+		{"csv", "", true, "port,pid,process\n3000,9000100,node\n8080,9000300,java\n"},
+		{"tsv", "", false, "3000\t9000100\tnode\n8080\t9000300\tjava\n"},
+		{"", "{{.Port}} {{.PID}}", true, "3000 9000100\n8080 9000300\n"},
+		{"ndjson", "", true, `{"port":3000,"pid":9000100,"process":"node","user":"alice","proto":"tcp","cmdline":"node server.js","connections":0}` + "\n" +
+			`{"port":8080,"pid":9000300,"process":"java","user":"ci","proto":"tcp","cmdline":"java -jar app.jar","connections":0}` + "\n"},
+	}
+
+	portList := append(targetTestPorts[:1:1], targetTestPorts[3])
+	for _, tt := range tests {
+		t.Run(tt.format+tt.tmpl, func(t *testing.T) {
+			setOutputFlags(t, tt.format, tt.tmpl, tt.headers)
+			opts, err := outputOptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := captureStdout(t, func() {
+				if err := printPorts(portList, tableCols, opts); err != nil {
+					t.Errorf("printPorts error: %v", err)
+				}
+			})
+			if got != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPortRecordClients(t *testing.T) {
+	p := ports.PortInfo{Port: 5432, PID: 812, Process: "postgres", Proto: "tcp", Connections: []ports.Connection{
+		{Remote: "127.0.0.1:51000", State: "ESTABLISHED", PID: 4242, Process: "psql"},
+		{Remote: "10.0.0.5:40000", State: "CLOSE_WAIT"},
+	}}
+	r := newPortRecord(p)
+	if r.Connections != 2 || len(r.Clients) != 2 {
+		t.Fatalf("record = %+v, want 2 connections and clients", r)
+	}
+	want := clientRecord{Remote: "127.0.0.1:51000", State: "ESTABLISHED", PID: 4242, Process: "psql"}
+	if r.Clients[0] != want {
+		t.Errorf("Clients[0] = %+v, want %+v", r.Clients[0], want)
+	}
+	if r.Clients[1].PID != 0 || r.Clients[1].State != "CLOSE_WAIT" {
+		t.Errorf("Clients[1] = %+v", r.Clients[1])
+	}
+}
+
+func TestNewPortRecordResourcesAndLabel(t *testing.T) {
+	p := ports.PortInfo{Port: 3000, PID: 42, Process: "node", Proto: "tcp", CPU: 12.345, CPUTime: time.Minute, Threads: 11, FDs: 24, State: "S",
+		App: "vite", Project: "acme-web"}
+	data, err := json.Marshal(newPortRecord(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"cpu":12.3`, `"threads":11`, `"fds":24`, `"state":"S"`, `"app":"vite"`, `"project":"acme-web"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s missing %s", data, want)
+		}
+	}
+
+	data, _ = json.Marshal(newPortRecord(ports.PortInfo{Port: 3000, PID: 42, Proto: "tcp"}))
+	for _, key := range []string{"cpu", "threads", "fds", "state", "app", "project"} {
+		if strings.Contains(string(data), `"`+key+`"`) {
+			t.Errorf("JSON %s has %s without resources", data, key)
+		}
+	}
+}
+
+func TestKillTargetsDryRunCSV(t *testing.T) {
+	setKillFlags(t, true, false, false, false)
+	setOutputFlags(t, "csv", "", true)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	got := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts[:3]), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets dry run error: %v", err)
+	}
+	want := "pid,process,user,ports,status,error\n" +
+		"9000100,node,alice,3000,would_kill,\n" +
+		"9000200,node,alice,\"5173,5174\",would_kill,\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCheckMachineKill(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+	setOutputFlags(t, "yaml", "", true)
+
+	err := checkMachineKill(" when testing")
+	if err == nil || err.Error() != "--output yaml requires --force or --dry-run when testing" {
+		t.Errorf("error = %v", err)
+	}
+
+	force = true
+	if err := checkMachineKill(""); err != nil {
+		t.Errorf("--force should allow machine output: %v", err)
+	}
+
+	force = false
+	outputFormat = "wide"
+	if err := checkMachineKill(""); err != nil {
+		t.Errorf("wide is not machine output: %v", err)
+	}
+}
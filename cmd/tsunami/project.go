@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/wusher/tsunami/internal/config"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var (
+	noProject bool
+
+	// project is the .tsunami.yaml found from the working directory, if any
+	project *config.Project
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Work with the ports declared in .tsunami.yaml",
+	Long: `A .tsunami.yaml in the working directory or any parent declares the
+project's named ports and which processes may be killed:
+
+  name: shop
+  ports:
+    api: 8080
+    web: 5173
+    postgres: 5432
+    workers: "9000-9003"
+  allow: [name=node, name=python]   # only these may be killed
+  forbid: [name=postgres]           # never kill these
+
+Inside the project, "tsunami" opens the TUI filtered to its ports and
+"tsunami @api" kills by name.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyConfig(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var projectShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the project's ports and what is listening on them",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showProject(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var projectDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Kill everything listening on the project's ports",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sig, err := killer.ParseSignal(signal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := setupPolicy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := projectDown(sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&noProject, "no-project", false, "Ignore "+config.ProjectFileName)
+
+	addKillFlags(projectDownCmd)
+
+	projectCmd.AddCommand(projectShowCmd, projectDownCmd)
+	rootCmd.AddCommand(projectCmd)
+}
+
+// findProject looks for the project file from the working directory,
+// unless --no-project is given
+func findProject() (*config.Project, error) {
+	if noProject {
+		return nil, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return config.FindProject(wd)
+}
+
+// requireProject returns project, or an error if there is none
+func requireProject() (*config.Project, error) {
+	if project != nil {
+		return project, nil
+	}
+	wd, _ := os.Getwd()
+	return nil, fmt.Errorf("no %s in %s or any parent directory", config.ProjectFileName, wd)
+}
+
+// projectPolicy adds the project's forbid and allow rules to policy
+func projectPolicy() error {
+	if project == nil || policy == nil {
+		return nil
+	}
+	forbid, err := project.ForbidRules()
+	if err != nil {
+		return err
+	}
+	allow, err := project.AllowRules()
+	if err != nil {
+		return err
+	}
+	policy.Add(forbid...)
+	policy.Allow(allow...)
+	return nil
+}
+
+// projectListeners returns the scanned listeners on the project's ports
+func projectListeners(p *config.Project) ([]ports.PortInfo, error) {
+	portList, err := expandPortArgs(p.PortSpecs())
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[int]bool, len(portList))
+	for _, port := range portList {
+		wanted[port] = true
+	}
+
+	scanned, err := scanPorts()
+	if err != nil {
+		return nil, err
+	}
+	var result []ports.PortInfo
+	for _, l := range scanned {
+		if wanted[l.Port] {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
+
+// projectDown kills every process listening on one of the project's ports
+func projectDown(sig killer.Signal) error {
+	p, err := requireProject()
+	if err != nil {
+		return err
+	}
+	if err := checkMachineKill(""); err != nil {
+		return err
+	}
+
+	listeners, err := projectListeners(p)
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		if machineOutput() {
+			return printTargetResults(nil, nil, nil, false)
+		}
+		if !quiet {
+			fmt.Printf("Nothing to do: no %s ports are in use\n", p.Name)
+		}
+		return nil
+	}
+	return killTargets(groupByPID(listeners), sig)
+}
+
+// showProject writes the project's named ports and their listeners to w
+func showProject(w io.Writer) error {
+	p, err := requireProject()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Project: %s (%s)\n\n", p.Name, p.File())
+
+	listeners, err := projectListeners(p)
+	if err != nil {
+		return err
+	}
+
+	groups, _ := p.PortGroups()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPORTS\tLISTENING")
+	for _, name := range sortedGroupNames(groups) {
+		portList, err := expandPortArgs(groups[name])
+		if err != nil {
+			return err
+		}
+		var using []string
+		for _, l := range listeners {
+			for _, port := range portList {
+				if l.Port == port {
+					using = append(using, fmt.Sprintf("%s (PID %d) on %d", l.Process, l.PID, l.Port))
+				}
+			}
+		}
+		status := "-"
+		if len(using) > 0 {
+			status = strings.Join(using, ", ")
+		}
+		fmt.Fprintf(tw, "@%s\t%s\t%s\n", name, strings.Join(groups[name], ", "), status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(p.Allow) > 0 {
+		fmt.Fprintf(w, "\nAllowed: %s\n", strings.Join(p.Allow, ", "))
+	}
+	if len(p.Forbid) > 0 {
+		fmt.Fprintf(w, "Forbidden: %s\n", strings.Join(p.Forbid, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/config"
+	"github.com/wusher/tsunami/internal/killer"
+)
+
+// withProject runs the test from a directory below a .tsunami.yaml holding
+// data, with an empty user config, and restores the project globals
+func withProject(t *testing.T, data string) string {
+	t.Helper()
+	withConfigFile(t, "config.toml", "[groups]\napi = [1]\nweb = [3000]\n")
+
+	root := t.TempDir()
+	path := filepath.Join(root, config.ProjectFileName)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "src")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	origProject, origNoProject := project, noProject
+	t.Cleanup(func() { project, noProject = origProject, origNoProject })
+	noProject = false
+	return path
+}
+
+// applyTestConfig runs applyConfig on a command without flags
+func applyTestConfig(t *testing.T) {
+	t.Helper()
+	var timeout time.Duration
+	var sig string
+	var force bool
+	if err := applyConfig(configTestCmd(&timeout, &sig, &force)); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+}
+
+func TestApplyConfigFindsProject(t *testing.T) {
+	path := withProject(t, "name: shop\nports:\n  api: 8080\n  workers: \"9000-9001\"\n")
+	applyTestConfig(t)
+
+	if project == nil || project.File() != path {
+		t.Fatalf("project = %+v, want %s", project, path)
+	}
+
+	// Project names override the user's groups; other groups remain
+	got, err := expandPortArgs([]string{"@api", "@workers", "@web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{8080, 9000, 9001, 3000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expandPortArgs = %v, want %v", got, want)
+	}
+
+	opts, err := tuiOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Filter != "port:8080,9000-9001" {
+		t.Errorf("TUI filter = %q", opts.Filter)
+	}
+}
+
+func TestNoProjectFlag(t *testing.T) {
+	withProject(t, "ports: {api: 8080}\n")
+	noProject = true
+	applyTestConfig(t)
+
+	if project != nil {
+		t.Error("--no-project should skip .tsunami.yaml")
+	}
+	got, err := expandPortArgs([]string{"@api"})
+	if err != nil || !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("@api = %v, %v, want the config group", got, err)
+	}
+	opts, err := tuiOptions()
+	if err != nil || opts.Filter != "" {
+		t.Errorf("TUI filter = %q, %v, want none", opts.Filter, err)
+	}
+}
+
+func TestApplyConfigInvalidProject(t *testing.T) {
+	path := withProject(t, "ports: {api: 0}\n")
+	var timeout time.Duration
+	var sig string
+	var force bool
+	err := applyConfig(configTestCmd(&timeout, &sig, &force))
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("applyConfig() error = %v, want it to name %s", err, path)
+	}
+}
+
+func TestProjectPolicy(t *testing.T) {
+	withProject(t, "allow: [name=node]\nforbid: [port=5432]\n")
+	applyTestConfig(t)
+	withPolicy(t, killer.NewPolicy())
+
+	if err := setupPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if rules := policy.Rules(); len(rules) != 1 || rules[0].String() != "port=5432" {
+		t.Errorf("policy rules = %v", rules)
+	}
+	err := checkProtected(killer.Target{PID: 9000100, Name: "java", Port: 8080})
+	if err == nil || !strings.Contains(err.Error(), "allow list") {
+		t.Errorf("java should be outside the allow list, got %v", err)
+	}
+	err = checkProtected(killer.Target{PID: 9000100, Name: "node", Port: 5432})
+	if err == nil || !strings.Contains(err.Error(), "port=5432") {
+		t.Errorf("port 5432 should be forbidden, got %v", err)
+	}
+	if err := checkProtected(killer.Target{PID: 9000100, Name: "node", Port: 3000}); err != nil {
+		t.Errorf("node on 3000 should be allowed, got %v", err)
+	}
+}
+
+func TestProjectDownNoProject(t *testing.T) {
+	withProject(t, "")
+	noProject = true
+	applyTestConfig(t)
+
+	sig, _ := killer.ParseSignal("TERM")
+	err := projectDown(sig)
+	if err == nil || !strings.Contains(err.Error(), "no .tsunami.yaml") {
+		t.Errorf("projectDown() error = %v", err)
+	}
+	if err := showProject(&bytes.Buffer{}); err == nil {
+		t.Error("showProject() should fail without a project")
+	}
+}
+
+func TestProjectDownJSONNeedsForce(t *testing.T) {
+	withProject(t, "ports: {api: 1}\n")
+	applyTestConfig(t)
+	setKillFlags(t, false, false, true, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	if err := projectDown(sig); err == nil || !strings.Contains(err.Error(), "--json requires") {
+		t.Errorf("projectDown() error = %v", err)
+	}
+}
+
+// listenLocal opens a TCP listener owned by the test process
+func listenLocal(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestProjectDown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	port := listenLocal(t)
+	withProject(t, "name: shop\nports:\n  self: "+strconv.Itoa(port)+"\n  idle: 1\n")
+	applyTestConfig(t)
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, true, false, true, false)
+	if err := setupPolicy(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The only listener is this test process, which is protected
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() { err = projectDown(sig) })
+	if err != nil {
+		t.Fatalf("projectDown: %v", err)
+	}
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 1 || results[0].PID != os.Getpid() || results[0].Status != "protected" {
+		t.Errorf("results = %+v, want this process, protected", results)
+	}
+
+	var buf bytes.Buffer
+	if err := showProject(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Project: shop") || !strings.Contains(out, "PID "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("showProject output:\n%s", out)
+	}
+	if !strings.Contains(out, "@idle") {
+		t.Errorf("showProject should list idle ports:\n%s", out)
+	}
+}
+
+func TestProjectDownNothingListening(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	withProject(t, "name: shop\nports: {idle: 1}\n")
+	applyTestConfig(t)
+	setKillFlags(t, false, true, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() { err = projectDown(sig) })
+	if err != nil || !strings.Contains(output, "no shop ports are in use") {
+		t.Errorf("projectDown() = %v, output %q", err, output)
+	}
+}
+
+func TestProjectCommands(t *testing.T) {
+	var names []string
+	for _, c := range projectCmd.Commands() {
+		names = append(names, c.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"down", "show"}) {
+		t.Errorf("project subcommands = %v", names)
+	}
+	for _, flag := range []string{"force", "dry-run", "signal", "timeout", "json", "override-protection"} {
+		if projectDownCmd.Flags().Lookup(flag) == nil {
+			t.Errorf("project down is missing --%s", flag)
+		}
+	}
+	if rootCmd.PersistentFlags().Lookup("no-project") == nil {
+		t.Error("missing --no-project flag")
+	}
+}
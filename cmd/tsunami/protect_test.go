@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// withPolicy replaces the package policy for the duration of a test
+func withPolicy(t *testing.T, p *killer.Policy) {
+	t.Helper()
+	orig := policy
+	policy = p
+	t.Cleanup(func() { policy = orig })
+}
+
+func TestKillPIDsRefusesProtected(t *testing.T) {
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, false, true, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	for _, pid := range []int{1, os.Getpid()} {
+		err := killPIDs([]int{pid}, sig)
+		if err == nil || !strings.Contains(err.Error(), "refusing to kill") ||
+			!strings.Contains(err.Error(), "--override-protection") {
+			t.Errorf("killPIDs(%d) error = %v, want a protection refusal", pid, err)
+		}
+	}
+}
+
+func TestRefusalMessages(t *testing.T) {
+	withPolicy(t, killer.NewPolicy(killer.Rule{Kind: killer.RulePort, Value: "12345"}))
+
+	err := checkProtected(killer.Target{PID: 999999999, Port: 12345, Name: "process_api"})
+	want := "refusing to kill process_api (PID 999999999): matches protection rule port=12345 (use --override-protection to kill it anyway)"
+	if err == nil || err.Error() != want {
+		t.Errorf("checkProtected error = %v, want %q", err, want)
+	}
+	var perr *killer.ProtectedError
+	if !errors.As(err, &perr) || perr.PID != 999999999 {
+		t.Errorf("checkProtected error should unwrap to the ProtectedError, got %#v", err)
+	}
+
+	err = checkSocket(ports.Socket{PID: 999999999, LocalPort: 12345, Process: "process_api"})
+	want = "refusing to close a socket of process_api (PID 999999999): matches protection rule port=12345 (use --override-protection to close it anyway)"
+	if err == nil || err.Error() != want {
+		t.Errorf("checkSocket error = %v, want %q", err, want)
+	}
+
+	err = refuse(&killer.ProtectedError{PID: 1, Reason: "it is the init process (PID 1)"}, "kill", "kill")
+	want = "refusing to kill PID 1: it is the init process (PID 1) (use --override-protection to kill it anyway)"
+	if err.Error() != want {
+		t.Errorf("refuse without a name = %q, want %q", err, want)
+	}
+}
+
+func TestKillProcessRefusesProtected(t *testing.T) {
+	withPolicy(t, killer.NewPolicy(killer.Rule{Kind: killer.RulePort, Value: "12345"}))
+	setKillFlags(t, true, true, false, false)
+
+	p := ports.PortInfo{Port: 12345, PID: 999999999, Process: "testproc", User: "testuser"}
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() { err = killProcess(p, 12345, sig) })
+	if err == nil || !strings.Contains(err.Error(), "protection rule port=12345") {
+		t.Errorf("killProcess error = %v, want a port rule refusal", err)
+	}
+	if strings.Contains(output, "Would kill") {
+		t.Error("a protected process should not be reported as killable in a dry run")
+	}
+
+	p.Process = "sshd"
+	withPolicy(t, killer.NewPolicy())
+	if err := killProcess(p, 12345, sig); err == nil || !strings.Contains(err.Error(), "SSH server") {
+		t.Errorf("killProcess(sshd) error = %v, want a built-in refusal", err)
+	}
+}
+
+func TestKillTargetsProtected(t *testing.T) {
+	withPolicy(t, killer.NewPolicy(killer.Rule{Kind: killer.RuleName, Value: "java"}))
+	setKillFlags(t, true, false, true, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets dry run error: %v", err)
+	}
+
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	for _, r := range results {
+		want := "would_kill"
+		if r.Process == "java" {
+			want = "protected"
+		}
+		if r.Status != want {
+			t.Errorf("%s (PID %d) status = %q, want %q", r.Process, r.PID, r.Status, want)
+		}
+	}
+
+	// With nothing left to kill, a real run fails without prompting
+	dryRun, jsonOut, force = false, false, false
+	captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts[3:4]), sig)
+	})
+	if err == nil || !strings.Contains(err.Error(), "every matched process is protected") {
+		t.Errorf("killTargets with only protected targets error = %v", err)
+	}
+}
+
+func TestSetupPolicy(t *testing.T) {
+	withPolicy(t, killer.NewPolicy())
+	origRules, origOverride := protectRules, overrideProtection
+	defer func() { protectRules, overrideProtection = origRules, origOverride }()
+
+	protectRules = []string{"name=postgres", "port=5432"}
+	overrideProtection = false
+	if err := setupPolicy(); err != nil {
+		t.Fatalf("setupPolicy error: %v", err)
+	}
+	if len(policy.Rules()) != 2 {
+		t.Errorf("policy rules = %v, want 2", policy.Rules())
+	}
+
+	protectRules = []string{"bogus"}
+	if err := setupPolicy(); err == nil {
+		t.Error("setupPolicy should reject an invalid rule")
+	}
+
+	overrideProtection = true
+	if err := setupPolicy(); err != nil || policy != nil {
+		t.Errorf("--override-protection should clear the policy, got %v, %v", policy, err)
+	}
+	if err := checkProtected(killer.Target{PID: 1}); err != nil {
+		t.Errorf("with protection overridden, PID 1 should be allowed: %v", err)
+	}
+}
+
+func TestProtectionFlags(t *testing.T) {
+	for _, name := range []string{"override-protection", "protect"} {
+		if rootCmd.Flags().Lookup(name) == nil {
+			t.Errorf("--%s flag should exist", name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/respawn"
+)
+
+// defaultRespawnWindow is long enough for runit and s6, which wait a
+// second before restarting a process that died young
+const defaultRespawnWindow = 2 * time.Second
+
+// respawnWindowValue is the value of --respawn-window, which records that
+// it was set so unsupervised processes are watched too
+type respawnWindowValue struct{}
+
+func (respawnWindowValue) String() string { return respawnWindow.String() }
+func (respawnWindowValue) Type() string   { return "duration" }
+
+func (respawnWindowValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	respawnWindow, respawnWindowSet = d, true
+	return nil
+}
+
+// addRespawnWindowFlag binds --respawn-window to cmd
+func addRespawnWindowFlag(cmd *cobra.Command) {
+	respawnWindow = defaultRespawnWindow
+	cmd.Flags().Var(respawnWindowValue{}, "respawn-window", "Watch killed ports this long for a supervisor restarting the process, delaying the exit by up to as long; "+
+		"by default only processes with a recognized supervisor are watched (0 to skip)")
+}
+
+// watchesRespawn reports whether the ports of l are watched for a respawn
+// once its process is killed: by default when a supervisor is recognized,
+// and for every process when --respawn-window is given. It walks the
+// process tree, so it is called before the kill.
+func watchesRespawn(l ports.PortInfo) bool {
+	return respawnWindow > 0 && (respawnWindowSet || respawn.Supervised(l))
+}
+
+// respawnRecord is the machine-readable record of a process that took the
+// ports of a killed target
+type respawnRecord struct {
+	PID        int               `json:"pid" yaml:"pid"`
+	Process    string            `json:"process" yaml:"process"`
+	Ports      []int             `json:"ports" yaml:"ports"`
+	Supervisor *supervisorRecord `json:"supervisor,omitempty" yaml:"supervisor,omitempty"`
+}
+
+// supervisorRecord is the machine-readable form of a respawn.Supervisor
+type supervisorRecord struct {
+	Name    string `json:"name" yaml:"name"`
+	PID     int    `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Program string `json:"program,omitempty" yaml:"program,omitempty"`
+	Stop    string `json:"stop,omitempty" yaml:"stop,omitempty"`
+}
+
+// newRespawnRecord converts r for machine output
+func newRespawnRecord(r respawn.Respawn) respawnRecord {
+	rec := respawnRecord{PID: r.PID, Process: r.Process, Ports: r.Ports}
+	if s := r.Supervisor; s != nil {
+		rec.Supervisor = &supervisorRecord{Name: s.Name, PID: s.PID, Program: s.Program, Stop: s.Stop}
+	}
+	return rec
+}
+
+// watchRespawn watches portList for --respawn-window after the processes
+// in killed were signalled at since, and returns the processes that took
+// the ports over. HUP usually makes a server reload, so its new workers are
+// not looked for. The watch is best effort and ctrl+c ends it.
+func watchRespawn(killed, portList []int, sig killer.Signal, since time.Time) []respawn.Respawn {
+	if respawnWindow <= 0 || len(portList) == 0 || sig == killer.SIGHUP {
+		return nil
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Watching %s for %s in case it is restarted\n", describePorts(portList), respawnWindow)
+	}
+	ctx, stop := interruptible()
+	defer stop()
+	scan := func(ctx context.Context) ([]ports.PortInfo, error) {
+		list, err := scanContext(ctx)
+		if err == nil {
+			annotateListeners(ctx, list)
+		}
+		return list, err
+	}
+	found, _ := respawn.Watch(ctx, portList, killed, respawn.Options{Window: respawnWindow, Since: since, Scan: scan})
+	return found
+}
+
+// respawnError reports the processes that took back a killed process's
+// ports, or is nil if there are none
+func respawnError(found []respawn.Respawn) error {
+	if len(found) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(found))
+	for i, r := range found {
+		msgs[i] = r.String()
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
+}
+
+// targetRespawns returns the respawns in found that took a port of t
+func targetRespawns(t target, found []respawn.Respawn) []respawn.Respawn {
+	var result []respawn.Respawn
+	for _, r := range found {
+		for _, port := range r.Ports {
+			if containsInt(t.Ports(), port) {
+				result = append(result, r)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// containsInt reports whether list contains n
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/respawn"
+)
+
+func TestPrintTargetResultsRespawned(t *testing.T) {
+	setKillFlags(t, false, true, true, false)
+	targets := groupByPID(targetTestPorts[:3])
+	found := []respawn.Respawn{{PID: 9000500, Process: "node", Ports: []int{5173, 5174},
+		Supervisor: &respawn.Supervisor{Name: "pm2", PID: 9000001, Program: "vite", Stop: "pm2 stop vite"}}}
+	respawns := [][]respawn.Respawn{targetRespawns(targets[0], found), targetRespawns(targets[1], found)}
+
+	output := captureStdout(t, func() {
+		if err := printTargetResults(targets, make([]error, len(targets)), respawns, true); err != nil {
+			t.Errorf("printTargetResults error: %v", err)
+		}
+	})
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 2 || results[0].Status != "killed" || results[0].Respawns != nil {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[1].Status != "respawned" || len(results[1].Respawns) != 1 {
+		t.Fatalf("results[1] = %+v", results[1])
+	}
+	r := results[1].Respawns[0]
+	want := supervisorRecord{Name: "pm2", PID: 9000001, Program: "vite", Stop: "pm2 stop vite"}
+	if r.PID != 9000500 || r.Supervisor == nil || *r.Supervisor != want {
+		t.Errorf("respawn = %+v, supervisor %+v", r, r.Supervisor)
+	}
+}
+
+func TestWatchRespawnSkipped(t *testing.T) {
+	setKillFlags(t, false, true, false, false)
+	respawnWindow = time.Minute
+	start := time.Now()
+	if found := watchRespawn([]int{9000100}, []int{3000}, killer.SIGHUP, start); found != nil {
+		t.Errorf("watchRespawn after HUP = %+v", found)
+	}
+	if found := watchRespawn(nil, nil, killer.SIGTERM, start); found != nil {
+		t.Errorf("watchRespawn without ports = %+v", found)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("watchRespawn waited for its window without anything to watch")
+	}
+	if err := respawnError(nil); err != nil {
+		t.Errorf("respawnError(nil) = %v", err)
+	}
+}
+
+func TestKillProcessReportsRespawn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("needs python3")
+	}
+	setKillFlags(t, false, true, false, false)
+
+	// A shell loop is the simplest supervisor there is, and not a known one
+	const port = 18790
+	loop := exec.Command("sh", "-c", "while :; do python3 -m http.server 18790 --bind 127.0.0.1 >/dev/null 2>&1; sleep 0.1; done")
+	loop.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := loop.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = syscall.Kill(-loop.Process.Pid, syscall.SIGKILL)
+		_ = loop.Wait()
+	})
+
+	listening := func(other int) ports.PortInfo {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+			if matches, err := findByPort(port); err == nil && len(matches) > 0 && matches[0].PID != other {
+				return matches[0]
+			}
+		}
+		t.Fatal("python3 never listened")
+		return ports.PortInfo{}
+	}
+	server := listening(0)
+
+	// Without a recognized supervisor the default window is not waited out
+	respawnWindow = 10 * time.Second
+	start := time.Now()
+	var err error
+	captureStdout(t, func() {
+		err = killProcess(server, port, killer.SIGTERM)
+	})
+	if err != nil || time.Since(start) > 5*time.Second {
+		t.Errorf("killProcess = %v after %v, want no respawn watch", err, time.Since(start))
+	}
+
+	// An explicit --respawn-window watches any process
+	server = listening(server.PID)
+	respawnWindowSet = true
+	output := captureStdout(t, func() {
+		err = killProcess(server, port, killer.SIGTERM)
+	})
+	if !strings.Contains(output, "Killed") {
+		t.Errorf("output = %q", output)
+	}
+	if err == nil || !strings.Contains(err.Error(), "took port 18790 again; no known supervisor restarted it") {
+		t.Errorf("killProcess error = %v, want the respawn reported", err)
+	}
+}
+
+func TestRespawnWindowFlag(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+	flag := rootCmd.Flags().Lookup("respawn-window")
+	if flag.DefValue != defaultRespawnWindow.String() || flag.Value.Type() != "duration" {
+		t.Errorf("--respawn-window default = %q, type %q", flag.DefValue, flag.Value.Type())
+	}
+	if err := flag.Value.Set("nope"); err == nil || respawnWindowSet {
+		t.Error("an invalid window should be rejected")
+	}
+	if err := flag.Value.Set("5s"); err != nil || respawnWindow != 5*time.Second || !respawnWindowSet {
+		t.Errorf("after --respawn-window 5s: %v, window %v, set %v", err, respawnWindow, respawnWindowSet)
+	}
+	if !watchesRespawn(ports.PortInfo{PID: 999999999}) {
+		t.Error("an explicit window should watch a process without a supervisor")
+	}
+	respawnWindowSet = false
+	if watchesRespawn(ports.PortInfo{PID: 999999999}) {
+		t.Error("the default window should skip a process without a supervisor")
+	}
+	if !watchesRespawn(ports.PortInfo{PID: 999999999, Unit: &ports.Unit{Name: "api.service"}}) {
+		t.Error("the default window should watch a process in a systemd service")
+	}
+}
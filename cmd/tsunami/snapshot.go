@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/snapshot"
+)
+
+// killNew is the restore-state --kill-new flag
+var killNew bool
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save the listening ports and compare against them later",
+	Long: `Snapshots record every listener with its process, command line and start
+time, so a later scan can show exactly what changed:
+
+  tsunami snapshot save before.json
+  docker compose up -d && run-tests && docker compose down
+  tsunami snapshot diff before.json            # compare with what is listening now
+  tsunami snapshot restore-state before.json --kill-new -f`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyConfig(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var snapshotSaveCmd = &cobra.Command{
+	Use:   "save <file>",
+	Short: "Save the listening ports to a file (- for stdout)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := saveSnapshot(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <a> [b|live]",
+	Short: "Show listeners added, removed or taken over since a snapshot",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := diffSnapshots(args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore-state <file>",
+	Short: "Kill listeners that are not in a snapshot (with --kill-new)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sig, err := killer.ParseSignal(signal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := setupPolicy(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := restoreState(args[0], sig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	snapshotSaveCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Suppress output except errors")
+	addOutputFlags(snapshotDiffCmd, "Output format: "+formatNames())
+	addKillFlags(snapshotRestoreCmd)
+	snapshotRestoreCmd.Flags().BoolVar(&killNew, "kill-new", false, "Kill every listener that is not in the snapshot")
+
+	snapshotCmd.AddCommand(snapshotSaveCmd, snapshotDiffCmd, snapshotRestoreCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
+
+// saveSnapshot writes the current listeners to path, or stdout for "-"
+func saveSnapshot(path string) error {
+	scanned, err := scanPorts()
+	if err != nil {
+		return err
+	}
+	s := snapshot.New(scanned, time.Now())
+	if path == "-" {
+		return s.Write(os.Stdout)
+	}
+	if err := s.Save(path); err != nil {
+		return err
+	}
+	if !quiet {
+		noun := "listeners"
+		if len(s.Listeners) == 1 {
+			noun = "listener"
+		}
+		fmt.Printf("Saved %d %s to %s\n", len(s.Listeners), noun, path)
+	}
+	return nil
+}
+
+// loadListeners returns the listeners saved at path, or a fresh scan for
+// "live"
+func loadListeners(path string) ([]ports.PortInfo, error) {
+	if path == "live" {
+		return scanPorts()
+	}
+	s, err := snapshot.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.Ports(), nil
+}
+
+// diffSnapshots prints the changes from the first snapshot to the second,
+// which defaults to the live listeners
+func diffSnapshots(args []string) error {
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+	before, err := loadListeners(args[0])
+	if err != nil {
+		return err
+	}
+	afterPath := "live"
+	if len(args) == 2 {
+		afterPath = args[1]
+	}
+	after, err := loadListeners(afterPath)
+	if err != nil {
+		return err
+	}
+	return changePrinter.Print(os.Stdout, snapshot.Diff(before, after), opts)
+}
+
+// changeRecord is a snapshot change as printed by the structured formats
+type changeRecord struct {
+	Change          string `json:"change" yaml:"change"`
+	portRecord      `yaml:",inline"`
+	PreviousPID     int    `json:"previous_pid,omitempty" yaml:"previous_pid,omitempty"`
+	PreviousProcess string `json:"previous_process,omitempty" yaml:"previous_process,omitempty"`
+}
+
+// changePrinter renders snapshot changes
+var changePrinter = output.Printer[snapshot.Change]{
+	Columns: []output.Column[snapshot.Change]{
+		{Key: "change", Header: "CHANGE", Value: func(c snapshot.Change) string { return c.Kind }},
+		{Key: "port", Header: "PORT", Value: func(c snapshot.Change) string { return cols.FormatPort(c.Listener) }},
+		{Key: "proto", Header: "PROTO", Value: func(c snapshot.Change) string { return c.Listener.Proto }},
+		{Key: "address", Header: "ADDRESS", Value: func(c snapshot.Change) string { return c.Listener.Address }},
+		{Key: "pid", Header: "PID", Value: func(c snapshot.Change) string { return strconv.Itoa(c.Listener.PID) }},
+		{Key: "process", Header: "PROCESS", Flex: true, Min: 8, Value: func(c snapshot.Change) string { return c.Listener.Process }},
+		{Key: "user", Header: "USER", Flex: true, Min: 6, Value: func(c snapshot.Change) string { return c.Listener.User }},
+		{Key: "previous", Header: "PREVIOUS", Flex: true, Min: 10, Value: describePrevious},
+	},
+	Record: func(c snapshot.Change) any {
+		r := changeRecord{Change: c.Kind, portRecord: newPortRecord(c.Listener)}
+		if c.Previous != nil {
+			r.PreviousPID = c.Previous.PID
+			r.PreviousProcess = c.Previous.Process
+		}
+		return r
+	},
+	Empty: "No changes",
+}
+
+// describePrevious names the process an owner change replaced
+func describePrevious(c snapshot.Change) string {
+	if c.Previous == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (PID %d)", c.Previous.Process, c.Previous.PID)
+}
+
+// restoreState lists, or with --kill-new kills, the listeners that are
+// not in the snapshot at path. A process that also owns a listener from
+// the snapshot is left alone.
+func restoreState(path string, sig killer.Signal) error {
+	if killNew {
+		if err := checkMachineKill(" with --kill-new"); err != nil {
+			return err
+		}
+	}
+	s, err := snapshot.Load(path)
+	if err != nil {
+		return err
+	}
+	scanned, err := scanPorts()
+	if err != nil {
+		return err
+	}
+	baseline := s.Ports()
+
+	var listeners []ports.PortInfo
+	for _, l := range snapshot.NewListeners(baseline, scanned) {
+		if inBaseline(baseline, l) {
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Skipping %s (PID %d) on %s: the process is in %s\n",
+					l.Process, l.PID, l.Where(), path)
+			}
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+
+	if len(listeners) == 0 {
+		if machineOutput() {
+			return printTargetResults(nil, nil, nil, false)
+		}
+		if !quiet {
+			fmt.Printf("Nothing to do: every listener is in %s\n", path)
+		}
+		return nil
+	}
+	if !killNew {
+		return reportNew(listeners)
+	}
+	return killTargets(groupByPID(listeners), sig)
+}
+
+// inBaseline reports whether the process that owns l owned any listener
+// in baseline
+func inBaseline(baseline []ports.PortInfo, l ports.PortInfo) bool {
+	for _, b := range baseline {
+		if ports.SameProcess(b, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportNew lists the listeners restore-state --kill-new would kill
+func reportNew(listeners []ports.PortInfo) error {
+	targets := groupByPID(listeners)
+	if machineOutput() {
+		return printTargetResults(targets, make([]error, len(targets)), nil, false)
+	}
+	if !quiet {
+		tableCols, _ := cols.Parse(strings.Join(targetColumns, ","))
+		if err := printTable(listeners, tableCols, terminalWidth()); err != nil {
+			return err
+		}
+		fmt.Printf("\nWould kill %s with --kill-new\n", pluralProcesses(len(targets)))
+	}
+	return nil
+}
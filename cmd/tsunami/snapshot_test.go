@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/snapshot"
+)
+
+// writeSnapshot saves listeners as a snapshot in a temporary file
+func writeSnapshot(t *testing.T, listeners []ports.PortInfo) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := snapshot.New(listeners, time.Now()).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	setOutputFlags(t, "csv", "", true)
+	moved := targetTestPorts[3]
+	moved.PID = 1234
+	moved.Process = "jetty"
+	a := writeSnapshot(t, targetTestPorts[:4])
+	b := writeSnapshot(t, []ports.PortInfo{targetTestPorts[0], moved, targetTestPorts[4]})
+
+	var err error
+	got := captureStdout(t, func() { err = diffSnapshots([]string{a, b}) })
+	if err != nil {
+		t.Fatalf("diffSnapshots error: %v", err)
+	}
+	want := "change,port,proto,address,pid,process,user,previous\n" +
+		"removed,5173,tcp,,9000200,node,alice,\n" +
+		"removed,5174,tcp6,,9000200,node,alice,\n" +
+		"owner_changed,8080,tcp,,1234,jetty,ci,java (PID 9000300)\n" +
+		"added,9000,tcp,,9000400,Node,CI,\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := diffSnapshots([]string{a, filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing snapshot")
+	}
+}
+
+func TestSaveSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	port := listenLocal(t)
+	path := filepath.Join(t.TempDir(), "saved.json")
+	origQuiet := quiet
+	quiet = true
+	defer func() { quiet = origQuiet }()
+
+	if err := saveSnapshot(path); err != nil {
+		t.Fatalf("saveSnapshot error: %v", err)
+	}
+	s, err := snapshot.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range s.Listeners {
+		if l.Port == port && l.PID == os.Getpid() {
+			return
+		}
+	}
+	t.Errorf("snapshot is missing this test's listener on port %d", port)
+}
+
+func TestRestoreState(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	port := listenLocal(t)
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, true, false, false, false)
+	origKillNew := killNew
+	defer func() { killNew = origKillNew }()
+	sig, _ := killer.ParseSignal("TERM")
+
+	// Not in an empty snapshot: reported, and a dry run would kill it
+	empty := writeSnapshot(t, nil)
+	for _, kill := range []bool{false, true} {
+		killNew = kill
+		var err error
+		got := captureStdout(t, func() { err = restoreState(empty, sig) })
+		if err != nil {
+			t.Fatalf("restoreState(--kill-new=%v) error: %v", kill, err)
+		}
+		if !strings.Contains(got, strconv.Itoa(port)) || !strings.Contains(got, "Would kill") {
+			t.Errorf("restoreState(--kill-new=%v) output:\n%s", kill, got)
+		}
+	}
+
+	// A process that is in the snapshot is skipped even on a new port
+	self := writeSnapshot(t, []ports.PortInfo{{Port: 1, PID: os.Getpid(), Proto: "tcp"}})
+	var err error
+	got := captureStdout(t, func() { err = restoreState(self, sig) })
+	if err != nil {
+		t.Fatalf("restoreState error: %v", err)
+	}
+	if strings.Contains(got, strconv.Itoa(port)) {
+		t.Errorf("this test's process was not skipped:\n%s", got)
+	}
+}
+
+func TestRestoreStateMachineOutput(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+	setOutputFlags(t, "json", "", true)
+	origKillNew := killNew
+	killNew = true
+	defer func() { killNew = origKillNew }()
+
+	sig, _ := killer.ParseSignal("TERM")
+	err := restoreState(writeSnapshot(t, nil), sig)
+	if err == nil || !strings.Contains(err.Error(), "requires --force or --dry-run with --kill-new") {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// openTTY opens the terminal for confirmations when stdin carries targets
+var openTTY = func() (io.ReadCloser, error) {
+	return os.Open("/dev/tty")
+}
+
+// stdinEntry is one kill target read from stdin or the command line
+type stdinEntry struct {
+	Source  string   // "stdin line 3", "stdin record 2", "argument" or "--pid"
+	Ports   []int    // kill the listeners on these ports
+	Host    string   // that accept connections to this host; "" for any
+	Address string   // or are bound to exactly this address in Netns
+	Netns   string   // the network namespace of Address; "" for the host's
+	Sockets []string // and on these Unix socket paths
+	PID     int      // only this process; 0 selects by port alone
+}
+
+// stdinRecord is a JSON input record. It accepts the objects printed by
+// --list --json and by --json kill results.
+type stdinRecord struct {
+	Port    int      `json:"port"`
+	Ports   []int    `json:"ports"`
+	Proto   string   `json:"proto"`
+	Address string   `json:"address"`
+	Sockets []string `json:"sockets"`
+	PID     int      `json:"pid"`
+	Netns   string   `json:"netns"`
+}
+
+// staleSocketError reports a socket file that nothing listens on, which
+// makes a server that binds it fail with "address already in use"
+type staleSocketError struct {
+	Source string
+	Path   string
+}
+
+func (e *staleSocketError) Error() string {
+	return fmt.Sprintf("%s: no process listening on %s; the socket file is stale (remove it with --clean-stale)", e.Source, e.Path)
+}
+
+// unixPrefix marks a target as a Unix socket, e.g. unix:app.sock or
+// unix:@name for an abstract socket
+const unixPrefix = "unix:"
+
+// isSocketArg reports whether a target names a Unix socket rather than a
+// port: it has the unix: prefix, is a path such as /run/app.sock or
+// ./app.sock, or is a socket file in the current directory such as
+// app.sock
+func isSocketArg(s string) bool {
+	if strings.HasPrefix(s, unixPrefix) || strings.HasPrefix(s, "/") ||
+		strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") {
+		return true
+	}
+	return ports.IsSocketFile(s)
+}
+
+// socketEntry makes a target of the Unix socket s, without its unix:
+// prefix. A path is made absolute as /proc/net/unix lists it; an abstract
+// socket's @name is kept as it is.
+func socketEntry(s string) (stdinEntry, error) {
+	path := strings.TrimPrefix(s, unixPrefix)
+	if path == "" || path == "@" {
+		return stdinEntry{}, fmt.Errorf("invalid socket: %s", s)
+	}
+	if strings.HasPrefix(path, "@") {
+		return stdinEntry{Sockets: []string{path}}, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return stdinEntry{}, fmt.Errorf("invalid socket path %s: %w", path, err)
+	}
+	return stdinEntry{Sockets: []string{abs}}, nil
+}
+
+// usesStdin reports whether targets should be read from stdin
+func usesStdin(args []string) bool {
+	if readStdin {
+		return true
+	}
+	for _, arg := range args {
+		if arg == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// killFromStdin kills the targets read from stdin together with any port
+// arguments and --pid values, with a single confirmation read from the
+// terminal
+func killFromStdin(args []string, sig killer.Signal) error {
+	if err := checkMachineKill(" when reading targets from stdin"); err != nil {
+		return err
+	}
+
+	entries, err := readEntries(os.Stdin)
+	if err != nil {
+		return err
+	}
+	var portArgs []string
+	for _, arg := range args {
+		if arg != "-" {
+			portArgs = append(portArgs, arg)
+		}
+	}
+	argEntries, err := argumentEntries(portArgs)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, argEntries...)
+	if len(entries) == 0 {
+		return errors.New("no targets on stdin")
+	}
+
+	// Stdin is spoken for, so answers come from the terminal
+	if !force && !dryRun {
+		tty, err := openTTY()
+		if err != nil {
+			return fmt.Errorf("cannot ask for confirmation without a terminal (use --force or --dry-run): %w", err)
+		}
+		defer tty.Close()
+		confirmInput = tty
+		defer func() { confirmInput = nil }()
+	}
+	return killEntries(entries, sig)
+}
+
+// argumentEntries converts port and socket path arguments and --pid values
+// to targets
+func argumentEntries(args []string) ([]stdinEntry, error) {
+	var entries []stdinEntry
+	var portArgs []string
+	for _, arg := range args {
+		if !isSocketArg(arg) {
+			portArgs = append(portArgs, arg)
+			continue
+		}
+		entry, err := socketEntry(arg)
+		if err != nil {
+			return nil, err
+		}
+		entry.Source = "argument"
+		entries = append(entries, entry)
+	}
+	argPorts, err := expandPortArgs(portArgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, port := range argPorts {
+		entries = append(entries, stdinEntry{Source: "argument", Ports: []int{port}})
+	}
+	for _, pid := range pids {
+		entries = append(entries, stdinEntry{Source: "--pid", PID: pid})
+	}
+	return entries, nil
+}
+
+// killArguments kills the port arguments and --pid values as one set of
+// targets, so machine-readable output has a result for each. A "-"
+// argument adds the targets on stdin.
+func killArguments(args []string, sig killer.Signal) error {
+	if usesStdin(args) {
+		return killFromStdin(args, sig)
+	}
+	if err := checkMachineKill(""); err != nil {
+		return err
+	}
+	entries, err := argumentEntries(args)
+	if err != nil {
+		return err
+	}
+	return killEntries(entries, sig)
+}
+
+// killEntries resolves entries against a fresh scan and kills the targets
+// found with a single confirmation. Entries that match nothing are
+// reported but do not stop the others. With --clean-stale, stale socket
+// files are removed, as are those the killed targets leave behind.
+func killEntries(entries []stdinEntry, sig killer.Signal) error {
+	scanned, err := scanPorts()
+	if err != nil {
+		return err
+	}
+	targets, errs := resolveEntries(entries, scanned)
+	errs = cleanStaleSockets(errs)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	if len(targets) == 0 {
+		if len(errs) == 0 {
+			return nil // every target was a stale socket, now removed
+		}
+		return fmt.Errorf("none of the %d targets could be found", len(entries))
+	}
+
+	killErr := killTargets(targets, sig)
+	if cleanStale && !dryRun {
+		cleanReleasedSockets(targets)
+	}
+	if killErr != nil {
+		return killErr
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d targets could not be found", len(errs), len(entries))
+	}
+	return nil
+}
+
+// cleanStaleSockets removes the stale socket files among errs with
+// --clean-stale and returns the remaining errors, including those removing
+// them. Without --clean-stale errs is returned as is.
+func cleanStaleSockets(errs []error) []error {
+	if !cleanStale {
+		return errs
+	}
+	var result []error
+	for _, err := range errs {
+		var stale *staleSocketError
+		if !errors.As(err, &stale) {
+			result = append(result, err)
+			continue
+		}
+		if dryRun {
+			if !quiet && !machineOutput() {
+				fmt.Printf("Would remove stale socket %s\n", stale.Path)
+			}
+			continue
+		}
+		if err := os.Remove(stale.Path); err != nil {
+			result = append(result, fmt.Errorf("%s: removing stale socket: %w", stale.Source, err))
+			continue
+		}
+		if !quiet && !machineOutput() {
+			fmt.Printf("Removed stale socket %s\n", stale.Path)
+		}
+	}
+	return result
+}
+
+// cleanReleasedSockets removes the socket files of targets that refuse
+// connections once they are killed, which a killed server may leave
+// behind. Signals other than TERM are not waited on, so each socket gets
+// up to --timeout to be released.
+func cleanReleasedSockets(targets []target) {
+	ctx, stop := interruptible()
+	defer stop()
+	for _, t := range targets {
+		for _, path := range t.Sockets() {
+			if ctx.Err() != nil {
+				return
+			}
+			if !ports.IsSocketFile(path) || !socketReleased(ctx, path, timeout) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: removing stale socket: %v\n", err)
+				continue
+			}
+			if !quiet && !machineOutput() {
+				fmt.Printf("Removed stale socket %s\n", path)
+			}
+		}
+	}
+}
+
+// socketReleased polls until the socket at path refuses connections,
+// giving up after wait or when ctx is done
+func socketReleased(ctx context.Context, path string, wait time.Duration) bool {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	for {
+		if ports.SocketStale(path) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case <-poll.C:
+		}
+	}
+}
+
+// readEntries parses kill targets from r: a JSON array, NDJSON, or lines
+// of whitespace-separated ports, ranges, @groups, host:port, socket paths
+// and pid:N
+func readEntries(r io.Reader) ([]stdinEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %w", err)
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseJSONEntries(trimmed)
+	}
+	return parseTextEntries(string(data))
+}
+
+// parseTextEntries parses one or more targets per line. Blank lines and
+// lines starting with # are skipped.
+func parseTextEntries(data string) ([]stdinEntry, error) {
+	var entries []stdinEntry
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		source := fmt.Sprintf("stdin line %d", i+1)
+		for _, field := range strings.Fields(line) {
+			entry, err := parseEntry(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", source, err)
+			}
+			entry.Source = source
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseEntry parses a single text target
+func parseEntry(s string) (stdinEntry, error) {
+	if len(s) > 4 && strings.EqualFold(s[:4], "pid:") {
+		pid, err := strconv.Atoi(s[4:])
+		if err != nil || pid < 1 {
+			return stdinEntry{}, fmt.Errorf("invalid PID: %s", s[4:])
+		}
+		return stdinEntry{PID: pid}, nil
+	}
+
+	if isSocketArg(s) {
+		return socketEntry(s)
+	}
+
+	// host:port selects the listeners on port that accept connections to
+	// host; *:port and :port select by port alone
+	if host, portStr, err := net.SplitHostPort(s); err == nil {
+		port, err := parsePort(portStr)
+		if err != nil {
+			return stdinEntry{}, err
+		}
+		if host == "*" {
+			host = ""
+		}
+		return stdinEntry{Ports: []int{port}, Host: host}, nil
+	}
+
+	portList, err := expandPortArgs([]string{s})
+	if err != nil {
+		return stdinEntry{}, err
+	}
+	return stdinEntry{Ports: portList}, nil
+}
+
+// lookupHost returns the addresses of host, an IP address or a name such
+// as localhost
+func lookupHost(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", host, err)
+	}
+	return ips, nil
+}
+
+// acceptsOnAny reports whether l accepts connections to one of ips, or to
+// any address if ips is empty
+func acceptsOnAny(l ports.PortInfo, ips []net.IP) bool {
+	if len(ips) == 0 {
+		return true
+	}
+	for _, ip := range ips {
+		if l.AcceptsOn(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJSONEntries parses a JSON array of records, a stream of records
+// (NDJSON) or a stream of arrays
+func parseJSONEntries(data []byte) ([]stdinEntry, error) {
+	var entries []stdinEntry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid JSON on stdin: %w", err)
+		}
+
+		var records []stdinRecord
+		if raw[0] == '[' {
+			if err := json.Unmarshal(raw, &records); err != nil {
+				return nil, fmt.Errorf("invalid JSON on stdin: %w", err)
+			}
+		} else {
+			var rec stdinRecord
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return nil, fmt.Errorf("invalid JSON on stdin: %w", err)
+			}
+			records = append(records, rec)
+		}
+
+		for _, rec := range records {
+			source := fmt.Sprintf("stdin record %d", len(entries)+1)
+			entry, err := rec.entry()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", source, err)
+			}
+			entry.Source = source
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// entry validates a JSON record and converts it to a target
+func (r stdinRecord) entry() (stdinEntry, error) {
+	portList := r.Ports
+	sockets := r.Sockets
+	switch {
+	case r.Proto == "unix" && r.Address != "":
+		sockets = append([]string{r.Address}, sockets...)
+	case r.Port != 0:
+		portList = append([]int{r.Port}, portList...)
+	}
+	for _, port := range portList {
+		if port < 1 || port > 65535 {
+			return stdinEntry{}, fmt.Errorf("invalid port: %d (must be 1-65535)", port)
+		}
+	}
+	if r.PID < 0 {
+		return stdinEntry{}, fmt.Errorf("invalid PID: %d", r.PID)
+	}
+	for _, path := range sockets {
+		if !filepath.IsAbs(path) {
+			return stdinEntry{}, fmt.Errorf("invalid socket path: %s (must be absolute)", path)
+		}
+	}
+	if len(portList) == 0 && len(sockets) == 0 && r.PID == 0 {
+		return stdinEntry{}, errors.New(`record needs a "port", "ports", "sockets" or "pid"`)
+	}
+	entry := stdinEntry{Ports: portList, Sockets: sockets, PID: r.PID}
+	if r.Proto != "unix" && r.Address != "" {
+		// A listing's record names one listener, not whatever accepts
+		// connections to its address
+		entry.Address, entry.Netns = r.Address, r.Netns
+	}
+	return entry, nil
+}
+
+// boundTo reports whether l is bound to address in the network namespace
+// netns, comparing IP addresses by value so ::ffff:127.0.0.1 is 127.0.0.1
+func boundTo(l ports.PortInfo, address, netns string) bool {
+	if l.Netns != netns {
+		return false
+	}
+	a, b := net.ParseIP(l.Address), net.ParseIP(address)
+	if a != nil && b != nil {
+		return a.Equal(b)
+	}
+	return l.Address == address
+}
+
+// resolveEntries finds the processes the entries refer to in scanned. An
+// entry with ports and a PID only matches that process on those ports, so
+// a stale listing cannot kill a process that took over the port. Entries
+// that match nothing are returned as errors, a socket file nothing listens
+// on, which refuses connections, as a *staleSocketError.
+func resolveEntries(entries []stdinEntry, scanned []ports.PortInfo) ([]target, []error) {
+	var listeners []ports.PortInfo
+	var bare []target // PID entries that are not listening
+	var errs []error
+	seen := make(map[ports.ListenerKey]bool)
+	bareSeen := make(map[int]bool)
+
+	add := func(l ports.PortInfo) {
+		if key := l.Key(); !seen[key] {
+			seen[key] = true
+			listeners = append(listeners, l)
+		}
+	}
+
+	for _, e := range entries {
+		if len(e.Ports) == 0 && len(e.Sockets) == 0 {
+			var found bool
+			for _, l := range scanned {
+				if l.PID == e.PID {
+					add(l)
+					found = true
+				}
+			}
+			if found || bareSeen[e.PID] {
+				continue
+			}
+			info, err := killer.ReadProcInfo(e.PID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: no process with PID %d", e.Source, e.PID))
+				continue
+			}
+			bareSeen[e.PID] = true
+			bare = append(bare, target{PID: e.PID, Process: info.Name, User: info.User})
+			continue
+		}
+
+		var hostIPs []net.IP
+		if e.Host != "" && len(e.Ports) > 0 {
+			var err error
+			if hostIPs, err = lookupHost(e.Host); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", e.Source, err))
+				continue
+			}
+		}
+		for _, port := range e.Ports {
+			var matches []ports.PortInfo
+			pidsOnPort := make(map[int]bool)
+			for _, l := range scanned {
+				if l.Port == port && (e.PID == 0 || l.PID == e.PID) && acceptsOnAny(l, hostIPs) &&
+					(e.Address == "" || boundTo(l, e.Address, e.Netns)) {
+					matches = append(matches, l)
+					pidsOnPort[l.PID] = true
+				}
+			}
+			where := fmt.Sprintf("port %d", port)
+			switch {
+			case e.Host != "":
+				where = net.JoinHostPort(e.Host, strconv.Itoa(port))
+			case e.Address != "":
+				where = net.JoinHostPort(e.Address, strconv.Itoa(port))
+			}
+			if e.Netns != "" {
+				where += " in netns " + e.Netns
+			}
+			switch {
+			case len(matches) == 0 && e.PID != 0:
+				errs = append(errs, fmt.Errorf("%s: PID %d is not listening on %s", e.Source, e.PID, where))
+				continue
+			case len(matches) == 0:
+				errs = append(errs, fmt.Errorf("%s: no process listening on %s", e.Source, where))
+				continue
+			case len(pidsOnPort) > 1 && !all:
+				var pidList []string
+				for _, m := range matches {
+					if pid := strconv.Itoa(m.PID); !containsString(pidList, pid) {
+						pidList = append(pidList, pid)
+					}
+				}
+				errs = append(errs, fmt.Errorf("%s: multiple processes on %s: %s. Use --all to kill all",
+					e.Source, where, strings.Join(pidList, ", ")))
+				continue
+			}
+			for _, m := range matches {
+				add(m)
+			}
+		}
+
+		for _, path := range e.Sockets {
+			var matches []ports.PortInfo
+			for _, l := range scanned {
+				if l.Unix() && l.Address == path && (e.PID == 0 || l.PID == e.PID) {
+					matches = append(matches, l)
+				}
+			}
+			switch {
+			case len(matches) == 0 && e.PID != 0:
+				errs = append(errs, fmt.Errorf("%s: PID %d is not listening on %s", e.Source, e.PID, path))
+				continue
+			case len(matches) == 0 && ports.IsSocketFile(path) && ports.SocketStale(path):
+				errs = append(errs, &staleSocketError{Source: e.Source, Path: path})
+				continue
+			case len(matches) == 0 && ports.IsSocketFile(path):
+				errs = append(errs, fmt.Errorf("%s: %s accepts connections, but its listener cannot be seen (another user's, or bound by a relative path)", e.Source, path))
+				continue
+			case len(matches) == 0:
+				errs = append(errs, fmt.Errorf("%s: no process listening on %s", e.Source, path))
+				continue
+			}
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	}
+
+	targets := groupByPID(listeners)
+	for _, t := range bare {
+		if !containsPID(listeners, t.PID) {
+			targets = append(targets, t)
+		}
+	}
+	return targets, errs
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// withStdin replaces os.Stdin with a pipe containing data
+func withStdin(t *testing.T, data string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = orig
+		r.Close()
+	})
+	go func() {
+		_, _ = w.WriteString(data)
+		w.Close()
+	}()
+}
+
+// withTTY makes confirmations read answers, or fail to open a terminal
+// when answers is empty
+func withTTY(t *testing.T, answers string) {
+	t.Helper()
+	orig := openTTY
+	openTTY = func() (io.ReadCloser, error) {
+		if answers == "" {
+			return nil, errors.New("no such device")
+		}
+		return io.NopCloser(strings.NewReader(answers)), nil
+	}
+	t.Cleanup(func() { openTTY = orig })
+}
+
+func TestUsesStdin(t *testing.T) {
+	orig := readStdin
+	t.Cleanup(func() { readStdin = orig })
+
+	readStdin = false
+	if usesStdin([]string{"3000"}) {
+		t.Error("ports alone should not read stdin")
+	}
+	if !usesStdin([]string{"3000", "-"}) {
+		t.Error("- should read stdin")
+	}
+	readStdin = true
+	if !usesStdin(nil) {
+		t.Error("--stdin should read stdin")
+	}
+}
+
+func TestParseTextEntries(t *testing.T) {
+	input := `# ports to free
+3000
+8080 9000-9001
+127.0.0.1:5173
+[::1]:5432   *:6379
+pid:1234
+
+PID:42
+`
+	entries, err := parseTextEntries(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []stdinEntry{
+		{Source: "stdin line 2", Ports: []int{3000}},
+		{Source: "stdin line 3", Ports: []int{8080}},
+		{Source: "stdin line 3", Ports: []int{9000, 9001}},
+		{Source: "stdin line 4", Ports: []int{5173}, Host: "127.0.0.1"},
+		{Source: "stdin line 5", Ports: []int{5432}, Host: "::1"},
+		{Source: "stdin line 5", Ports: []int{6379}},
+		{Source: "stdin line 6", PID: 1234},
+		{Source: "stdin line 8", PID: 42},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", entries, want)
+	}
+}
+
+func TestParseTextEntriesErrors(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"3000\n70000\n", "stdin line 2: invalid port: 70000"},
+		{"host:http\n", "invalid port: http"},
+		{"pid:abc\n", "invalid PID: abc"},
+		{"pid:0\n", "invalid PID: 0"},
+		{"node\n", "invalid port: node"},
+	}
+	for _, tt := range tests {
+		_, err := parseTextEntries(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseTextEntries(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestParseJSONEntries(t *testing.T) {
+	// The exact output of --list --json
+	listJSON := captureStdout(t, func() {
+		if err := printPorts(targetTestPorts[:2], nil, output.Options{Format: output.JSON}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		want  []stdinEntry
+	}{
+		{"list output", listJSON, []stdinEntry{
+			{Source: "stdin record 1", Ports: []int{3000}, PID: 9000100},
+			{Source: "stdin record 2", Ports: []int{5173}, PID: 9000200},
+		}},
+		{"ndjson", "{\"port\": 3000}\n{\"pid\": 42}\n", []stdinEntry{
+			{Source: "stdin record 1", Ports: []int{3000}},
+			{Source: "stdin record 2", PID: 42},
+		}},
+		{"kill results", `[{"pid": 7, "ports": [80, 443], "status": "would_kill"}]`, []stdinEntry{
+			{Source: "stdin record 1", Ports: []int{80, 443}, PID: 7},
+		}},
+		{"stream of arrays", "[{\"port\": 1}]\n[{\"port\": 2}]", []stdinEntry{
+			{Source: "stdin record 1", Ports: []int{1}},
+			{Source: "stdin record 2", Ports: []int{2}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := readEntries(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONEntriesErrors(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`[{"port": 3000}, {"process": "node"}]`, `stdin record 2: record needs a "port", "ports", "sockets" or "pid"`},
+		{`{"port": 0, "ports": [70000]}`, "invalid port: 70000"},
+		{`{"pid": -1}`, "invalid PID"},
+		{`[{"port": 3000}`, "invalid JSON"},
+		{`{"port": "3000"}`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		_, err := readEntries(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("readEntries(%s) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestResolveEntries(t *testing.T) {
+	orig := all
+	t.Cleanup(func() { all = orig })
+	all = false
+
+	scanned := append([]ports.PortInfo{}, targetTestPorts...)
+	scanned = append(scanned, ports.PortInfo{Port: 3000, PID: 9000500, Process: "deno", Proto: "tcp6"})
+
+	entries := []stdinEntry{
+		{Source: "stdin line 1", Ports: []int{5173}},
+		{Source: "stdin line 2", Ports: []int{5174, 5173}},         // same process again
+		{Source: "stdin line 3", PID: 9000300},                     // by PID, listening
+		{Source: "stdin line 4", PID: os.Getpid()},                 // by PID, not listening
+		{Source: "stdin line 5", Ports: []int{8080}, PID: 9000100}, // stale listing
+		{Source: "stdin line 6", Ports: []int{3000}},               // two processes
+		{Source: "stdin line 7", Ports: []int{4000}},
+		{Source: "stdin line 8", PID: 999999999},
+	}
+	targets, errs := resolveEntries(entries, scanned)
+
+	var got []string
+	for _, tgt := range targets {
+		got = append(got, strconv.Itoa(tgt.PID)+":"+describePorts(tgt.Ports()))
+	}
+	want := []string{"9000200:ports 5173, 5174", "9000300:port 8080", strconv.Itoa(os.Getpid()) + ":ports "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	wantErrs := []string{
+		"stdin line 5: PID 9000100 is not listening on port 8080",
+		"stdin line 6: multiple processes on port 3000: 9000100, 9000500. Use --all to kill all",
+		"stdin line 7: no process listening on port 4000",
+		"stdin line 8: no process with PID 999999999",
+	}
+	if !reflect.DeepEqual(msgs, wantErrs) {
+		t.Errorf("errors =\n%s\nwant\n%s", strings.Join(msgs, "\n"), strings.Join(wantErrs, "\n"))
+	}
+
+	all = true
+	targets, errs = resolveEntries([]stdinEntry{{Source: "stdin line 1", Ports: []int{3000}}}, scanned)
+	if len(targets) != 2 || len(errs) != 0 {
+		t.Errorf("--all: targets = %+v, errs = %v", targets, errs)
+	}
+}
+
+func TestResolveHostEntries(t *testing.T) {
+	scanned := []ports.PortInfo{
+		{Port: 5432, PID: 9000100, Process: "postgres", Proto: "tcp", Address: "127.0.0.1"},
+		{Port: 5432, PID: 9000200, Process: "postgres", Proto: "tcp6", Address: "::1"},
+		{Port: 8080, PID: 9000300, Process: "java", Proto: "tcp", Address: "0.0.0.0"},
+		{Port: 9000, PID: 9000400, Process: "node", Proto: "tcp", Address: "192.168.1.5"},
+	}
+	tests := []struct {
+		input string
+		want  int // PID, or 0 for an error
+		err   string
+	}{
+		{"127.0.0.1:5432", 9000100, ""},
+		{"[::1]:5432", 9000200, ""},
+		{"[::ffff:127.0.0.1]:5432", 9000100, ""},
+		{"10.0.0.5:8080", 9000300, ""},
+		{"[::1]:8080", 0, "no process listening on [::1]:8080"},
+		{"127.0.0.1:9000", 0, "no process listening on 127.0.0.1:9000"},
+		{"*:9000", 9000400, ""},
+	}
+	for _, tt := range tests {
+		e, err := parseEntry(tt.input)
+		if err != nil {
+			t.Fatalf("parseEntry(%q) error: %v", tt.input, err)
+		}
+		e.Source = "stdin line 1"
+		targets, errs := resolveEntries([]stdinEntry{e}, scanned)
+		switch {
+		case tt.want != 0 && (len(targets) != 1 || targets[0].PID != tt.want || len(errs) != 0):
+			t.Errorf("%s: targets = %+v, errs = %v; want PID %d", tt.input, targets, errs, tt.want)
+		case tt.want == 0 && (len(targets) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.err)):
+			t.Errorf("%s: targets = %+v, errs = %v; want %q", tt.input, targets, errs, tt.err)
+		}
+	}
+}
+
+func TestResolveRecordAddresses(t *testing.T) {
+	scanned := []ports.PortInfo{
+		{Port: 8080, PID: 9000100, Process: "node", Proto: "tcp", Address: "127.0.0.1"},
+		{Port: 8080, PID: 9000200, Process: "java", Proto: "tcp", Address: "0.0.0.0"},
+		{Port: 8080, PID: 9000300, Process: "nginx", Proto: "tcp", Address: "127.0.0.1", Netns: "blue"},
+	}
+	tests := []struct {
+		input string
+		want  int // PID, or 0 for an error
+		err   string
+	}{
+		{`{"port": 8080, "proto": "tcp", "address": "127.0.0.1"}`, 9000100, ""},
+		{`{"port": 8080, "proto": "tcp", "address": "::ffff:127.0.0.1"}`, 9000100, ""},
+		{`{"port": 8080, "proto": "tcp", "address": "0.0.0.0"}`, 9000200, ""},
+		{`{"port": 8080, "proto": "tcp", "address": "127.0.0.1", "netns": "blue"}`, 9000300, ""},
+		{`{"port": 8080, "proto": "tcp6", "address": "::"}`, 0, "no process listening on [::]:8080"},
+		{`{"port": 8080, "proto": "tcp", "address": "10.0.0.5", "netns": "blue"}`, 0, "no process listening on 10.0.0.5:8080 in netns blue"},
+	}
+	for _, tt := range tests {
+		entries, err := readEntries(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("readEntries(%s) error: %v", tt.input, err)
+		}
+		targets, errs := resolveEntries(entries, scanned)
+		switch {
+		case tt.want != 0 && (len(targets) != 1 || targets[0].PID != tt.want || len(errs) != 0):
+			t.Errorf("%s: targets = %+v, errs = %v; want PID %d", tt.input, targets, errs, tt.want)
+		case tt.want == 0 && (len(targets) != 0 || len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.err)):
+			t.Errorf("%s: targets = %+v, errs = %v; want %q", tt.input, targets, errs, tt.err)
+		}
+	}
+}
+
+func TestKillFromStdinErrors(t *testing.T) {
+	sig, _ := killer.ParseSignal("TERM")
+
+	t.Run("json needs force", func(t *testing.T) {
+		setKillFlags(t, false, false, true, false)
+		withStdin(t, "3000\n")
+		if err := killFromStdin([]string{"-"}, sig); err == nil || !strings.Contains(err.Error(), "--json requires") {
+			t.Errorf("error = %v", err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		setKillFlags(t, true, false, false, false)
+		withStdin(t, "# nothing\n")
+		if err := killFromStdin([]string{"-"}, sig); err == nil || !strings.Contains(err.Error(), "no targets") {
+			t.Errorf("error = %v", err)
+		}
+	})
+
+	t.Run("invalid entry", func(t *testing.T) {
+		setKillFlags(t, true, false, false, false)
+		withStdin(t, "3000\nbogus\n")
+		if err := killFromStdin([]string{"-"}, sig); err == nil || !strings.Contains(err.Error(), "stdin line 2") {
+			t.Errorf("error = %v", err)
+		}
+	})
+
+	t.Run("no terminal", func(t *testing.T) {
+		setKillFlags(t, false, false, false, false)
+		withStdin(t, "3000\n")
+		withTTY(t, "")
+		if err := killFromStdin([]string{"-"}, sig); err == nil || !strings.Contains(err.Error(), "use --force") {
+			t.Errorf("error = %v", err)
+		}
+	})
+}
+
+func TestKillFromStdinDryRunJSON(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, true, false, true, false)
+	port := listenLocal(t)
+
+	// A listing piped back in, plus a port that is not listening
+	listJSON := captureStdout(t, func() {
+		_ = printPorts([]ports.PortInfo{{Port: port, PID: os.Getpid()}, {Port: 1}}, nil, output.Options{Format: output.JSON})
+	})
+	withStdin(t, listJSON)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() { err = killFromStdin([]string{"-"}, sig) })
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 targets could not be found") {
+		t.Errorf("error = %v", err)
+	}
+
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 1 || results[0].Status != "protected" || !reflect.DeepEqual(results[0].Ports, []int{port}) {
+		t.Errorf("results = %+v, want this process, protected", results)
+	}
+}
+
+func TestKillArgumentsStdinJSON(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping port scan in short mode")
+	}
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, true, false, true, false)
+	port := listenLocal(t)
+	withStdin(t, strconv.Itoa(port)+"\n")
+
+	// echo PORT | tsunami - --json --dry-run reaches the target path
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() { err = killArguments([]string{"-"}, sig) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Ports, []int{port}) {
+		t.Errorf("results = %+v, want this process on port %d", results, port)
+	}
+}
+
+func TestKillFromStdinConfirmsOnTTY(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, false, false, false, false)
+	sig, _ := killer.ParseSignal("KILL")
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start sleep: %v", err)
+	}
+	done := make(chan struct{})
+	go func() { _ = cmd.Wait(); close(done) }()
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	pid := strconv.Itoa(cmd.Process.Pid)
+
+	// Declined on the terminal: nothing happens
+	withStdin(t, "pid:"+pid+"\n")
+	withTTY(t, "n\n")
+	output := captureStdout(t, func() {
+		if err := killFromStdin([]string{"-"}, sig); err != nil {
+			t.Errorf("killFromStdin: %v", err)
+		}
+	})
+	if !strings.Contains(output, "sleep (PID "+pid+", not listening)") || !strings.Contains(output, "Kill 1 process? [y/N]") {
+		t.Errorf("output:\n%s", output)
+	}
+	if confirmInput != nil {
+		t.Error("confirmInput should be reset")
+	}
+	select {
+	case <-done:
+		t.Fatal("process was killed after answering no")
+	default:
+	}
+
+	// Confirmed on the terminal
+	withStdin(t, "pid:"+pid+"\n")
+	withTTY(t, "y\n")
+	output = captureStdout(t, func() {
+		if err := killFromStdin([]string{"-"}, sig); err != nil {
+			t.Errorf("killFromStdin: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Killed sleep (PID "+pid+")") {
+		t.Errorf("output:\n%s", output)
+	}
+	<-done
+}
+
+func TestStdinFlag(t *testing.T) {
+	if rootCmd.Flags().Lookup("stdin") == nil {
+		t.Error("missing --stdin flag")
+	}
+}
+
+func TestSocketEntries(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"/run/app.sock", []string{"/run/app.sock"}},
+		{"./app.sock", []string{filepath.Join(cwd, "app.sock")}},
+		{"/run/../run/php/fpm.sock", []string{"/run/php/fpm.sock"}},
+		{"unix:app.sock", []string{filepath.Join(cwd, "app.sock")}},
+		{"unix:@/tmp/.X11-unix/X0", []string{"@/tmp/.X11-unix/X0"}},
+	}
+	for _, tt := range tests {
+		entry, err := parseEntry(tt.input)
+		if err != nil || !reflect.DeepEqual(entry.Sockets, tt.want) || len(entry.Ports) != 0 {
+			t.Errorf("parseEntry(%q) = %+v, %v; want sockets %v", tt.input, entry, err, tt.want)
+		}
+	}
+	for _, input := range []string{"unix:", "3000/tcp"} {
+		if entry, err := parseEntry(input); err == nil {
+			t.Errorf("parseEntry(%q) = %+v, want an error", input, entry)
+		}
+	}
+
+	// A bare name is a socket only if a socket file has it
+	dir := t.TempDir()
+	staleSocket(t, filepath.Join(dir, "app.sock"))
+	t.Chdir(dir)
+	if entry, err := parseEntry("app.sock"); err != nil || !reflect.DeepEqual(entry.Sockets, []string{filepath.Join(dir, "app.sock")}) {
+		t.Errorf("parseEntry(app.sock) = %+v, %v", entry, err)
+	}
+	if _, err := parseEntry("other.sock"); err == nil {
+		t.Error("parseEntry(other.sock) without the file should not be a socket")
+	}
+
+	entries, err := argumentEntries([]string{"3000", "/run/app.sock"})
+	if err != nil || len(entries) != 2 || !reflect.DeepEqual(entries[0].Sockets, []string{"/run/app.sock"}) || !reflect.DeepEqual(entries[1].Ports, []int{3000}) {
+		t.Errorf("argumentEntries = %+v, %v", entries, err)
+	}
+
+	// --list --json records of Unix sockets and --json kill results
+	entries, err = readEntries(strings.NewReader(`[{"port": 0, "pid": 7, "proto": "unix", "address": "/run/app.sock"}, {"pid": 8, "ports": [], "sockets": ["/run/b.sock"]}]`))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("readEntries = %+v, %v", entries, err)
+	}
+	if !reflect.DeepEqual(entries[0].Sockets, []string{"/run/app.sock"}) || entries[0].PID != 7 || len(entries[0].Ports) != 0 {
+		t.Errorf("list record = %+v", entries[0])
+	}
+	if !reflect.DeepEqual(entries[1].Sockets, []string{"/run/b.sock"}) || entries[1].PID != 8 {
+		t.Errorf("result record = %+v", entries[1])
+	}
+	if _, err := readEntries(strings.NewReader(`{"sockets": ["app.sock"]}`)); err == nil || !strings.Contains(err.Error(), "must be absolute") {
+		t.Errorf("relative socket path error = %v", err)
+	}
+}
+
+// staleSocket leaves a socket file at path that nothing listens on
+func staleSocket(t *testing.T, path string) {
+	t.Helper()
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+}
+
+func TestSocketReleased(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.sock")
+	staleSocket(t, stale)
+	if !socketReleased(context.Background(), stale, time.Second) {
+		t.Error("socketReleased(stale socket) = false")
+	}
+
+	live := filepath.Join(dir, "live.sock")
+	ln, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if socketReleased(ctx, live, time.Minute) {
+		t.Error("socketReleased(live socket) = true")
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Errorf("socketReleased waited %s after an interrupt", waited)
+	}
+}
+
+func TestResolveSocketEntries(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.sock")
+	staleSocket(t, stale)
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A listener the scan misses, e.g. another user's, is not stale
+	hidden := filepath.Join(dir, "hidden.sock")
+	ln, err := net.Listen("unix", hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	scanned := []ports.PortInfo{
+		{PID: 9000700, Process: "gunicorn", Proto: "unix", Address: "/run/app.sock"},
+		{Port: 8000, PID: 9000700, Process: "gunicorn", Proto: "tcp"},
+	}
+	entries := []stdinEntry{
+		{Source: "argument", Sockets: []string{"/run/app.sock"}},
+		{Source: "stdin line 2", Sockets: []string{"/run/app.sock"}, PID: 9000800},
+		{Source: "stdin line 3", Sockets: []string{stale}},
+		{Source: "stdin line 4", Sockets: []string{plain}},
+		{Source: "stdin line 5", Sockets: []string{hidden}},
+	}
+	targets, errs := resolveEntries(entries, scanned)
+	if len(targets) != 1 || targets[0].PID != 9000700 || describeListeners(targets[0].Listeners) != "/run/app.sock" {
+		t.Errorf("targets = %+v", targets)
+	}
+
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	wantErrs := []string{
+		"stdin line 2: PID 9000800 is not listening on /run/app.sock",
+		"stdin line 3: no process listening on " + stale + "; the socket file is stale (remove it with --clean-stale)",
+		"stdin line 4: no process listening on " + plain,
+		"stdin line 5: " + hidden + " accepts connections, but its listener cannot be seen (another user's, or bound by a relative path)",
+	}
+	if !reflect.DeepEqual(msgs, wantErrs) {
+		t.Errorf("errors =\n%s\nwant\n%s", strings.Join(msgs, "\n"), strings.Join(wantErrs, "\n"))
+	}
+}
+
+func TestCleanStaleSockets(t *testing.T) {
+	setKillFlags(t, false, true, false, false)
+	orig := cleanStale
+	t.Cleanup(func() { cleanStale = orig })
+
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	staleSocket(t, stale)
+	other := errors.New("stdin line 2: no process listening on port 4000")
+	errs := []error{&staleSocketError{Source: "argument", Path: stale}, other}
+
+	cleanStale = false
+	if got := cleanStaleSockets(errs); len(got) != 2 || !ports.IsSocketFile(stale) {
+		t.Errorf("without --clean-stale: %v", got)
+	}
+
+	cleanStale = true
+	dryRun = true
+	output := captureStdout(t, func() {
+		if got := cleanStaleSockets(errs); len(got) != 1 || got[0] != other {
+			t.Errorf("dry run errors = %v", got)
+		}
+	})
+	if output != "Would remove stale socket "+stale+"\n" || !ports.IsSocketFile(stale) {
+		t.Errorf("dry run output = %q", output)
+	}
+
+	dryRun = false
+	output = captureStdout(t, func() {
+		if got := cleanStaleSockets(errs); len(got) != 1 || got[0] != other {
+			t.Errorf("errors = %v", got)
+		}
+	})
+	if output != "Removed stale socket "+stale+"\n" || ports.IsSocketFile(stale) {
+		t.Errorf("output = %q, socket still there: %v", output, ports.IsSocketFile(stale))
+	}
+}
+
+func TestKillSocketCleansStale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("Unix socket listeners are only scanned on Linux")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("needs python3")
+	}
+	withPolicy(t, killer.NewPolicy())
+	setKillFlags(t, false, true, false, false)
+	orig := cleanStale
+	t.Cleanup(func() { cleanStale = orig })
+	cleanStale = true
+
+	// SIGKILL leaves the socket file behind
+	path := filepath.Join(t.TempDir(), "app.sock")
+	script := "import socket, sys, time\n" +
+		"s = socket.socket(socket.AF_UNIX)\ns.bind(sys.argv[1])\ns.listen()\n" +
+		"print('ready', flush=True)\ntime.sleep(60)\n"
+	cmd := exec.Command("python3", "-c", script, path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() { _ = cmd.Wait(); close(done) }()
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	if _, err := io.ReadFull(stdout, make([]byte, 6)); err != nil {
+		t.Fatalf("listener did not start: %v", err)
+	}
+
+	sig, _ := killer.ParseSignal("KILL")
+	output := captureStdout(t, func() {
+		if err := killArguments([]string{path}, sig); err != nil {
+			t.Errorf("killArguments: %v", err)
+		}
+	})
+	<-done
+	want := "Killed python3 (PID " + strconv.Itoa(cmd.Process.Pid) + ") on " + path
+	if !strings.Contains(output, want) || !strings.Contains(output, "Removed stale socket "+path) {
+		t.Errorf("output:\n%s\nwant %q and the socket removed", output, want)
+	}
+	if ports.IsSocketFile(path) {
+		t.Error("socket file left behind")
+	}
+
+	// Killing it again only finds the file gone
+	if err := killArguments([]string{path}, sig); err == nil || !strings.Contains(err.Error(), "none of the 1 targets") {
+		t.Errorf("second kill error = %v", err)
+	}
+}
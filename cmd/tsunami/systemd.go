@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/systemd"
+)
+
+// processOnly kills processes that belong to a systemd unit instead of
+// stopping the unit
+var processOnly bool
+
+// annotateUnits finds the socket units of listeners held by the service
+// manager and the restart policy of every unit. It is best effort: without
+// systemctl the units from the cgroups are listed as they are.
+func annotateUnits(ctx context.Context, list []ports.PortInfo) {
+	_ = systemd.Annotate(ctx, list)
+}
+
+// targetUnits returns the units to stop in place of killing t: its
+// service, or the socket units of the ports the service manager holds for
+// it. It is nil for a process that is killed as usual.
+func targetUnits(t target) []ports.Unit {
+	var result []ports.Unit
+	seen := make(map[string]bool)
+	for _, l := range t.Listeners {
+		u := stoppable(l)
+		if u == nil || seen[systemd.Describe(*u)] {
+			continue
+		}
+		seen[systemd.Describe(*u)] = true
+		result = append(result, *u)
+	}
+	return result
+}
+
+// stoppable returns the unit to stop in place of killing p, or nil if p
+// is killed as usual or --process-only was given
+func stoppable(p ports.PortInfo) *ports.Unit {
+	if processOnly {
+		return nil
+	}
+	return systemd.Stoppable(p)
+}
+
+// oneListenerPerUnit drops all but the first listener of each unit to be
+// stopped, such as a socket's IPv4 and IPv6 addresses or a service's
+// workers sharing a port
+func oneListenerPerUnit(list []ports.PortInfo) []ports.PortInfo {
+	var result []ports.PortInfo
+	seen := make(map[string]bool)
+	for _, p := range list {
+		if u := stoppable(p); u != nil {
+			if seen[systemd.Describe(*u)] {
+				continue
+			}
+			seen[systemd.Describe(*u)] = true
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// describeUnit names u with its restart policy when it has one, e.g.
+// "unit nginx.service (Restart=always)"
+func describeUnit(u ports.Unit) string {
+	if u.Restart == "" || u.Restart == "no" {
+		return systemd.Describe(u)
+	}
+	return systemd.Describe(u) + " (Restart=" + u.Restart + ")"
+}
+
+// stopUnit stops u with systemctl. Signals other than TERM are sent to the
+// unit's processes with systemctl kill.
+func stopUnit(u ports.Unit, sig killer.Signal) error {
+	ctx, stop := interruptible()
+	defer stop()
+	var err error
+	if sig == killer.SIGTERM {
+		err = systemd.Stop(ctx, u)
+	} else {
+		err = systemd.Kill(ctx, u, string(sig))
+	}
+	return interruptErr(ctx, err)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// unitTestPorts are nginx, a service that restarts, on ports 80 and 443,
+// and cups.socket held by PID 1 on IPv4 and IPv6
+var unitTestPorts = []ports.PortInfo{
+	{Port: 80, PID: 9000600, Process: "nginx", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "nginx.service", Restart: "always"}},
+	{Port: 443, PID: 9000600, Process: "nginx", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "nginx.service", Restart: "always"}},
+	{Port: 631, PID: 1, Process: "systemd", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "cups.socket", Activates: []string{"cups.service"}}},
+	{Port: 631, PID: 1, Process: "systemd", User: "root", Proto: "tcp6",
+		Unit: &ports.Unit{Name: "cups.socket", Activates: []string{"cups.service"}}},
+}
+
+// fakeSystemctl puts a systemctl that only logs its arguments first on
+// PATH and returns the logged invocations
+func fakeSystemctl(t *testing.T) func() []string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\necho \"$*\" >> " + log + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() []string {
+		data, _ := os.ReadFile(log)
+		if len(data) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+}
+
+func TestKillTargetsStopsUnits(t *testing.T) {
+	calls := fakeSystemctl(t)
+	setKillFlags(t, false, true, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(unitTestPorts), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets error: %v", err)
+	}
+	for _, want := range []string{
+		"Stopped unit nginx.service (Restart=always) on ports 80, 443",
+		"Stopped unit cups.socket on port 631",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Killed") {
+		t.Errorf("the unit processes should not be killed:\n%s", output)
+	}
+	want := "stop -- nginx.service\nstop -- cups.socket cups.service"
+	if got := strings.Join(calls(), "\n"); got != want {
+		t.Errorf("systemctl calls = %q, want %q", got, want)
+	}
+}
+
+func TestKillTargetsUnitDryRun(t *testing.T) {
+	calls := fakeSystemctl(t)
+	setKillFlags(t, true, false, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	targets := groupByPID(append([]ports.PortInfo{targetTestPorts[0]}, unitTestPorts...))
+	output := captureStdout(t, func() {
+		if err := killTargets(targets, sig); err != nil {
+			t.Errorf("killTargets error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Would stop 2 units and kill 1 process with signal TERM") {
+		t.Errorf("dry-run output:\n%s", output)
+	}
+
+	setKillFlags(t, true, false, true, false)
+	output = captureStdout(t, func() {
+		_ = killTargets(targets, sig)
+	})
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 3 || results[0].Status != "would_kill" ||
+		results[1].Status != "would_stop" || strings.Join(results[1].Units, ",") != "nginx.service" ||
+		results[2].Status != "would_stop" || strings.Join(results[2].Units, ",") != "cups.socket" {
+		t.Errorf("results = %+v", results)
+	}
+	if got := calls(); got != nil {
+		t.Errorf("a dry run ran systemctl: %q", got)
+	}
+}
+
+func TestKillProcessStopsUnit(t *testing.T) {
+	calls := fakeSystemctl(t)
+	setKillFlags(t, false, true, false, false)
+
+	sig, _ := killer.ParseSignal("HUP")
+	output := captureStdout(t, func() {
+		if err := killProcess(unitTestPorts[0], 80, sig); err != nil {
+			t.Errorf("killProcess error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Stopped unit nginx.service (Restart=always) on port 80") {
+		t.Errorf("output = %q", output)
+	}
+	if got := strings.Join(calls(), "\n"); got != "kill --signal=SIGHUP -- nginx.service" {
+		t.Errorf("systemctl calls = %q", got)
+	}
+}
+
+func TestProcessOnly(t *testing.T) {
+	calls := fakeSystemctl(t)
+	setKillFlags(t, true, false, false, false)
+	processOnly = true
+	t.Cleanup(func() { processOnly = false })
+
+	sig, _ := killer.ParseSignal("TERM")
+	output := captureStdout(t, func() {
+		if err := killTargets(groupByPID(unitTestPorts[:2]), sig); err != nil {
+			t.Errorf("killTargets error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Would kill") || strings.Contains(output, "stop") {
+		t.Errorf("--process-only dry-run output:\n%s", output)
+	}
+	if got := oneListenerPerUnit(unitTestPorts); len(got) != len(unitTestPorts) {
+		t.Errorf("oneListenerPerUnit with --process-only = %+v", got)
+	}
+	if got := calls(); got != nil {
+		t.Errorf("--process-only ran systemctl: %q", got)
+	}
+}
+
+func TestProtectedSocketUnit(t *testing.T) {
+	setKillFlags(t, true, false, false, false)
+	ssh := ports.PortInfo{Port: 22, PID: 1, Process: "systemd", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "ssh.socket", Activates: []string{"ssh.service"}}}
+	err := killProcess(ssh, 22, killer.SIGTERM)
+	if err == nil || !strings.Contains(err.Error(), "SSH server") {
+		t.Errorf("killProcess(ssh.socket) error = %v, want it protected", err)
+	}
+
+	// Without a socket unit the listener is PID 1 itself
+	ssh.Unit = nil
+	err = killProcess(ssh, 22, killer.SIGTERM)
+	if err == nil || !strings.Contains(err.Error(), "init process") {
+		t.Errorf("killProcess(PID 1) error = %v, want it protected", err)
+	}
+}
+
+func TestOneListenerPerUnit(t *testing.T) {
+	list := append([]ports.PortInfo{targetTestPorts[0]}, unitTestPorts...)
+	got := oneListenerPerUnit(list)
+	if len(got) != 3 || got[1].Port != 80 || got[2].Port != 631 || got[2].Proto != "tcp" {
+		t.Errorf("oneListenerPerUnit = %+v", got)
+	}
+}
+
+func TestPortRecordUnit(t *testing.T) {
+	data, err := json.Marshal(newPortRecord(unitTestPorts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"unit":{"name":"nginx.service","restart":"always"}`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("record = %s, want it to contain %s", data, want)
+	}
+}
+
+func TestDescribeKill(t *testing.T) {
+	tests := []struct {
+		processes, containers, units int
+		want                         string
+	}{
+		{2, 0, 0, "kill 2 processes"},
+		{0, 1, 0, "stop 1 container"},
+		{1, 0, 2, "stop 2 units and kill 1 process"},
+		{2, 1, 1, "stop 1 container and 1 unit, and kill 2 processes"},
+	}
+	for _, tt := range tests {
+		if got := describeKill(tt.processes, tt.containers, tt.units); got != tt.want {
+			t.Errorf("describeKill(%d, %d, %d) = %q, want %q", tt.processes, tt.containers, tt.units, got, tt.want)
+		}
+	}
+}
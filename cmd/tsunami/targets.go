@@ -0,0 +1,638 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/docker"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/query"
+	"github.com/wusher/tsunami/internal/respawn"
+	"github.com/wusher/tsunami/internal/systemd"
+)
+
+// killCap is the most processes a single --name/--user/--match kill may
+// target without --yes-really
+var killCap = 10
+
+// targetColumns are shown when listing matched listeners before a kill
+var targetColumns = []string{"port", "pid", "process", "user", "conns", "cmdline"}
+
+// target is one process selected for killing, with every listener it owns
+type target struct {
+	PID       int
+	Process   string
+	User      string
+	Cmdline   string
+	Listeners []ports.PortInfo
+
+	// Clients are the connections of a target killed for being a client
+	// of a port, by `tsunami clients --kill`
+	Clients []ports.Client
+}
+
+// Ports returns the ports the target listens on
+func (t target) Ports() []int {
+	result := make([]int, 0, len(t.Listeners))
+	for _, l := range t.Listeners {
+		if !l.Unix() {
+			result = append(result, l.Port)
+		}
+	}
+	return result
+}
+
+// Sockets returns the paths of the Unix sockets the target listens on
+func (t target) Sockets() []string {
+	var result []string
+	for _, l := range t.Listeners {
+		if l.Unix() {
+			result = append(result, l.Address)
+		}
+	}
+	return result
+}
+
+// ConnectedTo returns the ports a client target is connected to
+func (t target) ConnectedTo() []int {
+	var result []int
+	seen := make(map[int]bool)
+	for _, c := range t.Clients {
+		if !seen[c.Port] {
+			seen[c.Port] = true
+			result = append(result, c.Port)
+		}
+	}
+	return result
+}
+
+// targetResult is the machine-readable record for one target
+type targetResult struct {
+	PID     int    `json:"pid" yaml:"pid"`
+	Process string `json:"process" yaml:"process"`
+	User    string `json:"user" yaml:"user"`
+	Ports   []int  `json:"ports" yaml:"ports"`
+	// Sockets are the paths of the Unix sockets the target listens on
+	Sockets []string `json:"sockets,omitempty" yaml:"sockets,omitempty"`
+	Cmdline string   `json:"cmdline,omitempty" yaml:"cmdline,omitempty"`
+	// ConnectedTo are the ports a client target is connected to
+	ConnectedTo []int `json:"connected_to,omitempty" yaml:"connected_to,omitempty"`
+	// Containers a docker-proxy target publishes and systemd units a
+	// target belongs to; they are stopped instead
+	Containers []string `json:"containers,omitempty" yaml:"containers,omitempty"`
+	Units      []string `json:"units,omitempty" yaml:"units,omitempty"`
+	Status     string   `json:"status" yaml:"status"` // would_kill, killed, respawned, would_stop, stopped, protected or failed
+	Error      string   `json:"error,omitempty" yaml:"error,omitempty"`
+	// Respawns are the processes that took the ports back after the kill
+	Respawns []respawnRecord `json:"respawns,omitempty" yaml:"respawns,omitempty"`
+}
+
+// addKillFlags binds the flags that control a kill to a subcommand that
+// kills a set of targets
+func addKillFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
+	f.StringVarP(&signal, "signal", "s", "TERM", "Signal to send (TERM, KILL, INT, HUP)")
+	f.DurationVarP(&timeout, "timeout", "t", 2*time.Second, "Time to wait before escalating SIGTERM to SIGKILL")
+	addRespawnWindowFlag(cmd)
+	f.StringVar(&netns, "netns", "", "Look for listeners in the network namespace with this ip netns name, path or member PID")
+	f.BoolVar(&allNetns, "all-netns", false, "Look for listeners in every network namespace")
+	f.BoolVarP(&dryRun, "dry-run", "n", false, "Show what would be killed without killing")
+	f.BoolVar(&processOnly, "process-only", false, "Kill the process itself instead of stopping the systemd unit it belongs to")
+	f.BoolVarP(&quiet, "quiet", "q", false, "Suppress output except errors")
+	f.BoolVarP(&verbose, "verbose", "v", false, "Show progress while waiting for processes to exit")
+	f.BoolVar(&yesReally, "yes-really", false, fmt.Sprintf("Allow killing more than %d processes at once", killCap))
+	f.BoolVar(&overrideProtection, "override-protection", false, "Allow killing protected and forbidden processes")
+	f.StringArrayVar(&protectRules, "protect", nil, "Also protect processes matching name=, port=, user= or path= (can be repeated)")
+	addOutputFlags(cmd, "Output format for results: "+formatNames()+" (machine formats require --force or --dry-run)")
+}
+
+// hasMatchTargeting reports whether --name, --user or --match was given
+func hasMatchTargeting() bool {
+	return nameTarget != "" || userTarget != "" || matchTarget != ""
+}
+
+// killMatching kills every process whose listeners match --name, --user
+// and --match (all given selectors must match)
+func killMatching(sig killer.Signal) error {
+	q, err := query.Parse(matchTarget)
+	if err != nil {
+		return err
+	}
+	if err := checkMachineKill(" when killing by --name, --user or --match"); err != nil {
+		return err
+	}
+
+	scanned, err := scanPorts()
+	if err != nil {
+		return err
+	}
+	listeners := selectListeners(scanned, nameTarget, userTarget, q)
+	if len(listeners) == 0 {
+		return fmt.Errorf("no listening processes match %s", describeSelectors())
+	}
+	return killTargets(groupByPID(listeners), sig)
+}
+
+// selectListeners returns the listeners whose process name (exact,
+// case-insensitive), user and query all match. Empty selectors match all.
+func selectListeners(portList []ports.PortInfo, name, user string, q *query.Query) []ports.PortInfo {
+	var result []ports.PortInfo
+	for _, p := range portList {
+		if name != "" && !strings.EqualFold(p.Process, name) {
+			continue
+		}
+		if user != "" && !strings.EqualFold(p.User, user) {
+			continue
+		}
+		if q != nil && !q.Match(p) {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// groupByPID collects listeners into one target per process, in the order
+// each process is first seen
+func groupByPID(listeners []ports.PortInfo) []target {
+	var targets []target
+	index := make(map[int]int)
+	for _, l := range listeners {
+		i, ok := index[l.PID]
+		if !ok {
+			i = len(targets)
+			index[l.PID] = i
+			targets = append(targets, target{PID: l.PID, Process: l.Process, User: l.User, Cmdline: l.Cmdline})
+		}
+		targets[i].Listeners = append(targets[i].Listeners, l)
+	}
+	return targets
+}
+
+// showMatches reports whether the matched targets are listed before acting
+// on them: unless the output is for machines, or --quiet is given and no
+// confirmation will ask about them
+func showMatches() bool {
+	return !machineOutput() && (!quiet || (!force && !dryRun))
+}
+
+// killTargets shows the matched listeners, asks for a single confirmation
+// and then signals each target. Protected targets are refused. It honors
+// --dry-run, --force, --output, --quiet and the --yes-really cap.
+func killTargets(targets []target, sig killer.Signal) error {
+	machine := machineOutput()
+	if showMatches() {
+		var listeners []ports.PortInfo
+		var clients []ports.Client
+		for _, t := range targets {
+			listeners = append(listeners, t.Listeners...)
+			clients = append(clients, t.Clients...)
+		}
+		if len(listeners) > 0 {
+			tableCols, _ := cols.Parse(strings.Join(targetColumns, ","))
+			if err := printTable(listeners, tableCols, terminalWidth()); err != nil {
+				return err
+			}
+		}
+		if len(clients) > 0 {
+			if err := clientPrinter.Print(os.Stdout, clients, output.Options{Format: output.Table, Width: terminalWidth()}); err != nil {
+				return err
+			}
+		}
+		for _, t := range targets {
+			if len(t.Listeners) == 0 && len(t.Clients) == 0 {
+				fmt.Printf("%s (PID %d, not listening)\n", t.Process, t.PID)
+			}
+		}
+		fmt.Println()
+	}
+
+	// Outcome of each target; protected ones and docker-proxies whose
+	// container is unknown are settled up front
+	errs := make([]error, len(targets))
+	containers := make([][]ports.Container, len(targets))
+	units := make([][]ports.Unit, len(targets))
+	allowed, kills, conns := 0, 0, 0
+	containerStops := make(map[string]bool) // container IDs
+	unitStops := make(map[string]bool)      // unit descriptions
+	var refused []string
+	for i, t := range targets {
+		if errs[i] = checkTarget(t); errs[i] == nil {
+			containers[i], errs[i] = targetContainers(t)
+		}
+		if errs[i] == nil && len(containers[i]) == 0 {
+			units[i] = targetUnits(t)
+		}
+		if errs[i] != nil {
+			refused = append(refused, errs[i].Error())
+			if !machine {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", errs[i])
+			}
+			continue
+		}
+		allowed++
+		conns += countConnections(t.Listeners)
+		for _, c := range containers[i] {
+			containerStops[c.ID] = true
+		}
+		for _, u := range units[i] {
+			unitStops[systemd.Describe(u)] = true
+		}
+		if len(containers[i]) == 0 && len(units[i]) == 0 {
+			kills++
+		}
+	}
+	overCap := allowed > killCap && !yesReally
+
+	if dryRun {
+		if machine {
+			return printTargetResults(targets, errs, nil, false)
+		}
+		fmt.Printf("Would %s with signal %s\n", describeKill(kills, len(containerStops), len(unitStops)), sig)
+		if overCap {
+			fmt.Printf("Note: more than %d processes; a real run needs --yes-really\n", killCap)
+		}
+		return nil
+	}
+
+	if allowed == 0 {
+		if machine {
+			if err := printTargetResults(targets, errs, nil, true); err != nil {
+				return err
+			}
+		}
+		for _, err := range errs {
+			var perr *killer.ProtectedError
+			if !errors.As(err, &perr) {
+				return fmt.Errorf("nothing can be killed: %s", strings.Join(refused, "; "))
+			}
+		}
+		return fmt.Errorf("every matched process is protected")
+	}
+	if overCap {
+		return fmt.Errorf("refusing to kill %s (limit %d without --yes-really)",
+			pluralProcesses(allowed), killCap)
+	}
+
+	if !force {
+		action := describeKill(kills, len(containerStops), len(unitStops))
+		if !confirm(fmt.Sprintf("%s%s%s?", strings.ToUpper(action[:1]), action[1:], openConnections(conns))) {
+			return nil // User cancelled
+		}
+	}
+
+	// Whether to watch for a respawn is decided while the processes run
+	watched := make([]bool, len(targets))
+	for i, t := range targets {
+		if errs[i] == nil && len(containers[i]) == 0 && len(units[i]) == 0 {
+			for _, l := range t.Listeners {
+				watched[i] = watched[i] || watchesRespawn(l)
+			}
+		}
+	}
+
+	failures := refused
+	interrupted := false
+	since := time.Now()
+	stopped := make(map[string]bool) // containers and units, as IPv4 and IPv6 have a proxy each
+	for i, t := range targets {
+		if errs[i] != nil {
+			continue
+		}
+		if interrupted {
+			// ctrl+c stops the run; the rest are reported but not signalled
+			errs[i] = errInterrupted
+			continue
+		}
+		switch {
+		case len(containers[i]) > 0:
+			errs[i] = stopContainers(t, containers[i], sig, stopped, machine)
+		case len(units[i]) > 0:
+			errs[i] = stopUnits(t, units[i], sig, stopped, machine)
+		default:
+			errs[i] = sendSignal(t.PID, sig, targetReleased(t))
+		}
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("PID %d: %v", t.PID, errs[i]))
+			interrupted = errors.Is(errs[i], errInterrupted)
+			continue
+		}
+		if !quiet && !machine && len(containers[i]) == 0 && len(units[i]) == 0 {
+			switch {
+			case len(t.Clients) > 0:
+				fmt.Printf("Killed %s (PID %d), a client of %s\n", t.Process, t.PID, describePorts(t.ConnectedTo()))
+			case len(t.Listeners) == 0:
+				fmt.Printf("Killed %s (PID %d)\n", t.Process, t.PID)
+			default:
+				fmt.Printf("Killed %s (PID %d) on %s\n", t.Process, t.PID, describeListeners(t.Listeners))
+			}
+		}
+	}
+
+	// A supervisor may bring the killed processes straight back
+	var killedPIDs, killedPorts []int
+	if !interrupted {
+		for i, t := range targets {
+			if errs[i] == nil && watched[i] {
+				killedPIDs = append(killedPIDs, t.PID)
+				killedPorts = append(killedPorts, t.Ports()...)
+			}
+		}
+	}
+	found := watchRespawn(killedPIDs, killedPorts, sig, since)
+	respawns := make([][]respawn.Respawn, len(targets))
+	for i, t := range targets {
+		if errs[i] == nil && len(containers[i]) == 0 && len(units[i]) == 0 {
+			respawns[i] = targetRespawns(t, found)
+		}
+	}
+
+	if machine {
+		if err := printTargetResults(targets, errs, respawns, true); err != nil {
+			return err
+		}
+	}
+	respawnErr := respawnError(found)
+	if len(failures) > 0 {
+		if respawnErr != nil && !machine {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", respawnErr)
+		}
+		return fmt.Errorf("failed to kill: %s", strings.Join(failures, "; "))
+	}
+	return respawnErr
+}
+
+// stopContainers stops each container a docker-proxy target publishes
+// that is not already in stopped, reporting them unless quiet or machine is
+// set
+func stopContainers(t target, containers []ports.Container, sig killer.Signal, stopped map[string]bool, machine bool) error {
+	for _, c := range containers {
+		if stopped["container:"+c.ID] {
+			continue
+		}
+		if err := stopContainer(c, sig); err != nil {
+			return fmt.Errorf("%s: %w", docker.Describe(c), err)
+		}
+		stopped["container:"+c.ID] = true
+		if !quiet && !machine {
+			fmt.Printf("Stopped %s on %s\n", docker.Describe(c), describeListeners(containerListeners(t, c)))
+		}
+	}
+	return nil
+}
+
+// stopUnits stops each systemd unit of t that is not already in stopped,
+// reporting them unless quiet or machine is set
+func stopUnits(t target, units []ports.Unit, sig killer.Signal, stopped map[string]bool, machine bool) error {
+	for _, u := range units {
+		key := "unit:" + systemd.Describe(u)
+		if stopped[key] {
+			continue
+		}
+		if err := stopUnit(u, sig); err != nil {
+			return fmt.Errorf("%s: %w", systemd.Describe(u), err)
+		}
+		stopped[key] = true
+		if !quiet && !machine {
+			fmt.Printf("Stopped %s on %s\n", describeUnit(u), describeListeners(unitListeners(t, u)))
+		}
+	}
+	return nil
+}
+
+// unitListeners returns the listeners of t held for the unit u
+func unitListeners(t target, u ports.Unit) []ports.PortInfo {
+	var result []ports.PortInfo
+	for _, l := range t.Listeners {
+		if s := stoppable(l); s != nil && systemd.Describe(*s) == systemd.Describe(u) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// containerListeners returns the listeners of t that forward to c
+func containerListeners(t target, c ports.Container) []ports.PortInfo {
+	var result []ports.PortInfo
+	for _, l := range t.Listeners {
+		if l.Container != nil && l.Container.ID == c.ID {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// checkTarget applies the protection policy to each listener of t, or to
+// the process itself when it has none
+func checkTarget(t target) error {
+	if len(t.Listeners) == 0 {
+		return checkProtected(killer.Target{PID: t.PID, Name: t.Process, User: t.User})
+	}
+	for _, l := range t.Listeners {
+		if err := checkProtected(killer.Target{PID: t.PID, Port: l.Port, Name: t.Process, User: t.User, Unit: systemd.HeldSocket(l)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetReleased returns a check that every port and Unix socket of t has
+// been released
+func targetReleased(t target) func() bool {
+	return func() bool {
+		for _, port := range t.Ports() {
+			matches, err := findByPort(port)
+			if err != nil || containsPID(matches, t.PID) {
+				return false
+			}
+		}
+		for _, path := range t.Sockets() {
+			matches, err := findBySocket(path)
+			if err != nil || containsPID(matches, t.PID) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// printTargetResults writes targets in the selected output format. errs[i]
+// is the outcome for targets[i]; a protected target's error is a
+// *killer.ProtectedError. respawns[i], if any, took back the ports of a
+// killed targets[i]. When killed is false (a dry run) the other targets
+// are reported as would_kill.
+func printTargetResults(targets []target, errs []error, respawns [][]respawn.Respawn, killed bool) error {
+	results := make([]targetResult, len(targets))
+	for i, t := range targets {
+		results[i] = targetResult{
+			PID:     t.PID,
+			Process: t.Process,
+			User:    t.User,
+			Ports:   t.Ports(),
+			Sockets: t.Sockets(),
+			Cmdline: t.Cmdline,
+			Status:  "would_kill",
+
+			ConnectedTo: t.ConnectedTo(),
+		}
+		containers, _ := targetContainers(t)
+		for _, c := range containers {
+			results[i].Containers = append(results[i].Containers, c.Name)
+		}
+		units := targetUnits(t)
+		if len(containers) == 0 {
+			for _, u := range units {
+				results[i].Units = append(results[i].Units, u.Name)
+			}
+		}
+		stops := len(containers) > 0 || len(results[i].Units) > 0
+		var perr *killer.ProtectedError
+		switch {
+		case errors.As(errs[i], &perr):
+			results[i].Status = "protected"
+			results[i].Error = perr.Reason
+		case errs[i] != nil:
+			results[i].Status = "failed"
+			results[i].Error = errs[i].Error()
+		case stops && killed:
+			results[i].Status = "stopped"
+		case stops:
+			results[i].Status = "would_stop"
+		case killed && len(respawns) > i && len(respawns[i]) > 0:
+			results[i].Status = "respawned"
+			for _, r := range respawns[i] {
+				results[i].Respawns = append(results[i].Respawns, newRespawnRecord(r))
+			}
+		case killed:
+			results[i].Status = "killed"
+		}
+	}
+
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+	return resultPrinter.Print(os.Stdout, results, opts)
+}
+
+// describeSelectors summarizes the --name, --user and --match flags for
+// error messages
+func describeSelectors() string {
+	var parts []string
+	if nameTarget != "" {
+		parts = append(parts, "--name "+strconv.Quote(nameTarget))
+	}
+	if userTarget != "" {
+		parts = append(parts, "--user "+strconv.Quote(userTarget))
+	}
+	if matchTarget != "" {
+		parts = append(parts, "--match "+strconv.Quote(matchTarget))
+	}
+	return strings.Join(parts, " ")
+}
+
+// describePorts formats a port list as "port 3000" or "ports 3000, 3001"
+func describePorts(portList []int) string {
+	strs := make([]string, len(portList))
+	for i, p := range portList {
+		strs[i] = strconv.Itoa(p)
+	}
+	if len(strs) == 1 {
+		return "port " + strs[0]
+	}
+	return "ports " + strings.Join(strs, ", ")
+}
+
+// describeListeners formats what listeners listen on as "port 3000",
+// "ports 3000, 3001", "/run/app.sock" or "port 3000 and /run/app.sock",
+// naming a port held for both IPv4 and IPv6 once
+func describeListeners(listeners []ports.PortInfo) string {
+	var portList []int
+	var sockets []string
+	seen := make(map[string]bool)
+	for _, l := range listeners {
+		if seen[l.Where()] {
+			continue
+		}
+		seen[l.Where()] = true
+		if l.Unix() {
+			sockets = append(sockets, l.Address)
+		} else {
+			portList = append(portList, l.Port)
+		}
+	}
+	switch {
+	case len(sockets) == 0:
+		return describePorts(portList)
+	case len(portList) == 0:
+		return strings.Join(sockets, ", ")
+	}
+	return describePorts(portList) + " and " + strings.Join(sockets, ", ")
+}
+
+// describeKill summarizes a kill as "kill 2 processes", "stop 1 container"
+// or "stop 1 container and 1 unit, and kill 2 processes"
+func describeKill(processes, containers, units int) string {
+	kill := "kill " + pluralProcesses(processes)
+	var stops []string
+	if containers > 0 {
+		stops = append(stops, plural(containers, "container"))
+	}
+	if units > 0 {
+		stops = append(stops, plural(units, "unit"))
+	}
+	if len(stops) == 0 {
+		return kill
+	}
+	stop := "stop " + strings.Join(stops, " and ")
+	switch {
+	case processes == 0:
+		return stop
+	case len(stops) > 1:
+		return stop + ", and " + kill
+	}
+	return stop + " and " + kill
+}
+
+// plural formats n of noun as "1 unit" or "n units"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// countConnections returns the number of open connections to listeners
+func countConnections(listeners []ports.PortInfo) int {
+	n := 0
+	for _, l := range listeners {
+		n += len(l.Connections)
+	}
+	return n
+}
+
+// openConnections notes the n open connections a kill would drop for a
+// confirmation prompt, as " (3 open connections)", or "" if there are none
+func openConnections(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return " (" + plural(n, "open connection") + ")"
+}
+
+// pluralProcesses formats n as "1 process" or "n processes"
+func pluralProcesses(n int) string {
+	if n == 1 {
+		return "1 process"
+	}
+	return fmt.Sprintf("%d processes", n)
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/query"
+)
+
+var targetTestPorts = []ports.PortInfo{
+	{Port: 3000, PID: 9000100, Process: "node", User: "alice", Proto: "tcp", Cmdline: "node server.js"},
+	{Port: 5173, PID: 9000200, Process: "node", User: "alice", Proto: "tcp", Cmdline: "node node_modules/.bin/vite"},
+	{Port: 5174, PID: 9000200, Process: "node", User: "alice", Proto: "tcp6", Cmdline: "node node_modules/.bin/vite"},
+	{Port: 8080, PID: 9000300, Process: "java", User: "ci", Proto: "tcp", Cmdline: "java -jar app.jar"},
+	{Port: 9000, PID: 9000400, Process: "Node", User: "CI", Proto: "tcp"},
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	old := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+// setKillFlags sets the flags used by killTargets and restores them when
+// the test ends. Killed ports are not watched for respawns.
+func setKillFlags(t *testing.T, dry, frc, js, yes bool) {
+	t.Helper()
+	origDry, origForce, origJSON, origYes, origQuiet, origWindow := dryRun, force, jsonOut, yesReally, quiet, respawnWindow
+	origWindowSet := respawnWindowSet
+	dryRun, force, jsonOut, yesReally, quiet, respawnWindow, respawnWindowSet = dry, frc, js, yes, false, 0, false
+	t.Cleanup(func() {
+		dryRun, force, jsonOut, yesReally, quiet, respawnWindow = origDry, origForce, origJSON, origYes, origQuiet, origWindow
+		respawnWindowSet = origWindowSet
+	})
+}
+
+func TestSelectListeners(t *testing.T) {
+	tests := []struct {
+		name  string
+		pname string
+		user  string
+		query string
+		want  []int
+	}{
+		{"no selectors", "", "", "", []int{3000, 5173, 5174, 8080, 9000}},
+		{"name exact case-insensitive", "node", "", "", []int{3000, 5173, 5174, 9000}},
+		{"name is not a substring match", "nod", "", "", nil},
+		{"user", "", "ci", "", []int{8080, 9000}},
+		{"name and user", "node", "ci", "", []int{9000}},
+		{"query", "", "", "cmd:vite", []int{5173, 5174}},
+		{"all selectors", "node", "alice", "port<5000", []int{3000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectListeners(targetTestPorts, tt.pname, tt.user, query.MustParse(tt.query))
+			var gotPorts []int
+			for _, p := range got {
+				gotPorts = append(gotPorts, p.Port)
+			}
+			if !reflect.DeepEqual(gotPorts, tt.want) {
+				t.Errorf("selectListeners() = %v, want %v", gotPorts, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByPID(t *testing.T) {
+	targets := groupByPID(targetTestPorts)
+	if len(targets) != 4 {
+		t.Fatalf("groupByPID() returned %d targets, want 4", len(targets))
+	}
+	if targets[1].PID != 9000200 || !reflect.DeepEqual(targets[1].Ports(), []int{5173, 5174}) {
+		t.Errorf("targets[1] = PID %d ports %v, want PID 9000200 ports [5173 5174]",
+			targets[1].PID, targets[1].Ports())
+	}
+	if targets[1].Cmdline != "node node_modules/.bin/vite" {
+		t.Errorf("targets[1].Cmdline = %q", targets[1].Cmdline)
+	}
+	if groupByPID(nil) != nil {
+		t.Error("groupByPID(nil) should return nil")
+	}
+}
+
+func TestKillTargetsDryRun(t *testing.T) {
+	setKillFlags(t, true, false, false, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts[:3]), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets dry run error: %v", err)
+	}
+	for _, want := range []string{"PORT", "3000", "5174", "vite", "Would kill 2 processes with signal TERM"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("dry-run output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestKillTargetsDryRunJSON(t *testing.T) {
+	setKillFlags(t, true, false, true, false)
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts[:3]), sig)
+	})
+	if err != nil {
+		t.Fatalf("killTargets dry run error: %v", err)
+	}
+
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[1].Status != "would_kill" || !reflect.DeepEqual(results[1].Ports, []int{5173, 5174}) {
+		t.Errorf("results[1] = %+v", results[1])
+	}
+}
+
+func TestKillTargetsCap(t *testing.T) {
+	setKillFlags(t, false, true, false, false)
+	origCap := killCap
+	killCap = 2
+	defer func() { killCap = origCap }()
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts), sig)
+	})
+	if err == nil || !strings.Contains(err.Error(), "refusing to kill 4 processes (limit 2 without --yes-really)") {
+		t.Errorf("killTargets over the cap error = %v", err)
+	}
+
+	// A dry run still shows what would happen, with a note
+	dryRun = true
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts), sig)
+	})
+	if err != nil || !strings.Contains(output, "needs --yes-really") {
+		t.Errorf("dry run over the cap: err = %v, output:\n%s", err, output)
+	}
+}
+
+func TestKillTargetsUserCancels(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+	go func() {
+		_, _ = w.WriteString("n\n")
+		w.Close()
+	}()
+
+	sig, _ := killer.ParseSignal("TERM")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(groupByPID(targetTestPorts[:3]), sig)
+	})
+	if err != nil {
+		t.Errorf("killTargets should return nil when the user cancels: %v", err)
+	}
+	if strings.Count(output, "[y/N]") != 1 || !strings.Contains(output, "Kill 2 processes?") {
+		t.Errorf("expected a single confirmation prompt, got:\n%s", output)
+	}
+}
+
+func TestKillTargetsQuiet(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+	quiet = true
+	confirmInput = strings.NewReader("n\n")
+	t.Cleanup(func() { confirmInput = nil })
+
+	// A confirmation still shows what it asks about
+	sig, _ := killer.ParseSignal("TERM")
+	output := captureStdout(t, func() {
+		if err := killTargets(groupByPID(targetTestPorts[:3]), sig); err != nil {
+			t.Errorf("killTargets error: %v", err)
+		}
+	})
+	if !strings.Contains(output, "PORT") || !strings.Contains(output, "Kill 2 processes?") {
+		t.Errorf("--quiet without --force should list the targets it asks about:\n%s", output)
+	}
+
+	dryRun = true
+	output = captureStdout(t, func() {
+		_ = killTargets(groupByPID(targetTestPorts[:3]), sig)
+	})
+	if strings.Contains(output, "PORT") {
+		t.Errorf("--quiet --dry-run listed the targets:\n%s", output)
+	}
+}
+
+func TestKillTargetsKills(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	setKillFlags(t, false, true, true, false)
+
+	cmd := exec.Command("sleep", "60")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start sleep: %v", err)
+	}
+	go func() { _ = cmd.Wait() }()
+
+	targets := []target{
+		{PID: cmd.Process.Pid, Process: "sleep", Listeners: []ports.PortInfo{{Port: 1, PID: cmd.Process.Pid}}},
+		{PID: 999999999, Process: "ghost", Listeners: []ports.PortInfo{{Port: 2, PID: 999999999}}},
+	}
+
+	sig, _ := killer.ParseSignal("KILL")
+	var err error
+	output := captureStdout(t, func() {
+		err = killTargets(targets, sig)
+	})
+	if err == nil || !strings.Contains(err.Error(), "PID 999999999") {
+		t.Errorf("killTargets error = %v, want a failure for the missing PID", err)
+	}
+
+	var results []targetResult
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(results) != 2 || results[0].Status != "killed" || results[1].Status != "failed" || results[1].Error == "" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestKillMatchingErrors(t *testing.T) {
+	setKillFlags(t, false, false, false, false)
+	origMatch := matchTarget
+	defer func() { matchTarget = origMatch }()
+
+	sig, _ := killer.ParseSignal("TERM")
+
+	matchTarget = "port>="
+	if err := killMatching(sig); err == nil || !strings.Contains(err.Error(), "missing value") {
+		t.Errorf("invalid --match error = %v", err)
+	}
+
+	matchTarget = "proc=node"
+	jsonOut = true
+	if err := killMatching(sig); err == nil || !strings.Contains(err.Error(), "--json requires --force or --dry-run") {
+		t.Errorf("--json without --force error = %v", err)
+	}
+
+	jsonOut = false
+	matchTarget = "proc=no-such-process-xyz"
+	if err := killMatching(sig); err == nil || !strings.Contains(err.Error(), `no listening processes match --match "proc=no-such-process-xyz"`) {
+		t.Errorf("no match error = %v", err)
+	}
+}
+
+func TestHasMatchTargeting(t *testing.T) {
+	origName, origUser, origMatch := nameTarget, userTarget, matchTarget
+	defer func() { nameTarget, userTarget, matchTarget = origName, origUser, origMatch }()
+
+	nameTarget, userTarget, matchTarget = "", "", ""
+	if hasMatchTargeting() {
+		t.Error("no selectors should not enable targeting")
+	}
+	userTarget = "ci"
+	if !hasMatchTargeting() {
+		t.Error("--user should enable targeting")
+	}
+	nameTarget = "node"
+	if got := describeSelectors(); got != `--name "node" --user "ci"` {
+		t.Errorf("describeSelectors() = %q", got)
+	}
+}
+
+func TestDescribePorts(t *testing.T) {
+	if got := describePorts([]int{3000}); got != "port 3000" {
+		t.Errorf("describePorts single = %q", got)
+	}
+	if got := describePorts([]int{3000, 3001}); got != "ports 3000, 3001" {
+		t.Errorf("describePorts multiple = %q", got)
+	}
+	if got := pluralProcesses(1); got != "1 process" {
+		t.Errorf("pluralProcesses(1) = %q", got)
+	}
+	if got := pluralProcesses(3); got != "3 processes" {
+		t.Errorf("pluralProcesses(3) = %q", got)
+	}
+}
+
+func TestDescribeListeners(t *testing.T) {
+	v4 := ports.PortInfo{Port: 3000, Proto: "tcp"}
+	v6 := ports.PortInfo{Port: 3000, Proto: "tcp6"}
+	api := ports.PortInfo{Port: 8000, Proto: "tcp"}
+	sock := ports.PortInfo{Proto: "unix", Address: "/run/app.sock"}
+	tests := []struct {
+		listeners []ports.PortInfo
+		want      string
+	}{
+		{[]ports.PortInfo{v4, v6}, "port 3000"},
+		{[]ports.PortInfo{v4, api}, "ports 3000, 8000"},
+		{[]ports.PortInfo{sock}, "/run/app.sock"},
+		{[]ports.PortInfo{sock, v4, v6}, "port 3000 and /run/app.sock"},
+	}
+	for _, tt := range tests {
+		if got := describeListeners(tt.listeners); got != tt.want {
+			t.Errorf("describeListeners(%+v) = %q, want %q", tt.listeners, got, tt.want)
+		}
+	}
+
+	tgt := target{Listeners: []ports.PortInfo{v4, sock}}
+	if !reflect.DeepEqual(tgt.Ports(), []int{3000}) || !reflect.DeepEqual(tgt.Sockets(), []string{"/run/app.sock"}) {
+		t.Errorf("Ports = %v, Sockets = %v", tgt.Ports(), tgt.Sockets())
+	}
+}
+
+func TestOpenConnections(t *testing.T) {
+	busy := ports.PortInfo{Port: 5432, Connections: []ports.Connection{{State: "ESTABLISHED"}, {State: "CLOSE_WAIT"}}}
+	one := ports.PortInfo{Port: 5433, Connections: []ports.Connection{{State: "ESTABLISHED"}}}
+	tests := []struct {
+		listeners []ports.PortInfo
+		want      string
+	}{
+		{nil, ""},
+		{[]ports.PortInfo{{Port: 3000}}, ""},
+		{[]ports.PortInfo{one}, " (1 open connection)"},
+		{[]ports.PortInfo{busy, one}, " (3 open connections)"},
+	}
+	for _, tt := range tests {
+		if got := openConnections(countConnections(tt.listeners)); got != tt.want {
+			t.Errorf("openConnections for %d listeners = %q, want %q", len(tt.listeners), got, tt.want)
+		}
+	}
+}
+
+func TestTargetingFlags(t *testing.T) {
+	for _, name := range []string{"name", "user", "match", "yes-really"} {
+		if rootCmd.Flags().Lookup(name) == nil {
+			t.Errorf("--%s flag should exist", name)
+		}
+	}
+}
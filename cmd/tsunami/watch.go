@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	ossignal "os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	cols "github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// defaultWatchInterval is used by --watch without a value
+const defaultWatchInterval = 2 * time.Second
+
+// watchInterval is the --watch polling interval; 0 disables watching
+var watchInterval time.Duration
+
+// watchEvent is an NDJSON record for a listener that opened, closed or
+// changed owner
+type watchEvent struct {
+	Event string    `json:"event"` // opened, closed or owner_changed
+	Time  time.Time `json:"time"`
+	portRecord
+	PreviousPID     int    `json:"previous_pid,omitempty"`
+	PreviousProcess string `json:"previous_process,omitempty"`
+}
+
+// watchArgs resolves the interval for "--watch 5s", where the value was
+// parsed as a positional argument
+func watchArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("--list takes no port arguments")
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid --watch interval: %s", args[0])
+	}
+	watchInterval = d
+	return nil
+}
+
+// watchPorts lists ports every --watch interval until interrupted. On a
+// terminal the listing is redrawn in place; otherwise a stream of change
+// events is written as NDJSON.
+func watchPorts() error {
+	if watchInterval <= 0 {
+		return fmt.Errorf("invalid --watch interval: %s (must be positive)", watchInterval)
+	}
+	tableCols, err := cols.Parse(columns)
+	if err != nil {
+		return err
+	}
+	opts, err := outputOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := ossignal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if terminalWidth() > 0 {
+		return watchTable(ctx, os.Stdout, tableCols, opts)
+	}
+	// Only the default scanner can skip polls where nothing changed
+	var scan func(context.Context) ([]ports.PortInfo, error)
+	if filter != "" || idle || netns != "" || allNetns {
+		scan = filteredScan
+	}
+	return watchEvents(ctx, os.Stdout, scan)
+}
+
+// filteredScan scans for listening ports matching --filter and --idle, in
+// the namespaces chosen with --netns or --all-netns. Listeners are
+// labelled first so that --filter can match their apps and projects.
+func filteredScan(ctx context.Context) ([]ports.PortInfo, error) {
+	p, err := scanContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appLabels.Annotate(p)
+	return filterPorts(p, listFilter())
+}
+
+// watchTable redraws the listing on w after every scan
+func watchTable(ctx context.Context, w io.Writer, tableCols []cols.Column, opts output.Options) error {
+	var cmdline strings.Builder
+	cmdline.WriteString("tsunami -l")
+	if filter != "" {
+		fmt.Fprintf(&cmdline, " --filter %q", filter)
+	}
+	if idle {
+		cmdline.WriteString(" --idle")
+	}
+
+	return pollListing(ctx, func() error {
+		p, err := scanListing(ctx)
+		if ctx.Err() != nil {
+			return nil // interrupted mid-scan; leave the last listing up
+		}
+		// Home the cursor and clear the screen below it
+		fmt.Fprint(w, "\033[H\033[J")
+		fmt.Fprintf(w, "Every %s: %s    %s\n\n", watchInterval, cmdline.String(), time.Now().Format("15:04:05"))
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return nil
+		}
+		opts.Width = terminalWidth()
+		return printPorts(p, tableCols, opts)
+	})
+}
+
+// watchEvents writes an opened event for every listener in the first scan
+// and then one event per change until ctx is done. Scan errors after the
+// first are reported on stderr. A nil scan uses ports.ScanContext.
+func watchEvents(ctx context.Context, w io.Writer, scan func(context.Context) ([]ports.PortInfo, error)) error {
+	events, err := ports.Watch(ctx, ports.WatchOptions{Interval: watchInterval, Initial: true, Scan: scan})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for e := range events {
+		if e.Kind == ports.ScanFailed {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", e.Err)
+			continue
+		}
+		if e.Kind != ports.Closed {
+			listener := []ports.PortInfo{e.Listener}
+			annotateListeners(ctx, listener)
+			e.Listener = listener[0]
+		}
+		record := watchEvent{Event: string(e.Kind), Time: e.Time, portRecord: newPortRecord(e.Listener)}
+		if e.Previous != nil {
+			record.PreviousPID = e.Previous.PID
+			record.PreviousProcess = e.Previous.Process
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollListing calls update now and after every --watch interval until ctx
+// is done or update fails
+func pollListing(ctx context.Context, update func() error) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		if err := update(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// cancelAfterLines cancels a context once n lines have been written
+type cancelAfterLines struct {
+	bytes.Buffer
+	n      int
+	cancel context.CancelFunc
+}
+
+func (w *cancelAfterLines) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	if strings.Count(w.String(), "\n") >= w.n {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestWatchEvents(t *testing.T) {
+	origInterval := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = origInterval }()
+
+	moved := targetTestPorts[0]
+	moved.PID = 1234
+	scans := [][]ports.PortInfo{
+		targetTestPorts[:2],
+		targetTestPorts[:2],
+		{moved, targetTestPorts[2]},
+	}
+	calls := 0
+	scan := func(context.Context) ([]ports.PortInfo, error) {
+		calls = min(calls+1, len(scans))
+		return scans[calls-1], nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelAfterLines{n: 5, cancel: cancel}
+	if err := watchEvents(ctx, w, scan); err != nil {
+		t.Fatalf("watchEvents error: %v", err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(w.String()), "\n") {
+		var e watchEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %q has no time", line)
+		}
+		if e.Event == "opened" && e.Port == 5173 && e.App != "vite" {
+			t.Errorf("event %q has app %q, want vite", line, e.App)
+		}
+		desc := e.Event + " " + strconv.Itoa(e.Port)
+		if e.PreviousPID != 0 {
+			desc += " from " + strconv.Itoa(e.PreviousPID)
+		}
+		got = append(got, desc)
+	}
+	want := []string{"opened 3000", "opened 5173", "owner_changed 3000 from 9000100", "closed 5173", "opened 5174"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestWatchEventsFirstScanError(t *testing.T) {
+	origInterval := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = origInterval }()
+
+	scan := func(context.Context) ([]ports.PortInfo, error) { return nil, errors.New("boom") }
+	var buf bytes.Buffer
+	err := watchEvents(context.Background(), &buf, scan)
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("error = %v, want boom", err)
+	}
+}
+
+func TestWatchArgs(t *testing.T) {
+	origInterval := watchInterval
+	defer func() { watchInterval = origInterval }()
+
+	watchInterval = defaultWatchInterval
+	if err := watchArgs([]string{"500ms"}); err != nil || watchInterval != 500*time.Millisecond {
+		t.Errorf("watchArgs(500ms) = %v, interval %v", err, watchInterval)
+	}
+	if err := watchArgs([]string{"soon"}); err == nil {
+		t.Error("expected an error for an invalid interval")
+	}
+	if err := watchArgs([]string{"1s", "2s"}); err == nil {
+		t.Error("expected an error for extra arguments")
+	}
+}
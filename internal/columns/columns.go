@@ -0,0 +1,292 @@
+// Package columns defines the table columns shared by `tsunami --list` and
+// the TUI, and lays them out to fit the available terminal width.
+package columns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wusher/tsunami/internal/output"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// Column describes a single table column
+type Column struct {
+	Key     string
+	Header  string
+	SortKey ports.SortKey // empty if the column is not sortable
+	Flex    bool          // may be shrunk to fit the terminal
+	Min     int           // narrowest width a flexible column is shrunk to
+	Value   func(ports.PortInfo) string
+}
+
+// DefaultKeys are the columns shown when none are configured
+var DefaultKeys = []string{"port", "pid", "process", "user", "proto", "conns"}
+
+// all lists every available column in their canonical order
+var all = []Column{
+	{Key: "port", Header: "PORT", SortKey: ports.SortByPort,
+		Value: FormatPort},
+	{Key: "pid", Header: "PID", SortKey: ports.SortByPID,
+		Value: func(p ports.PortInfo) string { return strconv.Itoa(p.PID) }},
+	{Key: "process", Header: "PROCESS", SortKey: ports.SortByProcess, Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string { return p.Process }},
+	{Key: "label", Header: "LABEL", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string { return orDash(p.Label()) }},
+	{Key: "user", Header: "USER", SortKey: ports.SortByUser, Flex: true, Min: 6,
+		Value: func(p ports.PortInfo) string { return p.User }},
+	{Key: "proto", Header: "PROTO", SortKey: ports.SortByProto,
+		Value: func(p ports.PortInfo) string { return p.Proto }},
+	{Key: "conns", Header: "CONNS", SortKey: ports.SortByConns,
+		Value: func(p ports.PortInfo) string { return strconv.Itoa(len(p.Connections)) }},
+	{Key: "address", Header: "ADDRESS", Flex: true, Min: 7,
+		Value: func(p ports.PortInfo) string { return orDash(p.Address) }},
+	{Key: "uptime", Header: "UPTIME", SortKey: ports.SortByAge,
+		Value: func(p ports.PortInfo) string { return FormatUptime(p.Uptime()) }},
+	{Key: "memory", Header: "MEM", SortKey: ports.SortByMemory,
+		Value: func(p ports.PortInfo) string { return FormatBytes(p.Memory) }},
+	{Key: "cpu", Header: "CPU%", SortKey: ports.SortByCPU,
+		Value: FormatCPU},
+	{Key: "threads", Header: "THR", SortKey: ports.SortByThreads,
+		Value: func(p ports.PortInfo) string { return countOrDash(p.Threads) }},
+	{Key: "fds", Header: "FDS", SortKey: ports.SortByFDs,
+		Value: func(p ports.PortInfo) string { return countOrDash(p.FDs) }},
+	{Key: "state", Header: "S", SortKey: ports.SortByState,
+		Value: func(p ports.PortInfo) string { return orDash(p.State) }},
+	{Key: "cmdline", Header: "COMMAND", Flex: true, Min: 10,
+		Value: func(p ports.PortInfo) string { return orDash(Printable(p.Cmdline)) }},
+	{Key: "container", Header: "CONTAINER", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string { return orDash(ContainerName(p)) }},
+	{Key: "image", Header: "IMAGE", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return "-"
+			}
+			return orDash(p.Container.Image)
+		}},
+	{Key: "runtime", Header: "RUNTIME",
+		Value: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return "-"
+			}
+			return orDash(p.Container.Runtime)
+		}},
+	{Key: "slice", Header: "SLICE", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string { return orDash(p.Slice) }},
+	{Key: "unit", Header: "UNIT", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string {
+			if p.Unit == nil {
+				return "-"
+			}
+			return p.Unit.Name
+		}},
+	{Key: "restart", Header: "RESTART",
+		Value: func(p ports.PortInfo) string {
+			if p.Unit == nil {
+				return "-"
+			}
+			return orDash(p.Unit.Restart)
+		}},
+	{Key: "netns", Header: "NETNS", Flex: true, Min: 8,
+		Value: func(p ports.PortInfo) string { return orDash(p.Netns) }},
+}
+
+// ContainerName returns the name of the container behind p, its short ID
+// if it has no name, or "" if there is none
+func ContainerName(p ports.PortInfo) string {
+	c := p.Container
+	switch {
+	case c == nil:
+		return ""
+	case c.Name != "":
+		return c.Name
+	case len(c.ID) > 12:
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// Keys returns the key of every available column
+func Keys() []string {
+	keys := make([]string, len(all))
+	for i, c := range all {
+		keys[i] = c.Key
+	}
+	return keys
+}
+
+// Lookup returns the column with the given key
+func Lookup(key string) (Column, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, c := range all {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// Default returns the default column set
+func Default() []Column {
+	cols, _ := Parse("")
+	return cols
+}
+
+// Parse parses a comma-separated list of column keys, preserving order.
+// An empty spec yields the default columns.
+func Parse(spec string) ([]Column, error) {
+	keys := DefaultKeys
+	if strings.TrimSpace(spec) != "" {
+		keys = strings.Split(spec, ",")
+	}
+
+	var cols []Column
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		c, ok := Lookup(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s (valid: %s)",
+				strings.TrimSpace(key), strings.Join(Keys(), ", "))
+		}
+		if seen[c.Key] {
+			return nil, fmt.Errorf("duplicate column: %s", c.Key)
+		}
+		seen[c.Key] = true
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// Widths computes a width for each column that fits its header and every
+// row, shrinking flexible columns to fit available if it is positive
+func Widths(cols []Column, rows []ports.PortInfo, available int) []int {
+	return output.Widths(Output(cols), rows, available)
+}
+
+// TotalWidth returns the rendered width of a row with the given column widths
+func TotalWidth(widths []int) int {
+	return output.TotalWidth(widths)
+}
+
+// Output converts cols for an output.Printer
+func Output(cols []Column) []output.Column[ports.PortInfo] {
+	result := make([]output.Column[ports.PortInfo], len(cols))
+	for i, c := range cols {
+		result[i] = output.Column[ports.PortInfo]{Key: c.Key, Header: c.Header, Flex: c.Flex, Min: c.Min, Value: c.Value}
+	}
+	return result
+}
+
+// Cells renders each column of p, padded or truncated to its width
+func Cells(cols []Column, widths []int, p ports.PortInfo) []string {
+	cells := make([]string, len(cols))
+	for i, c := range cols {
+		cells[i] = Fit(c.Value(p), widths[i])
+	}
+	return cells
+}
+
+// Headers renders each column header, padded to its width
+func Headers(cols []Column, widths []int) []string {
+	cells := make([]string, len(cols))
+	for i, c := range cols {
+		cells[i] = Fit(c.Header, widths[i])
+	}
+	return cells
+}
+
+// Fit truncates s with "..." if it is wider than w, then pads it to w
+func Fit(s string, w int) string {
+	return output.Fit(s, w)
+}
+
+// Printable replaces each control character in s, such as a newline or tab
+// inside a command line argument, with a space so a value stays on one row
+func Printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// FormatPort renders the port of p, or "-" for a Unix socket, which has
+// none
+func FormatPort(p ports.PortInfo) string {
+	if p.Unix() {
+		return "-"
+	}
+	return strconv.Itoa(p.Port)
+}
+
+// FormatUptime renders a duration compactly using its two largest units,
+// e.g. 3d4h, 2h5m, 45s
+func FormatUptime(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	seconds := int(d/time.Second) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
+
+// FormatCPU renders the CPU usage of p as a percentage with one decimal,
+// e.g. 12.5, or "-" if it is unknown
+func FormatCPU(p ports.PortInfo) string {
+	if p.StartTime.IsZero() && p.CPU == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(p.CPU, 'f', 1, 64)
+}
+
+// FormatBytes renders a byte count with a binary unit suffix, e.g. 12.5M
+func FormatBytes(n uint64) string {
+	if n == 0 {
+		return "-"
+	}
+
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n) / unit
+	for _, suffix := range []string{"K", "M", "G", "T"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f%s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1fP", value)
+}
+
+// countOrDash renders n, or "-" for 0, which means unknown
+func countOrDash(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.Itoa(n)
+}
+
+// orDash substitutes "-" for empty values
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,282 @@
+package columns
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{"", DefaultKeys, false},
+		{"port,cmdline", []string{"port", "cmdline"}, false},
+		{" PID , Process ", []string{"pid", "process"}, false},
+		{"uptime,port", []string{"uptime", "port"}, false},
+		{"port,bogus", nil, true},
+		{"port,port", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			cols, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(cols) != len(tt.want) {
+				t.Fatalf("Parse(%q) returned %d columns, want %d", tt.spec, len(cols), len(tt.want))
+			}
+			for i, c := range cols {
+				if c.Key != tt.want[i] {
+					t.Errorf("column %d = %q, want %q", i, c.Key, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrorListsValidColumns(t *testing.T) {
+	_, err := Parse("nope")
+	if err == nil || !strings.Contains(err.Error(), "cmdline") {
+		t.Errorf("error should list valid columns, got %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if _, ok := Lookup("ADDRESS"); !ok {
+		t.Error("Lookup should be case-insensitive")
+	}
+	if _, ok := Lookup("nope"); ok {
+		t.Error("Lookup should fail for unknown keys")
+	}
+}
+
+func TestWidthsNatural(t *testing.T) {
+	cols := Default()
+	rows := []ports.PortInfo{
+		{Port: 3000, PID: 12345, Process: "a-long-process-name", User: "alice", Proto: "tcp6"},
+	}
+
+	widths := Widths(cols, rows, 0)
+	expected := []int{4, 5, 19, 5, 5}
+	for i := range expected {
+		if widths[i] != expected[i] {
+			t.Errorf("width[%d] = %d, want %d", i, widths[i], expected[i])
+		}
+	}
+}
+
+func TestWidthsShrinkToFit(t *testing.T) {
+	cols := Default()
+	rows := []ports.PortInfo{
+		{Port: 3000, PID: 12345, Process: "a-very-very-long-process-name", User: "someone-with-a-long-name", Proto: "tcp"},
+	}
+
+	widths := Widths(cols, rows, 40)
+	if total := TotalWidth(widths); total > 40 {
+		t.Errorf("total width = %d, should fit in 40", total)
+	}
+	// Fixed columns never shrink
+	if widths[0] != 4 || widths[1] != 5 {
+		t.Errorf("fixed columns should keep their width, got %v", widths)
+	}
+}
+
+func TestWidthsRespectMinimum(t *testing.T) {
+	cols := Default()
+	rows := []ports.PortInfo{
+		{Port: 3000, PID: 12345, Process: "a-very-very-long-process-name", User: "someone", Proto: "tcp"},
+	}
+
+	widths := Widths(cols, rows, 10)
+	if widths[2] != 8 {
+		t.Errorf("process width = %d, should stop at its minimum of 8", widths[2])
+	}
+	if widths[3] != 6 {
+		t.Errorf("user width = %d, should stop at its minimum of 6", widths[3])
+	}
+}
+
+func TestTotalWidth(t *testing.T) {
+	if got := TotalWidth([]int{4, 5, 6}); got != 17 {
+		t.Errorf("TotalWidth = %d, want 17", got)
+	}
+	if got := TotalWidth(nil); got != 0 {
+		t.Errorf("TotalWidth(nil) = %d, want 0", got)
+	}
+}
+
+func TestCellsAndHeaders(t *testing.T) {
+	cols, _ := Parse("port,process")
+	widths := []int{6, 7}
+
+	headers := Headers(cols, widths)
+	if headers[0] != "PORT  " || headers[1] != "PROCESS" {
+		t.Errorf("Headers = %q", headers)
+	}
+
+	cells := Cells(cols, widths, ports.PortInfo{Port: 80, Process: "nginx-master"})
+	if cells[0] != "80    " {
+		t.Errorf("port cell = %q", cells[0])
+	}
+	if cells[1] != "ngin..." {
+		t.Errorf("process cell = %q, want truncated", cells[1])
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		s    string
+		w    int
+		want string
+	}{
+		{"node", 6, "node  "},
+		{"node", 4, "node"},
+		{"postgres", 6, "pos..."},
+		{"日本語", 6, "日本語"},
+		{"日本語です", 7, "日本..."},
+	}
+
+	for _, tt := range tests {
+		if got := Fit(tt.s, tt.w); got != tt.want {
+			t.Errorf("Fit(%q, %d) = %q, want %q", tt.s, tt.w, got, tt.want)
+		}
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "-"},
+		{45 * time.Second, "45s"},
+		{2*time.Minute + 5*time.Second, "2m5s"},
+		{2*time.Hour + 5*time.Minute, "2h5m"},
+		{76 * time.Hour, "3d4h"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatUptime(tt.d); got != tt.want {
+			t.Errorf("FormatUptime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "-"},
+		{512, "512B"},
+		{1536, "1.5K"},
+		{12 * 1024 * 1024, "12.0M"},
+		{3 * 1024 * 1024 * 1024, "3.0G"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatPort(t *testing.T) {
+	if got := FormatPort(ports.PortInfo{Port: 8080, Proto: "tcp"}); got != "8080" {
+		t.Errorf("FormatPort(tcp) = %q", got)
+	}
+	if got := FormatPort(ports.PortInfo{Proto: "unix", Address: "/run/app.sock"}); got != "-" {
+		t.Errorf("FormatPort(unix) = %q, want -", got)
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"node server.js", "node server.js"},
+		{"python3 -c import sys\nprint(sys.argv)", "python3 -c import sys print(sys.argv)"},
+		{"a\r\nb\tc", "a  b c"},
+		{"bell\x07 del\x7f", "bell  del "},
+		{"café ✓", "café ✓"},
+	}
+
+	for _, tt := range tests {
+		if got := Printable(tt.in); got != tt.want {
+			t.Errorf("Printable(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCmdlineColumnSingleLine(t *testing.T) {
+	c, _ := Lookup("cmdline")
+	got := c.Value(ports.PortInfo{Cmdline: "python3 -c import http.server\nhttp.server.test()"})
+	if want := "python3 -c import http.server http.server.test()"; got != want {
+		t.Errorf("cmdline = %q, want %q", got, want)
+	}
+}
+
+func TestColumnValues(t *testing.T) {
+	p := ports.PortInfo{
+		Port:      3000,
+		PID:       42,
+		Address:   "127.0.0.1",
+		Cmdline:   "node server.js",
+		StartTime: time.Now().Add(-90 * time.Second),
+		Memory:    2048,
+		CPU:       12.345,
+		Threads:   8,
+		FDs:       23,
+		State:     "S",
+		App:       "vite",
+		Project:   "acme-web",
+		Slice:     "system.slice",
+		Netns:     "blue",
+		Unit:      &ports.Unit{Name: "nginx.service", Restart: "always"},
+		Container: &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b6c7d", Image: "postgres:16"},
+	}
+
+	tests := map[string]string{
+		"port":      "3000",
+		"pid":       "42",
+		"address":   "127.0.0.1",
+		"cmdline":   "node server.js",
+		"uptime":    "1m30s",
+		"memory":    "2.0K",
+		"cpu":       "12.3",
+		"threads":   "8",
+		"fds":       "23",
+		"state":     "S",
+		"label":     "vite · acme-web",
+		"container": "4f1c2d3e4a5b",
+		"image":     "postgres:16",
+		"runtime":   "docker",
+		"slice":     "system.slice",
+		"unit":      "nginx.service",
+		"restart":   "always",
+		"netns":     "blue",
+	}
+	for key, want := range tests {
+		c, _ := Lookup(key)
+		if got := c.Value(p); got != want {
+			t.Errorf("%s value = %q, want %q", key, got, want)
+		}
+	}
+
+	// Unknown values render as a dash
+	for _, key := range []string{"address", "cmdline", "uptime", "memory", "cpu", "threads", "fds", "state", "label", "container", "image", "runtime", "slice", "unit", "restart", "netns"} {
+		c, _ := Lookup(key)
+		if got := c.Value(ports.PortInfo{}); got != "-" {
+			t.Errorf("%s value for empty entry = %q, want \"-\"", key, got)
+		}
+	}
+}
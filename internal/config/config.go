@@ -0,0 +1,408 @@
+// Package config loads tsunami's optional config file from
+// $XDG_CONFIG_HOME/tsunami/config.toml (or config.yaml) and resolves it,
+// together with TSUNAMI_* environment variables, into flag defaults.
+//
+// Precedence, highest first: command-line flags, environment variables,
+// the selected profile, the rest of the file, built-in defaults.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/keymap"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/labels"
+	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/query"
+	"github.com/wusher/tsunami/internal/theme"
+)
+
+// EnvConfig and EnvProfile override the config file path and profile
+const (
+	EnvConfig  = "TSUNAMI_CONFIG"
+	EnvProfile = "TSUNAMI_PROFILE"
+)
+
+// Config is the contents of a config file
+type Config struct {
+	// Profile is applied when neither --profile nor TSUNAMI_PROFILE is set
+	Profile string `toml:"profile" yaml:"profile"`
+
+	Defaults   Defaults   `toml:"defaults" yaml:"defaults"`
+	Escalation Escalation `toml:"escalation" yaml:"escalation"`
+	List       List       `toml:"list" yaml:"list"`
+	Protect    Protect    `toml:"protect" yaml:"protect"`
+	TUI        TUI        `toml:"tui" yaml:"tui"`
+
+	// Groups are named port lists usable as @name, e.g. web = [3000, "5173-5175"]
+	Groups map[string][]any `toml:"groups" yaml:"groups"`
+
+	// Labels name apps in the label column, tried before the built-in rules
+	Labels []LabelRule `toml:"labels" yaml:"labels"`
+
+	Profiles map[string]Profile `toml:"profiles" yaml:"profiles"`
+
+	// path is where the config was loaded from ("" if no file was found)
+	path string
+}
+
+// Defaults are default values for general flags
+type Defaults struct {
+	Force   *bool  `toml:"force" yaml:"force"`
+	Quiet   *bool  `toml:"quiet" yaml:"quiet"`
+	Verbose *bool  `toml:"verbose" yaml:"verbose"`
+	All     *bool  `toml:"all" yaml:"all"`
+	JSON    *bool  `toml:"json" yaml:"json"`
+	Filter  string `toml:"filter" yaml:"filter"`
+}
+
+// Escalation configures how processes are killed
+type Escalation struct {
+	Signal  string `toml:"signal" yaml:"signal"`
+	Timeout string `toml:"timeout" yaml:"timeout"`
+	// RespawnWindow is how long to watch a killed process's ports for a
+	// supervisor bringing it back; "0s" turns the watch off
+	RespawnWindow string `toml:"respawn_window" yaml:"respawn_window"`
+	// MaxKill is how many processes --name/--user/--match may kill
+	// without --yes-really
+	MaxKill *int `toml:"max_kill" yaml:"max_kill"`
+}
+
+// List configures the port list (for --list and the TUI)
+type List struct {
+	Columns []string `toml:"columns" yaml:"columns"`
+	Sort    string   `toml:"sort" yaml:"sort"`
+	Reverse *bool    `toml:"reverse" yaml:"reverse"`
+}
+
+// Protect adds processes to the protection policy
+type Protect struct {
+	Names []string `toml:"names" yaml:"names"`
+	Ports []int    `toml:"ports" yaml:"ports"`
+	Users []string `toml:"users" yaml:"users"`
+	Paths []string `toml:"paths" yaml:"paths"`
+}
+
+// TUI configures the interactive interface
+type TUI struct {
+	Theme  string              `toml:"theme" yaml:"theme"`
+	Colors map[string]string   `toml:"colors" yaml:"colors"`
+	Keys   map[string][]string `toml:"keys" yaml:"keys"`
+}
+
+// LabelRule names the app of the processes whose command line matches
+// Match and whose executable matches Exe, both regular expressions. Name
+// may refer to Match's groups, e.g. "storybook $1".
+type LabelRule struct {
+	Name  string `toml:"name" yaml:"name"`
+	Match string `toml:"match" yaml:"match"`
+	Exe   string `toml:"exe" yaml:"exe"`
+}
+
+// Profile is a named overlay of flag defaults, selected with --profile
+type Profile struct {
+	Defaults   Defaults   `toml:"defaults" yaml:"defaults"`
+	Escalation Escalation `toml:"escalation" yaml:"escalation"`
+	List       List       `toml:"list" yaml:"list"`
+}
+
+// FileNames are the config file names looked for, in order
+var FileNames = []string{"config.toml", "config.yaml", "config.yml"}
+
+// Dir returns $XDG_CONFIG_HOME/tsunami, defaulting to ~/.config/tsunami
+func Dir() (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot find config directory: %w", err)
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "tsunami"), nil
+}
+
+// Path returns the config file to load: explicit if set, else
+// $TSUNAMI_CONFIG, else the config file found in Dir. When no file
+// exists, the preferred location (config.toml) is returned with
+// found=false.
+func Path(explicit string) (path string, found bool, err error) {
+	if explicit == "" {
+		explicit = os.Getenv(EnvConfig)
+	}
+	if explicit != "" {
+		_, err := os.Stat(explicit)
+		return explicit, err == nil, nil
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return "", false, err
+	}
+	var existing []string
+	for _, name := range FileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			existing = append(existing, filepath.Join(dir, name))
+		}
+	}
+	switch len(existing) {
+	case 0:
+		return filepath.Join(dir, FileNames[0]), false, nil
+	case 1:
+		return existing[0], true, nil
+	default:
+		return "", false, fmt.Errorf("multiple config files found: %s (keep one)", strings.Join(existing, ", "))
+	}
+}
+
+// Load reads and decodes the config file at path, rejecting unknown keys.
+// A missing file yields an empty config. The config is not validated.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Parse(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.path = path
+	return cfg, nil
+}
+
+// Parse decodes config data in the format given by ext (".toml", ".yaml"
+// or ".yml")
+func Parse(data []byte, ext string) (*Config, error) {
+	var cfg Config
+	switch strings.ToLower(ext) {
+	case ".toml":
+		md, err := toml.Decode(string(data), &cfg)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return nil, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (use .toml or .yaml)", ext)
+	}
+	return &cfg, nil
+}
+
+// File returns the path the config was loaded from, or "" if none
+func (c *Config) File() string {
+	return c.path
+}
+
+// groupNamePattern restricts group names to what is easy to type after @
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// portSpecPattern matches a port or port range
+var portSpecPattern = regexp.MustCompile(`^(\d+)(?:-(\d+))?$`)
+
+// Validate checks every value in the config, reporting all problems
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(err error, format string, args ...any) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err))
+		}
+	}
+
+	validateFlags := func(prefix string, d Defaults, e Escalation, l List) {
+		if d.Filter != "" {
+			_, err := query.Parse(d.Filter)
+			add(err, "%sdefaults.filter", prefix)
+		}
+		if e.Signal != "" {
+			_, err := killer.ParseSignal(e.Signal)
+			add(err, "%sescalation.signal", prefix)
+		}
+		if e.Timeout != "" {
+			d, err := time.ParseDuration(e.Timeout)
+			if err == nil && d <= 0 {
+				err = errors.New("must be positive")
+			}
+			add(err, "%sescalation.timeout", prefix)
+		}
+		if e.RespawnWindow != "" {
+			d, err := time.ParseDuration(e.RespawnWindow)
+			if err == nil && d < 0 {
+				err = errors.New("must not be negative")
+			}
+			add(err, "%sescalation.respawn_window", prefix)
+		}
+		if e.MaxKill != nil && *e.MaxKill < 1 {
+			add(errors.New("must be at least 1"), "%sescalation.max_kill", prefix)
+		}
+		if len(l.Columns) > 0 {
+			_, err := columns.Parse(strings.Join(l.Columns, ","))
+			add(err, "%slist.columns", prefix)
+		}
+		if l.Sort != "" {
+			_, err := ports.ParseSortKey(l.Sort)
+			add(err, "%slist.sort", prefix)
+		}
+	}
+
+	validateFlags("", c.Defaults, c.Escalation, c.List)
+	for _, name := range sortedKeys(c.Profiles) {
+		p := c.Profiles[name]
+		validateFlags("profiles."+name+".", p.Defaults, p.Escalation, p.List)
+	}
+	if c.Profile != "" {
+		if _, ok := c.Profiles[c.Profile]; !ok {
+			add(fmt.Errorf("no profile named %q", c.Profile), "profile")
+		}
+	}
+
+	_, err := c.Rules()
+	add(err, "protect")
+
+	_, err = c.Theme()
+	add(err, "tui")
+	_, err = c.Keymap()
+	add(err, "tui.keys")
+
+	_, err = c.PortGroups()
+	add(err, "groups")
+
+	_, err = c.LabelRules()
+	add(err, "labels")
+
+	return errors.Join(errs...)
+}
+
+// Rules returns the protection rules from the [protect] section
+func (c *Config) Rules() ([]killer.Rule, error) {
+	var specs []string
+	for _, n := range c.Protect.Names {
+		specs = append(specs, "name="+n)
+	}
+	for _, p := range c.Protect.Ports {
+		specs = append(specs, "port="+strconv.Itoa(p))
+	}
+	for _, u := range c.Protect.Users {
+		specs = append(specs, "user="+u)
+	}
+	for _, p := range c.Protect.Paths {
+		specs = append(specs, "path="+p)
+	}
+	return parseRules(specs)
+}
+
+// Theme returns the TUI theme with any color overrides applied
+func (c *Config) Theme() (theme.Theme, error) {
+	t, err := theme.Lookup(c.TUI.Theme)
+	if err != nil {
+		return theme.Theme{}, err
+	}
+	return t.WithColors(c.TUI.Colors)
+}
+
+// Keymap returns the TUI keymap with any rebinding applied
+func (c *Config) Keymap() (keymap.Keymap, error) {
+	return keymap.Default().WithBindings(c.TUI.Keys)
+}
+
+// PortGroups returns the [groups] section as port specs ("3000" or
+// "3000-3010") keyed by group name
+func (c *Config) PortGroups() (map[string][]string, error) {
+	groups := make(map[string][]string, len(c.Groups))
+	for _, name := range sortedKeys(c.Groups) {
+		if !groupNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid group name %q (use letters, digits, - and _)", name)
+		}
+		if len(c.Groups[name]) == 0 {
+			return nil, fmt.Errorf("group %s is empty", name)
+		}
+		for _, v := range c.Groups[name] {
+			spec, err := portSpec(v)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+			groups[name] = append(groups[name], spec)
+		}
+	}
+	return groups, nil
+}
+
+// LabelRules returns the compiled label rules, in the order given
+func (c *Config) LabelRules() ([]labels.Rule, error) {
+	var rules []labels.Rule
+	for _, lr := range c.Labels {
+		r, err := labels.NewRule(lr.Name, lr.Match, lr.Exe)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// portSpec normalizes a group entry, a number or a "start-end" string
+func portSpec(v any) (string, error) {
+	var s string
+	switch v := v.(type) {
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return "", fmt.Errorf("invalid port %v (use a number or \"start-end\")", v)
+	}
+
+	m := portSpecPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", fmt.Errorf("invalid port %q (use a number or \"start-end\")", s)
+	}
+	start, _ := strconv.Atoi(m[1])
+	end := start
+	if m[2] != "" {
+		end, _ = strconv.Atoi(m[2])
+	}
+	if start < 1 || end > 65535 || start > end {
+		return "", fmt.Errorf("invalid port %q (must be 1-65535, start <= end)", s)
+	}
+	return s, nil
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,451 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTOML = `
+profile = "dev"
+
+[defaults]
+force = true
+filter = "user:root"
+
+[escalation]
+signal = "INT"
+timeout = "5s"
+max_kill = 3
+
+[list]
+columns = ["port", "pid", "process"]
+sort = "pid"
+
+[protect]
+names = ["postgres"]
+ports = [5432]
+
+[tui]
+theme = "light"
+colors = { accent = "#123456" }
+keys = { up = ["up", "ctrl+p"] }
+
+[groups]
+web = [3000, 5173, 8080]
+db = ["5432", "6379-6380"]
+
+[[labels]]
+name = "storybook"
+match = 'storybook\s+dev'
+
+[[labels]]
+name = "worker"
+exe = "/opt/acme/bin/"
+
+[profiles.dev.escalation]
+timeout = "1s"
+
+[profiles.ci.defaults]
+quiet = true
+`
+
+const testYAML = `
+profile: dev
+defaults:
+  force: true
+  filter: "user:root"
+escalation:
+  signal: INT
+  timeout: 5s
+  max_kill: 3
+list:
+  columns: [port, pid, process]
+  sort: pid
+protect:
+  names: [postgres]
+  ports: [5432]
+tui:
+  theme: light
+  colors:
+    accent: "#123456"
+  keys:
+    up: [up, ctrl+p]
+groups:
+  web: [3000, 5173, 8080]
+  db: ["5432", "6379-6380"]
+labels:
+  - name: storybook
+    match: 'storybook\s+dev'
+  - name: worker
+    exe: /opt/acme/bin/
+profiles:
+  dev:
+    escalation:
+      timeout: 1s
+  ci:
+    defaults:
+      quiet: true
+`
+
+func noEnv(string) string { return "" }
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestParseFormats(t *testing.T) {
+	for _, tt := range []struct{ ext, data string }{
+		{".toml", testTOML},
+		{".yaml", testYAML},
+		{".yml", testYAML},
+	} {
+		t.Run(tt.ext, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data), tt.ext)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if cfg.Defaults.Force == nil || !*cfg.Defaults.Force {
+				t.Error("defaults.force not set")
+			}
+			if cfg.Escalation.MaxKill == nil || *cfg.Escalation.MaxKill != 3 {
+				t.Error("escalation.max_kill not 3")
+			}
+
+			groups, err := cfg.PortGroups()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]string{
+				"web": {"3000", "5173", "8080"},
+				"db":  {"5432", "6379-6380"},
+			}
+			if !reflect.DeepEqual(groups, want) {
+				t.Errorf("groups = %v, want %v", groups, want)
+			}
+
+			rules, err := cfg.Rules()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var specs []string
+			for _, r := range rules {
+				specs = append(specs, r.String())
+			}
+			if got := strings.Join(specs, " "); got != "name=postgres port=5432" {
+				t.Errorf("rules = %q", got)
+			}
+
+			theme, err := cfg.Theme()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if theme.Name != "light" || theme.Accent != "#123456" {
+				t.Errorf("theme = %s accent %s, want light #123456", theme.Name, theme.Accent)
+			}
+
+			labelRules, err := cfg.LabelRules()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(labelRules) != 2 || labelRules[0].Name != "storybook" || labelRules[1].Name != "worker" {
+				t.Errorf("label rules = %+v", labelRules)
+			}
+
+			keymap, err := cfg.Keymap()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(keymap["up"], []string{"up", "ctrl+p"}) {
+				t.Errorf("up keys = %v", keymap["up"])
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, ext, data, want string
+	}{
+		{"toml unknown key", ".toml", "[defaults]\nforse = true\n", "unknown keys: defaults.forse"},
+		{"yaml unknown key", ".yaml", "defaults:\n  forse: true\n", "forse"},
+		{"toml syntax", ".toml", "[defaults\n", ""},
+		{"bad type", ".toml", "[defaults]\nforce = \"yes\"\n", ""},
+		{"format", ".json", "{}", "unsupported config format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.ext)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, ext := range []string{".toml", ".yaml"} {
+		cfg, err := Parse(nil, ext)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", ext, err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("empty %s config invalid: %v", ext, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"signal", "[escalation]\nsignal = \"BOGUS\"\n", "escalation.signal"},
+		{"timeout", "[escalation]\ntimeout = \"soon\"\n", "escalation.timeout"},
+		{"negative timeout", "[escalation]\ntimeout = \"-1s\"\n", "must be positive"},
+		{"respawn_window", "[escalation]\nrespawn_window = \"-1s\"\n", "escalation.respawn_window"},
+		{"max_kill", "[escalation]\nmax_kill = 0\n", "escalation.max_kill"},
+		{"filter", "[defaults]\nfilter = \"port:>\"\n", "defaults.filter"},
+		{"columns", "[list]\ncolumns = [\"bogus\"]\n", "list.columns"},
+		{"sort", "[list]\nsort = \"bogus\"\n", "list.sort"},
+		{"profile key", "profile = \"nope\"\n", "no profile named"},
+		{"profile values", "[profiles.ci.escalation]\nsignal = \"BOGUS\"\n", "profiles.ci.escalation.signal"},
+		{"protect", "[protect]\nports = [70000]\n", "protect"},
+		{"theme", "[tui]\ntheme = \"neon\"\n", "unknown theme"},
+		{"color", "[tui.colors]\nsparkle = \"#fff\"\n", "unknown theme color"},
+		{"key action", "[tui.keys]\njump = [\"ctrl+j\"]\n", "unknown key action"},
+		{"printable key", "[tui.keys]\nup = [\"k\"]\n", "printable keys"},
+		{"duplicate key", "[tui.keys]\nup = [\"down\"]\n", "bound to both"},
+		{"group name", "[groups]\n\"we b\" = [80]\n", "invalid group name"},
+		{"group port", "[groups]\nweb = [0]\n", "invalid port"},
+		{"group range", "[groups]\nweb = [\"90-80\"]\n", "invalid port"},
+		{"empty group", "[groups]\nweb = []\n", "is empty"},
+		{"label pattern", "[[labels]]\nname = \"vite\"\nmatch = \"vite(\"\n", "labels: rule vite: invalid match"},
+		{"label without pattern", "[[labels]]\nname = \"vite\"\n", "neither match nor exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data), ".toml")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			err = cfg.Validate()
+			if err == nil {
+				t.Fatal("expected validation error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAll(t *testing.T) {
+	cfg, err := Parse([]byte("[escalation]\nsignal = \"BOGUS\"\ntimeout = \"soon\"\n"), ".toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "signal") || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Validate() = %v, want both signal and timeout errors", err)
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	cfg, err := Parse([]byte(testTOML), ".toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := func(profile string, getenv func(string) string) map[string]Setting {
+		m := make(map[string]Setting)
+		for _, s := range cfg.Settings(profile, getenv) {
+			m[s.Flag] = s
+		}
+		return m
+	}
+
+	// File only
+	s := settings("", noEnv)
+	if s["timeout"].Value != "5s" || s["timeout"].Source != "file" {
+		t.Errorf("timeout = %+v, want 5s from file", s["timeout"])
+	}
+	if s["columns"].Value != "port,pid,process" {
+		t.Errorf("columns = %q", s["columns"].Value)
+	}
+	if s["force"].Value != "true" {
+		t.Errorf("force = %q", s["force"].Value)
+	}
+	if _, ok := s["quiet"]; ok {
+		t.Error("quiet should not be set without the ci profile")
+	}
+
+	// Profile overrides file
+	s = settings("dev", noEnv)
+	if s["timeout"].Value != "1s" || s["timeout"].Source != "profile dev" {
+		t.Errorf("timeout = %+v, want 1s from profile dev", s["timeout"])
+	}
+	if s["signal"].Source != "file" {
+		t.Errorf("signal source = %q, want file", s["signal"].Source)
+	}
+
+	// Environment overrides profile
+	s = settings("dev", env(map[string]string{"TSUNAMI_TIMEOUT": "9s", "TSUNAMI_VERBOSE": "true", "TSUNAMI_RESPAWN_WINDOW": "0s"}))
+	if s["timeout"].Value != "9s" || s["timeout"].Source != "TSUNAMI_TIMEOUT" {
+		t.Errorf("timeout = %+v, want 9s from TSUNAMI_TIMEOUT", s["timeout"])
+	}
+	if s["verbose"].Value != "true" {
+		t.Errorf("verbose = %+v", s["verbose"])
+	}
+	if s["respawn-window"].Value != "0s" {
+		t.Errorf("respawn-window = %+v", s["respawn-window"])
+	}
+
+	// Settings come out in Flags order
+	var order []string
+	for _, st := range cfg.Settings("", noEnv) {
+		order = append(order, st.Flag)
+	}
+	want := []string{"signal", "timeout", "force", "filter", "sort", "columns"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestActiveProfile(t *testing.T) {
+	cfg, err := Parse([]byte(testTOML), ".toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		explicit string
+		env      string
+		want     string
+		wantErr  bool
+	}{
+		{"", "", "dev", false},
+		{"", "ci", "ci", false},
+		{"ci", "dev", "ci", false},
+		{"nope", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cfg.ActiveProfile(tt.explicit, env(map[string]string{EnvProfile: tt.env}))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ActiveProfile(%q, env %q) error = %v", tt.explicit, tt.env, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ActiveProfile(%q, env %q) = %q, want %q", tt.explicit, tt.env, got, tt.want)
+		}
+	}
+
+	empty := &Config{}
+	if got, err := empty.ActiveProfile("", noEnv); got != "" || err != nil {
+		t.Errorf("empty config profile = %q, %v", got, err)
+	}
+}
+
+func TestMaxKill(t *testing.T) {
+	cfg, err := Parse([]byte(testTOML+"\n[profiles.big.escalation]\nmax_kill = 50\n"), ".toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := cfg.MaxKill(""); !ok || n != 3 {
+		t.Errorf("MaxKill() = %d, %v, want 3", n, ok)
+	}
+	if n, ok := cfg.MaxKill("big"); !ok || n != 50 {
+		t.Errorf("MaxKill(big) = %d, %v, want 50", n, ok)
+	}
+	if _, ok := (&Config{}).MaxKill(""); ok {
+		t.Error("empty config should not set max_kill")
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	if got := EnvVar("timeout"); got != "TSUNAMI_TIMEOUT" {
+		t.Errorf("EnvVar(timeout) = %q", got)
+	}
+}
+
+func TestPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv(EnvConfig, "")
+	cfgDir := filepath.Join(dir, "tsunami")
+
+	path, found, err := Path("")
+	if err != nil || found || path != filepath.Join(cfgDir, "config.toml") {
+		t.Errorf("no file: Path() = %q, %v, %v", path, found, err)
+	}
+
+	if err := os.MkdirAll(cfgDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	yamlPath := filepath.Join(cfgDir, "config.yaml")
+	if err := os.WriteFile(yamlPath, []byte(testYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, found, err = Path("")
+	if err != nil || !found || path != yamlPath {
+		t.Errorf("yaml file: Path() = %q, %v, %v", path, found, err)
+	}
+
+	tomlPath := filepath.Join(cfgDir, "config.toml")
+	if err := os.WriteFile(tomlPath, []byte(testTOML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Path(""); err == nil || !strings.Contains(err.Error(), "multiple config files") {
+		t.Errorf("two files: error = %v", err)
+	}
+
+	// An explicit path or $TSUNAMI_CONFIG skips the search
+	path, found, err = Path(tomlPath)
+	if err != nil || !found || path != tomlPath {
+		t.Errorf("explicit: Path() = %q, %v, %v", path, found, err)
+	}
+	t.Setenv(EnvConfig, yamlPath)
+	path, found, err = Path("")
+	if err != nil || !found || path != yamlPath {
+		t.Errorf("env: Path() = %q, %v, %v", path, found, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := Load(filepath.Join(dir, "missing.toml"))
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if cfg.File() != "" {
+		t.Errorf("missing file path = %q", cfg.File())
+	}
+
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte(testTOML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File() != path {
+		t.Errorf("File() = %q, want %q", cfg.File(), path)
+	}
+
+	bad := filepath.Join(dir, "bad.toml")
+	if err := os.WriteFile(bad, []byte("nonsense = [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(bad); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("bad file error = %v, want it to name the file", err)
+	}
+}
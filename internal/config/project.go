@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/killer"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the per-project file looked for from the working
+// directory upwards
+const ProjectFileName = ".tsunami.yaml"
+
+// Project is a .tsunami.yaml file declaring a project's named ports and
+// which processes may be killed while working in it
+type Project struct {
+	// Name defaults to the directory containing the file
+	Name string `yaml:"name"`
+	// Ports maps names to a port, a "start-end" range or a list of them
+	Ports map[string]any `yaml:"ports"`
+	// Allow, if set, limits kills to processes matching one of these
+	// protection rules (name=, port=, user=, path=)
+	Allow []string `yaml:"allow"`
+	// Forbid protects processes matching any of these rules
+	Forbid []string `yaml:"forbid"`
+
+	path string
+}
+
+// FindProject walks up from dir to the filesystem root looking for
+// ProjectFileName. It returns nil if there is none.
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if _, err := os.Stat(path); err == nil {
+			return LoadProject(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProject reads, decodes and validates the project file at path
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Project
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p.path = path
+	if p.Name == "" {
+		p.Name = filepath.Base(filepath.Dir(path))
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid project file %s:\n%w", path, err)
+	}
+	return &p, nil
+}
+
+// File returns the path the project was loaded from
+func (p *Project) File() string {
+	return p.path
+}
+
+// Validate checks every value in the project file, reporting all problems
+func (p *Project) Validate() error {
+	var errs []error
+	if _, err := p.PortGroups(); err != nil {
+		errs = append(errs, fmt.Errorf("ports: %w", err))
+	}
+	if _, err := p.AllowRules(); err != nil {
+		errs = append(errs, fmt.Errorf("allow: %w", err))
+	}
+	if _, err := p.ForbidRules(); err != nil {
+		errs = append(errs, fmt.Errorf("forbid: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// PortGroups returns the named ports as port specs keyed by name, in the
+// same form as Config.PortGroups
+func (p *Project) PortGroups() (map[string][]string, error) {
+	groups := make(map[string][]string, len(p.Ports))
+	for _, name := range sortedKeys(p.Ports) {
+		if !groupNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid port name %q (use letters, digits, - and _)", name)
+		}
+		values, ok := p.Ports[name].([]any)
+		if !ok {
+			values = []any{p.Ports[name]}
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%s has no ports", name)
+		}
+		for _, v := range values {
+			spec, err := portSpec(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			groups[name] = append(groups[name], spec)
+		}
+	}
+	return groups, nil
+}
+
+// PortSpecs returns every named port spec, in name order
+func (p *Project) PortSpecs() []string {
+	groups, _ := p.PortGroups()
+	var specs []string
+	for _, name := range sortedKeys(groups) {
+		specs = append(specs, groups[name]...)
+	}
+	return specs
+}
+
+// Filter returns a filter query matching the project's ports, or "" if it
+// names none
+func (p *Project) Filter() string {
+	specs := p.PortSpecs()
+	if len(specs) == 0 {
+		return ""
+	}
+	return "port:" + strings.Join(specs, ",")
+}
+
+// AllowRules returns the parsed allow list
+func (p *Project) AllowRules() ([]killer.Rule, error) {
+	return parseRules(p.Allow)
+}
+
+// ForbidRules returns the parsed forbid list
+func (p *Project) ForbidRules() ([]killer.Rule, error) {
+	return parseRules(p.Forbid)
+}
+
+// parseRules parses kind=value protection rules
+func parseRules(specs []string) ([]killer.Rule, error) {
+	var rules []killer.Rule
+	for _, spec := range specs {
+		r, err := killer.ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
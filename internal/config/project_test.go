@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testProject = `
+name: shop
+ports:
+  api: 8080
+  web: [5173, "5174"]
+  workers: "9000-9003"
+allow: [name=node, port=8080]
+forbid: [name=postgres]
+`
+
+func writeProject(t *testing.T, dir, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, ProjectFileName)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindProject(t *testing.T) {
+	root := t.TempDir()
+	path := writeProject(t, root, testProject)
+	nested := filepath.Join(root, "services", "api")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{root, nested} {
+		p, err := FindProject(dir)
+		if err != nil {
+			t.Fatalf("FindProject(%s): %v", dir, err)
+		}
+		if p == nil || p.File() != path {
+			t.Fatalf("FindProject(%s) = %+v, want %s", dir, p, path)
+		}
+	}
+
+	// The nearest file wins
+	inner := writeProject(t, nested, "ports: {api: 18080}\n")
+	p, err := FindProject(nested)
+	if err != nil || p.File() != inner {
+		t.Errorf("FindProject(nested) = %+v, %v, want %s", p, err, inner)
+	}
+	if p.Name != "api" {
+		t.Errorf("Name = %q, want the directory name", p.Name)
+	}
+}
+
+func TestFindProjectNone(t *testing.T) {
+	p, err := FindProject(t.TempDir())
+	if err != nil || p != nil {
+		t.Errorf("FindProject() = %+v, %v, want nil", p, err)
+	}
+}
+
+func TestProjectPorts(t *testing.T) {
+	p, err := LoadProject(writeProject(t, t.TempDir(), testProject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "shop" {
+		t.Errorf("Name = %q", p.Name)
+	}
+
+	groups, err := p.PortGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"api":     {"8080"},
+		"web":     {"5173", "5174"},
+		"workers": {"9000-9003"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("PortGroups() = %v, want %v", groups, want)
+	}
+	if got := p.Filter(); got != "port:8080,5173,5174,9000-9003" {
+		t.Errorf("Filter() = %q", got)
+	}
+	if (&Project{}).Filter() != "" {
+		t.Error("a project without ports should not filter")
+	}
+
+	allow, err := p.AllowRules()
+	if err != nil || len(allow) != 2 || allow[1].String() != "port=8080" {
+		t.Errorf("AllowRules() = %v, %v", allow, err)
+	}
+	forbid, err := p.ForbidRules()
+	if err != nil || len(forbid) != 1 || forbid[0].String() != "name=postgres" {
+		t.Errorf("ForbidRules() = %v, %v", forbid, err)
+	}
+}
+
+func TestLoadProjectErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"unknown key", "portz: {api: 80}\n", "portz"},
+		{"bad port", "ports: {api: 70000}\n", "ports: api: invalid port"},
+		{"bad range", "ports: {api: \"90-80\"}\n", "invalid port"},
+		{"empty list", "ports: {api: []}\n", "api has no ports"},
+		{"bad name", "ports: {\"a pi\": 80}\n", "invalid port name"},
+		{"bad allow", "allow: [nodejs]\n", "allow: invalid protection rule"},
+		{"bad forbid", "forbid: [kind=x]\n", "forbid: invalid protection rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeProject(t, t.TempDir(), tt.data)
+			_, err := LoadProject(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q should name %s and mention %q", err, path, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProjectEmpty(t *testing.T) {
+	p, err := LoadProject(writeProject(t, t.TempDir(), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.PortSpecs()) != 0 {
+		t.Errorf("PortSpecs() = %v", p.PortSpecs())
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Flags lists the flags the config file and environment can set, in
+// display order
+var Flags = []string{"signal", "timeout", "respawn-window", "force", "quiet", "verbose", "all", "json", "filter", "sort", "reverse", "columns"}
+
+// Setting is a flag value taken from the config file or environment
+type Setting struct {
+	Flag   string
+	Value  string
+	Source string // "file", "profile <name>" or the environment variable
+}
+
+// EnvVar returns the environment variable that sets flag, e.g.
+// TSUNAMI_TIMEOUT for --timeout
+func EnvVar(flag string) string {
+	return "TSUNAMI_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// ActiveProfile returns the profile to apply: explicit if set, else
+// $TSUNAMI_PROFILE, else the file's profile key. "" means none.
+func (c *Config) ActiveProfile(explicit string, getenv func(string) string) (string, error) {
+	name := explicit
+	if name == "" {
+		name = getenv(EnvProfile)
+	}
+	if name == "" {
+		name = c.Profile
+	}
+	if name == "" {
+		return "", nil
+	}
+	if _, ok := c.Profiles[name]; !ok {
+		return "", fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(sortedKeys(c.Profiles), ", "))
+	}
+	return name, nil
+}
+
+// Settings resolves the flag values set by the file, the given profile
+// and the environment, in the order of Flags. Each flag appears at most
+// once, with the value of its highest-precedence source.
+func (c *Config) Settings(profile string, getenv func(string) string) []Setting {
+	resolved := make(map[string]Setting)
+	for flag, value := range flagValues(c.Defaults, c.Escalation, c.List) {
+		resolved[flag] = Setting{Flag: flag, Value: value, Source: "file"}
+	}
+	if p, ok := c.Profiles[profile]; ok {
+		for flag, value := range flagValues(p.Defaults, p.Escalation, p.List) {
+			resolved[flag] = Setting{Flag: flag, Value: value, Source: "profile " + profile}
+		}
+	}
+	for _, flag := range Flags {
+		if value := getenv(EnvVar(flag)); value != "" {
+			resolved[flag] = Setting{Flag: flag, Value: value, Source: EnvVar(flag)}
+		}
+	}
+
+	var settings []Setting
+	for _, flag := range Flags {
+		if s, ok := resolved[flag]; ok {
+			settings = append(settings, s)
+		}
+	}
+	return settings
+}
+
+// MaxKill returns escalation.max_kill from the profile or file
+func (c *Config) MaxKill(profile string) (int, bool) {
+	if p, ok := c.Profiles[profile]; ok && p.Escalation.MaxKill != nil {
+		return *p.Escalation.MaxKill, true
+	}
+	if c.Escalation.MaxKill != nil {
+		return *c.Escalation.MaxKill, true
+	}
+	return 0, false
+}
+
+// flagValues converts the set fields of a defaults/escalation/list triple
+// into flag values
+func flagValues(d Defaults, e Escalation, l List) map[string]string {
+	values := make(map[string]string)
+	setBool := func(flag string, b *bool) {
+		if b != nil {
+			values[flag] = strconv.FormatBool(*b)
+		}
+	}
+	setString := func(flag, s string) {
+		if s != "" {
+			values[flag] = s
+		}
+	}
+
+	setBool("force", d.Force)
+	setBool("quiet", d.Quiet)
+	setBool("verbose", d.Verbose)
+	setBool("all", d.All)
+	setBool("json", d.JSON)
+	setString("filter", d.Filter)
+	setString("signal", e.Signal)
+	setString("timeout", e.Timeout)
+	setString("respawn-window", e.RespawnWindow)
+	setString("sort", l.Sort)
+	setBool("reverse", l.Reverse)
+	if len(l.Columns) > 0 {
+		values["columns"] = strings.Join(l.Columns, ",")
+	}
+	return values
+}
@@ -0,0 +1,355 @@
+// Package docker maps docker-proxy and rootlesskit listeners to the
+// containers they publish, using the Docker Engine API on its Unix socket,
+// and stops those containers instead of killing the proxy. It also names
+// the Docker containers that the ports package finds from cgroups.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// DefaultSocket is where the Docker daemon listens unless DOCKER_HOST says
+// otherwise
+const DefaultSocket = "/var/run/docker.sock"
+
+// SocketPath returns the daemon socket from a unix:// DOCKER_HOST, or
+// DefaultSocket
+func SocketPath() string {
+	if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok && host != "" {
+		return host
+	}
+	return DefaultSocket
+}
+
+// Client talks to the Docker Engine API over a Unix socket
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// NewClient creates a client for the daemon listening on socket. Each
+// request uses its own connection, closed once the response is read, so
+// clients created for every watch event hold no descriptors between them.
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{socket: socket, http: &http.Client{Transport: transport}}
+}
+
+// Container is a running container as listed by the daemon
+type Container struct {
+	ID              string   `json:"Id"`
+	Names           []string `json:"Names"`
+	Image           string   `json:"Image"`
+	Ports           []Port   `json:"Ports"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Port is a container port, published on the host if PublicPort is set
+type Port struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"` // tcp, udp or sctp
+}
+
+// Name returns the container's name without the leading slash, or its
+// short ID if it has none
+func (c Container) Name() string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return ShortID(c.ID)
+}
+
+// hasIP reports whether the container has ip on any of its networks
+func (c Container) hasIP(ip string) bool {
+	for _, n := range c.NetworkSettings.Networks {
+		if n.IPAddress == ip || n.GlobalIPv6Address == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortID abbreviates a container ID the way the docker CLI does
+func ShortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// Containers lists the running containers
+func (c *Client) Containers(ctx context.Context) ([]Container, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	var list []Container
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("docker: invalid container list: %w", err)
+	}
+	return list, nil
+}
+
+// Stop stops a container, giving it timeout to exit before the daemon
+// kills it. Stopping a container that is not running is not an error.
+func (c *Client) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	q := url.Values{"t": {strconv.Itoa(int(timeout.Round(time.Second) / time.Second))}}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", q)
+	if err != nil {
+		return err
+	}
+	return closeBody(resp)
+}
+
+// Kill sends signal (e.g. "HUP") to a container's main process
+func (c *Client) Kill(ctx context.Context, id, signal string) error {
+	q := url.Values{"signal": {signal}}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/kill", q)
+	if err != nil {
+		return err
+	}
+	return closeBody(resp)
+}
+
+// closeBody drains and closes the body of resp
+func closeBody(resp *http.Response) error {
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// do sends a request and turns an error status into an error carrying the
+// daemon's message. 304 Not Modified (already stopped) counts as success.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("docker: cannot reach the daemon at %s: %w", c.socket, err)
+	}
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("docker: permission denied: %s", body.Message)
+	}
+	return nil, fmt.Errorf("docker: %s", body.Message)
+}
+
+// Proxy is what a docker-proxy process forwards: a host port to a port on
+// a container's address. ContainerIP is empty for rootlesskit, which only
+// knows the host port.
+type Proxy struct {
+	Proto         string
+	HostIP        string
+	HostPort      int
+	ContainerIP   string
+	ContainerPort int
+}
+
+// IsProxy reports whether p is held by docker-proxy or rootlesskit, which
+// publish container ports on the host
+func IsProxy(p ports.PortInfo) bool {
+	name := p.Process
+	if fields := strings.Fields(p.Cmdline); len(fields) > 0 {
+		exe := fields[0]
+		name = exe[strings.LastIndex(exe, "/")+1:]
+	}
+	return name == "docker-proxy" || strings.HasPrefix(name, "rootlesskit")
+}
+
+// Published returns the container a proxy listener publishes, or nil if p
+// is not a proxy or its container is unknown
+func Published(p ports.PortInfo) *ports.Container {
+	if p.Container == nil || !IsProxy(p) {
+		return nil
+	}
+	return p.Container
+}
+
+// CheckProxy returns an error for a proxy listener whose container is
+// unknown. Killing the proxy would break Docker networking and leave the
+// container running. annotateErr, the error Annotate returned for p if
+// any, says why the container is unknown.
+func CheckProxy(p ports.PortInfo, annotateErr error) error {
+	if p.Container != nil || !IsProxy(p) {
+		return nil
+	}
+	if annotateErr != nil {
+		return fmt.Errorf("%s (PID %d) forwards port %d to a container that could not be identified (%v); stop the container with docker instead",
+			p.Process, p.PID, p.Port, annotateErr)
+	}
+	return fmt.Errorf("%s (PID %d) forwards port %d to a container that could not be identified; stop the container with docker instead",
+		p.Process, p.PID, p.Port)
+}
+
+// Describe names a container and its image, e.g. "container db (postgres:16)"
+func Describe(c ports.Container) string {
+	name := c.Name
+	if name == "" {
+		name = ShortID(c.ID)
+	}
+	if c.Image == "" {
+		return "container " + name
+	}
+	return fmt.Sprintf("container %s (%s)", name, c.Image)
+}
+
+// ParseProxy reads the forwarding arguments from a proxy listener's command
+// line. ok is false if p is not a proxy.
+func ParseProxy(p ports.PortInfo) (proxy Proxy, ok bool) {
+	if !IsProxy(p) {
+		return Proxy{}, false
+	}
+	proxy = Proxy{Proto: "tcp", HostIP: p.Address, HostPort: p.Port}
+	args := strings.Fields(p.Cmdline)
+	for i := 1; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		switch name {
+		case "proto":
+			proxy.Proto = value
+		case "host-ip":
+			proxy.HostIP = value
+		case "host-port":
+			if n, err := strconv.Atoi(value); err == nil {
+				proxy.HostPort = n
+			}
+		case "container-ip":
+			proxy.ContainerIP = value
+		case "container-port":
+			if n, err := strconv.Atoi(value); err == nil {
+				proxy.ContainerPort = n
+			}
+		}
+	}
+	return proxy, true
+}
+
+// Match finds the container the proxy forwards to: by container address
+// when the proxy names one, otherwise by the published host port
+func (p Proxy) Match(containers []Container) (Container, bool) {
+	for _, c := range containers {
+		if p.ContainerIP != "" && c.hasIP(p.ContainerIP) {
+			return c, true
+		}
+	}
+	if p.ContainerIP != "" {
+		return Container{}, false
+	}
+	for _, c := range containers {
+		for _, port := range c.Ports {
+			if port.PublicPort == p.HostPort && strings.HasPrefix(p.Proto, port.Type) {
+				return c, true
+			}
+		}
+	}
+	return Container{}, false
+}
+
+// Annotate annotates list like Client.Annotate, asking the daemon at
+// SocketPath(). Its error, which is also what CheckProxy reports for a
+// proxy it leaves unidentified, means list was not annotated.
+func Annotate(ctx context.Context, list []ports.PortInfo) error {
+	return NewClient(SocketPath()).Annotate(ctx, list)
+}
+
+// Annotate sets Container on each proxy listener in list that forwards to
+// a running container, and names the Docker containers that listeners run
+// in. The daemon is only asked when list has such a listener.
+func (c *Client) Annotate(ctx context.Context, list []ports.PortInfo) error {
+	var containers []Container
+	listed := false
+	for i := range list {
+		proxy, isProxy := ParseProxy(list[i])
+		if !isProxy && !unnamed(list[i].Container) {
+			continue
+		}
+		if !listed {
+			var err error
+			if containers, err = c.Containers(ctx); err != nil {
+				return err
+			}
+			listed = true
+		}
+		if !isProxy {
+			if match, ok := byID(containers, list[i].Container.ID); ok {
+				named := *list[i].Container
+				named.Name, named.Image = match.Name(), match.Image
+				list[i].Container = &named
+			}
+			continue
+		}
+		if match, ok := proxy.Match(containers); ok {
+			list[i].Container = &ports.Container{
+				Runtime: "docker",
+				ID:      match.ID,
+				Name:    match.Name(),
+				Image:   match.Image,
+			}
+		}
+	}
+	return nil
+}
+
+// unnamed reports whether c is a Docker container found from a cgroup,
+// which only gives its ID
+func unnamed(c *ports.Container) bool {
+	return c != nil && c.Runtime == "docker" && c.Name == ""
+}
+
+// byID finds the container with the full ID id
+func byID(containers []Container, id string) (Container, bool) {
+	for _, c := range containers {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Container{}, false
+}
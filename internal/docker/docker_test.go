@@ -0,0 +1,347 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+const postgresID = "4f1c2d3e4a5b6c7d8e9f00112233445566778899aabbccddeeff001122334455"
+
+// fakeContainers is what the fake daemon lists
+var fakeContainers = `[
+  {"Id": "` + postgresID + `", "Names": ["/db"], "Image": "postgres:16",
+   "Ports": [{"IP": "0.0.0.0", "PrivatePort": 5432, "PublicPort": 5432, "Type": "tcp"}],
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}},
+  {"Id": "9a8b7c6d5e4f", "Names": ["/cache"], "Image": "redis:7",
+   "Ports": [{"IP": "127.0.0.1", "PrivatePort": 6379, "PublicPort": 6380, "Type": "tcp"}],
+   "NetworkSettings": {"Networks": {"app_default": {"IPAddress": "172.18.0.5"}}}}
+]`
+
+// fakeDaemon serves a minimal Docker Engine API on a Unix socket
+type fakeDaemon struct {
+	mu       sync.Mutex
+	requests []string // "METHOD path?query"
+	lists    int
+	open     int // connections not yet closed
+}
+
+func startFakeDaemon(t *testing.T) (*fakeDaemon, string) {
+	t.Helper()
+	// Unix socket paths are limited to ~100 bytes, shorter than some TempDirs
+	dir, err := os.MkdirTemp("", "tsdock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("cannot listen on a Unix socket: %v", err)
+	}
+
+	d := &fakeDaemon{}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(d.serve))
+	srv.Listener = ln
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		switch state {
+		case http.StateNew:
+			d.open++
+		case http.StateClosed, http.StateHijacked:
+			d.open--
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return d, socket
+}
+
+func (d *fakeDaemon) serve(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	d.requests = append(d.requests, r.Method+" "+r.URL.RequestURI())
+	if r.URL.Path == "/containers/json" {
+		d.lists++
+	}
+	d.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/containers/json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fakeContainers))
+	case r.Method == http.MethodPost && r.URL.Path == "/containers/"+postgresID+"/stop":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/containers/9a8b7c6d5e4f/stop":
+		w.WriteHeader(http.StatusNotModified) // already stopped
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/kill"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "No such container: missing"})
+	}
+}
+
+func (d *fakeDaemon) last() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.requests) == 0 {
+		return ""
+	}
+	return d.requests[len(d.requests)-1]
+}
+
+var (
+	dockerProxy = ports.PortInfo{Port: 5432, PID: 900, Process: "docker-proxy", User: "root", Proto: "tcp", Address: "0.0.0.0",
+		Cmdline: "/usr/bin/docker-proxy -proto tcp -host-ip 0.0.0.0 -host-port 5432 -container-ip 172.17.0.2 -container-port 5432"}
+	rootlesskit = ports.PortInfo{Port: 6380, PID: 901, Process: "rootlesskit", User: "dev", Proto: "tcp6", Address: "::",
+		Cmdline: "rootlesskit --net=slirp4netns --port-driver=builtin dockerd"}
+	node = ports.PortInfo{Port: 3000, PID: 100, Process: "node", User: "dev", Proto: "tcp", Cmdline: "node server.js"}
+)
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		p    ports.PortInfo
+		want Proxy
+		ok   bool
+	}{
+		{"docker-proxy", dockerProxy,
+			Proxy{Proto: "tcp", HostIP: "0.0.0.0", HostPort: 5432, ContainerIP: "172.17.0.2", ContainerPort: 5432}, true},
+		{"equals form", ports.PortInfo{Port: 8080, Process: "docker-proxy",
+			Cmdline: "docker-proxy --proto=tcp --host-port=8080 --container-ip=172.17.0.3 --container-port=80"},
+			Proxy{Proto: "tcp", HostPort: 8080, ContainerIP: "172.17.0.3", ContainerPort: 80}, true},
+		{"rootlesskit knows only the host port", rootlesskit,
+			Proxy{Proto: "tcp", HostIP: "::", HostPort: 6380}, true},
+		{"truncated comm of rootlesskit-docker-proxy", ports.PortInfo{Port: 80, Process: "rootlesskit-doc"},
+			Proxy{Proto: "tcp", HostPort: 80}, true},
+		{"not a proxy", node, Proxy{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseProxy(tt.p)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseProxy = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestProxyMatch(t *testing.T) {
+	var containers []Container
+	if err := json.Unmarshal([]byte(fakeContainers), &containers); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		proxy Proxy
+		want  string
+	}{
+		{"by container address", Proxy{Proto: "tcp", HostPort: 15432, ContainerIP: "172.17.0.2"}, "db"},
+		{"by published port", Proxy{Proto: "tcp6", HostPort: 6380}, "cache"},
+		{"unknown container address", Proxy{Proto: "tcp", HostPort: 5432, ContainerIP: "10.0.0.9"}, ""},
+		{"unpublished port", Proxy{Proto: "tcp", HostPort: 6379}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if c, ok := tt.proxy.Match(containers); ok {
+				got = c.Name()
+			}
+			if got != tt.want {
+				t.Errorf("Match = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	d, socket := startFakeDaemon(t)
+	list := []ports.PortInfo{node, dockerProxy, rootlesskit}
+	if err := NewClient(socket).Annotate(context.Background(), list); err != nil {
+		t.Fatalf("Annotate error: %v", err)
+	}
+
+	if list[0].Container != nil {
+		t.Errorf("node got container %+v", list[0].Container)
+	}
+	want := ports.Container{Runtime: "docker", ID: postgresID, Name: "db", Image: "postgres:16"}
+	if c := list[1].Container; c == nil || *c != want {
+		t.Errorf("docker-proxy container = %+v, want %+v", c, want)
+	}
+	if c := list[2].Container; c == nil || c.Name != "cache" || c.Image != "redis:7" {
+		t.Errorf("rootlesskit container = %+v, want cache", c)
+	}
+	if d.lists != 1 {
+		t.Errorf("containers listed %d times, want once", d.lists)
+	}
+}
+
+func TestAnnotateNamesCgroupContainers(t *testing.T) {
+	_, socket := startFakeDaemon(t)
+	inDocker := node
+	inDocker.Container = &ports.Container{Runtime: "docker", ID: postgresID}
+	inPodman := node
+	inPodman.Container = &ports.Container{Runtime: "podman", ID: postgresID}
+	list := []ports.PortInfo{inDocker, inPodman}
+	if err := NewClient(socket).Annotate(context.Background(), list); err != nil {
+		t.Fatalf("Annotate error: %v", err)
+	}
+
+	want := ports.Container{Runtime: "docker", ID: postgresID, Name: "db", Image: "postgres:16"}
+	if c := list[0].Container; *c != want {
+		t.Errorf("docker container = %+v, want %+v", c, want)
+	}
+	if inDocker.Container.Name != "" {
+		t.Error("Annotate modified the scanned container in place")
+	}
+	if c := list[1].Container; c.Name != "" {
+		t.Errorf("podman container named %q by the Docker daemon", c.Name)
+	}
+}
+
+func TestAnnotateWithoutProxies(t *testing.T) {
+	// No proxy listeners: the daemon is not contacted at all
+	client := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if err := client.Annotate(context.Background(), []ports.PortInfo{node}); err != nil {
+		t.Errorf("Annotate error: %v", err)
+	}
+	err := client.Annotate(context.Background(), []ports.PortInfo{dockerProxy})
+	if err == nil || !strings.Contains(err.Error(), "cannot reach the daemon") {
+		t.Errorf("Annotate error = %v, want an unreachable daemon", err)
+	}
+
+	// The package's Annotate asks the daemon DOCKER_HOST names
+	missing := filepath.Join(t.TempDir(), "docker.sock")
+	t.Setenv("DOCKER_HOST", "unix://"+missing)
+	err = Annotate(context.Background(), []ports.PortInfo{dockerProxy})
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("Annotate error = %v, want the daemon at %s unreachable", err, missing)
+	}
+}
+
+func TestStopAndKill(t *testing.T) {
+	d, socket := startFakeDaemon(t)
+	client := NewClient(socket)
+	ctx := context.Background()
+
+	if err := client.Stop(ctx, postgresID, 5*time.Second); err != nil {
+		t.Errorf("Stop error: %v", err)
+	}
+	if got, want := d.last(), "POST /containers/"+postgresID+"/stop?t=5"; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+	if err := client.Stop(ctx, "9a8b7c6d5e4f", time.Second); err != nil {
+		t.Errorf("stopping a stopped container: %v", err)
+	}
+	if err := client.Kill(ctx, postgresID, "HUP"); err != nil {
+		t.Errorf("Kill error: %v", err)
+	}
+	if got, want := d.last(), "POST /containers/"+postgresID+"/kill?signal=HUP"; got != want {
+		t.Errorf("request = %q, want %q", got, want)
+	}
+	if err := client.Stop(ctx, "missing", time.Second); err == nil || err.Error() != "docker: No such container: missing" {
+		t.Errorf("Stop(missing) error = %v", err)
+	}
+}
+
+func TestClientClosesConnections(t *testing.T) {
+	d, socket := startFakeDaemon(t)
+	ctx := context.Background()
+
+	for range 3 {
+		if err := NewClient(socket).Annotate(ctx, []ports.PortInfo{dockerProxy}); err != nil {
+			t.Fatalf("Annotate error: %v", err)
+		}
+		if err := NewClient(socket).Stop(ctx, postgresID, time.Second); err != nil {
+			t.Fatalf("Stop error: %v", err)
+		}
+		if err := NewClient(socket).Kill(ctx, postgresID, "HUP"); err != nil {
+			t.Fatalf("Kill error: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d.mu.Lock()
+		open := d.open
+		d.mu.Unlock()
+		if open == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections to the daemon are still open", open)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	if got := SocketPath(); got != DefaultSocket {
+		t.Errorf("SocketPath() = %q, want %q", got, DefaultSocket)
+	}
+	t.Setenv("DOCKER_HOST", "unix:///run/user/1000/docker.sock")
+	if got := SocketPath(); got != "/run/user/1000/docker.sock" {
+		t.Errorf("SocketPath() = %q", got)
+	}
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.1:2375")
+	if got := SocketPath(); got != DefaultSocket {
+		t.Errorf("SocketPath() with a tcp host = %q, want %q", got, DefaultSocket)
+	}
+}
+
+func TestPublishedAndCheckProxy(t *testing.T) {
+	annotated := dockerProxy
+	annotated.Container = &ports.Container{Runtime: "docker", ID: postgresID, Name: "db", Image: "postgres:16"}
+	inContainer := node
+	inContainer.Container = annotated.Container
+
+	if c := Published(annotated); c == nil || c.Name != "db" {
+		t.Errorf("Published(proxy) = %+v", c)
+	}
+	if c := Published(inContainer); c != nil {
+		t.Errorf("Published(non-proxy) = %+v, want nil", c)
+	}
+	if err := CheckProxy(annotated, nil); err != nil {
+		t.Errorf("CheckProxy(identified proxy) = %v", err)
+	}
+	if err := CheckProxy(node, nil); err != nil {
+		t.Errorf("CheckProxy(node) = %v", err)
+	}
+	if err := CheckProxy(dockerProxy, nil); err == nil || !strings.Contains(err.Error(), "port 5432") {
+		t.Errorf("CheckProxy(unidentified proxy) = %v", err)
+	}
+	daemonErr := errors.New("docker: cannot reach the daemon at /var/run/docker.sock: permission denied")
+	if err := CheckProxy(dockerProxy, daemonErr); err == nil || !strings.Contains(err.Error(), "(docker: cannot reach the daemon at /var/run/docker.sock: permission denied)") {
+		t.Errorf("CheckProxy(unidentified proxy, daemon error) = %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		c    ports.Container
+		want string
+	}{
+		{ports.Container{ID: postgresID, Name: "db", Image: "postgres:16"}, "container db (postgres:16)"},
+		{ports.Container{ID: postgresID}, "container 4f1c2d3e4a5b"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.c); got != tt.want {
+			t.Errorf("Describe(%+v) = %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package keymap defines the TUI's bindable list view actions and checks
+// rebindings from the config file.
+package keymap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Action is a list view command that can be bound to keys
+type Action string
+
+const (
+	ActionUp        Action = "up"
+	ActionDown      Action = "down"
+	ActionSelect    Action = "select"
+	ActionSortNext  Action = "sort_next"
+	ActionSortPrev  Action = "sort_prev"
+	ActionReverse   Action = "reverse"
+	ActionMatchMode Action = "match_mode"
+	ActionClear     Action = "clear" // clears the filter, or quits when it is empty
+	ActionDelete    Action = "delete"
+)
+
+// Keymap binds list view actions to key names as reported by bubbletea
+// ("up", "ctrl+r", "shift+tab", ...). Printable characters cannot be bound
+// because typing them edits the filter.
+type Keymap map[Action][]string
+
+// Default returns the built-in bindings
+func Default() Keymap {
+	return Keymap{
+		ActionUp:        {"up"},
+		ActionDown:      {"down"},
+		ActionSelect:    {"enter"},
+		ActionSortNext:  {"tab"},
+		ActionSortPrev:  {"shift+tab"},
+		ActionReverse:   {"ctrl+r"},
+		ActionMatchMode: {"ctrl+t"},
+		ActionClear:     {"esc"},
+		ActionDelete:    {"backspace"},
+	}
+}
+
+// Actions returns every bindable action, sorted
+func Actions() []string {
+	var names []string
+	for a := range Default() {
+		names = append(names, string(a))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithBindings returns a copy of k with the keys of the given actions
+// replaced. Unknown actions, printable keys and keys bound to two actions
+// are errors.
+func (k Keymap) WithBindings(bindings map[string][]string) (Keymap, error) {
+	result := make(Keymap, len(k))
+	for a, keys := range k {
+		result[a] = keys
+	}
+	for name, keys := range bindings {
+		a := Action(strings.ToLower(name))
+		if _, ok := result[a]; !ok {
+			return nil, fmt.Errorf("unknown key action: %s (valid: %s)", name, strings.Join(Actions(), ", "))
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no keys bound to %s", name)
+		}
+		for _, key := range keys {
+			if utf8.RuneCountInString(key) == 1 {
+				return nil, fmt.Errorf("cannot bind %q to %s: printable keys are used for filtering", key, name)
+			}
+		}
+		result[a] = keys
+	}
+
+	seen := make(map[string]Action)
+	for _, a := range Actions() {
+		for _, key := range result[Action(a)] {
+			if other, dup := seen[key]; dup {
+				return nil, fmt.Errorf("key %q is bound to both %s and %s", key, other, a)
+			}
+			seen[key] = Action(a)
+		}
+	}
+	return result, nil
+}
+
+// Lookup returns the action bound to key
+func (k Keymap) Lookup(key string) (Action, bool) {
+	for a, keys := range k {
+		for _, bound := range keys {
+			if bound == key {
+				return a, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Help returns the display name of the first key bound to a
+func (k Keymap) Help(a Action) string {
+	keys := k[a]
+	if len(keys) == 0 {
+		return "?"
+	}
+	switch keys[0] {
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	}
+	return keys[0]
+}
@@ -0,0 +1,46 @@
+package keymap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithBindings(t *testing.T) {
+	k, err := Default().WithBindings(map[string][]string{"up": {"up", "ctrl+p"}, "DOWN": {"ctrl+n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := k.Lookup("ctrl+p"); !ok || a != ActionUp {
+		t.Errorf("ctrl+p = %q, %v, want up", a, ok)
+	}
+	if _, ok := k.Lookup("down"); ok {
+		t.Error("down should no longer be bound")
+	}
+	if k.Help(ActionDown) != "ctrl+n" {
+		t.Errorf("Help(down) = %q", k.Help(ActionDown))
+	}
+	if Default().Help(ActionUp) != "↑" {
+		t.Error("default keymap changed")
+	}
+}
+
+func TestWithBindingsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings map[string][]string
+		want     string
+	}{
+		{"unknown action", map[string][]string{"jump": {"ctrl+j"}}, "unknown key action"},
+		{"no keys", map[string][]string{"up": {}}, "no keys"},
+		{"printable", map[string][]string{"up": {"k"}}, "printable keys"},
+		{"duplicate", map[string][]string{"up": {"enter"}}, "bound to both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Default().WithBindings(tt.bindings)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
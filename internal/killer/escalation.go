@@ -0,0 +1,241 @@
+package killer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long an escalation waits after SIGTERM before
+// sending SIGKILL.
+const DefaultTimeout = 2 * time.Second
+
+// pollInterval is how often a running escalation checks the process.
+const pollInterval = 100 * time.Millisecond
+
+// ErrAborted is returned by Escalation.Run when the wait is abandoned via Abort
+var ErrAborted = errors.New("stopped waiting for process to exit")
+
+// EventKind identifies a step of an escalating kill
+type EventKind int
+
+const (
+	// EventSignalSent is emitted after a signal has been delivered
+	EventSignalSent EventKind = iota
+	// EventWaiting is emitted on every poll while waiting for the process to exit
+	EventWaiting
+	// EventEscalated is emitted when SIGTERM is escalated to SIGKILL
+	EventEscalated
+	// EventExited is emitted once the process is gone
+	EventExited
+	// EventPortReleased is emitted once the Released check reports the port free
+	EventPortReleased
+)
+
+// Event reports the progress of an escalating kill
+type Event struct {
+	Kind    EventKind
+	PID     int
+	Signal  Signal
+	Elapsed time.Duration
+	Timeout time.Duration
+}
+
+// String returns a short human-readable description of the event
+func (e Event) String() string {
+	switch e.Kind {
+	case EventSignalSent:
+		return fmt.Sprintf("Sent SIG%s to PID %d", e.Signal, e.PID)
+	case EventWaiting:
+		return fmt.Sprintf("Waiting for PID %d to exit (%.1f/%.1fs)",
+			e.PID, e.Elapsed.Seconds(), e.Timeout.Seconds())
+	case EventEscalated:
+		return fmt.Sprintf("Escalated to SIGKILL (PID %d)", e.PID)
+	case EventExited:
+		return fmt.Sprintf("PID %d exited after %.1fs", e.PID, e.Elapsed.Seconds())
+	case EventPortReleased:
+		return fmt.Sprintf("Port released by PID %d", e.PID)
+	default:
+		return fmt.Sprintf("PID %d: unknown event %d", e.PID, e.Kind)
+	}
+}
+
+// Escalation sends SIGTERM to a process, waits for it to exit and sends
+// SIGKILL once Timeout has passed. Progress is reported through OnEvent, and
+// the wait can be cut short with EscalateNow or abandoned with Abort.
+type Escalation struct {
+	PID     int
+	Timeout time.Duration
+
+	// OnEvent, if set, is called synchronously for every progress event.
+	OnEvent func(Event)
+
+	// Released, if set, is polled after the process exits and should report
+	// whether the port it was holding is free again.
+	Released func() bool
+
+	escalate chan struct{}
+	abort    chan struct{}
+}
+
+// NewEscalation creates an escalation for pid with the given timeout
+func NewEscalation(pid int, timeout time.Duration) *Escalation {
+	return &Escalation{
+		PID:      pid,
+		Timeout:  timeout,
+		escalate: make(chan struct{}, 1),
+		abort:    make(chan struct{}, 1),
+	}
+}
+
+// EscalateNow stops waiting and sends SIGKILL immediately
+func (e *Escalation) EscalateNow() {
+	select {
+	case e.escalate <- struct{}{}:
+	default:
+	}
+}
+
+// Abort stops waiting without sending SIGKILL. Run returns ErrAborted.
+func (e *Escalation) Abort() {
+	select {
+	case e.abort <- struct{}{}:
+	default:
+	}
+}
+
+// Run performs the escalation and blocks until the process has exited,
+// SIGKILL has been sent, or the wait was aborted
+func (e *Escalation) Run() error {
+	return e.RunContext(context.Background())
+}
+
+// RunContext is Run with cancellation. When ctx is done it stops waiting
+// without sending SIGKILL, like Abort, and returns ctx.Err().
+func (e *Escalation) RunContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := Kill(e.PID, SIGTERM); err != nil {
+		return err
+	}
+	start := time.Now()
+	e.emit(EventSignalSent, SIGTERM, start)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+wait:
+	for {
+		if !isProcessAlive(e.PID) {
+			e.emit(EventExited, "", start)
+			return e.waitReleased(ctx, start)
+		}
+		if time.Since(start) >= e.Timeout {
+			break
+		}
+		e.emit(EventWaiting, "", start)
+
+		select {
+		case <-ticker.C:
+		case <-e.escalate:
+			break wait
+		case <-e.abort:
+			return ErrAborted
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Process still alive, send SIGKILL
+	if !isProcessAlive(e.PID) {
+		e.emit(EventExited, "", start)
+		return e.waitReleased(ctx, start)
+	}
+	if err := Kill(e.PID, SIGKILL); err != nil {
+		return err
+	}
+	e.emit(EventEscalated, SIGKILL, start)
+
+	// SIGKILL cannot be caught, but the process may take a moment to go away
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if !isProcessAlive(e.PID) {
+			e.emit(EventExited, "", start)
+			return e.waitReleased(ctx, start)
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitReleased polls Released until it reports the port free, the timeout
+// passes again or ctx is done
+func (e *Escalation) waitReleased(ctx context.Context, start time.Time) error {
+	if e.Released == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(e.Timeout)
+	for {
+		if e.Released() {
+			e.emit(EventPortReleased, "", start)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d, returning ctx.Err() early if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// emit reports an event to OnEvent, if set
+func (e *Escalation) emit(kind EventKind, sig Signal, start time.Time) {
+	if e.OnEvent == nil {
+		return
+	}
+	e.OnEvent(Event{
+		Kind:    kind,
+		PID:     e.PID,
+		Signal:  sig,
+		Elapsed: time.Since(start),
+		Timeout: e.Timeout,
+	})
+}
+
+// isZombie reports whether pid has exited but not yet been reaped by its
+// parent. Zombies still answer signal 0 but no longer hold any sockets.
+// Always false where /proc is unavailable.
+func isZombie(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// Format: pid (comm) state ...; comm may contain spaces and parens
+	stat := string(data)
+	idx := strings.LastIndex(stat, ")")
+	if idx == -1 || idx+2 >= len(stat) {
+		return false
+	}
+	return stat[idx+2] == 'Z'
+}
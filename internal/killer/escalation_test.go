@@ -0,0 +1,261 @@
+package killer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecorder collects escalation events in a goroutine-safe way
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) kinds() []EventKind {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var kinds []EventKind
+	for _, e := range r.events {
+		if len(kinds) > 0 && kinds[len(kinds)-1] == e.Kind {
+			continue
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func startStubborn(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start test process: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	// Give the process time to set up signal handler
+	time.Sleep(200 * time.Millisecond)
+	return cmd
+}
+
+func TestEscalationEventsCooperative(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start test process: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	var rec eventRecorder
+	esc := NewEscalation(cmd.Process.Pid, time.Second)
+	esc.OnEvent = rec.record
+	esc.Released = func() bool { return true }
+
+	if err := esc.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	kinds := rec.kinds()
+	if kinds[0] != EventSignalSent {
+		t.Errorf("first event = %v, expected EventSignalSent", kinds[0])
+	}
+	if kinds[len(kinds)-1] != EventPortReleased {
+		t.Errorf("last event = %v, expected EventPortReleased", kinds[len(kinds)-1])
+	}
+	for _, k := range kinds {
+		if k == EventEscalated {
+			t.Error("cooperative process should not be escalated")
+		}
+	}
+}
+
+func TestEscalationEventsStubborn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	cmd := startStubborn(t)
+
+	var rec eventRecorder
+	esc := NewEscalation(cmd.Process.Pid, 300*time.Millisecond)
+	esc.OnEvent = rec.record
+
+	if err := esc.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	expected := []EventKind{EventSignalSent, EventWaiting, EventEscalated, EventExited}
+	kinds := rec.kinds()
+	if len(kinds) != len(expected) {
+		t.Fatalf("events = %v, expected %v", kinds, expected)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Errorf("event[%d] = %v, expected %v", i, kinds[i], expected[i])
+		}
+	}
+}
+
+func TestEscalateNow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	cmd := startStubborn(t)
+
+	esc := NewEscalation(cmd.Process.Pid, 10*time.Second)
+	esc.OnEvent = func(e Event) {
+		if e.Kind == EventWaiting {
+			esc.EscalateNow()
+		}
+	}
+
+	start := time.Now()
+	if err := esc.Run(); err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("EscalateNow should skip the wait, took %v", elapsed)
+	}
+}
+
+func TestEscalationAbort(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	cmd := startStubborn(t)
+
+	esc := NewEscalation(cmd.Process.Pid, 10*time.Second)
+	esc.Abort()
+
+	if err := esc.Run(); err != ErrAborted {
+		t.Errorf("Run() = %v, expected ErrAborted", err)
+	}
+	if !isProcessAlive(cmd.Process.Pid) {
+		t.Error("aborted escalation should not kill the process")
+	}
+}
+
+func TestEscalationCancel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+
+	cmd := startStubborn(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := KillContext(ctx, cmd.Process.Pid, 10*time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("KillContext() = %v, expected context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("KillContext returned after %v, expected soon after the deadline", elapsed)
+	}
+	if !isProcessAlive(cmd.Process.Pid) {
+		t.Error("a cancelled escalation should not send SIGKILL")
+	}
+}
+
+func TestEscalationCancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var rec eventRecorder
+	esc := NewEscalation(999999999, time.Second)
+	esc.OnEvent = rec.record
+	if err := esc.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunContext() = %v, expected context.Canceled", err)
+	}
+	if len(rec.kinds()) != 0 {
+		t.Errorf("no signal should be sent once cancelled, got %v", rec.kinds())
+	}
+}
+
+func TestEscalationNonexistent(t *testing.T) {
+	var rec eventRecorder
+	esc := NewEscalation(999999999, time.Second)
+	esc.OnEvent = rec.record
+
+	if err := esc.Run(); err == nil {
+		t.Error("Run() expected error for nonexistent process")
+	}
+	if len(rec.kinds()) != 0 {
+		t.Errorf("no events expected when the signal fails, got %v", rec.kinds())
+	}
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		event    Event
+		contains string
+	}{
+		{Event{Kind: EventSignalSent, PID: 42, Signal: SIGTERM}, "SIGTERM to PID 42"},
+		{Event{Kind: EventWaiting, PID: 42, Elapsed: 500 * time.Millisecond, Timeout: 2 * time.Second}, "0.5/2.0s"},
+		{Event{Kind: EventEscalated, PID: 42}, "SIGKILL"},
+		{Event{Kind: EventExited, PID: 42}, "exited"},
+		{Event{Kind: EventPortReleased, PID: 42}, "released"},
+		{Event{Kind: EventKind(99), PID: 42}, "unknown"},
+	}
+
+	for _, tt := range tests {
+		if s := tt.event.String(); !strings.Contains(s, tt.contains) {
+			t.Errorf("Event{Kind: %d}.String() = %q, expected to contain %q", tt.event.Kind, s, tt.contains)
+		}
+	}
+}
+
+func TestIsZombie(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("zombie detection needs /proc")
+	}
+	if isZombie(os.Getpid()) {
+		t.Error("a running process should not be a zombie")
+	}
+
+	cmd := exec.Command("true")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start test process: %v", err)
+	}
+	pid := cmd.Process.Pid
+
+	// Not reaped yet, so it lingers as a zombie once it exits
+	deadline := time.Now().Add(2 * time.Second)
+	for !isZombie(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !isZombie(pid) {
+		t.Error("exited but unreaped process should be a zombie")
+	}
+	if isProcessAlive(pid) {
+		t.Error("exited but unreaped process should not be reported alive")
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if isZombie(pid) {
+		t.Error("a reaped process should not be a zombie")
+	}
+}
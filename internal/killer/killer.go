@@ -4,6 +4,7 @@
 package killer
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -71,32 +72,18 @@ func Kill(pid int, sig Signal) error {
 
 // KillWithEscalation sends SIGTERM, waits 2 seconds, then SIGKILL if needed
 func KillWithEscalation(pid int) error {
-	return KillWithEscalationTimeout(pid, 2*time.Second)
+	return KillWithEscalationTimeout(pid, DefaultTimeout)
 }
 
 // KillWithEscalationTimeout sends SIGTERM, waits for timeout, then SIGKILL if needed
 func KillWithEscalationTimeout(pid int, timeout time.Duration) error {
-	// First, try SIGTERM
-	err := Kill(pid, SIGTERM)
-	if err != nil {
-		return err
-	}
-
-	// Wait up to timeout for process to exit
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		if !isProcessAlive(pid) {
-			return nil
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	// Process still alive, send SIGKILL
-	if isProcessAlive(pid) {
-		return Kill(pid, SIGKILL)
-	}
+	return NewEscalation(pid, timeout).Run()
+}
 
-	return nil
+// KillContext is KillWithEscalationTimeout with cancellation. If ctx is
+// done while waiting, SIGKILL is not sent and ctx.Err() is returned.
+func KillContext(ctx context.Context, pid int, timeout time.Duration) error {
+	return NewEscalation(pid, timeout).RunContext(ctx)
 }
 
 // isProcessAlive checks if a process is still running
@@ -108,5 +95,5 @@ func isProcessAlive(pid int) bool {
 
 	// Sending signal 0 checks if process exists without actually signaling
 	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	return err == nil && !isZombie(pid)
 }
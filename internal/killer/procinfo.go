@@ -0,0 +1,125 @@
+package killer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ProcInfo identifies a running process
+type ProcInfo struct {
+	PID  int
+	PPID int
+	Name string // short command name
+	User string
+	Exe  string // executable path, empty if unreadable
+}
+
+// ReadProcInfo looks up pid using /proc on Linux and ps elsewhere
+func ReadProcInfo(pid int) (ProcInfo, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return readProcInfoLinux(pid)
+	default:
+		return readProcInfoPs(pid)
+	}
+}
+
+// readProcInfoLinux reads /proc/<pid>/{stat,status,exe}
+func readProcInfoLinux(pid int) (ProcInfo, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ProcInfo{}, fmt.Errorf("process %d not found", pid)
+	}
+	info, err := parseProcStat(string(data))
+	if err != nil {
+		return ProcInfo{}, err
+	}
+	info.PID = pid
+
+	if file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid)); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "Uid:" {
+				info.User = lookupUser(fields[1])
+				break
+			}
+		}
+		file.Close()
+	}
+
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		info.Exe = strings.TrimSuffix(exe, " (deleted)")
+	}
+	return info, nil
+}
+
+// parseProcStat extracts comm and ppid from the contents of /proc/<pid>/stat
+func parseProcStat(stat string) (ProcInfo, error) {
+	// comm may contain spaces and parens, so it runs to the last ')'
+	open := strings.Index(stat, "(")
+	end := strings.LastIndex(stat, ")")
+	if open == -1 || end < open {
+		return ProcInfo{}, fmt.Errorf("malformed stat: %q", stat)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// fields[0] is state, fields[1] is ppid
+	if len(fields) < 2 {
+		return ProcInfo{}, fmt.Errorf("malformed stat: %q", stat)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ProcInfo{}, fmt.Errorf("malformed stat ppid: %q", fields[1])
+	}
+	return ProcInfo{PPID: ppid, Name: stat[open+1 : end]}, nil
+}
+
+// readProcInfoPs looks up pid with ps, for platforms without /proc
+func readProcInfoPs(pid int) (ProcInfo, error) {
+	output, err := exec.Command("ps", "-o", "ppid=,user=,comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ProcInfo{}, fmt.Errorf("process %d not found", pid)
+	}
+	info, err := parsePsInfo(string(output))
+	if err != nil {
+		return ProcInfo{}, err
+	}
+	info.PID = pid
+	return info, nil
+}
+
+// parsePsInfo parses `ps -o ppid=,user=,comm=` output. On macOS comm is the
+// full executable path.
+// Example: "    1 _www   /usr/sbin/httpd"
+func parsePsInfo(output string) (ProcInfo, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return ProcInfo{}, fmt.Errorf("unexpected ps output: %q", output)
+	}
+	ppid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return ProcInfo{}, fmt.Errorf("unexpected ps output: %q", output)
+	}
+	comm := strings.Join(fields[2:], " ")
+	info := ProcInfo{PPID: ppid, User: fields[1], Name: filepath.Base(comm)}
+	if filepath.IsAbs(comm) {
+		info.Exe = comm
+	}
+	return info, nil
+}
+
+// lookupUser converts a UID to a username, falling back to the UID
+func lookupUser(uid string) string {
+	u, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+	return u.Username
+}
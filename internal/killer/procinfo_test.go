@@ -0,0 +1,77 @@
+package killer
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		stat     string
+		wantName string
+		wantPPID int
+		wantErr  bool
+	}{
+		{"1234 (node) S 1 1234 1234 0 -1", "node", 1, false},
+		{"42 (tmux: server) S 7 42 42 0 -1", "tmux: server", 7, false},
+		{"43 (a) b) R 9 43", "a) b", 9, false},
+		{"garbage", "", 0, true},
+		{"1 (x) S", "", 0, true},
+		{"1 (x) S notanumber", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		info, err := parseProcStat(tt.stat)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseProcStat(%q) error = %v, wantErr %v", tt.stat, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (info.Name != tt.wantName || info.PPID != tt.wantPPID) {
+			t.Errorf("parseProcStat(%q) = %+v, want name %q ppid %d", tt.stat, info, tt.wantName, tt.wantPPID)
+		}
+	}
+}
+
+func TestParsePsInfo(t *testing.T) {
+	info, err := parsePsInfo("    1 _www   /usr/sbin/httpd\n")
+	if err != nil {
+		t.Fatalf("parsePsInfo error: %v", err)
+	}
+	if info.PPID != 1 || info.User != "_www" || info.Name != "httpd" || info.Exe != "/usr/sbin/httpd" {
+		t.Errorf("parsePsInfo = %+v", info)
+	}
+
+	info, err = parsePsInfo("  12 alice  node\n")
+	if err != nil || info.Name != "node" || info.Exe != "" {
+		t.Errorf("parsePsInfo relative comm = %+v, %v", info, err)
+	}
+
+	for _, bad := range []string{"", "1 root", "x root /bin/sh"} {
+		if _, err := parsePsInfo(bad); err == nil {
+			t.Errorf("parsePsInfo(%q) should fail", bad)
+		}
+	}
+}
+
+func TestReadProcInfoSelf(t *testing.T) {
+	info, err := ReadProcInfo(os.Getpid())
+	if err != nil {
+		t.Fatalf("ReadProcInfo(self) error: %v", err)
+	}
+	if info.PID != os.Getpid() || info.PPID != os.Getppid() {
+		t.Errorf("ReadProcInfo(self) = %+v, want PPID %d", info, os.Getppid())
+	}
+	if info.Name == "" || info.User == "" {
+		t.Errorf("ReadProcInfo(self) should have a name and user: %+v", info)
+	}
+	if runtime.GOOS == "linux" && info.Exe == "" {
+		t.Error("ReadProcInfo(self) should read the executable on Linux")
+	}
+}
+
+func TestReadProcInfoMissing(t *testing.T) {
+	if _, err := ReadProcInfo(999999999); err == nil {
+		t.Error("ReadProcInfo of a nonexistent PID should fail")
+	}
+}
@@ -0,0 +1,257 @@
+package killer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RuleKind is what a protection rule matches on
+type RuleKind string
+
+const (
+	RuleName RuleKind = "name" // process name, case-insensitive
+	RulePort RuleKind = "port" // listening port
+	RuleUser RuleKind = "user" // owning user
+	RulePath RuleKind = "path" // executable path glob, or directory prefix ending in /
+)
+
+// Rule is a user-configured protection
+type Rule struct {
+	Kind  RuleKind
+	Value string
+}
+
+// String returns the rule in kind=value form
+func (r Rule) String() string {
+	return string(r.Kind) + "=" + r.Value
+}
+
+// ParseRule parses a kind=value rule, e.g. "name=postgres", "port=5432",
+// "user=postgres" or "path=/usr/lib/postgresql/"
+func ParseRule(spec string) (Rule, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok || value == "" {
+		return Rule{}, fmt.Errorf("invalid protection rule %q (expected name=, port=, user= or path=)", spec)
+	}
+	r := Rule{Kind: RuleKind(strings.ToLower(strings.TrimSpace(kind))), Value: strings.TrimSpace(value)}
+	switch r.Kind {
+	case RuleName, RuleUser:
+	case RulePort:
+		if port, err := strconv.Atoi(r.Value); err != nil || port < 1 || port > 65535 {
+			return Rule{}, fmt.Errorf("invalid protection rule %q: port must be 1-65535", spec)
+		}
+	case RulePath:
+		if _, err := filepath.Match(r.Value, ""); err != nil {
+			return Rule{}, fmt.Errorf("invalid protection rule %q: %v", spec, err)
+		}
+	default:
+		return Rule{}, fmt.Errorf("invalid protection rule %q: unknown kind %q (expected name, port, user or path)", spec, kind)
+	}
+	return r, nil
+}
+
+// builtinNames are process names that are always protected
+var builtinNames = map[string]string{
+	"init":          "the init process",
+	"launchd":       "the init process",
+	"systemd":       "the system service manager",
+	"sshd":          "the SSH server",
+	"ssh":           "the SSH server", // Debian's ssh.socket and ssh.service
+	"Xorg":          "the display server",
+	"X":             "the display server",
+	"Xwayland":      "the display server",
+	"WindowServer":  "the display server",
+	"loginwindow":   "the login session",
+	"gnome-shell":   "the display server",
+	"kwin_wayland":  "the display server",
+	"kwin_x11":      "the window manager",
+	"mutter":        "the display server",
+	"sway":          "the display server",
+	"weston":        "the display server",
+	"Hyprland":      "the display server",
+	"gdm":           "the display manager",
+	"sddm":          "the display manager",
+	"lightdm":       "the display manager",
+	"gdm-x-session": "the display server",
+}
+
+// Target is a process the policy is asked about. PID is required; empty
+// fields are looked up from the PID.
+type Target struct {
+	PID  int
+	Port int // 0 when not killing by port
+	Name string
+	User string
+
+	// Unit is a systemd socket unit that is stopped instead of signalling
+	// PID, the service manager holding the socket. The unit's name, less
+	// its suffix, is then checked in place of the process.
+	Unit string
+}
+
+// Policy decides which processes must not be killed. The built-in
+// defaults protect PID 1, kernel threads, this process and its ancestors
+// (the shell, terminal multiplexer and so on), sshd, systemd and the
+// display server; Add extends them with user rules and Allow restricts
+// kills to an allow list. A nil *Policy protects nothing.
+type Policy struct {
+	rules []Rule
+	allow []Rule
+
+	self   int
+	lookup func(pid int) (ProcInfo, error)
+
+	ancestorsOnce sync.Once
+	ancestors     map[int]bool
+}
+
+// NewPolicy returns a policy with the built-in defaults and rules
+func NewPolicy(rules ...Rule) *Policy {
+	return &Policy{rules: rules, self: os.Getpid(), lookup: ReadProcInfo}
+}
+
+// Add appends user rules to the policy
+func (p *Policy) Add(rules ...Rule) {
+	p.rules = append(p.rules, rules...)
+}
+
+// Rules returns the user rules
+func (p *Policy) Rules() []Rule {
+	return p.rules
+}
+
+// Allow adds rules to the allow list. Once it is non-empty, targets that
+// match none of its rules are protected.
+func (p *Policy) Allow(rules ...Rule) {
+	p.allow = append(p.allow, rules...)
+}
+
+// ProtectedError is returned for a target the policy refuses to kill
+type ProtectedError struct {
+	PID    int
+	Name   string
+	Reason string
+}
+
+func (e *ProtectedError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("PID %d is protected: %s", e.PID, e.Reason)
+	}
+	return fmt.Sprintf("%s (PID %d) is protected: %s", e.Name, e.PID, e.Reason)
+}
+
+// Check returns a *ProtectedError if t must not be killed, or nil
+func (p *Policy) Check(t Target) error {
+	if p == nil {
+		return nil
+	}
+	reason, name := p.check(t)
+	if reason == "" {
+		return nil
+	}
+	return &ProtectedError{PID: t.PID, Name: name, Reason: reason}
+}
+
+// check returns why t is protected ("" if it is not) and its name
+func (p *Policy) check(t Target) (reason, name string) {
+	info, err := p.lookup(t.PID)
+	if err != nil {
+		info = ProcInfo{PID: t.PID}
+	}
+	if t.Name == "" {
+		t.Name = info.Name
+	}
+	if t.User == "" {
+		t.User = info.User
+	}
+
+	if t.Unit != "" {
+		t.Name = strings.TrimSuffix(t.Unit, filepath.Ext(t.Unit))
+		info.Exe = ""
+	}
+
+	switch {
+	case t.Unit != "":
+		// the manager is not signalled, so the PID checks do not apply
+	case t.PID <= 1:
+		return "it is the init process (PID 1)", t.Name
+	case t.PID == p.self:
+		return "it is tsunami itself", t.Name
+	case t.PID == 2 || info.PPID == 2:
+		return "it is a kernel thread", t.Name
+	case p.isAncestor(t.PID):
+		return "it is an ancestor of tsunami (e.g. your shell or terminal)", t.Name
+	}
+
+	if desc, ok := builtinNames[t.Name]; ok {
+		return fmt.Sprintf("%s is %s", t.Name, desc), t.Name
+	}
+	if strings.HasPrefix(t.Name, "systemd-") {
+		return fmt.Sprintf("%s is a systemd service", t.Name), t.Name
+	}
+
+	for _, r := range p.rules {
+		if r.matches(t, info.Exe) {
+			return fmt.Sprintf("matches protection rule %s", r), t.Name
+		}
+	}
+
+	if len(p.allow) > 0 {
+		for _, r := range p.allow {
+			if r.matches(t, info.Exe) {
+				return "", t.Name
+			}
+		}
+		allowed := make([]string, len(p.allow))
+		for i, r := range p.allow {
+			allowed[i] = r.String()
+		}
+		return fmt.Sprintf("it is not in the allow list (%s)", strings.Join(allowed, ", ")), t.Name
+	}
+	return "", t.Name
+}
+
+// matches reports whether the rule applies to t, whose executable is exe
+func (r Rule) matches(t Target, exe string) bool {
+	switch r.Kind {
+	case RuleName:
+		return strings.EqualFold(t.Name, r.Value)
+	case RuleUser:
+		return strings.EqualFold(t.User, r.Value)
+	case RulePort:
+		return t.Port != 0 && strconv.Itoa(t.Port) == r.Value
+	case RulePath:
+		if exe == "" {
+			return false
+		}
+		if strings.HasSuffix(r.Value, "/") {
+			return strings.HasPrefix(exe, r.Value)
+		}
+		ok, _ := filepath.Match(r.Value, exe)
+		return ok
+	}
+	return false
+}
+
+// isAncestor reports whether pid is a parent, grandparent, etc. of this
+// process. The chain is read once and cached.
+func (p *Policy) isAncestor(pid int) bool {
+	p.ancestorsOnce.Do(func() {
+		p.ancestors = make(map[int]bool)
+		cur := p.self
+		// Bound the walk in case of a cycle in inconsistent lookups
+		for i := 0; i < 64 && cur > 1; i++ {
+			info, err := p.lookup(cur)
+			if err != nil || info.PPID <= 1 {
+				break
+			}
+			p.ancestors[info.PPID] = true
+			cur = info.PPID
+		}
+	})
+	return p.ancestors[pid]
+}
@@ -0,0 +1,225 @@
+package killer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakePolicy returns a policy over a fixed process table, running as PID 500
+// under bash (400) under tmux (300)
+func fakePolicy(rules ...Rule) *Policy {
+	procs := map[int]ProcInfo{
+		2:   {PID: 2, PPID: 0, Name: "kthreadd"},
+		50:  {PID: 50, PPID: 2, Name: "kworker/0:1"},
+		100: {PID: 100, PPID: 1, Name: "sshd", User: "root", Exe: "/usr/sbin/sshd"},
+		150: {PID: 150, PPID: 1, Name: "systemd-resolve", User: "systemd-resolve"},
+		200: {PID: 200, PPID: 1, Name: "Xorg", User: "root"},
+		300: {PID: 300, PPID: 1, Name: "tmux: server", User: "alice"},
+		400: {PID: 400, PPID: 300, Name: "bash", User: "alice"},
+		500: {PID: 500, PPID: 400, Name: "tsunami", User: "alice"},
+		600: {PID: 600, PPID: 1, Name: "node", User: "alice", Exe: "/usr/bin/node"},
+		700: {PID: 700, PPID: 1, Name: "postgres", User: "postgres", Exe: "/usr/lib/postgresql/16/bin/postgres"},
+	}
+	p := NewPolicy(rules...)
+	p.self = 500
+	p.lookup = func(pid int) (ProcInfo, error) {
+		info, ok := procs[pid]
+		if !ok {
+			return ProcInfo{}, errors.New("not found")
+		}
+		return info, nil
+	}
+	return p
+}
+
+func TestPolicyBuiltins(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		reason string // "" means not protected
+	}{
+		{"init", Target{PID: 1}, "init process"},
+		{"kthreadd", Target{PID: 2}, "kernel thread"},
+		{"kernel worker", Target{PID: 50}, "kernel thread"},
+		{"self", Target{PID: 500}, "tsunami itself"},
+		{"parent shell", Target{PID: 400}, "ancestor of tsunami"},
+		{"tmux server", Target{PID: 300}, "ancestor of tsunami"},
+		{"sshd", Target{PID: 100, Port: 22}, "sshd is the SSH server"},
+		{"systemd service", Target{PID: 150, Port: 53}, "systemd service"},
+		{"display server", Target{PID: 200}, "display server"},
+		{"ordinary process", Target{PID: 600, Port: 3000}, ""},
+		{"unknown pid", Target{PID: 999}, ""},
+		{"name from scan", Target{PID: 999, Name: "sshd"}, "SSH server"},
+		{"socket unit held by init", Target{PID: 1, Port: 631, Name: "systemd", Unit: "cups.socket"}, ""},
+		{"ssh socket unit", Target{PID: 1, Port: 22, Name: "systemd", Unit: "ssh.socket"}, "ssh is the SSH server"},
+		{"systemd socket unit", Target{PID: 1, Port: 53, Name: "systemd", Unit: "systemd-resolved.socket"}, "systemd service"},
+	}
+
+	p := fakePolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.target)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("Check(%+v) = %v, want not protected", tt.target, err)
+				}
+				return
+			}
+			var perr *ProtectedError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Check(%+v) = %v, want *ProtectedError", tt.target, err)
+			}
+			if !strings.Contains(perr.Reason, tt.reason) {
+				t.Errorf("reason = %q, want it to contain %q", perr.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	tests := []struct {
+		rule      string
+		target    Target
+		protected bool
+	}{
+		{"name=postgres", Target{PID: 700}, true},
+		{"name=POSTGRES", Target{PID: 700}, true},
+		{"name=postgres", Target{PID: 600}, false},
+		{"user=postgres", Target{PID: 700}, true},
+		{"user=alice", Target{PID: 600, User: "alice"}, true},
+		{"port=3000", Target{PID: 600, Port: 3000}, true},
+		{"port=3000", Target{PID: 600}, false},
+		{"path=/usr/lib/postgresql/", Target{PID: 700}, true},
+		{"path=/usr/bin/*", Target{PID: 600}, true},
+		{"path=/usr/bin/*", Target{PID: 700}, false},
+		{"path=/usr/bin/node", Target{PID: 999}, false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) error: %v", tt.rule, err)
+		}
+		err = fakePolicy(r).Check(tt.target)
+		if (err != nil) != tt.protected {
+			t.Errorf("rule %s, target %+v: Check() = %v, want protected=%v", tt.rule, tt.target, err, tt.protected)
+		}
+		if err != nil && !strings.Contains(err.Error(), "protection rule "+r.String()) {
+			t.Errorf("error %q should name the rule", err)
+		}
+	}
+}
+
+func TestPolicyRulesForSocketUnit(t *testing.T) {
+	p := fakePolicy(Rule{RuleName, "cups"}, Rule{RulePort, "8080"})
+	if err := p.Check(Target{PID: 1, Port: 631, Name: "systemd", Unit: "cups.socket"}); err == nil {
+		t.Error("name=cups should protect cups.socket")
+	}
+	if err := p.Check(Target{PID: 1, Port: 8080, Name: "systemd", Unit: "web.socket"}); err == nil {
+		t.Error("port=8080 should protect the socket unit on 8080")
+	}
+	if err := p.Check(Target{PID: 1, Port: 9000, Name: "systemd", Unit: "web.socket"}); err != nil {
+		t.Errorf("unprotected socket unit: %v", err)
+	}
+}
+
+func TestPolicyAdd(t *testing.T) {
+	p := fakePolicy()
+	if p.Check(Target{PID: 600}) != nil {
+		t.Fatal("node should not be protected by default")
+	}
+	p.Add(Rule{Kind: RuleName, Value: "node"})
+	if p.Check(Target{PID: 600}) == nil {
+		t.Error("node should be protected after Add")
+	}
+	if len(p.Rules()) != 1 {
+		t.Errorf("Rules() = %v, want 1 rule", p.Rules())
+	}
+}
+
+func TestPolicyAllow(t *testing.T) {
+	p := fakePolicy(Rule{Kind: RuleName, Value: "postgres"})
+	p.Allow(Rule{Kind: RuleName, Value: "node"}, Rule{Kind: RulePort, Value: "8080"})
+
+	if err := p.Check(Target{PID: 600, Port: 3000}); err != nil {
+		t.Errorf("allowed node: Check() = %v", err)
+	}
+	if err := p.Check(Target{PID: 999, Name: "java", Port: 8080}); err != nil {
+		t.Errorf("allowed port: Check() = %v", err)
+	}
+	err := p.Check(Target{PID: 999, Name: "java", Port: 9090})
+	if err == nil || !strings.Contains(err.Error(), "not in the allow list (name=node, port=8080)") {
+		t.Errorf("java on 9090: Check() = %v, want allow list refusal", err)
+	}
+
+	// Protection rules and built-ins win over the allow list
+	p.Allow(Rule{Kind: RuleName, Value: "postgres"}, Rule{Kind: RuleName, Value: "sshd"})
+	if p.Check(Target{PID: 700}) == nil {
+		t.Error("postgres matches a protection rule and should stay protected")
+	}
+	if p.Check(Target{PID: 100}) == nil {
+		t.Error("sshd should stay protected")
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *Policy
+	if err := p.Check(Target{PID: 1}); err != nil {
+		t.Errorf("nil policy should protect nothing, got %v", err)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Rule
+		wantErr string
+	}{
+		{"name=sshd", Rule{RuleName, "sshd"}, ""},
+		{" PORT = 22 ", Rule{RulePort, "22"}, ""},
+		{"user=root", Rule{RuleUser, "root"}, ""},
+		{"path=/opt/*/bin/*", Rule{RulePath, "/opt/*/bin/*"}, ""},
+		{"sshd", Rule{}, "expected name=, port=, user= or path="},
+		{"name=", Rule{}, "expected name="},
+		{"port=http", Rule{}, "port must be 1-65535"},
+		{"port=70000", Rule{}, "port must be 1-65535"},
+		{"path=[", Rule{}, "syntax error"},
+		{"pid=1", Rule{}, `unknown kind "pid"`},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRule(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRule(%q) error = %v, want it to contain %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRule(%q) = %+v, %v; want %+v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestProtectedErrorMessage(t *testing.T) {
+	err := &ProtectedError{PID: 100, Name: "sshd", Reason: "sshd is the SSH server"}
+	if got := err.Error(); got != "sshd (PID 100) is protected: sshd is the SSH server" {
+		t.Errorf("Error() = %q", got)
+	}
+	err.Name = ""
+	if got := err.Error(); got != "PID 100 is protected: sshd is the SSH server" {
+		t.Errorf("Error() without name = %q", got)
+	}
+}
+
+func TestPolicyProtectsRealSelfAndParent(t *testing.T) {
+	p := NewPolicy()
+	if p.Check(Target{PID: os.Getpid()}) == nil {
+		t.Error("the current process should be protected")
+	}
+	if ppid := os.Getppid(); ppid > 1 && p.Check(Target{PID: ppid}) == nil {
+		t.Error("the parent process should be protected")
+	}
+}
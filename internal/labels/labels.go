@@ -0,0 +1,182 @@
+// Package labels names the app behind a listener, the dev server,
+// database or runtime its command line and executable give away, and the
+// project it serves, from the nearest project file or git repository
+// above its working directory. Six rows that all say node become
+// vite · acme-web, next · acme-docs and so on.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// Rule names the app of the processes whose command line matches Match
+// and whose executable matches Exe. A pattern left empty matches
+// anything. Name may refer to Match's capture groups, e.g. "java $1".
+type Rule struct {
+	Name  string
+	match *regexp.Regexp
+	exe   *regexp.Regexp
+}
+
+// NewRule compiles a rule; match and exe are regular expressions, at
+// least one of which must be given
+func NewRule(name, match, exe string) (Rule, error) {
+	r := Rule{Name: strings.TrimSpace(name)}
+	if r.Name == "" {
+		return Rule{}, errors.New("rule has no name")
+	}
+	if match == "" && exe == "" {
+		return Rule{}, fmt.Errorf("rule %s has neither match nor exe", r.Name)
+	}
+	var err error
+	if match != "" {
+		if r.match, err = regexp.Compile(match); err != nil {
+			return Rule{}, fmt.Errorf("rule %s: invalid match: %w", r.Name, err)
+		}
+	}
+	if exe != "" {
+		if r.exe, err = regexp.Compile(exe); err != nil {
+			return Rule{}, fmt.Errorf("rule %s: invalid exe: %w", r.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// mustRule compiles a built-in rule
+func mustRule(name, match, exe string) Rule {
+	r, err := NewRule(name, match, exe)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Builtin are the rules tried after any configured ones, first match
+// wins: frameworks' dev servers before the runtimes that run them
+var Builtin = []Rule{
+	// JavaScript
+	mustRule("next", `(?:^|[\s/])next(?:\s+(?:dev|start)\b|\s*$)|^next-server\b|/next/dist/`, ""),
+	mustRule("nuxt", `(?:^|[\s/])nuxi?\s+(?:dev|start|preview)\b`, ""),
+	mustRule("astro", `(?:^|[\s/])astro\s+(?:dev|preview)\b`, ""),
+	mustRule("storybook", `(?:^|[\s/])(?:start-)?storybook(?:\s|$)|/storybook/bin/`, ""),
+	mustRule("vite", `(?:^|[\s/])vite(?:\.js)?(?:\s|$)`, ""),
+	mustRule("webpack-dev-server", `webpack-dev-server|(?:^|[\s/])webpack(?:-cli|\.js)?\s+serve\b`, ""),
+	mustRule("angular", `(?:^|[\s/])ng\s+serve\b`, ""),
+	mustRule("gatsby", `(?:^|[\s/])gatsby\s+develop\b`, ""),
+
+	// Ruby and Python
+	mustRule("rails", `(?:^|[\s/])rails\s+s(?:erver)?\b`, ""),
+	mustRule("puma", `^puma\b|(?:^|[\s/])puma(?:\s|$)`, ""),
+	mustRule("unicorn", `^unicorn\b|(?:^|[\s/])unicorn(?:\s|$)`, ""),
+	mustRule("django", `(?:manage\.py|django-admin)\s+runserver\b`, ""),
+	mustRule("uvicorn", `(?:^|[\s/])uvicorn(?:\s|$)`, ""),
+	mustRule("gunicorn", `(?:^|[\s/])gunicorn(?:\s|:|$)`, ""),
+	mustRule("hypercorn", `(?:^|[\s/])hypercorn(?:\s|$)`, ""),
+	mustRule("flask", `(?:^|[\s/])flask\s+run\b`, ""),
+	mustRule("streamlit", `(?:^|[\s/])streamlit\s+run\b`, ""),
+	mustRule("jupyter", `(?:^|[\s/])jupyter(?:-lab|-notebook|-server)?(?:\s|$)`, ""),
+
+	// Compiled by a toolchain on the fly
+	mustRule("go run", "", `/go-build\d+/`),
+	mustRule("cargo", "", `(?:^|/)target/(?:debug|release)/[^/]+$`),
+
+	// Databases, caches and web servers
+	mustRule("postgres", `^postgres(?::|\s|$)|(?:^|/)(?:postgres|postmaster)(?:\s|$)`, ""),
+	mustRule("mysql", `(?:^|/)(?:mysqld|mariadbd)(?:\s|$)`, ""),
+	mustRule("redis", `(?:^|/)redis-server(?:\s|$)`, ""),
+	mustRule("valkey", `(?:^|/)valkey-server(?:\s|$)`, ""),
+	mustRule("mongodb", `(?:^|/)mongod(?:\s|$)`, ""),
+	mustRule("memcached", `(?:^|/)memcached(?:\s|$)`, ""),
+	mustRule("elasticsearch", `org\.elasticsearch\.bootstrap\b`, ""),
+	mustRule("kafka", `\bkafka\.Kafka\b`, ""),
+	mustRule("nginx", `^nginx:|(?:^|/)nginx(?:\s|$)`, ""),
+	mustRule("caddy", `(?:^|/)caddy\s+(?:run|start)\b`, ""),
+	mustRule("apache", `(?:^|/)(?:httpd|apache2)(?:\s|$)`, ""),
+
+	// Runtimes, named with the script or archive they run
+	mustRule("spring boot", `org\.springframework\.boot\.loader\b`, ""),
+	mustRule("java $1", `(?:^|/)java\s.*?-jar\s+(?:\S*/)?([^\s/]+?)(?:\.jar)?(?:\s|$)`, ""),
+	mustRule("dotnet $1", `(?:^|/)dotnet\s+(?:run\b|(?:\S*/)?([^\s/]+?)\.dll\b)`, ""),
+	mustRule("node $1", `(?:^|/)node(?:js)?\s+(?:-\S+\s+)*(?:\S*/)?([^\s/]+)`, ""),
+	mustRule("bun $1", `(?:^|/)bun\s+(?:run\s+)?(?:\S*/)?([^\s/-][^\s/]*)`, ""),
+	mustRule("deno", `(?:^|/)deno\s+(?:run|serve|task)\b`, ""),
+	mustRule("python -m $1", `(?:^|/)python[\d.]*\s+(?:-[^m\s]\S*\s+)*-m\s+(\S+)`, ""),
+	mustRule("python $1", `(?:^|/)python[\d.]*\s+(?:-\S+\s+)*(?:\S*/)?([^\s/]+\.py)(?:\s|$)`, ""),
+	mustRule("ruby $1", `(?:^|/)ruby[\d.]*\s+(?:-\S+\s+)*(?:\S*/)?([^\s/]+\.rb)(?:\s|$)`, ""),
+	mustRule("php", `(?:^|/)php[\d.]*\s.*-S\s`, ""),
+}
+
+// Labeler sets App and Project on listeners
+type Labeler struct {
+	rules []Rule
+	// project looks up the project of a directory; Project if nil
+	project func(dir string) string
+}
+
+// New returns a Labeler that tries rules before the built-in ones
+func New(rules []Rule) *Labeler {
+	return &Labeler{rules: append(append([]Rule(nil), rules...), Builtin...)}
+}
+
+// App names the app of p from the first rule its command line and
+// executable match, or returns "" if none does
+func (l *Labeler) App(p ports.PortInfo) string {
+	cmdline := p.Cmdline
+	if cmdline == "" {
+		cmdline = p.Process
+	}
+	exe := p.Exe
+	if exe == "" {
+		// Where the executable is unknown, as on macOS, argv[0] stands in
+		exe, _, _ = strings.Cut(p.Cmdline, " ")
+	}
+
+	for _, r := range l.rules {
+		var m []int
+		if r.match != nil {
+			if m = r.match.FindStringSubmatchIndex(cmdline); m == nil {
+				continue
+			}
+		}
+		if r.exe != nil && (exe == "" || !r.exe.MatchString(exe)) {
+			continue
+		}
+		name := r.Name
+		if r.match != nil {
+			name = string(r.match.ExpandString(nil, r.Name, cmdline, m))
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Annotate sets App and Project on each listener in list. Containers are
+// skipped for projects: their working directories are not on this
+// host's filesystem.
+func (l *Labeler) Annotate(list []ports.PortInfo) {
+	project := l.project
+	if project == nil {
+		project = Project
+	}
+	projects := make(map[string]string)
+	for i := range list {
+		p := &list[i]
+		p.App = l.App(*p)
+		if p.Cwd == "" || p.Container != nil {
+			continue
+		}
+		name, ok := projects[p.Cwd]
+		if !ok {
+			name = project(p.Cwd)
+			projects[p.Cwd] = name
+		}
+		p.Project = name
+	}
+}
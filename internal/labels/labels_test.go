@@ -0,0 +1,130 @@
+package labels
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+func TestApp(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		exe     string
+		want    string
+	}{
+		{"node /home/dev/acme-web/node_modules/.bin/vite --port 5173", "/usr/bin/node", "vite"},
+		{"node /app/node_modules/vite/bin/vite.js", "", "vite"},
+		{"next-server (v14.2.3)", "/usr/bin/node", "next"},
+		{"node /app/node_modules/.bin/next dev", "", "next"},
+		{"node /app/node_modules/.bin/nuxi dev", "", "nuxt"},
+		{"node /app/node_modules/.bin/webpack-dev-server --mode development", "", "webpack-dev-server"},
+		{"node /app/node_modules/.bin/webpack serve", "", "webpack-dev-server"},
+		{"node /app/node_modules/.bin/storybook dev -p 6006", "", "storybook"},
+		{"node /app/node_modules/.bin/ng serve", "", "angular"},
+		{"ruby bin/rails server -p 3000", "", "rails"},
+		{"puma 6.4.0 (tcp://localhost:3000) [acme]", "/usr/bin/ruby", "puma"},
+		{"python manage.py runserver 0.0.0.0:8000", "", "django"},
+		{"/venv/bin/python3 /venv/bin/uvicorn main:app --reload", "", "uvicorn"},
+		{"python -m uvicorn main:app", "", "uvicorn"},
+		{"gunicorn: master [app:server]", "", "gunicorn"},
+		{"/venv/bin/python -m flask run --port 5000", "", "flask"},
+		{"/tmp/go-build1234/b001/exe/main", "/tmp/go-build1234/b001/exe/main", "go run"},
+		{"target/debug/api --port 8080", "", "cargo"},
+		{"/usr/lib/postgresql/16/bin/postgres -D /var/lib/postgresql/16/main", "", "postgres"},
+		{"/usr/sbin/mysqld", "", "mysql"},
+		{"redis-server *:6379", "/usr/bin/redis-server", "redis"},
+		{"/usr/bin/mongod --config /etc/mongod.conf", "", "mongodb"},
+		{"nginx: master process /usr/sbin/nginx -g daemon off;", "", "nginx"},
+		{"/usr/bin/java -Xmx512m -jar /srv/app/billing-service.jar --server.port=8080", "", "java billing-service"},
+		{"java -cp app.jar org.springframework.boot.loader.launch.JarLauncher", "", "spring boot"},
+		{"dotnet Acme.Api.dll", "", "dotnet Acme.Api"},
+		{"node --inspect server.js", "/usr/bin/node", "node server.js"},
+		{"bun run index.ts", "", "bun index.ts"},
+		{"python3 -m http.server 8000", "", "python -m http.server"},
+		{"python3 -u app.py", "", "python app.py"},
+		{"ruby server.rb", "", "ruby server.rb"},
+		{"php -S localhost:8000 -t public", "", "php"},
+		{"/usr/sbin/sshd -D", "/usr/sbin/sshd", ""},
+		{"", "", ""},
+	}
+
+	l := New(nil)
+	for _, tt := range tests {
+		if got := l.App(ports.PortInfo{Process: "x", Cmdline: tt.cmdline, Exe: tt.exe}); got != tt.want {
+			t.Errorf("App(%q) = %q, want %q", tt.cmdline, got, tt.want)
+		}
+	}
+
+	// Without a command line the process name is matched
+	if got := l.App(ports.PortInfo{Process: "redis-server"}); got != "redis" {
+		t.Errorf("App(redis-server process) = %q, want redis", got)
+	}
+}
+
+func TestAppConfiguredRules(t *testing.T) {
+	storybook, err := NewRule("storybook $1", `storybook\s+dev\s+-p\s+(\d+)`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker, err := NewRule("worker", "", `/opt/acme/bin/`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New([]Rule{storybook, worker})
+
+	if got := l.App(ports.PortInfo{Cmdline: "node .bin/storybook dev -p 6006"}); got != "storybook 6006" {
+		t.Errorf("configured rule = %q, want it tried before the built-ins", got)
+	}
+	if got := l.App(ports.PortInfo{Cmdline: "acme-worker --listen :9000", Exe: "/opt/acme/bin/acme-worker"}); got != "worker" {
+		t.Errorf("exe rule = %q, want worker", got)
+	}
+	if got := l.App(ports.PortInfo{Cmdline: "/opt/acme/bin/acme-worker"}); got != "worker" {
+		t.Errorf("exe rule without an executable = %q, want argv[0] matched", got)
+	}
+}
+
+func TestNewRuleErrors(t *testing.T) {
+	tests := []struct {
+		name, match, exe string
+		want             string
+	}{
+		{"", "vite", "", "no name"},
+		{"vite", "", "", "neither"},
+		{"vite", "vite(", "", "invalid match"},
+		{"vite", "", "[", "invalid exe"},
+	}
+	for _, tt := range tests {
+		if _, err := NewRule(tt.name, tt.match, tt.exe); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewRule(%q, %q, %q) error = %v, want %q", tt.name, tt.match, tt.exe, err, tt.want)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	var looked []string
+	l := New(nil)
+	l.project = func(dir string) string {
+		looked = append(looked, dir)
+		return map[string]string{"/src/acme-web": "acme-web"}[dir]
+	}
+
+	list := []ports.PortInfo{
+		{Port: 5173, Process: "node", Cmdline: "node node_modules/.bin/vite", Cwd: "/src/acme-web"},
+		{Port: 3000, Process: "node", Cmdline: "node /x/y", Cwd: "/src/acme-web"},
+		{Port: 5432, Process: "postgres", Cmdline: "postgres -D /data", Cwd: "/data",
+			Container: &ports.Container{ID: "abc"}},
+		{Port: 22, Process: "sshd", Cmdline: "sshd -D", Cwd: "/"},
+	}
+	l.Annotate(list)
+
+	want := []string{"vite · acme-web", "node y · acme-web", "postgres", ""}
+	for i, p := range list {
+		if got := p.Label(); got != want[i] {
+			t.Errorf("list[%d].Label() = %q, want %q", i, got, want[i])
+		}
+	}
+	if len(looked) != 2 {
+		t.Errorf("looked up projects of %v, want each directory once and no containers", looked)
+	}
+}
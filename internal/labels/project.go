@@ -0,0 +1,107 @@
+package labels
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// markers are the files that name a project, checked in order in each
+// directory on the way up
+var markers = []struct {
+	file string
+	name func(data []byte) string
+}{
+	{"package.json", packageJSONName},
+	{"Cargo.toml", tomlName},
+	{"pyproject.toml", tomlName},
+	{"go.mod", goModName},
+}
+
+// Project returns the name of the project dir belongs to: the name in the
+// nearest package.json, Cargo.toml, pyproject.toml or go.mod, else the
+// directory of the nearest git repository. The search stops below the
+// home directory, whose dotfiles are no project, and "" is returned if
+// it finds nothing.
+func Project(dir string) string {
+	home, _ := os.UserHomeDir()
+	dir = filepath.Clean(dir)
+	for dir != home {
+		for _, m := range markers {
+			if data, err := os.ReadFile(filepath.Join(dir, m.file)); err == nil {
+				if name := m.name(data); name != "" {
+					return name
+				}
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return filepath.Base(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+	return ""
+}
+
+// packageJSONName returns the name in a package.json without its npm
+// scope, e.g. web for @acme/web
+func packageJSONName(data []byte) string {
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &pkg) != nil || pkg.Name == "" {
+		return ""
+	}
+	return path.Base(pkg.Name)
+}
+
+// tomlName returns the package name in a Cargo.toml or pyproject.toml
+func tomlName(data []byte) string {
+	var f struct {
+		Package struct{ Name string } `toml:"package"`
+		Project struct{ Name string } `toml:"project"`
+		Tool    struct {
+			Poetry struct{ Name string } `toml:"poetry"`
+		} `toml:"tool"`
+	}
+	if _, err := toml.Decode(string(data), &f); err != nil {
+		return ""
+	}
+	for _, name := range []string{f.Package.Name, f.Project.Name, f.Tool.Poetry.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// goModName returns the last element of the module path in a go.mod,
+// skipping a major version suffix: api for github.com/acme/api/v2
+func goModName(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		module, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module ")
+		if !ok {
+			continue
+		}
+		module = strings.Trim(strings.TrimSpace(module), `"`)
+		base := path.Base(module)
+		if len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+			base = path.Base(path.Dir(module))
+		}
+		if base == "." || base == "/" {
+			return ""
+		}
+		return base
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile creates path under dir with content, making its directories
+func writeFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	path = filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProject(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+
+	writeFile(t, root, "acme/.git/HEAD", "ref: refs/heads/main\n")
+	writeFile(t, root, "acme/apps/web/package.json", `{"name": "@acme/web", "private": true}`)
+	writeFile(t, root, "acme/apps/docs/package.json", `{"private": true}`)
+	writeFile(t, root, "acme/api/go.mod", "module github.com/acme/api/v2\n\ngo 1.24\n")
+	writeFile(t, root, "acme/engine/Cargo.toml", "[package]\nname = \"engine\"\nversion = \"0.1.0\"\n")
+	writeFile(t, root, "acme/ml/pyproject.toml", "[tool.poetry]\nname = \"acme-ml\"\n")
+	writeFile(t, root, "acme/broken/package.json", `{not json`)
+	writeFile(t, root, ".git/HEAD", "ref: refs/heads/main\n") // dotfiles repo in home
+	writeFile(t, root, "notes/todo.txt", "")
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"acme/apps/web/src", "web"},
+		{"acme/apps/docs", "acme"}, // unnamed package.json falls through to the repo
+		{"acme/api", "api"},
+		{"acme/engine/src/bin", "engine"},
+		{"acme/ml", "acme-ml"},
+		{"acme/broken", "acme"},
+		{"acme", "acme"},
+		{"notes", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Project(filepath.Join(root, tt.dir)); got != tt.want {
+			t.Errorf("Project(%s) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestGoModName(t *testing.T) {
+	for data, want := range map[string]string{
+		"module example.com/tool\n":     "tool",
+		"// comment\nmodule \"acme\"\n": "acme",
+		"module github.com/acme/v3\n":   "acme",
+		"go 1.24\n":                     "",
+	} {
+		if got := goModName([]byte(data)); got != want {
+			t.Errorf("goModName(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
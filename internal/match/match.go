@@ -0,0 +1,265 @@
+// Package match implements the filter matching used by the TUI: fzf-style
+// fuzzy scoring, case-insensitive substring matching and regular expressions.
+// Every mode reports the rune positions that matched so callers can
+// highlight them.
+package match
+
+import (
+	"fmt"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mode selects how a pattern is matched against text
+type Mode int
+
+const (
+	// Fuzzy matches the pattern's characters in order, not necessarily adjacent
+	Fuzzy Mode = iota
+	// Exact matches the pattern as a case-insensitive substring
+	Exact
+	// Regex matches the pattern as a case-insensitive regular expression
+	Regex
+)
+
+// String returns the mode's name
+func (m Mode) String() string {
+	switch m {
+	case Exact:
+		return "exact"
+	case Regex:
+		return "regex"
+	default:
+		return "fuzzy"
+	}
+}
+
+// Next returns the mode after m, wrapping around
+func (m Mode) Next() Mode {
+	return (m + 1) % 3
+}
+
+// Scoring, modelled on fzf
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// bonusBoundary rewards matches at the start of a word
+	bonusBoundary = scoreMatch / 2
+	// bonusCamel rewards matches at a lower-to-upper or letter-to-digit change
+	bonusCamel = bonusBoundary - 1
+	// bonusConsecutive rewards runs of adjacent matches
+	bonusConsecutive = -(scoreGapStart + scoreGapExtension)
+	// bonusFirstCharMultiplier weighs the bonus of the pattern's first character
+	bonusFirstCharMultiplier = 2
+)
+
+// Result describes a successful match
+type Result struct {
+	Score     int
+	Positions []int // rune indexes into the text, ascending
+}
+
+// Matcher matches a single pattern against text
+type Matcher struct {
+	mode    Mode
+	pattern []rune // lowercased
+	re      *regexp.Regexp
+}
+
+// New creates a matcher for pattern. Only Regex mode can fail, when the
+// pattern does not compile.
+func New(mode Mode, pattern string) (*Matcher, error) {
+	m := &Matcher{mode: mode, pattern: lowerRunes(pattern)}
+	if mode == Regex && pattern != "" {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Empty reports whether the matcher has no pattern and so matches everything
+func (m *Matcher) Empty() bool {
+	return len(m.pattern) == 0
+}
+
+// Match matches text against the pattern. An empty pattern matches
+// everything with a zero score.
+func (m *Matcher) Match(text string) (Result, bool) {
+	if m.Empty() {
+		return Result{}, true
+	}
+
+	switch m.mode {
+	case Exact:
+		return exactMatch(m.pattern, []rune(text))
+	case Regex:
+		return regexMatch(m.re, text)
+	default:
+		return fuzzyMatch(m.pattern, []rune(text))
+	}
+}
+
+// fuzzyMatch finds the highest-scoring placement of pattern's runes, in
+// order, within text. H[i][j] is the best score for pattern[:i+1] with
+// pattern[i] matched at text[j].
+func fuzzyMatch(pattern, text []rune) (Result, bool) {
+	m, n := len(pattern), len(text)
+	if m > n {
+		return Result{}, false
+	}
+
+	lower := lowerRunes(string(text))
+	bonus := make([]int, n)
+	for j := range text {
+		bonus[j] = bonusAt(text, j)
+	}
+
+	const none = -1 << 30
+	score := make([][]int, m)
+	from := make([][]int, m)
+	for i := range score {
+		score[i] = make([]int, n)
+		from[i] = make([]int, n)
+		for j := range score[i] {
+			score[i][j] = none
+		}
+	}
+
+	for j := 0; j < n; j++ {
+		if lower[j] == pattern[0] {
+			score[0][j] = scoreMatch + bonus[j]*bonusFirstCharMultiplier
+			from[0][j] = -1
+		}
+	}
+
+	for i := 1; i < m; i++ {
+		// best tracks max(score[i-1][k] + k) over k < j-1, which turns the
+		// linear gap penalty into a running maximum
+		best, bestK := none, -1
+		for j := i; j < n; j++ {
+			if k := j - 2; k >= 0 && score[i-1][k] != none && score[i-1][k]+k > best {
+				best, bestK = score[i-1][k]+k, k
+			}
+			if lower[j] != pattern[i] {
+				continue
+			}
+
+			if prev := score[i-1][j-1]; prev != none {
+				score[i][j] = prev + scoreMatch + max(bonus[j], bonusConsecutive)
+				from[i][j] = j - 1
+			}
+			if bestK >= 0 {
+				gap := j - bestK - 1
+				s := score[i-1][bestK] + scoreMatch + bonus[j] + scoreGapStart + scoreGapExtension*(gap-1)
+				if s > score[i][j] {
+					score[i][j] = s
+					from[i][j] = bestK
+				}
+			}
+		}
+	}
+
+	end := -1
+	for j := 0; j < n; j++ {
+		if score[m-1][j] != none && (end == -1 || score[m-1][j] > score[m-1][end]) {
+			end = j
+		}
+	}
+	if end == -1 {
+		return Result{}, false
+	}
+
+	positions := make([]int, m)
+	for i, j := m-1, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+
+	return Result{Score: score[m-1][end], Positions: positions}, true
+}
+
+// exactMatch finds the first case-insensitive occurrence of pattern in text
+func exactMatch(pattern, text []rune) (Result, bool) {
+	lower := lowerRunes(string(text))
+	for start := 0; start+len(pattern) <= len(lower); start++ {
+		found := true
+		for i, r := range pattern {
+			if lower[start+i] != r {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		positions := make([]int, len(pattern))
+		for i := range positions {
+			positions[i] = start + i
+		}
+		score := scoreMatch*len(pattern) + bonusConsecutive*(len(pattern)-1) +
+			bonusAt(text, start)*bonusFirstCharMultiplier
+		return Result{Score: score, Positions: positions}, true
+	}
+	return Result{}, false
+}
+
+// regexMatch finds the leftmost match of re in text
+func regexMatch(re *regexp.Regexp, text string) (Result, bool) {
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return Result{}, false
+	}
+
+	start := utf8.RuneCountInString(text[:loc[0]])
+	count := utf8.RuneCountInString(text[loc[0]:loc[1]])
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = start + i
+	}
+
+	score := scoreMatch * max(count, 1)
+	if count > 0 {
+		score += bonusAt([]rune(text), start) * bonusFirstCharMultiplier
+	}
+	return Result{Score: score, Positions: positions}, true
+}
+
+// bonusAt returns the position bonus for a match at text[j]
+func bonusAt(text []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+
+	prev, cur := text[j-1], text[j]
+	switch {
+	case !isWordRune(prev) && isWordRune(cur):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return bonusCamel
+	case unicode.IsLetter(prev) && unicode.IsDigit(cur):
+		return bonusCamel
+	}
+	return 0
+}
+
+// isWordRune reports whether r is part of a word rather than a separator
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lowerRunes lowercases s rune by rune, so that rune indexes into the
+// result line up with rune indexes into s
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
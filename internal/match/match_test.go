@@ -0,0 +1,193 @@
+package match
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		want string
+	}{
+		{Fuzzy, "fuzzy"},
+		{Exact, "exact"},
+		{Regex, "regex"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.mode.String(); got != tt.want {
+			t.Errorf("Mode(%d).String() = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestModeNext(t *testing.T) {
+	if Fuzzy.Next() != Exact || Exact.Next() != Regex || Regex.Next() != Fuzzy {
+		t.Error("Next should cycle fuzzy → exact → regex → fuzzy")
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		ok      bool
+		pos     []int
+	}{
+		{"nd", "node", true, []int{0, 2}},
+		{"node", "node", true, []int{0, 1, 2, 3}},
+		{"NODE", "node", true, []int{0, 1, 2, 3}},
+		{"vite", "node_modules/.bin/vite", true, []int{18, 19, 20, 21}},
+		{"pg", "postgres", true, []int{0, 4}},
+		{"xyz", "node", false, nil},
+		{"nodes", "node", false, nil},
+		{"ön", "Öl und Öne", true, []int{7, 8}},
+		{"30", "3000", true, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		m, err := New(Fuzzy, tt.pattern)
+		if err != nil {
+			t.Fatalf("New(Fuzzy, %q) error: %v", tt.pattern, err)
+		}
+		res, ok := m.Match(tt.text)
+		if ok != tt.ok {
+			t.Errorf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(res.Positions, tt.pos) {
+			t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, res.Positions, tt.pos)
+		}
+	}
+}
+
+func TestFuzzyScoreRanking(t *testing.T) {
+	m, _ := New(Fuzzy, "vite")
+
+	contiguous, _ := m.Match("vite")
+	boundary, _ := m.Match("npm run vite")
+	scattered, _ := m.Match("very inactive terminal emulator")
+
+	if contiguous.Score <= scattered.Score {
+		t.Errorf("contiguous score %d should beat scattered %d", contiguous.Score, scattered.Score)
+	}
+	if boundary.Score <= scattered.Score {
+		t.Errorf("word-boundary score %d should beat scattered %d", boundary.Score, scattered.Score)
+	}
+}
+
+func TestFuzzyPrefersBoundaries(t *testing.T) {
+	m, _ := New(Fuzzy, "ws")
+
+	res, ok := m.Match("webpack-dev-server")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	// 'w' at the start and 's' at the start of "server" beat the earlier 's'
+	if !reflect.DeepEqual(res.Positions, []int{0, 12}) {
+		t.Errorf("positions = %v, want [0 12]", res.Positions)
+	}
+}
+
+func TestExactMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		ok      bool
+		pos     []int
+	}{
+		{"ode", "node", true, []int{1, 2, 3}},
+		{"ODE", "NoDe", true, []int{1, 2, 3}},
+		{"nd", "node", false, nil},
+		{"straße", "STRASSE straße", true, []int{8, 9, 10, 11, 12, 13}},
+		{"toolong", "node", false, nil},
+	}
+
+	for _, tt := range tests {
+		m, _ := New(Exact, tt.pattern)
+		res, ok := m.Match(tt.text)
+		if ok != tt.ok {
+			t.Errorf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(res.Positions, tt.pos) {
+			t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, res.Positions, tt.pos)
+		}
+	}
+}
+
+func TestRegexMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		ok      bool
+		pos     []int
+	}{
+		{"^no", "node", true, []int{0, 1}},
+		{"d.$", "node", true, []int{2, 3}},
+		{"NODE", "node", true, []int{0, 1, 2, 3}},
+		{"é+", "café", true, []int{3}},
+		{"^x", "node", false, nil},
+	}
+
+	for _, tt := range tests {
+		m, err := New(Regex, tt.pattern)
+		if err != nil {
+			t.Fatalf("New(Regex, %q) error: %v", tt.pattern, err)
+		}
+		res, ok := m.Match(tt.text)
+		if ok != tt.ok {
+			t.Errorf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(res.Positions, tt.pos) {
+			t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, res.Positions, tt.pos)
+		}
+	}
+}
+
+func TestRegexInvalid(t *testing.T) {
+	if _, err := New(Regex, "(unclosed"); err == nil {
+		t.Error("New(Regex, \"(unclosed\") should return error")
+	}
+	// Only regex mode compiles the pattern
+	if _, err := New(Fuzzy, "(unclosed"); err != nil {
+		t.Errorf("New(Fuzzy, ...) should not fail: %v", err)
+	}
+}
+
+func TestEmptyPattern(t *testing.T) {
+	for _, mode := range []Mode{Fuzzy, Exact, Regex} {
+		m, err := New(mode, "")
+		if err != nil {
+			t.Fatalf("New(%s, \"\") error: %v", mode, err)
+		}
+		if !m.Empty() {
+			t.Errorf("%s matcher with empty pattern should be Empty", mode)
+		}
+		if res, ok := m.Match("anything"); !ok || res.Score != 0 {
+			t.Errorf("%s empty pattern should match with zero score, got %v, %v", mode, res, ok)
+		}
+	}
+}
+
+func TestBonusAt(t *testing.T) {
+	text := []rune("my-appServer2")
+	tests := []struct {
+		idx  int
+		want int
+	}{
+		{0, bonusBoundary}, // start of text
+		{1, 0},             // middle of word
+		{3, bonusBoundary}, // after '-'
+		{6, bonusCamel},    // lower → upper
+		{12, bonusCamel},   // letter → digit
+	}
+
+	for _, tt := range tests {
+		if got := bonusAt(text, tt.idx); got != tt.want {
+			t.Errorf("bonusAt(%d) = %d, want %d", tt.idx, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package output renders lists of records as a table or in a machine
+// readable format. Port listings, kill results and subcommands all print
+// through a Printer so every command supports the same --output formats.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format
+type Format string
+
+const (
+	Table    Format = "table"    // aligned columns fitted to the terminal
+	Wide     Format = "wide"     // every column, never truncated
+	JSON     Format = "json"     // an indented array
+	NDJSON   Format = "ndjson"   // one compact object per line
+	CSV      Format = "csv"      // comma-separated, keyed header row
+	TSV      Format = "tsv"      // tab-separated, keyed header row
+	YAML     Format = "yaml"     // a sequence of mappings
+	Template Format = "template" // a Go template executed per row
+)
+
+// Formats lists every format
+var Formats = []Format{Table, Wide, JSON, NDJSON, CSV, TSV, YAML, Template}
+
+// ParseFormat parses a format name, case-insensitively
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range Formats {
+		if f == known {
+			return f, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, known := range Formats {
+		names[i] = string(known)
+	}
+	return "", fmt.Errorf("unknown output format: %s (valid: %s)", s, strings.Join(names, ", "))
+}
+
+// Human reports whether f is meant for people rather than programs
+func (f Format) Human() bool {
+	return f == Table || f == Wide
+}
+
+// Options selects and configures a format
+type Options struct {
+	Format    Format
+	NoHeaders bool // omit the table header and csv/tsv header row
+	Width     int  // terminal width a table is fitted to; 0 for no limit
+
+	tmpl        *template.Template
+	tmplNewline bool // the template ends with its own newline
+}
+
+// NewOptions validates a format name and template text. A template
+// without a format selects Template; an empty format is Table.
+func NewOptions(format, tmpl string, noHeaders bool) (Options, error) {
+	opts := Options{Format: Table, NoHeaders: noHeaders}
+	switch {
+	case format != "":
+		f, err := ParseFormat(format)
+		if err != nil {
+			return Options{}, err
+		}
+		opts.Format = f
+	case tmpl != "":
+		opts.Format = Template
+	}
+
+	if opts.Format == Template {
+		if tmpl == "" {
+			return Options{}, fmt.Errorf("output format template requires --template")
+		}
+		t, err := template.New("output").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return Options{}, fmt.Errorf("invalid template: %w", err)
+		}
+		opts.tmpl = t
+		opts.tmplNewline = strings.HasSuffix(tmpl, "\n")
+	} else if tmpl != "" {
+		return Options{}, fmt.Errorf("--template requires --output template, not %s", opts.Format)
+	}
+	return opts, nil
+}
+
+// Printer renders rows of type T in any format
+type Printer[T any] struct {
+	Columns     []Column[T] // table, csv and tsv
+	WideColumns []Column[T] // wide; Columns if nil
+	Record      func(T) any // json, ndjson and yaml; the row itself if nil
+	Empty       string      // shown under the table header when there are no rows
+}
+
+// Print writes rows to w in the format selected by opts
+func (p Printer[T]) Print(w io.Writer, rows []T, opts Options) error {
+	switch opts.Format {
+	case Table, "":
+		return p.table(w, rows, p.Columns, opts.Width, opts.NoHeaders)
+	case Wide:
+		cols := p.WideColumns
+		if cols == nil {
+			cols = p.Columns
+		}
+		return p.table(w, rows, cols, 0, opts.NoHeaders)
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p.records(rows))
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		for _, r := range p.records(rows) {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(p.records(rows)); err != nil {
+			return err
+		}
+		return enc.Close()
+	case CSV:
+		return p.delimited(w, rows, ',', opts.NoHeaders)
+	case TSV:
+		return p.delimited(w, rows, '\t', opts.NoHeaders)
+	case Template:
+		return p.template(w, rows, opts)
+	}
+	return fmt.Errorf("unknown output format: %s", opts.Format)
+}
+
+// records converts rows for the structured formats. It is never nil, so
+// an empty list encodes as [] rather than null.
+func (p Printer[T]) records(rows []T) []any {
+	records := make([]any, len(rows))
+	for i, r := range rows {
+		if p.Record != nil {
+			records[i] = p.Record(r)
+		} else {
+			records[i] = r
+		}
+	}
+	return records
+}
+
+// table writes aligned columns with a header and rule
+func (p Printer[T]) table(w io.Writer, rows []T, cols []Column[T], width int, noHeaders bool) error {
+	widths := Widths(cols, rows, width)
+	line := func(cells []string) error {
+		_, err := fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, " "), " "))
+		return err
+	}
+
+	if !noHeaders {
+		headers := make([]string, len(cols))
+		for i, c := range cols {
+			headers[i] = Fit(c.Header, widths[i])
+		}
+		if err := line(headers); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, strings.Repeat("-", TotalWidth(widths))); err != nil {
+			return err
+		}
+		if len(rows) == 0 && p.Empty != "" {
+			_, err := fmt.Fprintln(w, p.Empty)
+			return err
+		}
+	}
+
+	cells := make([]string, len(cols))
+	for _, r := range rows {
+		for i, c := range cols {
+			cells[i] = Fit(c.Value(r), widths[i])
+		}
+		if err := line(cells); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delimited writes csv, or tsv when sep is a tab. Tsv is not quoted;
+// tabs and newlines inside values become spaces.
+func (p Printer[T]) delimited(w io.Writer, rows []T, sep rune, noHeaders bool) error {
+	var write func([]string) error
+	cw := csv.NewWriter(w)
+	if sep == '\t' {
+		clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+		write = func(record []string) error {
+			for i, v := range record {
+				record[i] = clean.Replace(v)
+			}
+			_, err := fmt.Fprintln(w, strings.Join(record, "\t"))
+			return err
+		}
+	} else {
+		cw.Comma = sep
+		write = cw.Write
+	}
+
+	if !noHeaders {
+		keys := make([]string, len(p.Columns))
+		for i, c := range p.Columns {
+			keys[i] = c.Key
+		}
+		if err := write(keys); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(p.Columns))
+	for _, r := range rows {
+		for i, c := range p.Columns {
+			record[i] = c.Value(r)
+		}
+		if err := write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// template executes the template for each row, ending each with a newline
+// unless the template already does
+func (p Printer[T]) template(w io.Writer, rows []T, opts Options) error {
+	if opts.tmpl == nil {
+		return fmt.Errorf("output format template requires --template")
+	}
+	for _, r := range rows {
+		if err := opts.tmpl.Execute(w, r); err != nil {
+			return err
+		}
+		if !opts.tmplNewline {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package output
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	Name  string `json:"name" yaml:"name"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+var testRows = []row{{"alpha", 1}, {"beta\tgamma", 22}}
+
+var testPrinter = Printer[row]{
+	Columns: []Column[row]{
+		{Key: "name", Header: "NAME", Flex: true, Min: 4, Value: func(r row) string { return r.Name }},
+		{Key: "count", Header: "COUNT", Value: func(r row) string { return strconv.Itoa(r.Count) }},
+	},
+	Empty: "Nothing here",
+}
+
+func render(t *testing.T, rows []row, format, tmpl string, noHeaders bool) string {
+	t.Helper()
+	opts, err := NewOptions(format, tmpl, noHeaders)
+	if err != nil {
+		t.Fatalf("NewOptions(%q, %q) error: %v", format, tmpl, err)
+	}
+	var buf bytes.Buffer
+	if err := testPrinter.Print(&buf, rows, opts); err != nil {
+		t.Fatalf("Print(%s) error: %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestPrintFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		tmpl   string
+		want   string
+	}{
+		{"table", "", "NAME  COUNT\n-----------\nalpha 1\n"},
+		{"json", "", "[\n  {\n    \"name\": \"alpha\",\n    \"count\": 1\n  },\n  {\n    \"name\": \"beta\\tgamma\",\n    \"count\": 22\n  }\n]\n"},
+		{"ndjson", "", "{\"name\":\"alpha\",\"count\":1}\n{\"name\":\"beta\\tgamma\",\"count\":22}\n"},
+		{"yaml", "", "- name: alpha\n  count: 1\n- name: \"beta\\tgamma\"\n  count: 22\n"},
+		{"csv", "", "name,count\nalpha,1\nbeta\tgamma,22\n"},
+		{"tsv", "", "name\tcount\nalpha\t1\nbeta gamma\t22\n"},
+		{"", "{{.Name}}={{.Count}}", "alpha=1\nbeta\tgamma=22\n"},
+		{"template", "{{.Count}}\n", "1\n22\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+tt.tmpl, func(t *testing.T) {
+			rows := testRows
+			if tt.format == "table" {
+				rows = rows[:1]
+			}
+			if got := render(t, rows, tt.format, tt.tmpl, false); got != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintNoHeaders(t *testing.T) {
+	if got := render(t, testRows[:1], "table", "", true); got != "alpha 1\n" {
+		t.Errorf("table without headers = %q", got)
+	}
+	if got := render(t, testRows[:1], "csv", "", true); got != "alpha,1\n" {
+		t.Errorf("csv without headers = %q", got)
+	}
+	if got := render(t, nil, "table", "", true); got != "" {
+		t.Errorf("empty table without headers = %q, want nothing", got)
+	}
+}
+
+func TestPrintEmpty(t *testing.T) {
+	if got := render(t, nil, "table", "", false); !strings.HasSuffix(got, "Nothing here\n") {
+		t.Errorf("empty table = %q, want the empty message", got)
+	}
+	if got := render(t, nil, "json", "", false); got != "[]\n" {
+		t.Errorf("empty json = %q, want []", got)
+	}
+	if got := render(t, nil, "csv", "", false); got != "name,count\n" {
+		t.Errorf("empty csv = %q, want only the header", got)
+	}
+}
+
+func TestPrintWide(t *testing.T) {
+	p := testPrinter
+	p.WideColumns = append(p.Columns, Column[row]{Key: "double", Header: "DOUBLE", Value: func(r row) string {
+		return strconv.Itoa(r.Count * 2)
+	}})
+	opts, _ := NewOptions("wide", "", false)
+	opts.Width = 5 // ignored by wide
+	var buf bytes.Buffer
+	if err := p.Print(&buf, testRows[:1], opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := "NAME  COUNT DOUBLE\n------------------\nalpha 1     2\n"; buf.String() != want {
+		t.Errorf("wide = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrintTableFitsWidth(t *testing.T) {
+	opts, _ := NewOptions("table", "", false)
+	opts.Width = 10
+	var buf bytes.Buffer
+	if err := testPrinter.Print(&buf, testRows, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if len(line) > 10 {
+			t.Errorf("line %q is wider than 10", line)
+		}
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	tests := []struct {
+		format, tmpl string
+		want         Format
+		wantErr      string
+	}{
+		{"", "", Table, ""},
+		{"CSV", "", CSV, ""},
+		{"", "{{.Port}}", Template, ""},
+		{"template", "{{.Port}}", Template, ""},
+		{"xml", "", "", "unknown output format: xml"},
+		{"template", "", "", "requires --template"},
+		{"json", "{{.Port}}", "", "--template requires --output template, not json"},
+		{"", "{{.Port", "", "invalid template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+tt.tmpl, func(t *testing.T) {
+			opts, err := NewOptions(tt.format, tt.tmpl, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if opts.Format != tt.want {
+				t.Errorf("format = %s, want %s", opts.Format, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateMissingField(t *testing.T) {
+	opts, err := NewOptions("", "{{.Bogus}}", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := testPrinter.Print(&buf, testRows, opts); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestHuman(t *testing.T) {
+	for _, f := range Formats {
+		if want := f == Table || f == Wide; f.Human() != want {
+			t.Errorf("%s.Human() = %v, want %v", f, f.Human(), want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package output
+
+import (
+	"github.com/mattn/go-runewidth"
+)
+
+// Column is a table column over rows of type T
+type Column[T any] struct {
+	Key    string // csv/tsv header
+	Header string // table header
+	Flex   bool   // may be shrunk to fit the terminal
+	Min    int    // narrowest width a flexible column is shrunk to
+	Value  func(T) string
+}
+
+// Widths computes a width for each column that fits its header and every
+// row. If available is positive and the table would be wider, flexible
+// columns are shrunk, widest first, until it fits or they reach their minimum.
+func Widths[T any](cols []Column[T], rows []T, available int) []int {
+	widths := make([]int, len(cols))
+	for i, c := range cols {
+		widths[i] = runewidth.StringWidth(c.Header)
+		for _, r := range rows {
+			widths[i] = max(widths[i], runewidth.StringWidth(c.Value(r)))
+		}
+	}
+
+	if available <= 0 {
+		return widths
+	}
+
+	for TotalWidth(widths) > available {
+		widest := -1
+		for i, c := range cols {
+			if !c.Flex || widths[i] <= max(c.Min, runewidth.StringWidth(c.Header)) {
+				continue
+			}
+			if widest == -1 || widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widest == -1 {
+			break
+		}
+		widths[widest]--
+	}
+
+	return widths
+}
+
+// TotalWidth returns the rendered width of a row with the given column widths
+func TotalWidth(widths []int) int {
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+	if len(widths) > 1 {
+		total += len(widths) - 1
+	}
+	return total
+}
+
+// Fit truncates s with "..." if it is wider than w, then pads it to w
+func Fit(s string, w int) string {
+	if runewidth.StringWidth(s) > w {
+		s = runewidth.Truncate(s, w, "...")
+	}
+	return runewidth.FillRight(s, w)
+}
@@ -0,0 +1,183 @@
+package ports
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// containerScopes match the cgroup a container runtime puts its
+// containers in, with the systemd driver (a "<prefix>-<id>.scope" unit) or
+// the cgroupfs driver (a "/<parent>/<id>" directory)
+var containerScopes = []struct {
+	runtime string
+	re      *regexp.Regexp
+}{
+	{"docker", regexp.MustCompile(`(?:^|/)docker-([0-9a-f]{64})\.scope$|^/docker/([0-9a-f]{64})$`)},
+	{"podman", regexp.MustCompile(`(?:^|/)libpod-([0-9a-f]{64})\.scope(?:/container)?$|/libpod-([0-9a-f]{64})(?:/container)?$`)},
+	{"containerd", regexp.MustCompile(`(?:^|/)(?:cri-containerd|nerdctl)-([0-9a-f]{64})\.scope$`)},
+	{"cri-o", regexp.MustCompile(`(?:^|/)crio-([0-9a-f]{64})\.scope$`)},
+}
+
+// kubePod matches the pod slice or directory of a Kubernetes container. The
+// systemd driver writes the pod UID with underscores instead of dashes.
+var kubePod = regexp.MustCompile(`/kubepods[^/]*-pod([0-9a-f_]{36})\.slice/|/kubepods/(?:[a-z]+/)?pod([0-9a-f-]{36})/`)
+
+// kubeContainer is the container directory under a cgroupfs pod, whose
+// runtime cannot be told from the path
+var kubeContainer = regexp.MustCompile(`/pod[0-9a-f-]{36}/([0-9a-f]{64})$`)
+
+// lxcContainer matches an LXC container's payload cgroup, named after the
+// container rather than an ID
+var lxcContainer = regexp.MustCompile(`^/lxc(?:\.payload\.|/)([^/]+)`)
+
+// cgroupInfo is what a process's cgroup tells about it
+type cgroupInfo struct {
+	Container *Container
+	Slice     string
+	Unit      *Unit
+}
+
+// readCgroup fills in Container, Slice and Unit for p.PID from
+// /proc/<pid>/cgroup. An unreadable file leaves them unset.
+func readCgroup(p *PortInfo) {
+	info, ok := readCgroupInfo(p.PID)
+	if ok {
+		p.Container, p.Slice, p.Unit = info.Container, info.Slice, info.Unit
+	}
+}
+
+// UnitOf returns the systemd service pid belongs to, or nil if it is in
+// none or /proc/<pid>/cgroup cannot be read
+func UnitOf(pid int) *Unit {
+	info, _ := readCgroupInfo(pid)
+	return info.Unit
+}
+
+// readCgroupInfo reads and parses /proc/<pid>/cgroup
+func readCgroupInfo(pid int) (cgroupInfo, bool) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return cgroupInfo{}, false
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return parseCgroup(lines), true
+}
+
+// parseCgroup identifies the container, the innermost systemd slice and
+// the service from the lines of /proc/<pid>/cgroup
+// ("hierarchy-ID:controllers:path"). Under cgroup v1 each hierarchy has
+// its own line; the systemd one (or the unified v2 one) is preferred, then
+// any line naming a container.
+func parseCgroup(lines []string) cgroupInfo {
+	var paths []string
+	for _, line := range lines {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" || parts[1] == "name=systemd" {
+			paths = append([]string{parts[2]}, paths...)
+		} else {
+			paths = append(paths, parts[2])
+		}
+	}
+	if len(paths) == 0 {
+		return cgroupInfo{}
+	}
+
+	info := cgroupInfo{Slice: sliceFromCgroup(paths[0])}
+	for _, path := range paths {
+		if info.Container = containerFromCgroup(path); info.Container != nil {
+			break
+		}
+	}
+	if info.Container == nil {
+		// A unit inside a container belongs to the container's own manager
+		info.Unit = unitFromCgroup(paths[0])
+	}
+	return info
+}
+
+// containerFromCgroup identifies the container whose cgroup is path, or
+// returns nil for a process that is not in one
+func containerFromCgroup(path string) *Container {
+	var c *Container
+	for _, s := range containerScopes {
+		if m := s.re.FindStringSubmatch(path); m != nil {
+			c = &Container{Runtime: s.runtime, ID: firstMatch(m)}
+			break
+		}
+	}
+
+	if m := kubePod.FindStringSubmatch(path); m != nil {
+		if c == nil {
+			id := kubeContainer.FindStringSubmatch(path)
+			if id == nil {
+				return nil // the pod's own cgroup, not one of its containers
+			}
+			c = &Container{ID: id[1]}
+		}
+		c.Pod = strings.ReplaceAll(firstMatch(m), "_", "-")
+		return c
+	}
+	if c != nil {
+		return c
+	}
+
+	if m := lxcContainer.FindStringSubmatch(path); m != nil {
+		return &Container{Runtime: "lxc", ID: m[1], Name: m[1]}
+	}
+	return nil
+}
+
+// firstMatch returns the first non-empty submatch of m
+func firstMatch(m []string) string {
+	for _, s := range m[1:] {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// unitFromCgroup returns the service whose cgroup contains path, e.g.
+// "/system.slice/nginx.service". Below a user manager
+// ("user@1000.service") it is the user's service, never the manager
+// itself, and processes in scopes (login sessions, terminals) have none.
+func unitFromCgroup(path string) *Unit {
+	elems := strings.Split(path, "/")
+	user := false
+	for i, e := range elems {
+		if strings.HasPrefix(e, "user@") && strings.HasSuffix(e, ".service") {
+			elems, user = elems[i+1:], true
+			break
+		}
+	}
+	for i := len(elems) - 1; i >= 0; i-- {
+		if strings.HasSuffix(elems[i], ".service") {
+			return &Unit{Name: elems[i], User: user}
+		}
+	}
+	return nil
+}
+
+// sliceFromCgroup returns the innermost systemd slice in path, e.g.
+// "user-1000.slice", or "" if it has none
+func sliceFromCgroup(path string) string {
+	elems := strings.Split(path, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if strings.HasSuffix(elems[i], ".slice") {
+			return elems[i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package ports
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const (
+	cgroupID  = "4f1c2d3e4a5b6c7d8e9f00112233445566778899aabbccddeeff001122334455"
+	cgroupPod = "0d3c6f2a-7b1e-4c59-9a8d-2e6f5b4a3c21"
+)
+
+func TestParseCgroup(t *testing.T) {
+	podSlice := strings.ReplaceAll(cgroupPod, "-", "_")
+	tests := []struct {
+		name  string
+		lines []string
+		want  *Container
+		slice string
+	}{
+		{"host process",
+			[]string{"0::/user.slice/user-1000.slice/session-2.scope"},
+			nil, "user-1000.slice"},
+		{"systemd service",
+			[]string{"0::/system.slice/nginx.service"},
+			nil, "system.slice"},
+		{"docker with the systemd driver",
+			[]string{"0::/system.slice/docker-" + cgroupID + ".scope"},
+			&Container{Runtime: "docker", ID: cgroupID}, "system.slice"},
+		{"docker with the cgroupfs driver",
+			[]string{"0::/docker/" + cgroupID},
+			&Container{Runtime: "docker", ID: cgroupID}, ""},
+		{"rootless podman",
+			[]string{"0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + cgroupID + ".scope/container"},
+			&Container{Runtime: "podman", ID: cgroupID}, "user.slice"},
+		{"podman with cgroupfs",
+			[]string{"0::/libpod_parent/libpod-" + cgroupID},
+			&Container{Runtime: "podman", ID: cgroupID}, ""},
+		{"nerdctl",
+			[]string{"0::/system.slice/nerdctl-" + cgroupID + ".scope"},
+			&Container{Runtime: "containerd", ID: cgroupID}, "system.slice"},
+		{"kubernetes pod on containerd",
+			[]string{"0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + podSlice + ".slice/cri-containerd-" + cgroupID + ".scope"},
+			&Container{Runtime: "containerd", ID: cgroupID, Pod: cgroupPod}, "kubepods-burstable-pod" + podSlice + ".slice"},
+		{"kubernetes pod on cri-o",
+			[]string{"0::/kubepods.slice/kubepods-pod" + podSlice + ".slice/crio-" + cgroupID + ".scope"},
+			&Container{Runtime: "cri-o", ID: cgroupID, Pod: cgroupPod}, "kubepods-pod" + podSlice + ".slice"},
+		{"kubernetes pod with cgroupfs",
+			[]string{"0::/kubepods/besteffort/pod" + cgroupPod + "/" + cgroupID},
+			&Container{ID: cgroupID, Pod: cgroupPod}, ""},
+		{"kubernetes pod cgroup itself",
+			[]string{"0::/kubepods/besteffort/pod" + cgroupPod + "/"},
+			nil, ""},
+		{"lxc",
+			[]string{"0::/lxc.payload.web/system.slice/nginx.service"},
+			&Container{Runtime: "lxc", ID: "web", Name: "web"}, "system.slice"},
+		{"cgroup v1 prefers the systemd hierarchy",
+			[]string{
+				"12:memory:/docker/" + cgroupID,
+				"1:name=systemd:/system.slice/docker-" + cgroupID + ".scope",
+			},
+			&Container{Runtime: "docker", ID: cgroupID}, "system.slice"},
+		{"cgroup v1 container on another hierarchy",
+			[]string{
+				"4:cpu,cpuacct:/docker/" + cgroupID,
+				"1:name=systemd:/",
+			},
+			&Container{Runtime: "docker", ID: cgroupID}, ""},
+		{"malformed", []string{"garbage"}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseCgroup(tt.lines)
+			got, slice := info.Container, info.Slice
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("container = %+v, want %+v", got, tt.want)
+			}
+			if slice != tt.slice {
+				t.Errorf("slice = %q, want %q", slice, tt.slice)
+			}
+		})
+	}
+}
+
+func TestUnitFromCgroup(t *testing.T) {
+	tests := []struct {
+		path string
+		want *Unit
+	}{
+		{"/system.slice/nginx.service", &Unit{Name: "nginx.service"}},
+		{"/system.slice/system-getty.slice/getty@tty1.service", &Unit{Name: "getty@tty1.service"}},
+		{"/system.slice/docker.service", &Unit{Name: "docker.service"}},
+		{"/user.slice/user-1000.slice/user@1000.service/app.slice/api.service", &Unit{Name: "api.service", User: true}},
+		{"/user.slice/user-1000.slice/user@1000.service/init.scope", nil},
+		{"/user.slice/user-1000.slice/user@1000.service/app.slice/app-kitty-1234.scope", nil},
+		{"/user.slice/user-1000.slice/session-2.scope", nil},
+		{"/init.scope", nil},
+		{"/", nil},
+	}
+	for _, tt := range tests {
+		got := unitFromCgroup(tt.path)
+		if (got == nil) != (tt.want == nil) || (got != nil && (got.Name != tt.want.Name || got.User != tt.want.User)) {
+			t.Errorf("unitFromCgroup(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+
+	// Services inside a container are not the host's to stop
+	info := parseCgroup([]string{"0::/lxc.payload.web/system.slice/nginx.service"})
+	if info.Unit != nil {
+		t.Errorf("unit inside a container = %+v, want nil", info.Unit)
+	}
+	info = parseCgroup([]string{"0::/system.slice/nginx.service"})
+	if info.Unit == nil || info.Unit.Name != "nginx.service" {
+		t.Errorf("parseCgroup unit = %+v, want nginx.service", info.Unit)
+	}
+}
+
+func TestReadCgroupSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc")
+	}
+	p := PortInfo{PID: os.Getpid()}
+	readCgroup(&p) // must not panic whatever the sandbox's cgroup layout
+
+	missing := PortInfo{PID: 1 << 30}
+	readCgroup(&missing)
+	if missing.Container != nil || missing.Slice != "" || missing.Unit != nil {
+		t.Errorf("missing process got %+v, %q, %+v", missing.Container, missing.Slice, missing.Unit)
+	}
+	if u := UnitOf(1 << 30); u != nil {
+		t.Errorf("UnitOf(missing) = %+v, want nil", u)
+	}
+}
@@ -0,0 +1,198 @@
+package ports
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Client is a local process with an established connection to a port,
+// whether the server listening on it is local or remote
+type Client struct {
+	PID     int
+	Process string
+	User    string
+	Cmdline string
+	Local   string // the client's end, e.g. 127.0.0.1:51234
+	Remote  string // the server's end, e.g. 10.0.0.5:5432
+	Port    int    // the server's port
+	Netns   string // network namespace, "" for tsunami's own
+}
+
+// FindClients lists the local processes with established TCP connections
+// to any of portList, by port then PID
+func FindClients(ctx context.Context, portList []int) ([]Client, error) {
+	var clients []Client
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		clients, err = findDarwinClients(ctx, portList)
+	case "linux":
+		clients, err = findLinuxClients(ctx, "/proc/net", portList)
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortClients(clients)
+	return clients, nil
+}
+
+// FindClientsNetns is FindClients for the namespaces in nsList. Clients
+// outside tsunami's own namespace are tagged with it.
+func FindClientsNetns(ctx context.Context, nsList []Netns, portList []int) ([]Client, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errNetnsPlatform
+	}
+	var result []Client
+	for _, ns := range nsList {
+		clients, err := findLinuxClients(ctx, fmt.Sprintf("/proc/%d/net", ns.PID), portList)
+		if err != nil {
+			return nil, err
+		}
+		if !ns.Self {
+			for i := range clients {
+				clients[i].Netns = ns.String()
+			}
+		}
+		result = append(result, clients...)
+	}
+	sortClients(result)
+	return result, nil
+}
+
+// findLinuxClients finds the clients of portList in the tcp and tcp6
+// tables in dir, resolving each socket inode to its process
+func findLinuxClients(ctx context.Context, dir string, portList []int) ([]Client, error) {
+	conns, err := readTCPConnections(dir)
+	if err != nil {
+		return nil, err
+	}
+	wanted := intSet(portList)
+
+	var matched []tcpConn
+	inodes := make(map[string]bool)
+	for _, c := range conns {
+		if c.state != "ESTABLISHED" || !wanted[c.remotePort] {
+			continue
+		}
+		matched = append(matched, c)
+		inodes[c.inode] = true
+	}
+	owners := findProcessesByInode(ctx, inodes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var clients []Client
+	for _, c := range matched {
+		pid, ok := owners[c.inode]
+		if !ok {
+			continue // held by a process tsunami cannot see
+		}
+		clients = append(clients, Client{
+			PID:     pid,
+			Process: readComm(pid),
+			User:    processUser(pid),
+			Cmdline: readCmdline(pid),
+			Local:   c.local,
+			Remote:  c.remote,
+			Port:    c.remotePort,
+		})
+	}
+	return clients, nil
+}
+
+// findDarwinClients finds the clients of portList with lsof
+func findDarwinClients(ctx context.Context, portList []int) ([]Client, error) {
+	if _, err := exec.LookPath("lsof"); err != nil {
+		return nil, fmt.Errorf("lsof not found. Install with: brew install lsof")
+	}
+	cmd := exec.CommandContext(ctx, "lsof", "-iTCP", "-sTCP:ESTABLISHED", "-n", "-P")
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		// lsof exits with 1 if no results, which is fine
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("lsof failed: %w", err)
+	}
+
+	clients := lsofClients(parseLsofConnections(string(output)), portList)
+
+	// Fill in command lines the way listings do
+	details := make([]PortInfo, len(clients))
+	for i, c := range clients {
+		details[i].PID = c.PID
+	}
+	readPsDetails(ctx, details)
+	for i := range clients {
+		clients[i].Cmdline = details[i].Cmdline
+	}
+	return clients, nil
+}
+
+// lsofClients picks the connections in conns made to one of portList
+func lsofClients(conns []lsofConn, portList []int) []Client {
+	wanted := intSet(portList)
+	var clients []Client
+	for _, c := range conns {
+		port := parsePortFromLsofName(c.remote)
+		if c.state != "ESTABLISHED" || !wanted[port] {
+			continue
+		}
+		clients = append(clients, Client{
+			PID:     c.pid,
+			Process: c.process,
+			User:    c.user,
+			Local:   c.local,
+			Remote:  c.remote,
+			Port:    port,
+		})
+	}
+	return clients
+}
+
+// sortClients orders clients by port, then PID, then local address
+func sortClients(clients []Client) {
+	sort.SliceStable(clients, func(i, j int) bool {
+		a, b := clients[i], clients[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.PID != b.PID {
+			return a.PID < b.PID
+		}
+		return a.Local < b.Local
+	})
+}
+
+// intSet returns the set of the values in list
+func intSet(list []int) map[int]bool {
+	set := make(map[int]bool, len(list))
+	for _, n := range list {
+		set[n] = true
+	}
+	return set
+}
+
+// readCmdline returns the command line of pid with its arguments joined
+// by spaces, or "" if unreadable
+func readCmdline(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package ports
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestFindClients(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scan in short mode")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	clients, err := FindClients(context.Background(), []int{port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The accepted end is the server's, not a client
+	if len(clients) != 1 {
+		t.Fatalf("FindClients = %+v, want one client", clients)
+	}
+	c := clients[0]
+	if c.PID != os.Getpid() || c.Local != client.LocalAddr().String() || c.Remote != ln.Addr().String() || c.Port != port || c.Cmdline == "" {
+		t.Errorf("client = %+v, want %s from PID %d", c, client.LocalAddr(), os.Getpid())
+	}
+
+	none, err := FindClients(context.Background(), []int{1})
+	if err != nil || len(none) != 0 {
+		t.Errorf("FindClients(1) = %+v, %v; want none", none, err)
+	}
+}
+
+func TestFindClientsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FindClients(ctx, []int{80}); err != context.Canceled {
+		t.Errorf("FindClients with a cancelled context = %v, want context.Canceled", err)
+	}
+}
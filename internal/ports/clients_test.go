@@ -0,0 +1,39 @@
+package ports
+
+import "testing"
+
+func TestLsofClients(t *testing.T) {
+	output := `COMMAND   PID USER   FD   TYPE DEVICE SIZE/OFF NODE NAME
+postgres  812 pg     9u  IPv4 0x1234      0t0  TCP 127.0.0.1:5432->127.0.0.1:51000 (ESTABLISHED)
+psql     4242 mike   3u  IPv4 0x1235      0t0  TCP 127.0.0.1:51000->127.0.0.1:5432 (ESTABLISHED)
+pytest   4300 mike   7u  IPv6 0x1236      0t0  TCP [::1]:52000->[fd00::5]:5432 (ESTABLISHED)
+redis-cli 4400 mike  3u  IPv4 0x1237      0t0  TCP 127.0.0.1:53000->127.0.0.1:6379 (ESTABLISHED)
+`
+	clients := lsofClients(parseLsofConnections(output), []int{5432})
+	if len(clients) != 2 {
+		t.Fatalf("lsofClients = %+v, want psql and pytest", clients)
+	}
+	want := Client{PID: 4242, Process: "psql", User: "mike", Local: "127.0.0.1:51000", Remote: "127.0.0.1:5432", Port: 5432}
+	if clients[0] != want {
+		t.Errorf("clients[0] = %+v, want %+v", clients[0], want)
+	}
+	if clients[1].PID != 4300 || clients[1].Remote != "[fd00::5]:5432" {
+		t.Errorf("clients[1] = %+v", clients[1])
+	}
+}
+
+func TestSortClients(t *testing.T) {
+	clients := []Client{
+		{PID: 20, Port: 6379, Local: "127.0.0.1:1"},
+		{PID: 30, Port: 5432, Local: "127.0.0.1:9"},
+		{PID: 10, Port: 5432, Local: "127.0.0.1:8"},
+		{PID: 10, Port: 5432, Local: "127.0.0.1:7"},
+	}
+	sortClients(clients)
+	want := []string{"127.0.0.1:7", "127.0.0.1:8", "127.0.0.1:9", "127.0.0.1:1"}
+	for i, c := range clients {
+		if c.Local != want[i] {
+			t.Errorf("clients[%d] = %+v, want local %s", i, c, want[i])
+		}
+	}
+}
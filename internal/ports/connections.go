@@ -0,0 +1,271 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// TCP states in /proc/net/tcp of the connections attributed to listeners.
+// TIME_WAIT sockets are already closed and belong to no process.
+var tcpConnStates = map[string]string{
+	"01": "ESTABLISHED",
+	"08": "CLOSE_WAIT",
+}
+
+// Connection is an open connection to a listener: one it accepted over
+// TCP, or a client of a Unix socket
+type Connection struct {
+	Remote  string // peer address, e.g. 127.0.0.1:51234; "" for a Unix socket
+	State   string // ESTABLISHED or CLOSE_WAIT, or CONNECTED for a Unix socket
+	PID     int    // the peer process if it runs on this host and can be seen
+	Process string
+}
+
+// String describes c as "127.0.0.1:51234 psql (PID 4242)", adding the
+// state unless it is ESTABLISHED
+func (c Connection) String() string {
+	s := c.Remote
+	if s == "" {
+		s = "local client"
+	}
+	if c.PID > 0 {
+		s += fmt.Sprintf(" %s (PID %d)", c.Process, c.PID)
+	}
+	if c.State != "ESTABLISHED" && c.State != "CONNECTED" {
+		s += " " + c.State
+	}
+	return s
+}
+
+// tcpConn is an open socket from a tcp table, either end of a connection
+type tcpConn struct {
+	proto      string
+	local      string // address and port, as net.JoinHostPort
+	remote     string
+	localPort  int
+	remotePort int
+	state      string
+	inode      string
+}
+
+// readTCPConnections reads the open connections in the tcp and tcp6 tables
+// in dir
+func readTCPConnections(dir string) ([]tcpConn, error) {
+	var result []tcpConn
+	for _, proto := range []string{"tcp", "tcp6"} {
+		conns, err := parseProcNetTCPConns(dir+"/"+proto, proto)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		result = append(result, conns...)
+	}
+	return result, nil
+}
+
+// parseProcNetTCPConns parses the established and close-wait sockets in
+// /proc/net/tcp or /proc/net/tcp6
+func parseProcNetTCPConns(path, proto string) ([]tcpConn, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var conns []tcpConn
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		state, ok := tcpConnStates[fields[3]]
+		if !ok {
+			continue
+		}
+		localPort := parseHexPort(fields[1])
+		remotePort := parseHexPort(fields[2])
+		if localPort == 0 || remotePort == 0 {
+			continue
+		}
+		conns = append(conns, tcpConn{
+			proto:      proto,
+			local:      net.JoinHostPort(parseHexAddr(fields[1]), strconv.Itoa(localPort)),
+			remote:     net.JoinHostPort(parseHexAddr(fields[2]), strconv.Itoa(remotePort)),
+			localPort:  localPort,
+			remotePort: remotePort,
+			state:      state,
+			inode:      fields[9],
+		})
+	}
+	return conns, scanner.Err()
+}
+
+// attachConnections gives each TCP listener in list the connections in
+// conns made to its port, naming the client process when the other end of
+// the connection is in conns too
+func attachConnections(ctx context.Context, list []PortInfo, conns []tcpConn) {
+	byPort := make(map[int][]int)
+	for i, p := range list {
+		if !p.Unix() {
+			byPort[p.Port] = append(byPort[p.Port], i)
+		}
+	}
+	if len(byPort) == 0 {
+		return
+	}
+
+	ends := make(map[string]string, len(conns)) // "local remote" to inode
+	for _, c := range conns {
+		ends[c.local+" "+c.remote] = c.inode
+	}
+
+	type accepted struct {
+		listener int
+		conn     tcpConn
+		peer     string // inode of the client's end, if local
+	}
+	var found []accepted
+	peers := make(map[string]bool)
+	for _, c := range conns {
+		candidates := byPort[c.localPort]
+		if len(candidates) == 0 {
+			continue
+		}
+		a := accepted{listener: pickListener(list, candidates, c), conn: c, peer: ends[c.remote+" "+c.local]}
+		if a.peer != "" {
+			peers[a.peer] = true
+		}
+		found = append(found, a)
+	}
+
+	owners := findProcessesByInode(ctx, peers)
+	for _, a := range found {
+		conn := Connection{Remote: a.conn.remote, State: a.conn.state}
+		if pid, ok := owners[a.peer]; ok && a.peer != "" {
+			conn.PID, conn.Process = pid, readComm(pid)
+		}
+		list[a.listener].Connections = append(list[a.listener].Connections, conn)
+	}
+}
+
+// pickListener returns the listener among candidates, all on c's port,
+// that accepted c: one of the same protocol bound to c's address or to
+// every address, else the first
+func pickListener(list []PortInfo, candidates []int, c tcpConn) int {
+	host, _, _ := net.SplitHostPort(c.local)
+	for _, i := range candidates {
+		p := list[i]
+		if p.Proto == c.proto && (p.Address == host || isWildcard(p.Address)) {
+			return i
+		}
+	}
+	return candidates[0]
+}
+
+// isWildcard reports whether addr is the address of every interface
+func isWildcard(addr string) bool {
+	return addr == "" || addr == "*" || addr == "0.0.0.0" || addr == "::"
+}
+
+// AcceptsOn reports whether the listener p accepts connections to ip: it
+// is bound to ip, compared with IPv4-mapped addresses unwrapped, or to
+// every address. 0.0.0.0 only covers IPv4; :: covers both, as it does
+// unless IPV6_V6ONLY is set.
+func (p PortInfo) AcceptsOn(ip net.IP) bool {
+	if isWildcard(p.Address) {
+		return p.Address != "0.0.0.0" || ip.To4() != nil
+	}
+	addr := net.ParseIP(p.Address)
+	return addr != nil && addr.Equal(ip)
+}
+
+// lsofConn is one end of a TCP connection in lsof output
+type lsofConn struct {
+	pid       int
+	process   string
+	user      string
+	local     string
+	remote    string
+	localPort int
+	state     string
+}
+
+// scanDarwinConnections attaches the open connections lsof lists to the
+// listeners in list
+func scanDarwinConnections(ctx context.Context, list []PortInfo) {
+	cmd := exec.CommandContext(ctx, "lsof", "-iTCP", "-sTCP:ESTABLISHED,CLOSE_WAIT", "-n", "-P")
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return // no connections, or none can be listed
+	}
+	attachLsofConnections(list, parseLsofConnections(string(output)))
+}
+
+// parseLsofConnections parses lsof -iTCP -sTCP:ESTABLISHED,CLOSE_WAIT output
+// Example line: node 42156 mike 23u IPv4 0x1234 0t0 TCP 127.0.0.1:3000->127.0.0.1:52100 (ESTABLISHED)
+func parseLsofConnections(output string) []lsofConn {
+	var conns []lsofConn
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Scan() // header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		local, remote, ok := strings.Cut(fields[8], "->")
+		if !ok {
+			continue
+		}
+		conns = append(conns, lsofConn{
+			pid:       pid,
+			process:   fields[0],
+			user:      fields[2],
+			local:     local,
+			remote:    remote,
+			localPort: parsePortFromLsofName(local),
+			state:     strings.Trim(fields[9], "()"),
+		})
+	}
+	return conns
+}
+
+// attachLsofConnections gives each listener in list the connections its
+// process accepted on its port, naming the client process when lsof lists
+// the other end too
+func attachLsofConnections(list []PortInfo, conns []lsofConn) {
+	ends := make(map[string]lsofConn, len(conns))
+	for _, c := range conns {
+		ends[c.local+" "+c.remote] = c
+	}
+	seen := make(map[string]bool) // a listener's socket may be listed for IPv4 and IPv6
+	for i, p := range list {
+		if p.Unix() {
+			continue
+		}
+		for _, c := range conns {
+			key := fmt.Sprintf("%d %s %s", c.pid, c.local, c.remote)
+			if c.pid != p.PID || c.localPort != p.Port || seen[key] {
+				continue
+			}
+			seen[key] = true
+			conn := Connection{Remote: c.remote, State: c.state}
+			if peer, ok := ends[c.remote+" "+c.local]; ok {
+				conn.PID, conn.Process = peer.pid, peer.process
+			}
+			list[i].Connections = append(list[i].Connections, conn)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package ports
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProcNetTCPConnsWithMockData(t *testing.T) {
+	content := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 0100007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 100 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 0100007F:1538 0100007F:C738 01 00000000:00000000 00:00000000 00000000  1000        0 101 1 0000000000000000 20 4 30 10 -1\n" +
+		"   2: 0100007F:C738 0100007F:1538 01 00000000:00000000 00:00000000 00000000  1000        0 102 1 0000000000000000 20 4 30 10 -1\n" +
+		"   3: 0100007F:1538 0100007F:C739 08 00000000:00000000 00:00000000 00000000  1000        0 103 1 0000000000000000 20 4 30 10 -1\n" +
+		"   4: 0100007F:1538 0100007F:C73A 06 00000000:00000000 03:00000000 00000000     0        0 0 3 0000000000000000\n" +
+		"short line\n"
+	path := filepath.Join(t.TempDir(), "tcp")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conns, err := parseProcNetTCPConns(path, "tcp")
+	if err != nil {
+		t.Fatalf("parseProcNetTCPConns error: %v", err)
+	}
+	if len(conns) != 3 {
+		t.Fatalf("parseProcNetTCPConns returned %d connections, want 3 (no LISTEN or TIME_WAIT): %+v", len(conns), conns)
+	}
+	want := tcpConn{proto: "tcp", local: "127.0.0.1:5432", remote: "127.0.0.1:51000", localPort: 5432, remotePort: 51000, state: "ESTABLISHED", inode: "101"}
+	if conns[0] != want {
+		t.Errorf("conns[0] = %+v, want %+v", conns[0], want)
+	}
+	if conns[2].state != "CLOSE_WAIT" {
+		t.Errorf("conns[2].state = %q, want CLOSE_WAIT", conns[2].state)
+	}
+}
+
+func TestScanConnections(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scan in short mode")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	list, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range list {
+		if p.Port != port {
+			continue
+		}
+		if len(p.Connections) != 1 {
+			t.Fatalf("port %d has connections %+v, want 1", port, p.Connections)
+		}
+		c := p.Connections[0]
+		if c.Remote != client.LocalAddr().String() || c.PID != os.Getpid() || c.State != "ESTABLISHED" {
+			t.Errorf("connection = %+v, want %s from PID %d", c, client.LocalAddr(), os.Getpid())
+		}
+		return
+	}
+	t.Errorf("port %d not found in scan", port)
+}
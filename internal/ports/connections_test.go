@@ -0,0 +1,113 @@
+package ports
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestConnectionString(t *testing.T) {
+	tests := []struct {
+		conn Connection
+		want string
+	}{
+		{Connection{Remote: "10.0.0.5:51234", State: "ESTABLISHED"}, "10.0.0.5:51234"},
+		{Connection{Remote: "127.0.0.1:51234", State: "ESTABLISHED", PID: 4242, Process: "psql"}, "127.0.0.1:51234 psql (PID 4242)"},
+		{Connection{Remote: "[::1]:40000", State: "CLOSE_WAIT"}, "[::1]:40000 CLOSE_WAIT"},
+		{Connection{State: "CONNECTED"}, "local client"},
+	}
+	for _, tt := range tests {
+		if got := tt.conn.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestAttachConnections(t *testing.T) {
+	list := []PortInfo{
+		{Port: 5432, PID: 100, Proto: "tcp", Address: "127.0.0.1"},
+		{Port: 5432, PID: 100, Proto: "tcp6", Address: "::1"},
+		{Port: 8080, PID: 200, Proto: "tcp", Address: "0.0.0.0"},
+		{PID: 300, Proto: "unix", Address: "/run/app.sock"},
+	}
+	conns := []tcpConn{
+		{proto: "tcp", local: "127.0.0.1:5432", remote: "127.0.0.1:51000", localPort: 5432, state: "ESTABLISHED", inode: "1"},
+		{proto: "tcp", local: "127.0.0.1:51000", remote: "127.0.0.1:5432", localPort: 51000, state: "ESTABLISHED", inode: "2"},
+		{proto: "tcp6", local: "[::1]:5432", remote: "[::1]:52000", localPort: 5432, state: "CLOSE_WAIT", inode: "3"},
+		{proto: "tcp", local: "192.168.1.2:8080", remote: "192.168.1.9:60000", localPort: 8080, state: "ESTABLISHED", inode: "4"},
+		{proto: "tcp", local: "192.168.1.2:44000", remote: "93.184.216.34:443", localPort: 44000, state: "ESTABLISHED", inode: "5"},
+	}
+	attachConnections(context.Background(), list, conns)
+
+	want := []int{1, 1, 1, 0}
+	for i, p := range list {
+		if len(p.Connections) != want[i] {
+			t.Errorf("%s/%s has %d connections, want %d: %+v", p.Proto, p.Where(), len(p.Connections), want[i], p.Connections)
+		}
+	}
+	if got := list[0].Connections[0]; got.Remote != "127.0.0.1:51000" || got.State != "ESTABLISHED" {
+		t.Errorf("tcp connection = %+v", got)
+	}
+	if got := list[1].Connections[0]; got.Remote != "[::1]:52000" || got.State != "CLOSE_WAIT" {
+		t.Errorf("tcp6 connection = %+v", got)
+	}
+	if got := list[2].Connections[0]; got.Remote != "192.168.1.9:60000" || got.PID != 0 {
+		t.Errorf("remote connection = %+v", got)
+	}
+}
+
+func TestAcceptsOn(t *testing.T) {
+	tests := []struct {
+		address, ip string
+		want        bool
+	}{
+		{"127.0.0.1", "127.0.0.1", true},
+		{"127.0.0.1", "::ffff:127.0.0.1", true},
+		{"127.0.0.1", "10.0.0.5", false},
+		{"::1", "::1", true},
+		{"::1", "127.0.0.1", false},
+		{"0.0.0.0", "10.0.0.5", true},
+		{"0.0.0.0", "::1", false},
+		{"::", "127.0.0.1", true},
+		{"::", "::1", true},
+		{"*", "::1", true},
+	}
+	for _, tt := range tests {
+		p := PortInfo{Port: 3000, Proto: "tcp", Address: tt.address}
+		if got := p.AcceptsOn(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("listener on %s AcceptsOn(%s) = %v, want %v", tt.address, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestParseLsofConnections(t *testing.T) {
+	output := `COMMAND   PID USER   FD   TYPE DEVICE SIZE/OFF NODE NAME
+postgres  812 mike   9u  IPv4 0x1234      0t0  TCP 127.0.0.1:5432->127.0.0.1:51000 (ESTABLISHED)
+psql     4242 mike   3u  IPv4 0x1235      0t0  TCP 127.0.0.1:51000->127.0.0.1:5432 (ESTABLISHED)
+node      900 mike  20u  IPv6 0x1236      0t0  TCP [::1]:3000->[::1]:60000 (CLOSE_WAIT)
+broken line
+`
+	conns := parseLsofConnections(output)
+	if len(conns) != 3 {
+		t.Fatalf("parseLsofConnections returned %d connections, want 3: %+v", len(conns), conns)
+	}
+	if c := conns[2]; c.pid != 900 || c.localPort != 3000 || c.remote != "[::1]:60000" || c.state != "CLOSE_WAIT" {
+		t.Errorf("conns[2] = %+v", c)
+	}
+
+	list := []PortInfo{
+		{Port: 5432, PID: 812, Proto: "tcp"},
+		{Port: 5432, PID: 812, Proto: "tcp6"},
+		{Port: 3000, PID: 900, Proto: "tcp6"},
+	}
+	attachLsofConnections(list, conns)
+	if len(list[0].Connections) != 1 || len(list[1].Connections) != 0 {
+		t.Fatalf("postgres connections = %+v and %+v, want one in total", list[0].Connections, list[1].Connections)
+	}
+	if got := list[0].Connections[0]; got.PID != 4242 || got.Process != "psql" || got.Remote != "127.0.0.1:51000" {
+		t.Errorf("postgres connection = %+v", got)
+	}
+	if got := list[2].Connections; len(got) != 1 || got[0].PID != 0 || got[0].State != "CLOSE_WAIT" {
+		t.Errorf("node connections = %+v", got)
+	}
+}
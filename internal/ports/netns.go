@@ -0,0 +1,170 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// netnsDir is where `ip netns add` binds named namespaces
+const netnsDir = "/run/netns"
+
+// errNetnsPlatform is returned for network namespaces outside Linux
+var errNetnsPlatform = errors.New("network namespaces are only supported on Linux")
+
+// Netns is a network namespace with a process in it, whose view of
+// /proc/<pid>/net shows the namespace's sockets
+type Netns struct {
+	ID   string // the namespace link, e.g. net:[4026532301]
+	Name string // its `ip netns` name, if it has one
+	PID  int    // a process in the namespace
+	Self bool   // tsunami's own namespace
+}
+
+// String names the namespace by its `ip netns` name, else its ID
+func (n Netns) String() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.ID
+}
+
+// Namespaces lists the network namespaces of the processes tsunami can
+// see, tsunami's own first. Namespaces without processes have no
+// listeners and are left out.
+func Namespaces() ([]Netns, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errNetnsPlatform
+	}
+	self, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return nil, fmt.Errorf("reading own network namespace: %w", err)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var result []Netns
+	index := make(map[string]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		id, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", pid))
+		if err != nil {
+			continue // exited, or another user's process
+		}
+		if _, ok := index[id]; ok {
+			continue
+		}
+		index[id] = len(result)
+		result = append(result, Netns{ID: id, PID: pid, Self: id == self})
+	}
+
+	names := namedNetns()
+	for i := range result {
+		result[i].Name = nameOf(result[i], names)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Self && !result[j].Self })
+	return result, nil
+}
+
+// LookupNetns finds the namespace spec names: an `ip netns` name, the path
+// of a namespace file such as /proc/<pid>/ns/net, or the PID of a process
+// in it
+func LookupNetns(spec string) (Netns, error) {
+	if runtime.GOOS != "linux" {
+		return Netns{}, errNetnsPlatform
+	}
+	path := spec
+	if pid, err := strconv.Atoi(spec); err == nil {
+		path = fmt.Sprintf("/proc/%d/ns/net", pid)
+	} else if !strings.Contains(spec, "/") {
+		path = filepath.Join(netnsDir, spec)
+	}
+	want, err := os.Stat(path)
+	if err != nil {
+		return Netns{}, fmt.Errorf("no network namespace %q", spec)
+	}
+
+	all, err := Namespaces()
+	if err != nil {
+		return Netns{}, err
+	}
+	for _, ns := range all {
+		if fi, err := os.Stat(fmt.Sprintf("/proc/%d/ns/net", ns.PID)); err == nil && os.SameFile(fi, want) {
+			return ns, nil
+		}
+	}
+	return Netns{}, fmt.Errorf("network namespace %q has no processes tsunami can see", spec)
+}
+
+// namedNetns stats the namespaces bound under /run/netns, by name
+func namedNetns() map[string]os.FileInfo {
+	entries, err := os.ReadDir(netnsDir)
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]os.FileInfo)
+	for _, entry := range entries {
+		if fi, err := os.Stat(filepath.Join(netnsDir, entry.Name())); err == nil {
+			names[entry.Name()] = fi
+		}
+	}
+	return names
+}
+
+// nameOf returns the name ns is bound to in names, or ""
+func nameOf(ns Netns, names map[string]os.FileInfo) string {
+	if len(names) == 0 {
+		return ""
+	}
+	fi, err := os.Stat(fmt.Sprintf("/proc/%d/ns/net", ns.PID))
+	if err != nil {
+		return ""
+	}
+	var matches []string
+	for name, named := range names {
+		if os.SameFile(fi, named) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
+
+// ScanNetns lists the listeners in each namespace of nsList from the
+// socket tables of a process in it, sorted by port. Listeners outside
+// tsunami's own namespace are tagged with it. PIDs are global, so they
+// can be killed like any other.
+func ScanNetns(ctx context.Context, nsList []Netns) ([]PortInfo, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errNetnsPlatform
+	}
+	var result []PortInfo
+	for _, ns := range nsList {
+		list, err := scanLinuxNet(ctx, fmt.Sprintf("/proc/%d/net", ns.PID))
+		if err != nil {
+			return nil, err
+		}
+		if !ns.Self {
+			for i := range list {
+				list[i].Netns = ns.String()
+			}
+		}
+		result = append(result, list...)
+	}
+	Sort(result, SortByPort, false)
+	return result, nil
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package ports
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNamespacesSelf(t *testing.T) {
+	all, err := Namespaces()
+	if err != nil {
+		t.Fatalf("Namespaces error: %v", err)
+	}
+	if len(all) == 0 || !all[0].Self || !strings.HasPrefix(all[0].ID, "net:[") {
+		t.Fatalf("Namespaces = %+v, want tsunami's own first", all)
+	}
+	for _, ns := range all[1:] {
+		if ns.Self || ns.ID == all[0].ID {
+			t.Errorf("namespace %+v listed twice", ns)
+		}
+	}
+
+	ns, err := LookupNetns(strconv.Itoa(os.Getpid()))
+	if err != nil || !ns.Self {
+		t.Errorf("LookupNetns(own PID) = %+v, %v", ns, err)
+	}
+	ns, err = LookupNetns("/proc/self/ns/net")
+	if err != nil || !ns.Self {
+		t.Errorf("LookupNetns(path) = %+v, %v", ns, err)
+	}
+	if _, err := LookupNetns("tsunami-no-such-netns"); err == nil || !strings.Contains(err.Error(), "no network namespace") {
+		t.Errorf("LookupNetns(missing) error = %v", err)
+	}
+}
+
+func TestScanNetnsSelf(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	self, err := LookupNetns(strconv.Itoa(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ScanNetns(context.Background(), []Netns{self})
+	if err != nil {
+		t.Fatalf("ScanNetns error: %v", err)
+	}
+	found := false
+	for _, p := range list {
+		if p.Port == port && p.PID == os.Getpid() {
+			found = true
+			if p.Netns != "" {
+				t.Errorf("own namespace tagged %q", p.Netns)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("ScanNetns missed port %d", port)
+	}
+}
+
+func TestScanNetnsOther(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("needs python3")
+	}
+	// Needs CAP_SYS_ADMIN; skipped where unshare is not allowed
+	script := "import socket, sys, time\n" +
+		"s = socket.socket()\ns.bind(('0.0.0.0', 0))\ns.listen()\n" +
+		"print(s.getsockname()[1], flush=True)\ntime.sleep(60)\n"
+	cmd := exec.Command("unshare", "--net", "python3", "-c", script)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("unshare: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Skip("cannot create a network namespace here")
+	}
+	port, _ := strconv.Atoi(strings.TrimSpace(line))
+
+	ns, err := LookupNetns(strconv.Itoa(cmd.Process.Pid))
+	if err != nil {
+		t.Fatalf("LookupNetns error: %v", err)
+	}
+	if ns.Self {
+		t.Fatal("unshare --net did not create a namespace")
+	}
+
+	// The root scan cannot see the listener; the namespace scan can
+	own, err := ScanContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range own {
+		if p.PID == cmd.Process.Pid {
+			t.Errorf("own namespace scan found %+v", p)
+		}
+	}
+
+	all, err := Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ScanNetns(context.Background(), all)
+	if err != nil {
+		t.Fatalf("ScanNetns error: %v", err)
+	}
+	for _, p := range list {
+		if p.PID == cmd.Process.Pid && p.Port == port {
+			if p.Netns != ns.ID || p.Process != "python3" {
+				t.Errorf("listener = %+v, want it tagged %s", p, ns.ID)
+			}
+			return
+		}
+	}
+	t.Errorf("ScanNetns missed port %d in %s", port, ns)
+}
+
+func TestNetnsString(t *testing.T) {
+	if got := (Netns{ID: "net:[4026532301]"}).String(); got != "net:[4026532301]" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (Netns{ID: "net:[4026532301]", Name: "blue"}).String(); got != "blue" {
+		t.Errorf("String = %q", got)
+	}
+}
@@ -0,0 +1,358 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of /proc/<pid>/stat times. It is 100 on
+// every mainstream Linux architecture.
+const clockTicks = 100
+
+// Uptime returns how long the process has been running, or 0 if unknown
+func (p PortInfo) Uptime() time.Duration {
+	if p.StartTime.IsZero() {
+		return 0
+	}
+	return time.Since(p.StartTime)
+}
+
+// Label combines App and Project, e.g. "vite · acme-web". Without an app
+// the process name stands in; without either it is "".
+func (p PortInfo) Label() string {
+	switch {
+	case p.App != "" && p.Project != "":
+		return p.App + " · " + p.Project
+	case p.Project != "":
+		return p.Process + " · " + p.Project
+	}
+	return p.App
+}
+
+// readProcDetails fills in Cmdline, Exe, Cwd, Slice, Container and the
+// resources readProcResources reads for p.PID from /proc. Missing or
+// unreadable entries are left at their zero values.
+func readProcDetails(p *PortInfo) {
+	p.Cmdline = readCmdline(p.PID)
+
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", p.PID)); err == nil {
+		p.Exe = strings.TrimSuffix(exe, " (deleted)")
+	}
+	if cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", p.PID)); err == nil {
+		p.Cwd = cwd
+	}
+
+	readProcResources(p)
+	readCgroup(p)
+}
+
+// readProcResources fills in StartTime, State, CPUTime, Threads, Memory
+// and FDs for p.PID from /proc, and CPU as the average since it started
+func readProcResources(p *PortInfo) {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", p.PID)); err == nil {
+		if st, ok := parseStat(string(data)); ok {
+			if boot, err := bootTime(); err == nil {
+				p.StartTime = boot.Add(time.Duration(st.startTicks) * time.Second / clockTicks)
+			}
+			p.State = st.state
+			p.CPUTime = time.Duration(st.cpuTicks) * time.Second / clockTicks
+			p.Threads = st.threads
+		}
+	}
+
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", p.PID)); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) >= 2 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				p.Memory = pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+
+	// Another user's descriptors can only be counted by root
+	if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", p.PID)); err == nil {
+		p.FDs = len(fds)
+	}
+
+	p.CPU = averageCPU(p.CPUTime, p.StartTime, time.Now())
+}
+
+// procStat holds the fields of /proc/<pid>/stat that tsunami uses
+type procStat struct {
+	state      string // field 3
+	cpuTicks   uint64 // utime + stime, fields 14 and 15
+	threads    int    // field 20
+	startTicks uint64 // field 22, clock ticks since boot
+}
+
+// parseStat parses the contents of /proc/<pid>/stat
+func parseStat(stat string) (procStat, bool) {
+	// comm (field 2) may contain spaces and parens, so skip past the last ')'
+	idx := strings.LastIndex(stat, ")")
+	if idx == -1 {
+		return procStat{}, false
+	}
+	// fields[0] is state (field 3), so field n is fields[n-3]
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 20 {
+		return procStat{}, false
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	threads, err3 := strconv.Atoi(fields[17])
+	start, err4 := strconv.ParseUint(fields[19], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return procStat{}, false
+	}
+	return procStat{state: fields[0], cpuTicks: utime + stime, threads: threads, startTicks: start}, true
+}
+
+// parseStatStartTime extracts field 22 (starttime, in clock ticks since
+// boot) from the contents of /proc/<pid>/stat
+func parseStatStartTime(stat string) (uint64, bool) {
+	st, ok := parseStat(stat)
+	return st.startTicks, ok
+}
+
+// bootTime reads the system boot time from the btime line of /proc/stat
+func bootTime() (time.Time, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			secs, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
+}
+
+// parseHexAddr decodes the address half of a /proc/net/tcp{,6} address.
+// The kernel prints the in-memory address as 32-bit words in host byte
+// order, which is little-endian on every platform tsunami supports.
+func parseHexAddr(addr string) string {
+	idx := strings.Index(addr, ":")
+	if idx == -1 {
+		return ""
+	}
+	hexIP := addr[:idx]
+	if len(hexIP) != 8 && len(hexIP) != 32 {
+		return ""
+	}
+
+	ip := make(net.IP, len(hexIP)/2)
+	for word := 0; word < len(hexIP)/8; word++ {
+		v, err := strconv.ParseUint(hexIP[word*8:word*8+8], 16, 32)
+		if err != nil {
+			return ""
+		}
+		ip[word*4] = byte(v)
+		ip[word*4+1] = byte(v >> 8)
+		ip[word*4+2] = byte(v >> 16)
+		ip[word*4+3] = byte(v >> 24)
+	}
+	return ip.String()
+}
+
+// parseAddrFromLsofName extracts the address from an lsof NAME field
+// Handles: *:3000, 127.0.0.1:3000, [::1]:3000
+func parseAddrFromLsofName(name string) string {
+	idx := strings.LastIndex(name, ":")
+	if idx == -1 {
+		return ""
+	}
+	return strings.Trim(name[:idx], "[]")
+}
+
+// readPsDetails fills in Cmdline, Cwd, StartTime and Memory using ps and
+// lsof, for platforms without /proc
+func readPsDetails(ctx context.Context, portList []PortInfo) {
+	if len(portList) == 0 {
+		return
+	}
+
+	var pidList []string
+	for _, p := range portList {
+		pidList = append(pidList, strconv.Itoa(p.PID))
+	}
+
+	details := runPs(ctx, pidList)
+	if details == nil {
+		return
+	}
+	cwds := readLsofCwds(ctx, pidList)
+	for i := range portList {
+		if d, ok := details[portList[i].PID]; ok {
+			portList[i].Cmdline = d.Cmdline
+			setPsResources(&portList[i], d)
+		}
+		portList[i].Cwd = cwds[portList[i].PID]
+	}
+}
+
+// runPs reads the details of pidList with ps, or returns nil if it fails
+func runPs(ctx context.Context, pidList []string) map[int]PortInfo {
+	cmd := exec.CommandContext(ctx, "ps", "-o", "pid=,etime=,rss=,time=,state=,command=", "-p", strings.Join(pidList, ","))
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return nil
+	}
+	return parsePsOutput(string(output), time.Now())
+}
+
+// setPsResources copies the resources ps reports from d to p. ps on macOS
+// cannot count threads or open files.
+func setPsResources(p *PortInfo, d PortInfo) {
+	p.StartTime = d.StartTime
+	p.Memory = d.Memory
+	p.CPUTime = d.CPUTime
+	p.State = d.State
+	p.CPU = averageCPU(d.CPUTime, d.StartTime, time.Now())
+}
+
+// readLsofCwds looks up the working directory of each PID with lsof
+func readLsofCwds(ctx context.Context, pidList []string) map[int]string {
+	// -a: AND the selections, -d cwd: only the cwd entry, -F pn: machine-readable PID and name
+	cmd := exec.CommandContext(ctx, "lsof", "-a", "-d", "cwd", "-F", "pn", "-p", strings.Join(pidList, ","))
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return nil
+	}
+	return parseLsofCwds(string(output))
+}
+
+// parseLsofCwds parses `lsof -F pn` output: a "p<pid>" line followed by
+// "f..." and "n<path>" lines for that process
+func parseLsofCwds(output string) map[int]string {
+	cwds := make(map[int]string)
+	pid := 0
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'p':
+			pid, _ = strconv.Atoi(line[1:])
+		case 'n':
+			if pid != 0 {
+				cwds[pid] = line[1:]
+			}
+		}
+	}
+	return cwds
+}
+
+// parsePsOutput parses `ps -o pid=,etime=,rss=,time=,state=,command=`
+// output, keyed by PID
+// Example line: 42156  01-02:03:04  51234   0:12.34 Ss   node server.js
+func parsePsOutput(output string, now time.Time) map[int]PortInfo {
+	details := make(map[int]PortInfo)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		var info PortInfo
+		if elapsed, ok := parseEtime(fields[1]); ok {
+			info.StartTime = now.Add(-elapsed)
+		}
+		if kb, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			info.Memory = kb * 1024
+		}
+		if cpu, ok := parseCPUTime(fields[3]); ok {
+			info.CPUTime = cpu
+		}
+		info.State = psState(fields[4])
+		info.Cmdline = strings.Join(fields[5:], " ")
+		details[pid] = info
+	}
+	return details
+}
+
+// parseCPUTime parses the ps time format [[dd-]hh:]mm:ss[.cc]
+func parseCPUTime(s string) (time.Duration, bool) {
+	whole, frac, _ := strings.Cut(s, ".")
+	d, ok := parseEtime(whole)
+	if !ok {
+		return 0, false
+	}
+	if frac != "" {
+		cs, err := strconv.Atoi(frac)
+		if err != nil || len(frac) != 2 {
+			return 0, false
+		}
+		d += time.Duration(cs) * 10 * time.Millisecond
+	}
+	return d, true
+}
+
+// psState turns a ps state such as "Ss" or "U+" into the letter Linux
+// uses: U (uninterruptible wait) becomes D and I (idle) becomes S
+func psState(s string) string {
+	if s == "" {
+		return ""
+	}
+	switch s[:1] {
+	case "U":
+		return "D"
+	case "I":
+		return "S"
+	}
+	return s[:1]
+}
+
+// parseEtime parses the ps etime format [[dd-]hh:]mm:ss
+func parseEtime(s string) (time.Duration, bool) {
+	var days int
+	if idx := strings.Index(s, "-"); idx != -1 {
+		d, err := strconv.Atoi(s[:idx])
+		if err != nil {
+			return 0, false
+		}
+		days = d
+		s = s[idx+1:]
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+
+	var secs int
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+		secs = secs*60 + n
+	}
+
+	return time.Duration(days)*24*time.Hour + time.Duration(secs)*time.Second, true
+}
@@ -0,0 +1,208 @@
+package ports
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseHexAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"0100007F:0BB8", "127.0.0.1"},
+		{"00000000:0050", "0.0.0.0"},
+		{"00000000000000000000000000000000:1F90", "::"},
+		{"00000000000000000000000001000000:1F90", "::1"},
+		{"0000000000000000FFFF00000100007F:1F90", "127.0.0.1"},
+		{"invalid", ""},
+		{"ABC:0050", ""},
+		{"ZZZZZZZZ:0050", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseHexAddr(tt.addr); got != tt.want {
+			t.Errorf("parseHexAddr(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseAddrFromLsofName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"*:3000", "*"},
+		{"127.0.0.1:8080", "127.0.0.1"},
+		{"[::1]:5432", "::1"},
+		{"noport", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseAddrFromLsofName(tt.name); got != tt.want {
+			t.Errorf("parseAddrFromLsofName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseStatStartTime(t *testing.T) {
+	stat := "1234 (my (weird) proc) S 1 1234 1234 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 1 0 98765 1000000 200 18446744073709551615"
+	ticks, ok := parseStatStartTime(stat)
+	if !ok || ticks != 98765 {
+		t.Errorf("parseStatStartTime = %d, %v; want 98765, true", ticks, ok)
+	}
+
+	st, ok := parseStat(stat)
+	if !ok || st.state != "S" || st.cpuTicks != 8 || st.threads != 1 {
+		t.Errorf("parseStat = %+v, %v; want state S, 8 ticks, 1 thread", st, ok)
+	}
+
+	if _, ok := parseStatStartTime("1234 (short) S 1"); ok {
+		t.Error("parseStatStartTime should fail on truncated stat")
+	}
+	if _, ok := parseStatStartTime("garbage"); ok {
+		t.Error("parseStatStartTime should fail without comm")
+	}
+}
+
+func TestParseEtime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"00:05", 5 * time.Second, true},
+		{"12:34", 12*time.Minute + 34*time.Second, true},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"2-01:02:03", 49*time.Hour + 2*time.Minute + 3*time.Second, true},
+		{"5", 0, false},
+		{"x-01:02", 0, false},
+		{"aa:bb", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseEtime(tt.s)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseEtime(%q) = %v, %v; want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseCPUTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"0:01.50", 1500 * time.Millisecond, true},
+		{"12:03", 12*time.Minute + 3*time.Second, true},
+		{"1-02:00:00", 26 * time.Hour, true},
+		{"0:01.5", 0, false},
+		{"garbage", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseCPUTime(tt.s)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseCPUTime(%q) = %v, %v; want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for in, want := range map[string]string{"Ss": "S", "R+": "R", "U": "D", "I<": "S", "Z": "Z", "T": "T", "": ""} {
+		if got := psState(in); got != want {
+			t.Errorf("psState(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParsePsOutput(t *testing.T) {
+	now := time.Now()
+	output := `  123    01:00  2048   0:01.50 R+   node server.js --port 3000
+  456 1-00:00:00   100 1:02:03 Ss /usr/sbin/sshd
+bad line
+  789 garbage 5 garbage U cron
+`
+	details := parsePsOutput(output, now)
+
+	node := details[123]
+	if node.Cmdline != "node server.js --port 3000" {
+		t.Errorf("Cmdline = %q", node.Cmdline)
+	}
+	if node.Memory != 2048*1024 {
+		t.Errorf("Memory = %d, want %d", node.Memory, 2048*1024)
+	}
+	if !node.StartTime.Equal(now.Add(-time.Minute)) {
+		t.Errorf("StartTime = %v, want %v", node.StartTime, now.Add(-time.Minute))
+	}
+
+	if node.CPUTime != 1500*time.Millisecond || node.State != "R" {
+		t.Errorf("CPUTime, State = %v, %q", node.CPUTime, node.State)
+	}
+
+	if !details[456].StartTime.Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("StartTime for 456 = %v", details[456].StartTime)
+	}
+	if details[456].CPUTime != time.Hour+2*time.Minute+3*time.Second || details[456].State != "S" {
+		t.Errorf("CPUTime, State for 456 = %v, %q", details[456].CPUTime, details[456].State)
+	}
+
+	if !details[789].StartTime.IsZero() {
+		t.Error("unparseable etime should leave StartTime unset")
+	}
+	if details[789].CPUTime != 0 || details[789].State != "D" {
+		t.Errorf("CPUTime, State for 789 = %v, %q", details[789].CPUTime, details[789].State)
+	}
+	if len(details) != 3 {
+		t.Errorf("len(details) = %d, want 3", len(details))
+	}
+}
+
+func TestReadProcDetailsSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc")
+	}
+
+	p := PortInfo{PID: os.Getpid()}
+	readProcDetails(&p)
+
+	if p.Cmdline == "" {
+		t.Error("Cmdline should be read for the current process")
+	}
+	if p.StartTime.IsZero() || p.StartTime.After(time.Now()) {
+		t.Errorf("StartTime = %v, should be in the past", p.StartTime)
+	}
+	if p.Memory == 0 {
+		t.Error("Memory should be read for the current process")
+	}
+	if wd, _ := os.Getwd(); p.Cwd != wd {
+		t.Errorf("Cwd = %q, want %q", p.Cwd, wd)
+	}
+	if p.Uptime() <= 0 {
+		t.Error("Uptime should be positive")
+	}
+	if p.Threads == 0 || p.FDs == 0 || p.State == "" {
+		t.Errorf("Threads, FDs, State = %d, %d, %q", p.Threads, p.FDs, p.State)
+	}
+}
+
+func TestUptimeUnknown(t *testing.T) {
+	if (PortInfo{}).Uptime() != 0 {
+		t.Error("Uptime without a start time should be 0")
+	}
+}
+
+func TestParseLsofCwds(t *testing.T) {
+	output := "norphan\np123\nfcwd\nn/Users/mike/src/app\np456\nfcwd\nn/\n\n"
+	cwds := parseLsofCwds(output)
+
+	if cwds[123] != "/Users/mike/src/app" {
+		t.Errorf("cwd for 123 = %q", cwds[123])
+	}
+	if cwds[456] != "/" {
+		t.Errorf("cwd for 456 = %q", cwds[456])
+	}
+	if len(cwds) != 2 {
+		t.Errorf("len(cwds) = %d, want 2", len(cwds))
+	}
+}
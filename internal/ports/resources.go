@@ -0,0 +1,84 @@
+package ports
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Troubled reports whether p's process is a zombie or stopped, which
+// leaves its sockets open without anything serving them
+func (p PortInfo) Troubled() bool {
+	return p.State == "Z" || p.State == "T" || p.State == "t"
+}
+
+// averageCPU returns cpu as a percentage of one core over the time since
+// start, or 0 if start is unknown
+func averageCPU(cpu time.Duration, start, now time.Time) float64 {
+	if start.IsZero() || !now.After(start) {
+		return 0
+	}
+	return 100 * float64(cpu) / float64(now.Sub(start))
+}
+
+// RefreshResources re-reads the resources of each process in list, which
+// change between scans: CPU time, memory, threads, open files and state.
+// CPU is reset to the average since the process started; a CPUSampler
+// turns it into the recent rate.
+func RefreshResources(ctx context.Context, list []PortInfo) {
+	switch runtime.GOOS {
+	case "linux":
+		for i := range list {
+			if ctx.Err() != nil {
+				return
+			}
+			if list[i].PID > 0 {
+				readProcResources(&list[i])
+			}
+		}
+	case "darwin":
+		var pidList []string
+		for _, p := range list {
+			pidList = append(pidList, strconv.Itoa(p.PID))
+		}
+		if len(pidList) == 0 {
+			return
+		}
+		details := runPs(ctx, pidList)
+		for i := range list {
+			if d, ok := details[list[i].PID]; ok {
+				setPsResources(&list[i], d)
+			}
+		}
+	}
+}
+
+// CPUSampler measures the CPU usage of processes between samples, like
+// top. The zero value is ready to use.
+type CPUSampler struct {
+	last map[int]cpuSample
+}
+
+// cpuSample is a process's CPU time at one sample
+type cpuSample struct {
+	cpu   time.Duration
+	at    time.Time
+	start time.Time
+}
+
+// Sample sets CPU on each entry of list to the share of one core its
+// process used since the previous sample, taken at now. Processes not in
+// the previous sample keep the average since they started.
+func (s *CPUSampler) Sample(list []PortInfo, now time.Time) {
+	next := make(map[int]cpuSample, len(list))
+	for i := range list {
+		p := &list[i]
+		prev, ok := s.last[p.PID]
+		if ok && SameProcess(PortInfo{PID: p.PID, StartTime: prev.start}, *p) && now.After(prev.at) && p.CPUTime >= prev.cpu {
+			p.CPU = 100 * float64(p.CPUTime-prev.cpu) / float64(now.Sub(prev.at))
+		}
+		next[p.PID] = cpuSample{cpu: p.CPUTime, at: now, start: p.StartTime}
+	}
+	s.last = next
+}
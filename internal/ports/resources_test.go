@@ -0,0 +1,69 @@
+package ports
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTroubled(t *testing.T) {
+	for state, want := range map[string]bool{"Z": true, "T": true, "t": true, "S": false, "R": false, "D": false, "": false} {
+		if got := (PortInfo{State: state}).Troubled(); got != want {
+			t.Errorf("Troubled() with state %q = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestAverageCPU(t *testing.T) {
+	now := time.Now()
+	if got := averageCPU(30*time.Second, now.Add(-time.Minute), now); got != 50 {
+		t.Errorf("averageCPU = %v, want 50", got)
+	}
+	if got := averageCPU(time.Second, time.Time{}, now); got != 0 {
+		t.Errorf("averageCPU with unknown start = %v, want 0", got)
+	}
+}
+
+func TestCPUSampler(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	now := time.Now()
+	list := []PortInfo{
+		{Port: 3000, PID: 100, StartTime: start, CPUTime: 10 * time.Second, CPU: 0.3},
+		{Port: 8080, PID: 200, StartTime: start, CPUTime: time.Minute, CPU: 1.7},
+	}
+
+	// The first sample keeps the averages since start
+	var s CPUSampler
+	s.Sample(list, now)
+	if list[0].CPU != 0.3 || list[1].CPU != 1.7 {
+		t.Errorf("first sample CPU = %v, %v; want the averages", list[0].CPU, list[1].CPU)
+	}
+
+	next := []PortInfo{
+		{Port: 3000, PID: 100, StartTime: start, CPUTime: 11 * time.Second, CPU: 0.3},
+		{Port: 8080, PID: 200, StartTime: start.Add(time.Hour), CPUTime: time.Second, CPU: 4}, // PID reused
+		{Port: 9000, PID: 300, StartTime: start, CPUTime: time.Second, CPU: 0.1},
+	}
+	s.Sample(next, now.Add(2*time.Second))
+	if math.Abs(next[0].CPU-50) > 1e-9 {
+		t.Errorf("CPU over 2s = %v, want 50", next[0].CPU)
+	}
+	if next[1].CPU != 4 || next[2].CPU != 0.1 {
+		t.Errorf("new processes CPU = %v, %v; want their averages", next[1].CPU, next[2].CPU)
+	}
+}
+
+func TestRefreshResourcesSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc")
+	}
+
+	list := []PortInfo{{PID: os.Getpid()}}
+	RefreshResources(context.Background(), list)
+	if p := list[0]; p.Threads == 0 || p.FDs == 0 || p.Memory == 0 || p.State == "" {
+		t.Errorf("RefreshResources = %+v", p)
+	}
+}
@@ -1,51 +1,114 @@
 // Package ports provides network port scanning functionality to discover
-// processes listening on TCP ports. It supports both macOS (via lsof) and
-// Linux (via /proc/net/tcp) platforms.
+// processes listening on TCP ports, and on Linux on Unix domain sockets. It
+// supports both macOS (via lsof) and Linux (via /proc/net/tcp and
+// /proc/net/unix) platforms.
 package ports
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // PortInfo represents a process listening on a port
 type PortInfo struct {
-	Port    int
-	PID     int
-	Process string
-	User    string
-	Proto   string // tcp, tcp6
+	Port      int
+	PID       int
+	Process   string
+	User      string
+	Proto     string // tcp, tcp6 or unix
+	Address   string // local address the socket is bound to, or a Unix socket's path
+	Cmdline   string
+	Exe       string // path of the executable; Linux only
+	Cwd       string
+	StartTime time.Time
+	Memory    uint64 // resident set size in bytes
+	Slice     string // innermost systemd slice, e.g. user-1000.slice
+	Netns     string // network namespace, "" for tsunami's own
+
+	// CPU is the share of one core the process uses, in percent: since the
+	// previous sample of a CPUSampler, else since the process started
+	CPU     float64
+	CPUTime time.Duration // user and system CPU time used so far
+	Threads int           // 0 if unknown
+	FDs     int           // open file descriptors; 0 if they cannot be counted
+	State   string        // R running, S sleeping, D disk wait, Z zombie, T stopped, ...
+
+	// App names the dev server, database or runtime behind the listener,
+	// e.g. vite, and Project the project it runs from; see package labels
+	App     string
+	Project string
+
+	// Connections are the open connections to the listener: established
+	// and close-wait TCP connections to its port, or a Unix socket's
+	// connected clients
+	Connections []Connection
+
+	// Container is the container the process runs in, from its cgroup, or
+	// for a docker-proxy listener the container it publishes; nil otherwise
+	Container *Container
+
+	// Unit is the systemd service the process belongs to, or for a
+	// socket-activated listener held by the service manager its socket
+	// unit; nil otherwise
+	Unit *Unit
 }
 
-// Scan returns all processes listening on TCP ports, sorted by port number
+// Container identifies a container
+type Container struct {
+	Runtime string // docker, podman, containerd, cri-o or lxc; empty if unknown
+	ID      string
+	Name    string // known for LXC, and for Docker once the daemon is asked
+	Image   string
+	Pod     string // Kubernetes pod UID
+}
+
+// Unit identifies a systemd unit
+type Unit struct {
+	Name      string   // e.g. nginx.service or cups.socket
+	User      bool     // managed by a user's service manager (systemctl --user)
+	Restart   string   // restart policy, e.g. always; empty if unknown
+	MainPID   int      // the service's main process; 0 if unknown
+	Activates []string // services a socket unit starts
+}
+
+// Scan returns all processes listening on TCP ports or Unix sockets, sorted
+// by port number with Unix sockets last
 func Scan() ([]PortInfo, error) {
+	return ScanContext(context.Background())
+}
+
+// ScanContext is Scan with cancellation: lsof is killed and the /proc walk
+// stops once ctx is done, and ctx.Err() is returned
+func ScanContext(ctx context.Context) ([]PortInfo, error) {
 	var ports []PortInfo
 	var err error
 
 	switch runtime.GOOS {
 	case "darwin":
-		ports, err = scanDarwin()
+		ports, err = scanDarwin(ctx)
 	case "linux":
-		ports, err = scanLinux()
+		ports, err = scanLinux(ctx)
 	default:
 		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 
+	if err == nil {
+		err = ctx.Err() // details may be missing from a cancelled scan
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Sort by port number (low to high)
-	sort.Slice(ports, func(i, j int) bool {
-		return ports[i].Port < ports[j].Port
-	})
+	Sort(ports, SortByPort, false)
 
 	return ports, nil
 }
@@ -53,7 +116,12 @@ func Scan() ([]PortInfo, error) {
 // FindByPort returns all processes listening on a specific port
 // Returns multiple results if SO_REUSEPORT is in use
 func FindByPort(port int) ([]PortInfo, error) {
-	all, err := Scan()
+	return FindByPortContext(context.Background(), port)
+}
+
+// FindByPortContext is FindByPort with cancellation, as for ScanContext
+func FindByPortContext(ctx context.Context, port int) ([]PortInfo, error) {
+	all, err := ScanContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +137,7 @@ func FindByPort(port int) ([]PortInfo, error) {
 }
 
 // scanDarwin uses lsof to find listening ports on macOS
-func scanDarwin() ([]PortInfo, error) {
+func scanDarwin(ctx context.Context) ([]PortInfo, error) {
 	// Check if lsof is available
 	if _, err := exec.LookPath("lsof"); err != nil {
 		return nil, fmt.Errorf("lsof not found. Install with: brew install lsof")
@@ -79,8 +147,11 @@ func scanDarwin() ([]PortInfo, error) {
 	// -sTCP:LISTEN: only listening sockets
 	// -n: no hostname resolution
 	// -P: no port name resolution
-	cmd := exec.Command("lsof", "-iTCP", "-sTCP:LISTEN", "-n", "-P")
+	cmd := exec.CommandContext(ctx, "lsof", "-iTCP", "-sTCP:LISTEN", "-n", "-P")
 	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		// lsof exits with 1 if no results, which is fine
 		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
@@ -89,7 +160,13 @@ func scanDarwin() ([]PortInfo, error) {
 		return nil, fmt.Errorf("lsof failed: %w", err)
 	}
 
-	return parseLsofOutput(string(output))
+	ports, err := parseLsofOutput(string(output))
+	if err != nil {
+		return nil, err
+	}
+	readPsDetails(ctx, ports)
+	scanDarwinConnections(ctx, ports)
+	return ports, nil
 }
 
 // parseLsofOutput parses lsof -iTCP -sTCP:LISTEN -n -P output
@@ -135,6 +212,7 @@ func parseLsofOutput(output string) ([]PortInfo, error) {
 			Process: process,
 			User:    username,
 			Proto:   proto,
+			Address: parseAddrFromLsofName(nameField),
 		})
 	}
 
@@ -155,28 +233,50 @@ func parsePortFromLsofName(name string) int {
 }
 
 // scanLinux parses /proc/net/tcp and /proc/net/tcp6
-func scanLinux() ([]PortInfo, error) {
+func scanLinux(ctx context.Context) ([]PortInfo, error) {
+	return scanLinuxNet(ctx, "/proc/net")
+}
+
+// scanLinuxNet parses the tcp, tcp6 and unix tables in dir: /proc/net for
+// tsunami's own network namespace, or /proc/<pid>/net for the namespace
+// of pid
+func scanLinuxNet(ctx context.Context, dir string) ([]PortInfo, error) {
 	var ports []PortInfo
 
 	// Parse TCP (IPv4)
-	tcp4, err := parseProcNetTCP("/proc/net/tcp", "tcp")
+	tcp4, err := parseProcNetTCP(ctx, dir+"/tcp", "tcp")
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 	ports = append(ports, tcp4...)
 
 	// Parse TCP6 (IPv6)
-	tcp6, err := parseProcNetTCP("/proc/net/tcp6", "tcp6")
+	tcp6, err := parseProcNetTCP(ctx, dir+"/tcp6", "tcp6")
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 	ports = append(ports, tcp6...)
 
+	// Attribute open connections to the TCP listeners
+	conns, err := readTCPConnections(dir)
+	if err != nil {
+		return nil, err
+	}
+	attachConnections(ctx, ports, conns)
+
+	// Parse Unix domain sockets
+	unix, err := parseProcNetUnix(ctx, dir+"/unix")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ports = append(ports, unix...)
+
 	return ports, nil
 }
 
-// parseProcNetTCP parses /proc/net/tcp or /proc/net/tcp6
-func parseProcNetTCP(path, proto string) ([]PortInfo, error) {
+// parseProcNetTCP parses /proc/net/tcp or /proc/net/tcp6, stopping with
+// ctx.Err() once ctx is done
+func parseProcNetTCP(ctx context.Context, path, proto string) ([]PortInfo, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -213,7 +313,10 @@ func parseProcNetTCP(path, proto string) ([]PortInfo, error) {
 		inode := fields[9]
 
 		// Find PID and process name from inode
-		pid, process := findProcessByInode(inode)
+		pid, process := findProcessByInode(ctx, inode)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if pid == 0 {
 			continue
 		}
@@ -222,13 +325,16 @@ func parseProcNetTCP(path, proto string) ([]PortInfo, error) {
 		uid := fields[7]
 		username := getUsernameFromUID(uid)
 
-		ports = append(ports, PortInfo{
+		info := PortInfo{
 			Port:    port,
 			PID:     pid,
 			Process: process,
 			User:    username,
 			Proto:   proto,
-		})
+			Address: parseHexAddr(localAddr),
+		}
+		readProcDetails(&info)
+		ports = append(ports, info)
 	}
 
 	return ports, scanner.Err()
@@ -247,8 +353,9 @@ func parseHexPort(addr string) int {
 	return int(port)
 }
 
-// findProcessByInode searches /proc for the process using this socket inode
-func findProcessByInode(inode string) (int, string) {
+// findProcessByInode searches /proc for the process using this socket
+// inode. The search gives up when ctx is done.
+func findProcessByInode(ctx context.Context, inode string) (int, string) {
 	target := fmt.Sprintf("socket:[%s]", inode)
 
 	entries, err := os.ReadDir("/proc")
@@ -257,6 +364,9 @@ func findProcessByInode(inode string) (int, string) {
 	}
 
 	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return 0, ""
+		}
 		if !entry.IsDir() {
 			continue
 		}
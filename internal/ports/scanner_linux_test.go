@@ -3,13 +3,16 @@
 package ports
 
 import (
+	"context"
+	"errors"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
 )
 
 func TestScanLinux(t *testing.T) {
-	ports, err := scanLinux()
+	ports, err := scanLinux(context.Background())
 	if err != nil {
 		t.Fatalf("scanLinux() error: %v", err)
 	}
@@ -19,7 +22,7 @@ func TestScanLinux(t *testing.T) {
 
 func TestParseProcNetTCP(t *testing.T) {
 	// Test with actual /proc/net/tcp if available
-	ports, err := parseProcNetTCP("/proc/net/tcp", "tcp")
+	ports, err := parseProcNetTCP(context.Background(), "/proc/net/tcp", "tcp")
 	if err != nil {
 		t.Logf("parseProcNetTCP error (expected if not root): %v", err)
 	}
@@ -39,7 +42,7 @@ func TestParseProcNetTCPWithMockData(t *testing.T) {
 		t.Fatalf("failed to create temp file: %v", err)
 	}
 
-	ports, err := parseProcNetTCP(tmpFile, "tcp")
+	ports, err := parseProcNetTCP(context.Background(), tmpFile, "tcp")
 	if err != nil {
 		t.Fatalf("parseProcNetTCP() error: %v", err)
 	}
@@ -60,7 +63,7 @@ func TestParseProcNetTCPMalformed(t *testing.T) {
 		t.Fatalf("failed to create temp file: %v", err)
 	}
 
-	ports, err := parseProcNetTCP(tmpFile, "tcp")
+	ports, err := parseProcNetTCP(context.Background(), tmpFile, "tcp")
 	if err != nil {
 		t.Fatalf("parseProcNetTCP() error: %v", err)
 	}
@@ -72,7 +75,7 @@ func TestParseProcNetTCPMalformed(t *testing.T) {
 }
 
 func TestParseProcNetTCPFileNotFound(t *testing.T) {
-	_, err := parseProcNetTCP("/nonexistent/path/tcp", "tcp")
+	_, err := parseProcNetTCP(context.Background(), "/nonexistent/path/tcp", "tcp")
 	if err == nil {
 		t.Error("expected error for nonexistent file")
 	}
@@ -80,7 +83,7 @@ func TestParseProcNetTCPFileNotFound(t *testing.T) {
 
 func TestParseProcNetTCP6(t *testing.T) {
 	// Test with /proc/net/tcp6 if available
-	ports, err := parseProcNetTCP("/proc/net/tcp6", "tcp6")
+	ports, err := parseProcNetTCP(context.Background(), "/proc/net/tcp6", "tcp6")
 	if err != nil {
 		t.Logf("parseProcNetTCP6 error (expected if not available): %v", err)
 	}
@@ -89,7 +92,7 @@ func TestParseProcNetTCP6(t *testing.T) {
 
 func TestFindProcessByInodeNotFound(t *testing.T) {
 	// Test with invalid inode
-	pid, process := findProcessByInode("999999999999")
+	pid, process := findProcessByInode(context.Background(), "999999999999")
 	if pid != 0 {
 		t.Errorf("expected pid 0 for invalid inode, got %d", pid)
 	}
@@ -100,10 +103,27 @@ func TestFindProcessByInodeNotFound(t *testing.T) {
 
 func TestScanLinuxNoError(t *testing.T) {
 	// Verify scanLinux handles both tcp and tcp6
-	ports, err := scanLinux()
+	ports, err := scanLinux(context.Background())
 	if err != nil {
 		t.Errorf("scanLinux() returned error: %v", err)
 	}
 	// Results may be empty if no ports are listening
 	_ = ports
 }
+
+func TestScanContextCancelled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ScanContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ScanContext error = %v, want context.Canceled", err)
+	}
+	if _, err := FindByPortContext(ctx, 80); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindByPortContext error = %v, want context.Canceled", err)
+	}
+}
@@ -1,6 +1,7 @@
 package ports
 
 import (
+	"context"
 	"testing"
 )
 
@@ -182,11 +183,17 @@ func TestScan(t *testing.T) {
 		t.Fatalf("Scan() returned error: %v", err)
 	}
 
-	// Verify results are sorted by port
+	// Verify results are sorted by port, with Unix sockets last by path
 	for i := 1; i < len(ports); i++ {
-		if ports[i].Port < ports[i-1].Port {
+		a, b := ports[i-1], ports[i]
+		switch {
+		case a.Unix() && !b.Unix():
+			t.Errorf("results not sorted: port %d comes after socket %s", b.Port, a.Address)
+		case a.Unix() && b.Address < a.Address:
+			t.Errorf("results not sorted: socket %s comes after socket %s", b.Address, a.Address)
+		case !b.Unix() && b.Port < a.Port:
 			t.Errorf("results not sorted: port %d comes after port %d",
-				ports[i].Port, ports[i-1].Port)
+				b.Port, a.Port)
 		}
 	}
 }
@@ -198,7 +205,7 @@ func TestScanDarwin(t *testing.T) {
 	}
 
 	// This tests the actual lsof parsing on macOS
-	ports, err := scanDarwin()
+	ports, err := scanDarwin(context.Background())
 	if err != nil {
 		t.Fatalf("scanDarwin() error: %v", err)
 	}
@@ -406,8 +413,13 @@ func TestScanSortsResults(t *testing.T) {
 	}
 
 	for i := 1; i < len(ports); i++ {
-		if ports[i].Port < ports[i-1].Port {
-			t.Errorf("Ports not sorted: %d < %d", ports[i].Port, ports[i-1].Port)
+		if ports[i].Unix() {
+			if !ports[i-1].Unix() || ports[i].Address >= ports[i-1].Address {
+				continue
+			}
+			t.Errorf("Sockets not sorted: %s < %s", ports[i].Address, ports[i-1].Address)
+		} else if ports[i-1].Unix() || ports[i].Port < ports[i-1].Port {
+			t.Errorf("Ports not sorted: %d after %s", ports[i].Port, ports[i-1].Where())
 		}
 	}
 }
@@ -0,0 +1,296 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrCloseUnsupported is returned when the kernel cannot close sockets
+	ErrCloseUnsupported = errors.New("the kernel cannot close sockets (it needs CONFIG_INET_DIAG_DESTROY)")
+	// ErrClosePermission is returned when tsunami may not close a socket
+	ErrClosePermission = errors.New("closing sockets needs CAP_NET_ADMIN (try sudo)")
+	// ErrSocketGone is returned for a socket that closed before CloseSocket
+	ErrSocketGone = errors.New("socket already closed")
+
+	// errClosePlatform is returned for socket closing outside Linux
+	errClosePlatform = errors.New("closing single sockets is only supported on Linux")
+)
+
+// Kernel TCP states the watch fingerprint asks for
+const (
+	tcpEstablished = 1
+	tcpCloseWait   = 8
+	tcpListen      = 10
+)
+
+// tcpStateNames are the kernel's TCP states, indexed by number
+var tcpStateNames = [...]string{
+	1:  "ESTABLISHED",
+	2:  "SYN_SENT",
+	3:  "SYN_RECV",
+	4:  "FIN_WAIT1",
+	5:  "FIN_WAIT2",
+	6:  "TIME_WAIT",
+	7:  "CLOSE",
+	8:  "CLOSE_WAIT",
+	9:  "LAST_ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+}
+
+// closableStates are the states ParseSocketStates accepts, by the names
+// ss uses. TIME_WAIT sockets belong to no process and expire on their
+// own; CLOSE ones are already closed.
+var closableStates = []struct{ name, state string }{
+	{"listen", "LISTEN"},
+	{"established", "ESTABLISHED"},
+	{"syn-sent", "SYN_SENT"},
+	{"syn-recv", "SYN_RECV"},
+	{"fin-wait-1", "FIN_WAIT1"},
+	{"fin-wait-2", "FIN_WAIT2"},
+	{"close-wait", "CLOSE_WAIT"},
+	{"last-ack", "LAST_ACK"},
+	{"closing", "CLOSING"},
+}
+
+// Socket is an open TCP socket, a listener or one end of a connection,
+// that CloseSocket can close without signalling the process holding it
+type Socket struct {
+	Proto      string // tcp or tcp6
+	State      string // LISTEN, ESTABLISHED, CLOSE_WAIT, ...
+	Local      string // e.g. 127.0.0.1:5432
+	Remote     string // "" for a listener
+	LocalPort  int
+	RemotePort int
+	PID        int // 0 if no process tsunami can see holds it
+	Process    string
+	User       string
+
+	family uint8    // AF_INET or AF_INET6
+	state  uint8    // kernel TCP state
+	id     [48]byte // the kernel's inet_diag_sockid, cookie included
+	inode  string
+}
+
+// Endpoint selects one end of a socket by address, port or both; the zero
+// value matches any
+type Endpoint struct {
+	IP   net.IP
+	Port int
+}
+
+// ParseEndpoint parses "3000", ":3000", "127.0.0.1:3000", "[::1]:3000",
+// "*:3000" or a bare address such as "10.0.0.5" or "::1"
+func ParseEndpoint(s string) (Endpoint, error) {
+	if s == "" || s == "*" {
+		return Endpoint{}, nil
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		s = ":" + s
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), ""
+	}
+
+	var e Endpoint
+	if port != "" && port != "*" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return Endpoint{}, fmt.Errorf("invalid port in %q", s)
+		}
+		e.Port = n
+	}
+	if host != "" && host != "*" {
+		if e.IP = net.ParseIP(host); e.IP == nil {
+			return Endpoint{}, fmt.Errorf("invalid address %q: want an IP address and port", s)
+		}
+	}
+	return e, nil
+}
+
+// String formats e the way ParseEndpoint reads it
+func (e Endpoint) String() string {
+	host, port := "*", "*"
+	if e.IP != nil {
+		host = e.IP.String()
+	}
+	if e.Port != 0 {
+		port = strconv.Itoa(e.Port)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// match reports whether addr, a host and port, is selected by e.
+// IPv4-mapped IPv6 addresses match their IPv4 form.
+func (e Endpoint) match(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if e.Port != 0 && port != strconv.Itoa(e.Port) {
+		return false
+	}
+	return e.IP == nil || e.IP.Equal(net.ParseIP(host))
+}
+
+// SocketQuery selects the sockets to close
+type SocketQuery struct {
+	Local  []Endpoint // the socket's own address; any of them, or every one if empty
+	Remote []Endpoint // the peer's address; listeners have none
+	States []string   // as in Socket.State; every closable state if empty
+}
+
+// ParseSocketStates parses a comma-separated list of ss state names, such
+// as "listen,close-wait". "connected" stands for every state but LISTEN.
+func ParseSocketStates(s string) ([]string, error) {
+	var states []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range closableStates {
+			if name == c.name || (name == "connected" && c.state != "LISTEN") {
+				states = append(states, c.state)
+				found = true
+			}
+		}
+		if !found {
+			names := make([]string, len(closableStates))
+			for i, c := range closableStates {
+				names[i] = c.name
+			}
+			return nil, fmt.Errorf("unknown socket state %q (want %s or connected)", name, strings.Join(names, ", "))
+		}
+	}
+	return states, nil
+}
+
+// Match reports whether s is selected by q
+func (q SocketQuery) Match(s Socket) bool {
+	if len(q.States) > 0 && !containsString(q.States, s.State) {
+		return false
+	}
+	if len(q.States) == 0 && !closable(s.State) {
+		return false
+	}
+	if len(q.Local) > 0 && !matchAny(q.Local, s.Local) {
+		return false
+	}
+	if len(q.Remote) > 0 && (s.Remote == "" || !matchAny(q.Remote, s.Remote)) {
+		return false
+	}
+	return true
+}
+
+// closable reports whether state is one of closableStates
+func closable(state string) bool {
+	for _, c := range closableStates {
+		if c.state == state {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether one of endpoints matches addr
+func matchAny(endpoints []Endpoint, addr string) bool {
+	for _, e := range endpoints {
+		if e.match(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FindSockets lists the TCP sockets in tsunami's network namespace that q
+// selects, by local port, then state, then addresses
+func FindSockets(ctx context.Context, q SocketQuery) ([]Socket, error) {
+	all, err := dumpSockets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Socket
+	inodes := make(map[string]bool)
+	for _, s := range all {
+		if q.Match(s) {
+			result = append(result, s)
+			if s.inode != "0" {
+				inodes[s.inode] = true
+			}
+		}
+	}
+	owners := findProcessesByInode(ctx, inodes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if pid, ok := owners[result[i].inode]; ok && result[i].inode != "0" {
+			result[i].PID = pid
+			result[i].Process = readComm(pid)
+			result[i].User = processUser(pid)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.LocalPort != b.LocalPort {
+			return a.LocalPort < b.LocalPort
+		}
+		if (a.State == "LISTEN") != (b.State == "LISTEN") {
+			return a.State == "LISTEN"
+		}
+		if a.Local != b.Local {
+			return a.Local < b.Local
+		}
+		return a.Remote < b.Remote
+	})
+	return result, nil
+}
+
+// CloseSocket closes s in the kernel, as `ss -K` does. The process holding
+// it keeps running and sees the socket fail with ECONNABORTED.
+func CloseSocket(s Socket) error {
+	return destroySocket(s)
+}
+
+// newSocket builds a Socket from the fields of a socket diagnostics
+// record; remote is ignored for listeners
+func newSocket(family, state uint8, id [48]byte, inode uint32, proto string, local, remote net.IP, localPort, remotePort int) Socket {
+	s := Socket{
+		Proto:     proto,
+		Local:     net.JoinHostPort(local.String(), strconv.Itoa(localPort)),
+		LocalPort: localPort,
+		family:    family,
+		state:     state,
+		id:        id,
+		inode:     strconv.FormatUint(uint64(inode), 10),
+	}
+	if int(state) < len(tcpStateNames) {
+		s.State = tcpStateNames[state]
+	}
+	if s.State != "LISTEN" {
+		s.Remote = net.JoinHostPort(remote.String(), strconv.Itoa(remotePort))
+		s.RemotePort = remotePort
+	}
+	return s
+}
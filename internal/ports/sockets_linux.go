@@ -0,0 +1,193 @@
+package ports
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Socket diagnostics over netlink, from linux/sock_diag.h and
+// linux/inet_diag.h
+const (
+	sockDiagByFamily = 20
+	sockDestroy      = 21
+
+	inetDiagReqLen = 56 // struct inet_diag_req_v2
+	inetDiagMsgLen = 72 // struct inet_diag_msg
+)
+
+// dumpSockets lists every TCP socket in tsunami's network namespace
+func dumpSockets(ctx context.Context) ([]Socket, error) {
+	return dumpStates(ctx, ^uint32(0))
+}
+
+// dumpStates lists the TCP sockets in the states of the bitmask states,
+// bit n standing for kernel state n
+func dumpStates(ctx context.Context, states uint32) ([]Socket, error) {
+	fd, err := openSockDiag()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	var result []Socket
+	for _, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		var id [48]byte
+		req := inetDiagRequest(sockDiagByFamily, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP, family, states, id)
+		if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+			return nil, fmt.Errorf("socket diagnostics: %w", err)
+		}
+		sockets, err := readDump(ctx, fd)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, sockets...)
+	}
+	return result, nil
+}
+
+// readDump reads the replies to a dump request until its end
+func readDump(ctx context.Context, fd int) ([]Socket, error) {
+	var result []Socket
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("socket diagnostics: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, fmt.Errorf("socket diagnostics: %w", err)
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return result, nil
+			case syscall.NLMSG_ERROR:
+				return nil, fmt.Errorf("socket diagnostics: %w", netlinkError(m.Data))
+			case sockDiagByFamily:
+				if s, ok := parseInetDiagMsg(m.Data); ok {
+					result = append(result, s)
+				}
+			}
+		}
+	}
+}
+
+// destroySocket asks the kernel to close s
+func destroySocket(s Socket) error {
+	fd, err := openSockDiag()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	req := inetDiagRequest(sockDestroy, syscall.NLM_F_REQUEST|syscall.NLM_F_ACK, s.family, 1<<s.state, s.id)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.NLMSG_ERROR {
+			continue
+		}
+		switch err := netlinkError(m.Data); {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EOPNOTSUPP):
+			return ErrCloseUnsupported
+		case errors.Is(err, syscall.EPERM), errors.Is(err, syscall.EACCES):
+			return ErrClosePermission
+		case errors.Is(err, syscall.ENOENT):
+			return ErrSocketGone
+		case errors.Is(err, syscall.EINVAL):
+			// The subflows of MPTCP sockets, which Go programs listen on by
+			// default, cannot be closed on their own
+			return fmt.Errorf("the kernel refused to close it (%w); MPTCP sockets cannot be closed this way", err)
+		default:
+			return err
+		}
+	}
+	return errors.New("no reply from the kernel")
+}
+
+// openSockDiag opens a NETLINK_SOCK_DIAG socket
+func openSockDiag() (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_INET_DIAG)
+	if err != nil {
+		if errors.Is(err, syscall.EPROTONOSUPPORT) || errors.Is(err, syscall.EAFNOSUPPORT) {
+			return -1, ErrCloseUnsupported
+		}
+		return -1, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return -1, os.NewSyscallError("bind", err)
+	}
+	return fd, nil
+}
+
+// inetDiagRequest builds a netlink message carrying an inet_diag_req_v2
+// for TCP sockets of family in the states of the bitmask states
+func inetDiagRequest(msgType, flags uint16, family uint8, states uint32, id [48]byte) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:6], msgType)
+	binary.NativeEndian.PutUint16(b[6:8], flags)
+	binary.NativeEndian.PutUint32(b[8:12], 1) // sequence number
+
+	req := b[syscall.NLMSG_HDRLEN:]
+	req[0] = family
+	req[1] = syscall.IPPROTO_TCP
+	binary.NativeEndian.PutUint32(req[4:8], states)
+	copy(req[8:], id[:])
+	return b
+}
+
+// parseInetDiagMsg reads a struct inet_diag_msg
+func parseInetDiagMsg(b []byte) (Socket, bool) {
+	if len(b) < inetDiagMsgLen {
+		return Socket{}, false
+	}
+	family, state := b[0], b[1]
+	var id [48]byte
+	copy(id[:], b[4:52])
+
+	proto, size := "tcp", net.IPv4len
+	if family == syscall.AF_INET6 {
+		proto, size = "tcp6", net.IPv6len
+	}
+	local := net.IP(append([]byte(nil), id[4:4+size]...))
+	remote := net.IP(append([]byte(nil), id[20:20+size]...))
+	localPort := int(binary.BigEndian.Uint16(id[0:2]))
+	remotePort := int(binary.BigEndian.Uint16(id[2:4]))
+	inode := binary.NativeEndian.Uint32(b[68:72])
+	return newSocket(family, state, id, inode, proto, local, remote, localPort, remotePort), true
+}
+
+// netlinkError returns the error in an NLMSG_ERROR payload, nil for an
+// acknowledgement
+func netlinkError(b []byte) error {
+	if len(b) < 4 {
+		return errors.New("short netlink error")
+	}
+	if code := int32(binary.NativeEndian.Uint32(b[0:4])); code != 0 {
+		return syscall.Errno(-code)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//go:build linux
+
+package ports
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFindAndCloseSockets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping socket test in short mode")
+	}
+	// Go listens with MPTCP where it can, whose sockets cannot be closed
+	var lc net.ListenConfig
+	lc.SetMultipathTCP(false)
+	ln, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	local, _ := ParseEndpoint(ln.Addr().String())
+	sockets, err := FindSockets(context.Background(), SocketQuery{Local: []Endpoint{local}})
+	if err != nil {
+		if errors.Is(err, ErrCloseUnsupported) {
+			t.Skip(err)
+		}
+		t.Fatal(err)
+	}
+	// The listener, then the accepted connection
+	if len(sockets) != 2 || sockets[0].State != "LISTEN" || sockets[1].State != "ESTABLISHED" {
+		t.Fatalf("FindSockets = %+v, want the listener and the accepted connection", sockets)
+	}
+	for _, s := range sockets {
+		if s.PID != os.Getpid() || s.Process == "" || s.LocalPort != port {
+			t.Errorf("socket = %+v, want PID %d on port %d", s, os.Getpid(), port)
+		}
+	}
+	if sockets[1].Remote != client.LocalAddr().String() {
+		t.Errorf("accepted remote = %q, want %q", sockets[1].Remote, client.LocalAddr())
+	}
+
+	// Closing the accepted end aborts the connection; the listener stays
+	if err := CloseSocket(sockets[1]); err != nil {
+		if errors.Is(err, ErrCloseUnsupported) || errors.Is(err, ErrClosePermission) {
+			t.Skip(err)
+		}
+		t.Fatalf("CloseSocket: %v", err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("client read succeeded after its connection was closed")
+	}
+	if err := CloseSocket(sockets[1]); !errors.Is(err, ErrSocketGone) {
+		t.Errorf("closing it again = %v, want ErrSocketGone", err)
+	}
+
+	if err := CloseSocket(sockets[0]); err != nil {
+		t.Fatalf("CloseSocket(listener): %v", err)
+	}
+	left, err := FindSockets(context.Background(), SocketQuery{Local: []Endpoint{local}, States: []string{"LISTEN"}})
+	if err != nil || len(left) != 0 {
+		t.Errorf("listeners after close = %+v, %v; want none", left, err)
+	}
+}
+
+func TestFindSocketsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FindSockets(ctx, SocketQuery{}); err != context.Canceled {
+		t.Errorf("FindSockets with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestTCPFingerprint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping socket test in short mode")
+	}
+	ctx := context.Background()
+	before, err := tcpFingerprint(ctx, false)
+	if err != nil {
+		if errors.Is(err, ErrCloseUnsupported) {
+			t.Skip(err)
+		}
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	after, err := tcpFingerprint(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after == before {
+		t.Error("fingerprint did not change when a listener opened")
+	}
+	if again, _ := tcpFingerprint(ctx, false); again != after {
+		t.Errorf("fingerprint changed without a new socket:\n%s\nthen\n%s", after, again)
+	}
+
+	idle, _ := tcpFingerprint(ctx, true)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got, _ := tcpFingerprint(ctx, false); got != after {
+		t.Error("listener fingerprint changed when a client connected")
+	}
+	if got, _ := tcpFingerprint(ctx, true); got == idle {
+		t.Error("connection fingerprint did not change when a client connected")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package ports
+
+import "context"
+
+// dumpSockets needs Linux socket diagnostics
+func dumpSockets(ctx context.Context) ([]Socket, error) {
+	return nil, errClosePlatform
+}
+
+// dumpStates needs Linux socket diagnostics
+func dumpStates(ctx context.Context, states uint32) ([]Socket, error) {
+	return nil, errClosePlatform
+}
+
+// destroySocket needs Linux socket diagnostics
+func destroySocket(s Socket) error {
+	return errClosePlatform
+}
@@ -0,0 +1,131 @@
+package ports
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in      string
+		ip      string
+		port    int
+		wantErr bool
+	}{
+		{in: "3000", port: 3000},
+		{in: ":3000", port: 3000},
+		{in: "*:3000", port: 3000},
+		{in: "127.0.0.1:3000", ip: "127.0.0.1", port: 3000},
+		{in: "[::1]:3000", ip: "::1", port: 3000},
+		{in: "10.0.0.5", ip: "10.0.0.5"},
+		{in: "::1", ip: "::1"},
+		{in: "[::1]", ip: "::1"},
+		{in: "127.0.0.1:*", ip: "127.0.0.1"},
+		{in: "*"},
+		{in: "0", wantErr: true},
+		{in: "70000", wantErr: true},
+		{in: "localhost:3000", wantErr: true},
+		{in: "127.0.0.1:http", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			e, err := ParseEndpoint(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseEndpoint(%q) = %+v, want error", tt.in, e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEndpoint(%q) error: %v", tt.in, err)
+			}
+			if e.Port != tt.port || (tt.ip == "") != (e.IP == nil) || (e.IP != nil && e.IP.String() != tt.ip) {
+				t.Errorf("ParseEndpoint(%q) = %+v, want %s port %d", tt.in, e, tt.ip, tt.port)
+			}
+		})
+	}
+}
+
+func TestEndpointString(t *testing.T) {
+	for in, want := range map[string]string{
+		"3000":           "*:3000",
+		"127.0.0.1:3000": "127.0.0.1:3000",
+		"::1":            "[::1]:*",
+	} {
+		e, _ := ParseEndpoint(in)
+		if got := e.String(); got != want {
+			t.Errorf("ParseEndpoint(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseSocketStates(t *testing.T) {
+	got, err := ParseSocketStates("listen, Close-Wait")
+	if err != nil || !reflect.DeepEqual(got, []string{"LISTEN", "CLOSE_WAIT"}) {
+		t.Errorf("ParseSocketStates = %v, %v", got, err)
+	}
+
+	got, err = ParseSocketStates("connected")
+	if err != nil || len(got) != len(closableStates)-1 || containsString(got, "LISTEN") {
+		t.Errorf("ParseSocketStates(connected) = %v, %v", got, err)
+	}
+
+	if got, err := ParseSocketStates(""); err != nil || got != nil {
+		t.Errorf("ParseSocketStates(\"\") = %v, %v; want none", got, err)
+	}
+
+	_, err = ParseSocketStates("time-wait")
+	if err == nil || !strings.Contains(err.Error(), "close-wait") {
+		t.Errorf("ParseSocketStates(time-wait) error = %v", err)
+	}
+}
+
+func TestSocketQueryMatch(t *testing.T) {
+	listener := newSocket(2, 10, [48]byte{}, 1, "tcp", net.ParseIP("0.0.0.0").To4(), net.ParseIP("0.0.0.0").To4(), 5432, 0)
+	conn := newSocket(2, 1, [48]byte{}, 2, "tcp", net.ParseIP("127.0.0.1").To4(), net.ParseIP("127.0.0.1").To4(), 5432, 51000)
+	mapped := newSocket(10, 8, [48]byte{}, 3, "tcp6", net.ParseIP("::ffff:127.0.0.1"), net.ParseIP("::ffff:10.0.0.5"), 8080, 40000)
+	timeWait := newSocket(2, 6, [48]byte{}, 0, "tcp", net.ParseIP("127.0.0.1").To4(), net.ParseIP("127.0.0.1").To4(), 5432, 51001)
+	closed := newSocket(2, 7, [48]byte{}, 4, "tcp", net.ParseIP("127.0.0.1").To4(), net.ParseIP("0.0.0.0").To4(), 5432, 0)
+
+	if listener.Remote != "" || listener.State != "LISTEN" || listener.Local != "0.0.0.0:5432" {
+		t.Errorf("listener = %+v", listener)
+	}
+	if conn.Remote != "127.0.0.1:51000" || conn.RemotePort != 51000 || conn.State != "ESTABLISHED" {
+		t.Errorf("conn = %+v", conn)
+	}
+
+	endpoint := func(s string) Endpoint {
+		e, err := ParseEndpoint(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	tests := []struct {
+		name  string
+		query SocketQuery
+		want  []bool // listener, conn, mapped, timeWait, closed
+	}{
+		{"everything", SocketQuery{}, []bool{true, true, true, false, false}},
+		{"port", SocketQuery{Local: []Endpoint{endpoint("5432")}}, []bool{true, true, false, false, false}},
+		{"address", SocketQuery{Local: []Endpoint{endpoint("127.0.0.1:5432")}}, []bool{false, true, false, false, false}},
+		{"mapped address", SocketQuery{Local: []Endpoint{endpoint("127.0.0.1")}}, []bool{false, true, true, false, false}},
+		{"any of", SocketQuery{Local: []Endpoint{endpoint("5432"), endpoint("8080")}}, []bool{true, true, true, false, false}},
+		{"remote", SocketQuery{Remote: []Endpoint{endpoint("10.0.0.5")}}, []bool{false, false, true, false, false}},
+		{"remote port", SocketQuery{Remote: []Endpoint{endpoint("51000")}}, []bool{false, true, false, false, false}},
+		{"listen", SocketQuery{States: []string{"LISTEN"}}, []bool{true, false, false, false, false}},
+		{"close-wait on 8080", SocketQuery{Local: []Endpoint{endpoint("8080")}, States: []string{"CLOSE_WAIT"}}, []bool{false, false, true, false, false}},
+		{"time-wait", SocketQuery{States: []string{"TIME_WAIT"}}, []bool{false, false, false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, s := range []Socket{listener, conn, mapped, timeWait, closed} {
+				if got := tt.query.Match(s); got != tt.want[i] {
+					t.Errorf("Match(%s %s %s) = %v, want %v", s.State, s.Local, s.Remote, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
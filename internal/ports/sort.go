@@ -0,0 +1,151 @@
+package ports
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortKey identifies a field that port lists can be ordered by
+type SortKey string
+
+const (
+	SortByPort    SortKey = "port"
+	SortByPID     SortKey = "pid"
+	SortByProcess SortKey = "process"
+	SortByUser    SortKey = "user"
+	SortByProto   SortKey = "proto"
+	SortByAge     SortKey = "age"
+	SortByMemory  SortKey = "memory"
+	SortByConns   SortKey = "conns"
+	SortByCPU     SortKey = "cpu"
+	SortByThreads SortKey = "threads"
+	SortByFDs     SortKey = "fds"
+	SortByState   SortKey = "state"
+)
+
+// SortKeys lists every sort key in the order the TUI cycles through them
+var SortKeys = []SortKey{
+	SortByPort, SortByPID, SortByProcess, SortByUser, SortByProto, SortByAge, SortByMemory,
+	SortByConns, SortByCPU, SortByThreads, SortByFDs, SortByState,
+}
+
+// stateRank orders process states for sorting, the troubled ones first
+var stateRank = map[string]int{"Z": 0, "T": 1, "t": 1, "D": 2, "R": 3, "S": 4, "I": 5}
+
+// ParseSortKey parses a sort key name (case-insensitive)
+func ParseSortKey(s string) (SortKey, error) {
+	key := SortKey(strings.ToLower(strings.TrimSpace(s)))
+	for _, k := range SortKeys {
+		if k == key {
+			return k, nil
+		}
+	}
+
+	names := make([]string, len(SortKeys))
+	for i, k := range SortKeys {
+		names[i] = string(k)
+	}
+	return "", fmt.Errorf("unknown sort key: %s (valid: %s)", s, strings.Join(names, ", "))
+}
+
+// Sort orders portList in place by key, breaking ties by port then PID.
+// Unix sockets sort after ports, by path. Age sorts oldest first; memory,
+// conns, cpu, threads and fds sort largest first; state puts zombie,
+// stopped and disk-wait processes first. reverse flips the whole order.
+func Sort(portList []PortInfo, key SortKey, reverse bool) {
+	sort.SliceStable(portList, func(i, j int) bool {
+		a, b := portList[i], portList[j]
+		if c := compareBy(a, b, key); c != 0 {
+			return (c < 0) != reverse
+		}
+		if c := compareBy(a, b, SortByPort); c != 0 {
+			return (c < 0) != reverse
+		}
+		return (a.PID < b.PID) != reverse
+	})
+}
+
+// compareBy compares two entries on a single key, returning -1, 0 or 1
+func compareBy(a, b PortInfo, key SortKey) int {
+	switch key {
+	case SortByPID:
+		return compareInts(a.PID, b.PID)
+	case SortByProcess:
+		return strings.Compare(strings.ToLower(a.Process), strings.ToLower(b.Process))
+	case SortByUser:
+		return strings.Compare(strings.ToLower(a.User), strings.ToLower(b.User))
+	case SortByProto:
+		return strings.Compare(a.Proto, b.Proto)
+	case SortByAge:
+		// Oldest first; unknown start times sort last
+		switch {
+		case a.StartTime.Equal(b.StartTime):
+			return 0
+		case a.StartTime.IsZero():
+			return 1
+		case b.StartTime.IsZero():
+			return -1
+		case a.StartTime.Before(b.StartTime):
+			return -1
+		default:
+			return 1
+		}
+	case SortByMemory:
+		// Largest first
+		switch {
+		case a.Memory > b.Memory:
+			return -1
+		case a.Memory < b.Memory:
+			return 1
+		}
+		return 0
+	case SortByConns:
+		// Busiest first
+		return compareInts(len(b.Connections), len(a.Connections))
+	case SortByCPU:
+		switch {
+		case a.CPU > b.CPU:
+			return -1
+		case a.CPU < b.CPU:
+			return 1
+		}
+		return 0
+	case SortByThreads:
+		return compareInts(b.Threads, a.Threads)
+	case SortByFDs:
+		return compareInts(b.FDs, a.FDs)
+	case SortByState:
+		return compareInts(rankState(a.State), rankState(b.State))
+	default:
+		switch {
+		case a.Unix() && b.Unix():
+			return strings.Compare(a.Address, b.Address)
+		case a.Unix():
+			return 1
+		case b.Unix():
+			return -1
+		}
+		return compareInts(a.Port, b.Port)
+	}
+}
+
+// rankState returns the sort position of a process state; unknown
+// states sort last
+func rankState(state string) int {
+	if r, ok := stateRank[state]; ok {
+		return r
+	}
+	return len(stateRank)
+}
+
+// compareInts compares two ints, returning -1, 0 or 1
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
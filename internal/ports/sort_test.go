@@ -0,0 +1,105 @@
+package ports
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSortKey(t *testing.T) {
+	for _, k := range SortKeys {
+		got, err := ParseSortKey(string(k))
+		if err != nil || got != k {
+			t.Errorf("ParseSortKey(%q) = %q, %v", k, got, err)
+		}
+	}
+
+	if got, err := ParseSortKey(" MEMORY "); err != nil || got != SortByMemory {
+		t.Errorf("ParseSortKey should be case-insensitive, got %q, %v", got, err)
+	}
+	if _, err := ParseSortKey("size"); err == nil {
+		t.Error("ParseSortKey(\"size\") should return error")
+	}
+}
+
+func TestSort(t *testing.T) {
+	now := time.Now()
+	base := []PortInfo{
+		{Port: 8080, PID: 300, Process: "python", User: "bob", Proto: "tcp6", StartTime: now.Add(-time.Hour), Memory: 100,
+			CPU: 0.5, Threads: 4, FDs: 12, State: "S",
+			Connections: []Connection{{State: "ESTABLISHED"}, {State: "ESTABLISHED"}}},
+		{Port: 3000, PID: 200, Process: "Node", User: "alice", Proto: "tcp", StartTime: now.Add(-time.Minute), Memory: 300,
+			CPU: 12.5, Threads: 11, FDs: 30, State: "Z",
+			Connections: []Connection{{State: "ESTABLISHED"}}},
+		{Port: 5432, PID: 100, Process: "postgres", User: "postgres", Proto: "tcp", Memory: 200, Threads: 1, FDs: 40, State: "R"},
+	}
+
+	tests := []struct {
+		key     SortKey
+		reverse bool
+		want    []int // expected port order
+	}{
+		{SortByPort, false, []int{3000, 5432, 8080}},
+		{SortByPort, true, []int{8080, 5432, 3000}},
+		{SortByPID, false, []int{5432, 3000, 8080}},
+		{SortByProcess, false, []int{3000, 5432, 8080}},
+		{SortByUser, false, []int{3000, 8080, 5432}},
+		{SortByProto, false, []int{3000, 5432, 8080}},
+		{SortByAge, false, []int{8080, 3000, 5432}},
+		{SortByMemory, false, []int{3000, 5432, 8080}},
+		{SortByMemory, true, []int{8080, 5432, 3000}},
+		{SortByConns, false, []int{8080, 3000, 5432}},
+		{SortByConns, true, []int{5432, 3000, 8080}},
+		{SortByCPU, false, []int{3000, 8080, 5432}},
+		{SortByThreads, false, []int{3000, 8080, 5432}},
+		{SortByFDs, false, []int{5432, 3000, 8080}},
+		{SortByState, false, []int{3000, 5432, 8080}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.key), func(t *testing.T) {
+			list := append([]PortInfo(nil), base...)
+			Sort(list, tt.key, tt.reverse)
+			for i, want := range tt.want {
+				if list[i].Port != want {
+					t.Errorf("Sort(%s, reverse=%v)[%d].Port = %d, want %d", tt.key, tt.reverse, i, list[i].Port, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSortTiesBreakByPortThenPID(t *testing.T) {
+	list := []PortInfo{
+		{Port: 3000, PID: 2, User: "alice"},
+		{Port: 80, PID: 9, User: "alice"},
+		{Port: 3000, PID: 1, User: "alice"},
+	}
+
+	Sort(list, SortByUser, false)
+
+	if list[0].Port != 80 || list[1].PID != 1 || list[2].PID != 2 {
+		t.Errorf("ties should break by port then PID, got %+v", list)
+	}
+}
+
+func TestSortUnixSocketsLast(t *testing.T) {
+	list := []PortInfo{
+		{Proto: "unix", Address: "/run/php.sock", PID: 3},
+		{Port: 8080, PID: 2, Proto: "tcp"},
+		{Proto: "unix", Address: "/run/app.sock", PID: 4},
+		{Port: 80, PID: 1, Proto: "tcp"},
+	}
+
+	Sort(list, SortByPort, false)
+	want := []string{"port 80", "port 8080", "/run/app.sock", "/run/php.sock"}
+	for i, w := range want {
+		if got := list[i].Where(); got != w {
+			t.Errorf("Sort[%d] = %s, want %s", i, got, w)
+		}
+	}
+
+	Sort(list, SortByPort, true)
+	if list[0].Address != "/run/php.sock" || list[3].Port != 80 {
+		t.Errorf("reversed sort = %+v", list)
+	}
+}
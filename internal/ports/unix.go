@@ -0,0 +1,276 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Socket types, the __SO_ACCEPTCON flag and the connected state in
+// /proc/net/unix
+const (
+	unixStream     = "0001"
+	unixSeqpacket  = "0005"
+	unixAcceptConn = "00010000"
+	unixConnected  = "03"
+)
+
+// Unix reports whether p is a Unix domain socket listener, whose Address
+// is the socket path (an abstract socket's starts with @) and whose Port
+// is 0
+func (p PortInfo) Unix() bool {
+	return p.Proto == "unix"
+}
+
+// Where names what p listens on: "port 3000", or the path of a Unix
+// socket
+func (p PortInfo) Where() string {
+	if p.Unix() {
+		return p.Address
+	}
+	return fmt.Sprintf("port %d", p.Port)
+}
+
+// IsSocketFile reports whether path is a Unix socket file
+func IsSocketFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
+
+// SocketStale reports whether the socket file at path is stale: connecting
+// to it is refused because nothing listens on it. A scan cannot tell, as
+// it misses the listeners of other users, those that bound a relative
+// path and, for abstract sockets, those in other network namespaces. Any
+// other outcome, including a listener accepting, means it is not stale.
+func SocketStale(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// staleSearchDepth is how many directory levels below each directory
+// StaleSockets looks, enough for /run/php/php-fpm.sock
+const staleSearchDepth = 2
+
+// SocketDirs returns the directories services usually put their sockets
+// in: /run, /tmp, $XDG_RUNTIME_DIR and the working directory
+func SocketDirs() []string {
+	dirs := []string{"/run", "/tmp"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if dir, err := os.Getwd(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// StaleSockets returns the stale socket files (see SocketStale) in dirs
+// and up to staleSearchDepth levels below them, sorted. Sockets a listener
+// in listening is bound to are not checked. Unreadable directories are
+// skipped, and the search stops early when ctx is done.
+func StaleSockets(ctx context.Context, dirs []string, listening []PortInfo) []string {
+	bound := make(map[string]bool)
+	for _, p := range listening {
+		if p.Unix() {
+			bound[p.Address] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var stale []string
+	for _, root := range dirs {
+		root = filepath.Clean(root)
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return fs.SkipAll
+			}
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				if rel != "." && strings.Count(rel, string(filepath.Separator)) >= staleSearchDepth-1 {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSocket == 0 || seen[path] || bound[path] {
+				return nil
+			}
+			seen[path] = true
+			if SocketStale(path) {
+				stale = append(stale, path)
+			}
+			return nil
+		})
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// parseProcNetUnix parses the listening stream and seqpacket sockets in
+// /proc/net/unix that have a path, stopping with ctx.Err() once ctx is
+// done. Unnamed sockets cannot be told apart and are skipped.
+func parseProcNetUnix(ctx context.Context, path string) ([]PortInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	type socket struct{ inode, path string }
+	var sockets []socket
+	clients := make(map[string]int) // path to connected sockets accepted on it
+	scanner := bufio.NewScanner(file)
+
+	// Skip header line (Num RefCount Protocol Flags Type St Inode Path)
+	scanner.Scan()
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		if fields[4] != unixStream && fields[4] != unixSeqpacket {
+			continue
+		}
+		if fields[3] != unixAcceptConn {
+			// A socket accepted by a listener carries its path
+			if fields[5] == unixConnected {
+				if p := unixPath(line); p != "" {
+					clients[p]++
+				}
+			}
+			continue
+		}
+		sockets = append(sockets, socket{inode: fields[6], path: unixPath(line)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	inodes := make(map[string]bool, len(sockets))
+	for _, s := range sockets {
+		inodes[s.inode] = true
+	}
+	owners := findProcessesByInode(ctx, inodes)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ports []PortInfo
+	for _, s := range sockets {
+		pid, ok := owners[s.inode]
+		if !ok || s.path == "" {
+			continue
+		}
+		info := PortInfo{
+			PID:     pid,
+			Process: readComm(pid),
+			User:    processUser(pid),
+			Proto:   "unix",
+			Address: s.path,
+		}
+		for range clients[s.path] {
+			info.Connections = append(info.Connections, Connection{State: "CONNECTED"})
+		}
+		readProcDetails(&info)
+		ports = append(ports, info)
+	}
+	return ports, nil
+}
+
+// unixPath returns the path that ends a /proc/net/unix line, which may
+// contain spaces, or "" if the socket has none
+func unixPath(line string) string {
+	rest := line
+	for i := 0; i < 7; i++ {
+		rest = strings.TrimLeft(rest, " ")
+		j := strings.IndexByte(rest, ' ')
+		if j == -1 {
+			return ""
+		}
+		rest = rest[j:]
+	}
+	return strings.TrimPrefix(rest, " ")
+}
+
+// findProcessesByInode maps each socket inode in inodes to the first
+// process in /proc holding it, in a single walk that gives up when ctx is
+// done
+func findProcessesByInode(ctx context.Context, inodes map[string]bool) map[string]int {
+	owners := make(map[string]int)
+	if len(inodes) == 0 {
+		return owners
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil || len(owners) == len(inodes) {
+			break
+		}
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdPath := fmt.Sprintf("/proc/%d/fd", pid)
+		fds, err := os.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(fdPath + "/" + fd.Name())
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, seen := owners[inode]; inodes[inode] && !seen {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners
+}
+
+// readComm returns the short command name of pid, or "" if unreadable
+func readComm(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// processUser returns the name of the real user running pid, from the Uid
+// line of /proc/<pid>/status, or "" if unreadable
+func processUser(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				return getUsernameFromUID(fields[0])
+			}
+		}
+	}
+	return ""
+}
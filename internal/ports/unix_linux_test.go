@@ -0,0 +1,183 @@
+//go:build linux
+
+package ports
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseProcNetUnixWithMockData(t *testing.T) {
+	content := "Num       RefCount Protocol Flags    Type St Inode Path\n" +
+		"0000000000000000: 00000002 00000000 00010000 0001 01 12345 /run/app.sock\n" +
+		"0000000000000000: 00000002 00000000 00010000 0005 01 12346 /run/my app.sock\n" +
+		"0000000000000000: 00000003 00000000 00000000 0001 03 12347 /run/app.sock\n" +
+		"0000000000000000: 00000002 00000000 00010000 0002 01 12348 /run/dgram.sock\n" +
+		"0000000000000000: 00000002 00000000 00010000 0001 01 12349\n" +
+		"short line\n"
+	path := filepath.Join(t.TempDir(), "unix")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No process holds these inodes, so nothing is returned
+	list, err := parseProcNetUnix(context.Background(), path)
+	if err != nil {
+		t.Fatalf("parseProcNetUnix error: %v", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("parseProcNetUnix = %+v, want no listeners", list)
+	}
+}
+
+func TestUnixPath(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 12345 /run/app.sock", "/run/app.sock"},
+		{"0000000000000000: 00000002 00000000 00010000 0001 01   906 /run/my app.sock", "/run/my app.sock"},
+		{"0000000000000000: 00000002 00000000 00010000 0001 01 12345 @/tmp/.X11-unix/X0", "@/tmp/.X11-unix/X0"},
+		{"0000000000000000: 00000003 00000000 00000000 0001 03   906", ""},
+	}
+	for _, tt := range tests {
+		if got := unixPath(tt.line); got != tt.want {
+			t.Errorf("unixPath(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestScanUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsunami test.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	list, err := scanLinux(context.Background())
+	if err != nil {
+		t.Fatalf("scanLinux error: %v", err)
+	}
+	for _, p := range list {
+		if p.Address != path {
+			continue
+		}
+		if !p.Unix() || p.PID != os.Getpid() || p.Port != 0 || p.User == "" || p.Cmdline == "" {
+			t.Errorf("socket listener = %+v", p)
+		}
+		if p.Where() != path {
+			t.Errorf("Where = %q, want the path", p.Where())
+		}
+		if len(p.Connections) != 1 || p.Connections[0].State != "CONNECTED" {
+			t.Errorf("Connections = %+v, want one connected client", p.Connections)
+		}
+		if !IsSocketFile(path) {
+			t.Error("IsSocketFile = false for a listening socket")
+		}
+		return
+	}
+	t.Errorf("scan missed the socket %s", path)
+}
+
+func TestIsSocketFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "plain")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{file, dir, filepath.Join(dir, "missing")} {
+		if IsSocketFile(path) {
+			t.Errorf("IsSocketFile(%s) = true", path)
+		}
+	}
+}
+
+func TestSocketStale(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.sock")
+	ln, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	stale := filepath.Join(dir, "stale.sock")
+	closed, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.(*net.UnixListener).SetUnlinkOnClose(false)
+	closed.Close()
+
+	if SocketStale(live) {
+		t.Error("a socket with a listener is not stale")
+	}
+	if !SocketStale(stale) {
+		t.Error("a socket file nothing listens on is stale")
+	}
+	if SocketStale(filepath.Join(dir, "missing")) {
+		t.Error("a missing file is not a stale socket")
+	}
+}
+
+func TestStaleSockets(t *testing.T) {
+	// Unix socket paths are limited to ~100 bytes, shorter than some TempDirs
+	dir, err := os.MkdirTemp("", "tsstale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	staleAt := func(path string) {
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+	}
+	for _, sub := range []string{"php", "a/b"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staleAt(filepath.Join(dir, "app.sock"))
+	staleAt(filepath.Join(dir, "php", "fpm.sock"))
+	staleAt(filepath.Join(dir, "a", "b", "deep.sock")) // below the search depth
+	staleAt(filepath.Join(dir, "bound.sock"))
+
+	live := filepath.Join(dir, "live.sock")
+	ln, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	listening := []PortInfo{{Proto: "unix", Address: filepath.Join(dir, "bound.sock")}}
+	got := StaleSockets(context.Background(), []string{dir, dir}, listening)
+	want := []string{filepath.Join(dir, "app.sock"), filepath.Join(dir, "php", "fpm.sock")}
+	if !slices.Equal(got, want) {
+		t.Errorf("StaleSockets = %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := StaleSockets(ctx, []string{dir}, nil); len(got) != 0 {
+		t.Errorf("StaleSockets after cancel = %v, want none", got)
+	}
+}
@@ -0,0 +1,429 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the polling interval used when none is given
+const DefaultWatchInterval = 2 * time.Second
+
+// fullScanEvery forces a full scan after this many polls were skipped
+// because the kernel's listening sockets looked unchanged. An inherited
+// socket can change owner without the kernel's entry for it changing.
+const fullScanEvery = 10
+
+// EventKind says what happened to a listener
+type EventKind string
+
+const (
+	Opened       EventKind = "opened"        // a listener appeared
+	Closed       EventKind = "closed"        // a listener went away
+	OwnerChanged EventKind = "owner_changed" // another process took over the address
+	ScanFailed   EventKind = "error"         // a scan failed; Err is set
+
+	// ConnectionsChanged: the number of connections to a listener changed.
+	// Only sent when WatchOptions.Connections is set.
+	ConnectionsChanged EventKind = "connections_changed"
+)
+
+// ListenerKey identifies a listener across scans
+type ListenerKey struct {
+	Proto   string
+	Address string
+	Port    int
+	PID     int
+}
+
+// Key returns the identity of p's listener
+func (p PortInfo) Key() ListenerKey {
+	return ListenerKey{Proto: p.Proto, Address: p.Address, Port: p.Port, PID: p.PID}
+}
+
+// Event is a change in the set of listening sockets
+type Event struct {
+	Kind     EventKind
+	Time     time.Time
+	Listener PortInfo  // the listener that opened or closed, or the new owner
+	Previous *PortInfo // the old owner, for OwnerChanged
+	Err      error     // for ScanFailed
+}
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	Interval time.Duration // between scans; DefaultWatchInterval if zero
+	Debounce time.Duration // how long a change must last to be reported; 0 reports at once
+	Initial  bool          // report the listeners present at start as Opened
+
+	// Connections also reports ConnectionsChanged when connections to a
+	// listener open or close
+	Connections bool
+
+	// Scan lists the listeners; ScanContext if nil. A custom scanner can
+	// filter the listing or stand in for the system in tests. It is passed
+	// the context given to Watch.
+	Scan func(ctx context.Context) ([]PortInfo, error)
+}
+
+// Watch polls for listeners until ctx is done and sends an event for each
+// one that opens, closes or changes owner. The first scan happens before
+// Watch returns, and its error is returned; later scan errors are sent as
+// ScanFailed events. The channel is closed when ctx is done.
+//
+// On Linux a poll only rescans processes when the listening sockets in
+// /proc/net/tcp, /proc/net/tcp6 and /proc/net/unix have changed, or with
+// Connections the open connections too. procfs does not support inotify,
+// so polling is still needed.
+func Watch(ctx context.Context, opts WatchOptions) (<-chan Event, error) {
+	if opts.Interval < 0 {
+		return nil, fmt.Errorf("invalid watch interval: %s", opts.Interval)
+	}
+	if opts.Debounce < 0 {
+		return nil, fmt.Errorf("invalid watch debounce: %s", opts.Debounce)
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+
+	w := &watcher{
+		opts:     opts,
+		reported: make(map[ListenerKey]PortInfo),
+		pending:  make(map[ListenerKey]time.Time),
+	}
+	first, err := w.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range first {
+		w.reported[p.Key()] = p
+	}
+
+	events := make(chan Event, 64)
+	go func() {
+		defer close(events)
+		send := func(e Event) bool {
+			select {
+			case events <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if opts.Initial {
+			now := time.Now()
+			for _, p := range first {
+				if !send(Event{Kind: Opened, Time: now, Listener: p}) {
+					return
+				}
+			}
+		}
+
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			now := time.Now()
+			cur, err := w.scan(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if !send(Event{Kind: ScanFailed, Time: now, Err: err}) {
+					return
+				}
+				continue
+			}
+			for _, e := range w.update(cur, now) {
+				if !send(e) {
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// watcher tracks the listeners Watch has reported
+type watcher struct {
+	opts     WatchOptions
+	reported map[ListenerKey]PortInfo  // the state subscribers have been told about
+	pending  map[ListenerKey]time.Time // unreported changes and when they were first seen
+
+	// Last full scan and the socket fingerprint it was taken at
+	last        []PortInfo
+	fingerprint string
+	skipped     int
+}
+
+// scan lists the listeners, reusing the last scan when the kernel's
+// listening sockets are unchanged
+func (w *watcher) scan(ctx context.Context) ([]PortInfo, error) {
+	if w.opts.Scan != nil {
+		return w.opts.Scan(ctx)
+	}
+
+	fp, ok := listenFingerprint(ctx, w.opts.Connections)
+	if ok && w.fingerprint != "" && fp == w.fingerprint && w.skipped < fullScanEvery {
+		w.skipped++
+		return w.last, nil
+	}
+	cur, err := ScanContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.last, w.fingerprint, w.skipped = cur, fp, 0
+	return cur, nil
+}
+
+// update compares a scan with the reported state and returns the changes
+// that have lasted at least the debounce time, in port order
+func (w *watcher) update(cur []PortInfo, now time.Time) []Event {
+	present := make(map[ListenerKey]bool, len(cur))
+	changing := make(map[ListenerKey]bool)
+	var opened, closed, updated []PortInfo
+
+	for _, p := range cur {
+		k := p.Key()
+		present[k] = true
+		old, ok := w.reported[k]
+		if ok && SameProcess(old, p) {
+			w.reported[k] = p // keep details such as memory current
+			if w.opts.Connections && len(old.Connections) != len(p.Connections) {
+				updated = append(updated, p)
+			}
+			continue
+		}
+		changing[k] = true
+		if !w.settled(k, now) {
+			continue
+		}
+		if ok {
+			// A new process reused the PID; it replaces the old one
+			closed = append(closed, old)
+		}
+		opened = append(opened, p)
+	}
+	for k, p := range w.reported {
+		if present[k] {
+			continue
+		}
+		changing[k] = true
+		if w.settled(k, now) {
+			closed = append(closed, p)
+		}
+	}
+
+	// A change that reverted before it settled is forgotten
+	for k := range w.pending {
+		if !changing[k] {
+			delete(w.pending, k)
+		}
+	}
+	for _, p := range closed {
+		delete(w.reported, p.Key())
+		delete(w.pending, p.Key())
+	}
+	for _, p := range opened {
+		w.reported[p.Key()] = p
+		delete(w.pending, p.Key())
+	}
+
+	events := pairOwners(opened, closed, now)
+	for _, p := range updated {
+		events = append(events, Event{Kind: ConnectionsChanged, Time: now, Listener: p})
+	}
+	return events
+}
+
+// startTimeSlack is how far apart two start times of the same process may
+// be. Start times derived from elapsed time (ps on macOS) drift by a second.
+const startTimeSlack = 2 * time.Second
+
+// SameProcess reports whether a and b belong to the same process: the same
+// PID and, when both are known, the same start time. A different start
+// time means a new process reused the PID.
+func SameProcess(a, b PortInfo) bool {
+	if a.PID != b.PID {
+		return false
+	}
+	if a.StartTime.IsZero() || b.StartTime.IsZero() {
+		return true
+	}
+	d := a.StartTime.Sub(b.StartTime)
+	return d <= startTimeSlack && d >= -startTimeSlack
+}
+
+// Diff returns the changes from before to after as events without a time,
+// in the same form and order as Watch sends them
+func Diff(before, after []PortInfo) []Event {
+	w := &watcher{
+		reported: make(map[ListenerKey]PortInfo, len(before)),
+		pending:  make(map[ListenerKey]time.Time),
+	}
+	for _, p := range before {
+		w.reported[p.Key()] = p
+	}
+	return w.update(after, time.Time{})
+}
+
+// settled reports whether the change to k has lasted the debounce time,
+// starting its clock if it is new
+func (w *watcher) settled(k ListenerKey, now time.Time) bool {
+	if w.opts.Debounce == 0 {
+		return true
+	}
+	since, ok := w.pending[k]
+	if !ok {
+		w.pending[k] = now
+		return false
+	}
+	return now.Sub(since) >= w.opts.Debounce
+}
+
+// pairOwners turns a close and an open on the same address into a single
+// OwnerChanged event. Events are ordered by port, closes first.
+func pairOwners(opened, closed []PortInfo, now time.Time) []Event {
+	type address struct {
+		proto, addr string
+		port        int
+	}
+	addrOf := func(p PortInfo) address { return address{p.Proto, p.Address, p.Port} }
+	openCount := make(map[address]int)
+	closeCount := make(map[address]int)
+	for _, p := range opened {
+		openCount[addrOf(p)]++
+	}
+	for _, p := range closed {
+		closeCount[addrOf(p)]++
+	}
+	paired := func(p PortInfo) bool {
+		a := addrOf(p)
+		return openCount[a] == 1 && closeCount[a] == 1
+	}
+
+	var events []Event
+	previous := make(map[address]PortInfo)
+	for _, p := range closed {
+		if paired(p) {
+			previous[addrOf(p)] = p
+			continue
+		}
+		events = append(events, Event{Kind: Closed, Time: now, Listener: p})
+	}
+	for _, p := range opened {
+		if paired(p) {
+			prev := previous[addrOf(p)]
+			events = append(events, Event{Kind: OwnerChanged, Time: now, Listener: p, Previous: &prev})
+			continue
+		}
+		events = append(events, Event{Kind: Opened, Time: now, Listener: p})
+	}
+
+	rank := map[EventKind]int{Closed: 0, OwnerChanged: 1, Opened: 2}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].Listener, events[j].Listener
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if events[i].Kind != events[j].Kind {
+			return rank[events[i].Kind] < rank[events[j].Kind]
+		}
+		return a.PID < b.PID
+	})
+	return events
+}
+
+// listenFingerprint summarizes the kernel's listening TCP and Unix sockets
+// by address and inode, and with connections the open TCP connections and
+// connected Unix sockets. It is cheap compared to a scan, which has to
+// search every process for the socket inodes. TCP sockets come from a
+// socket diagnostics dump filtered by state in the kernel, falling back
+// to /proc/net/tcp where netlink is unavailable. ok is false where it is
+// not available.
+func listenFingerprint(ctx context.Context, connections bool) (fp string, ok bool) {
+	if runtime.GOOS != "linux" {
+		return "", false
+	}
+	var b strings.Builder
+	paths := []string{"/proc/net/tcp", "/proc/net/tcp6", "/proc/net/unix"}
+	if tcp, err := tcpFingerprint(ctx, connections); err == nil {
+		b.WriteString(tcp)
+		paths = paths[2:]
+	} else if ctx.Err() != nil {
+		return "", false
+	}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", false
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) >= 10 && fields[3] == "0A":
+				b.WriteString(fields[1])
+				b.WriteByte(' ')
+				b.WriteString(fields[9])
+			case len(fields) >= 8 && fields[3] == unixAcceptConn:
+				b.WriteString(unixPath(line))
+				b.WriteByte(' ')
+				b.WriteString(fields[6])
+			case connections && len(fields) >= 10 && tcpConnStates[fields[3]] != "":
+				b.WriteString(fields[1])
+				b.WriteByte(' ')
+				b.WriteString(fields[2])
+				b.WriteByte(' ')
+				b.WriteString(fields[3])
+			case connections && len(fields) >= 8 && fields[5] == unixConnected:
+				b.WriteString(fields[6])
+			default:
+				continue
+			}
+			b.WriteByte('\n')
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte('|')
+	}
+	return b.String(), true
+}
+
+// tcpFingerprint summarizes the listening TCP sockets, and with
+// connections the open connections, from a socket diagnostics dump
+func tcpFingerprint(ctx context.Context, connections bool) (string, error) {
+	states := uint32(1) << tcpListen
+	if connections {
+		states |= 1<<tcpEstablished | 1<<tcpCloseWait
+	}
+	sockets, err := dumpStates(ctx, states)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, 0, len(sockets))
+	for _, s := range sockets {
+		lines = append(lines, s.Proto+" "+s.Local+" "+s.Remote+" "+s.State+" "+s.inode)
+	}
+	// The dump follows the kernel's hash tables, not a stable order
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "|", nil
+}
@@ -0,0 +1,268 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	watchNode   = PortInfo{Port: 3000, PID: 100, Process: "node", Proto: "tcp", Address: "0.0.0.0"}
+	watchVite   = PortInfo{Port: 5173, PID: 200, Process: "vite", Proto: "tcp", Address: "127.0.0.1"}
+	watchNode2  = PortInfo{Port: 3000, PID: 101, Process: "node", Proto: "tcp", Address: "0.0.0.0"}
+	watchJava   = PortInfo{Port: 8080, PID: 300, Process: "java", Proto: "tcp6", Address: "::"}
+	watchJavaV4 = PortInfo{Port: 8080, PID: 300, Process: "java", Proto: "tcp", Address: "0.0.0.0"}
+)
+
+// describeEvents formats events as "opened 3000/100, ..."
+func describeEvents(events []Event) string {
+	var s []string
+	for _, e := range events {
+		d := fmt.Sprintf("%s %d/%d", e.Kind, e.Listener.Port, e.Listener.PID)
+		if e.Previous != nil {
+			d += fmt.Sprintf(" from %d", e.Previous.PID)
+		}
+		s = append(s, d)
+	}
+	return strings.Join(s, ", ")
+}
+
+func newTestWatcher(debounce time.Duration, initial ...PortInfo) *watcher {
+	w := &watcher{
+		opts:     WatchOptions{Debounce: debounce},
+		reported: make(map[ListenerKey]PortInfo),
+		pending:  make(map[ListenerKey]time.Time),
+	}
+	for _, p := range initial {
+		w.reported[p.Key()] = p
+	}
+	return w
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	tests := []struct {
+		name string
+		prev []PortInfo
+		cur  []PortInfo
+		want string
+	}{
+		{"no change", []PortInfo{watchNode}, []PortInfo{watchNode}, ""},
+		{"opened", []PortInfo{watchNode}, []PortInfo{watchNode, watchVite}, "opened 5173/200"},
+		{"closed", []PortInfo{watchNode, watchVite}, []PortInfo{watchVite}, "closed 3000/100"},
+		{"owner changed", []PortInfo{watchNode, watchVite}, []PortInfo{watchNode2, watchVite}, "owner_changed 3000/101 from 100"},
+		{"same port on another address is not an owner change",
+			[]PortInfo{watchJava}, []PortInfo{watchJavaV4}, "closed 8080/300, opened 8080/300"},
+		{"ordered by port, closes first",
+			[]PortInfo{watchJava, watchVite}, []PortInfo{watchNode, watchJavaV4}, "opened 3000/100, closed 5173/200, closed 8080/300, opened 8080/300"},
+		{"two new processes on a port are not an owner change",
+			[]PortInfo{watchNode}, []PortInfo{watchNode2, {Port: 3000, PID: 102, Proto: "tcp", Address: "0.0.0.0"}},
+			"closed 3000/100, opened 3000/101, opened 3000/102"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(0, tt.prev...)
+			got := describeEvents(w.update(tt.cur, time.Now()))
+			if got != tt.want {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			if again := w.update(tt.cur, time.Now()); len(again) != 0 {
+				t.Errorf("a repeated scan reported %s", describeEvents(again))
+			}
+		})
+	}
+}
+
+func TestWatcherConnections(t *testing.T) {
+	busy := watchNode
+	busy.Connections = []Connection{{Remote: "127.0.0.1:51000", State: "ESTABLISHED"}}
+
+	// Not reported unless asked for
+	w := newTestWatcher(0, watchNode)
+	if e := w.update([]PortInfo{busy}, time.Now()); len(e) != 0 {
+		t.Errorf("connection change reported without Connections: %s", describeEvents(e))
+	}
+
+	w = newTestWatcher(0, watchNode, watchVite)
+	w.opts.Connections = true
+	if got := describeEvents(w.update([]PortInfo{busy, watchVite}, time.Now())); got != "connections_changed 3000/100" {
+		t.Errorf("events = %q, want connections_changed 3000/100", got)
+	}
+	if e := w.update([]PortInfo{busy, watchVite}, time.Now()); len(e) != 0 {
+		t.Errorf("unchanged connections reported: %s", describeEvents(e))
+	}
+	if got := describeEvents(w.update([]PortInfo{watchNode}, time.Now())); got != "closed 5173/200, connections_changed 3000/100" {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	w := newTestWatcher(3*time.Second, watchNode)
+	start := time.Now()
+
+	// A listener that flaps is never reported
+	if e := w.update([]PortInfo{watchNode, watchVite}, start); len(e) != 0 {
+		t.Errorf("unsettled open reported: %s", describeEvents(e))
+	}
+	if e := w.update([]PortInfo{watchNode}, start.Add(time.Second)); len(e) != 0 {
+		t.Errorf("reverted open reported: %s", describeEvents(e))
+	}
+	if e := w.update([]PortInfo{watchNode, watchVite}, start.Add(2*time.Second)); len(e) != 0 {
+		t.Errorf("restarted open reported: %s", describeEvents(e))
+	}
+	if e := w.update([]PortInfo{watchNode, watchVite}, start.Add(4*time.Second)); len(e) != 0 {
+		t.Errorf("open reported after 2s of a 3s debounce: %s", describeEvents(e))
+	}
+	if got := describeEvents(w.update([]PortInfo{watchNode, watchVite}, start.Add(5*time.Second))); got != "opened 5173/200" {
+		t.Errorf("settled open = %q", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	scans := [][]PortInfo{
+		{watchNode},
+		{watchNode, watchVite},
+		{watchNode2, watchVite},
+	}
+	calls := 0
+	scan := func(context.Context) ([]PortInfo, error) {
+		if calls == len(scans) {
+			return nil, errors.New("boom")
+		}
+		calls++
+		return scans[calls-1], nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Watch(ctx, WatchOptions{Interval: time.Millisecond, Initial: true, Scan: scan})
+	if err != nil {
+		t.Fatalf("Watch error: %v", err)
+	}
+
+	var got []Event
+	for e := range events {
+		got = append(got, e)
+		if e.Kind == ScanFailed {
+			cancel()
+			break
+		}
+	}
+	want := "opened 3000/100, opened 5173/200, owner_changed 3000/101 from 100, error 0/0"
+	if describeEvents(got) != want {
+		t.Errorf("events = %q, want %q", describeEvents(got), want)
+	}
+	if err := got[len(got)-1].Err; err == nil || err.Error() != "boom" {
+		t.Errorf("scan error = %v", err)
+	}
+}
+
+func TestWatchClosesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	scan := func(context.Context) ([]PortInfo, error) { return []PortInfo{watchNode}, nil }
+	events, err := Watch(ctx, WatchOptions{Interval: time.Millisecond, Scan: scan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after cancel")
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	failing := func(context.Context) ([]PortInfo, error) { return nil, errors.New("boom") }
+	if _, err := Watch(context.Background(), WatchOptions{Scan: failing}); err == nil || err.Error() != "boom" {
+		t.Errorf("first scan error = %v, want boom", err)
+	}
+	if _, err := Watch(context.Background(), WatchOptions{Interval: -time.Second}); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+	if _, err := Watch(context.Background(), WatchOptions{Debounce: -time.Second}); err == nil {
+		t.Error("expected an error for a negative debounce")
+	}
+}
+
+func TestListenFingerprint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scan test in short mode")
+	}
+	before, ok := listenFingerprint(context.Background(), false)
+	if !ok {
+		t.Skip("listening sockets cannot be fingerprinted on this system")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	after, _ := listenFingerprint(context.Background(), false)
+	if after == before {
+		t.Error("fingerprint did not change when a listener opened")
+	}
+
+	sock, err := net.Listen("unix", filepath.Join(t.TempDir(), "watch.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sock.Close()
+	if got, _ := listenFingerprint(context.Background(), false); got == after {
+		t.Error("fingerprint did not change when a Unix socket listener opened")
+	}
+
+	idle, _ := listenFingerprint(context.Background(), true)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got, _ := listenFingerprint(context.Background(), true); got == idle {
+		t.Error("connection fingerprint did not change when a client connected")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	old := watchNode
+	old.StartTime = started
+	drifted := old
+	drifted.StartTime = started.Add(time.Second)
+	reused := old
+	reused.StartTime = started.Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		before, after []PortInfo
+		want          string
+	}{
+		{"unchanged", []PortInfo{old}, []PortInfo{old}, ""},
+		{"start time drift is the same process", []PortInfo{old}, []PortInfo{drifted}, ""},
+		{"unknown start time is the same process", []PortInfo{old}, []PortInfo{watchNode}, ""},
+		{"reused PID is a new owner", []PortInfo{old}, []PortInfo{reused}, "owner_changed 3000/100 from 100"},
+		{"added and removed", []PortInfo{watchVite}, []PortInfo{watchNode}, "opened 3000/100, closed 5173/200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := Diff(tt.before, tt.after)
+			if got := describeEvents(events); got != tt.want {
+				t.Errorf("Diff = %q, want %q", got, tt.want)
+			}
+			for _, e := range events {
+				if !e.Time.IsZero() {
+					t.Errorf("event time = %v, want zero", e.Time)
+				}
+			}
+		})
+	}
+}
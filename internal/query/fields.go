@@ -0,0 +1,239 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// fieldKind determines which operators a field supports and how values
+// are parsed
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindNumber
+	kindDuration
+)
+
+// field describes a queryable PortInfo attribute
+type field struct {
+	name    string
+	aliases []string
+	kind    fieldKind
+	str     func(ports.PortInfo) string
+	num     func(ports.PortInfo) (int64, bool)
+}
+
+// fields lists every queryable field in the order shown in error messages
+var fields = []field{
+	{name: "port", kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) { return int64(p.Port), !p.Unix() }},
+	{name: "pid", kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) { return int64(p.PID), true }},
+	{name: "conns", aliases: []string{"connections"}, kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) { return int64(len(p.Connections)), true }},
+	{name: "cpu", kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) {
+			return int64(math.Round(p.CPU)), !p.StartTime.IsZero() || p.CPU > 0
+		}},
+	{name: "threads", kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) { return int64(p.Threads), p.Threads > 0 }},
+	{name: "fds", kind: kindNumber,
+		num: func(p ports.PortInfo) (int64, bool) { return int64(p.FDs), p.FDs > 0 }},
+	{name: "proc", aliases: []string{"process"}, kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Process }},
+	{name: "user", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.User }},
+	{name: "proto", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Proto }},
+	{name: "addr", aliases: []string{"address"}, kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Address }},
+	{name: "cmd", aliases: []string{"cmdline", "command"}, kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Cmdline }},
+	{name: "cwd", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Cwd }},
+	{name: "container", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return ""
+			}
+			if p.Container.Name == "" {
+				return p.Container.ID
+			}
+			return p.Container.Name
+		}},
+	{name: "image", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return ""
+			}
+			return p.Container.Image
+		}},
+	{name: "runtime", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return ""
+			}
+			return p.Container.Runtime
+		}},
+	{name: "pod", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Container == nil {
+				return ""
+			}
+			return p.Container.Pod
+		}},
+	{name: "slice", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Slice }},
+	{name: "unit", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Unit == nil {
+				return ""
+			}
+			return p.Unit.Name
+		}},
+	{name: "restart", kind: kindString,
+		str: func(p ports.PortInfo) string {
+			if p.Unit == nil {
+				return ""
+			}
+			return p.Unit.Restart
+		}},
+	{name: "netns", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Netns }},
+	{name: "label", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Label() }},
+	{name: "app", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.App }},
+	{name: "project", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.Project }},
+	{name: "state", kind: kindString,
+		str: func(p ports.PortInfo) string { return p.State }},
+	{name: "age", kind: kindDuration,
+		num: func(p ports.PortInfo) (int64, bool) {
+			if p.StartTime.IsZero() {
+				return 0, false
+			}
+			return int64(p.Uptime()), true
+		}},
+}
+
+// lookupField finds a field by name or alias (case-insensitive)
+func lookupField(name string) (field, bool) {
+	name = strings.ToLower(name)
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+		for _, a := range f.aliases {
+			if a == name {
+				return f, true
+			}
+		}
+	}
+	return field{}, false
+}
+
+// fieldNames returns the canonical name of every field
+func fieldNames() []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// suggestField returns a ` (did you mean "x"?)` hint for a mistyped field
+// name, or "" if nothing is close
+func suggestField(name string) string {
+	name = strings.ToLower(name)
+	best, bestDist := "", 3
+	for _, f := range fields {
+		for _, candidate := range append([]string{f.name}, f.aliases...) {
+			if d := editDistance(name, candidate); d < bestDist {
+				best, bestDist = f.name, d
+			}
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// parseNumber parses a value for a numeric or duration field
+func parseNumber(kind fieldKind, s string) (int64, error) {
+	if kind == kindDuration {
+		d, err := ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		return int64(d), nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
+
+// ParseDuration parses a Go duration, additionally accepting d (days) and
+// w (weeks) units, e.g. "2d", "1w3d", "1d12h"
+func ParseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i >= len(rest) || (rest[i] != 'd' && rest[i] != 'w') {
+			break
+		}
+		n, _ := strconv.Atoi(rest[:i])
+		unit := 24 * time.Hour
+		if rest[i] == 'w' {
+			unit *= 7
+		}
+		total += time.Duration(n) * unit
+		rest = rest[i+1:]
+	}
+
+	if rest == "" {
+		if s == "" {
+			return 0, fmt.Errorf("empty duration")
+		}
+		return total, nil
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration (e.g. 30s, 5m, 2h, 1d)", s)
+	}
+	return total + d, nil
+}
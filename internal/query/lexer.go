@@ -0,0 +1,224 @@
+package query
+
+import (
+	"strings"
+)
+
+// tokenKind identifies a lexical token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokTerm // field op value
+	tokWord // bare word
+)
+
+// token is a lexical token with its byte offset into the input
+type token struct {
+	kind  tokenKind
+	pos   int
+	text  string // raw source text
+	field string // tokTerm only
+	op    string // tokTerm only
+	value string // tokTerm and tokWord
+	vpos  int    // tokTerm only: offset of the value
+}
+
+// operators in the order they must be tried, longest first
+var operators = []string{">=", "<=", "!=", "!~", "=", ">", "<", ":", "~"}
+
+// lex splits input into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for {
+		for i < len(input) && isSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			tokens = append(tokens, token{kind: tokEOF, pos: i})
+			return tokens, nil
+		}
+
+		start := i
+		switch {
+		case input[i] == '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: i, text: "("})
+			i++
+			continue
+		case input[i] == ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: i, text: ")"})
+			i++
+			continue
+		case strings.HasPrefix(input[i:], "&&"):
+			tokens = append(tokens, token{kind: tokAnd, pos: i, text: "&&"})
+			i += 2
+			continue
+		case strings.HasPrefix(input[i:], "||"):
+			tokens = append(tokens, token{kind: tokOr, pos: i, text: "||"})
+			i += 2
+			continue
+		case input[i] == '!':
+			tokens = append(tokens, token{kind: tokNot, pos: i, text: "!"})
+			i++
+			continue
+		case input[i] == '"':
+			value, end, err := readQuoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokWord, pos: start, text: input[start:end], value: value})
+			i = end
+			continue
+		}
+
+		// field op value
+		if tok, end, ok, err := readTerm(input, i); err != nil {
+			return nil, err
+		} else if ok {
+			tokens = append(tokens, tok)
+			i = end
+			continue
+		}
+
+		// Bare word or keyword
+		for i < len(input) && !isSpace(input[i]) && input[i] != '(' && input[i] != ')' {
+			i++
+		}
+		word := input[start:i]
+		switch strings.ToLower(word) {
+		case "and":
+			tokens = append(tokens, token{kind: tokAnd, pos: start, text: word})
+		case "or":
+			tokens = append(tokens, token{kind: tokOr, pos: start, text: word})
+		case "not":
+			tokens = append(tokens, token{kind: tokNot, pos: start, text: word})
+		default:
+			tokens = append(tokens, token{kind: tokWord, pos: start, text: word, value: word})
+		}
+	}
+}
+
+// readTerm tries to read `field op value` starting at i. It reports ok=false
+// if the input there is not a term, so it can be read as a bare word.
+func readTerm(input string, i int) (token, int, bool, error) {
+	start := i
+	for i < len(input) && isFieldChar(input[i]) {
+		i++
+	}
+	if i == start {
+		return token{}, 0, false, nil
+	}
+	name := input[start:i]
+
+	var op string
+	for _, o := range operators {
+		if strings.HasPrefix(input[i:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return token{}, 0, false, nil
+	}
+
+	f, known := lookupField(name)
+	if !known {
+		// "host:port" style words stay searchable as bare words
+		if op == ":" {
+			return token{}, 0, false, nil
+		}
+		return token{}, 0, false, errorf(input, start, "unknown field %q%s (valid: %s)",
+			name, suggestField(name), strings.Join(fieldNames(), ", "))
+	}
+	i += len(op)
+	vpos := i
+
+	var value string
+	switch {
+	case i < len(input) && input[i] == '"':
+		v, end, err := readQuoted(input, i)
+		if err != nil {
+			return token{}, 0, false, err
+		}
+		value, i = v, end
+	case i < len(input) && input[i] == '/' && (op == "~" || op == "!~"):
+		v, end, err := readRegex(input, i)
+		if err != nil {
+			return token{}, 0, false, err
+		}
+		value, i = v, end
+	default:
+		vstart := i
+		for i < len(input) && !isSpace(input[i]) && input[i] != '(' && input[i] != ')' {
+			i++
+		}
+		value = input[vstart:i]
+	}
+
+	if value == "" {
+		return token{}, 0, false, errorf(input, i, "missing value after %s%s", name, op)
+	}
+
+	return token{
+		kind:  tokTerm,
+		pos:   start,
+		text:  input[start:i],
+		field: f.name,
+		op:    op,
+		value: value,
+		vpos:  vpos,
+	}, i, true, nil
+}
+
+// readQuoted reads a double-quoted string starting at i, handling \" and \\
+func readQuoted(input string, i int) (string, int, error) {
+	var b strings.Builder
+	for j := i + 1; j < len(input); j++ {
+		switch input[j] {
+		case '\\':
+			if j+1 < len(input) {
+				j++
+				b.WriteByte(input[j])
+			}
+		case '"':
+			return b.String(), j + 1, nil
+		default:
+			b.WriteByte(input[j])
+		}
+	}
+	return "", 0, errorf(input, i, "unterminated quoted string")
+}
+
+// readRegex reads a /slash-delimited/ regex starting at i. A \/ inside the
+// regex is an escaped slash; every other escape is passed through.
+func readRegex(input string, i int) (string, int, error) {
+	var b strings.Builder
+	for j := i + 1; j < len(input); j++ {
+		switch {
+		case input[j] == '\\' && j+1 < len(input) && input[j+1] == '/':
+			b.WriteByte('/')
+			j++
+		case input[j] == '/':
+			return b.String(), j + 1, nil
+		default:
+			b.WriteByte(input[j])
+		}
+	}
+	return "", 0, errorf(input, i, "unterminated regex, expected closing /")
+}
+
+// isFieldChar reports whether c can appear in a field name
+func isFieldChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isSpace reports whether c separates tokens
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
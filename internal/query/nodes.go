@@ -0,0 +1,165 @@
+package query
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// node is an evaluable expression
+type node interface {
+	eval(p ports.PortInfo, matchWord WordMatcher) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(p ports.PortInfo, w WordMatcher) bool {
+	return n.left.eval(p, w) && n.right.eval(p, w)
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(p ports.PortInfo, w WordMatcher) bool {
+	return n.left.eval(p, w) || n.right.eval(p, w)
+}
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(p ports.PortInfo, w WordMatcher) bool {
+	return !n.inner.eval(p, w)
+}
+
+type wordNode struct{ word string }
+
+func (n wordNode) eval(p ports.PortInfo, w WordMatcher) bool {
+	return w(p, n.word)
+}
+
+// numRange is an inclusive range of numeric values
+type numRange struct{ lo, hi int64 }
+
+// termNode is a compiled field comparison
+type termNode struct {
+	field field
+	op    string
+
+	// Numeric and duration fields
+	num    int64
+	ranges []numRange
+
+	// Text fields
+	text string
+	re   *regexp.Regexp
+}
+
+// newTermNode validates a field comparison and compiles its value
+func newTermNode(input string, tok token) (node, error) {
+	f, _ := lookupField(tok.field)
+	n := termNode{field: f, op: tok.op}
+	valuePos := tok.vpos
+
+	if f.kind == kindString {
+		switch tok.op {
+		case "=", "!=", ":":
+			n.text = strings.ToLower(tok.value)
+		case "~", "!~":
+			re, err := regexp.Compile("(?i)" + tok.value)
+			if err != nil {
+				return nil, errorf(input, valuePos, "invalid regex for %s: %v", f.name, err)
+			}
+			n.re = re
+		default:
+			return nil, errorf(input, tok.pos, "operator %s is not supported for text field %s (use =, !=, :, ~ or !~)",
+				tok.op, f.name)
+		}
+		return n, nil
+	}
+
+	switch tok.op {
+	case "=", "!=", ">", ">=", "<", "<=":
+		v, err := parseNumber(f.kind, tok.value)
+		if err != nil {
+			return nil, errorf(input, valuePos, "invalid %s value: %v", f.name, err)
+		}
+		n.num = v
+	case ":":
+		for _, part := range strings.Split(tok.value, ",") {
+			r, err := parseRange(f.kind, part)
+			if err != nil {
+				return nil, errorf(input, valuePos, "invalid %s range %q: %v", f.name, part, err)
+			}
+			n.ranges = append(n.ranges, r)
+		}
+	default:
+		return nil, errorf(input, tok.pos, "operator %s is not supported for %s (use =, !=, <, <=, >, >= or :)",
+			tok.op, f.name)
+	}
+	return n, nil
+}
+
+// parseRange parses "N" or "N-M"
+func parseRange(kind fieldKind, s string) (numRange, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	from, err := parseNumber(kind, lo)
+	if err != nil {
+		return numRange{}, err
+	}
+	if !isRange {
+		return numRange{from, from}, nil
+	}
+	to, err := parseNumber(kind, hi)
+	if err != nil {
+		return numRange{}, err
+	}
+	if from > to {
+		return numRange{}, errors.New("start is greater than end")
+	}
+	return numRange{from, to}, nil
+}
+
+func (n termNode) eval(p ports.PortInfo, _ WordMatcher) bool {
+	if n.field.kind == kindString {
+		value := n.field.str(p)
+		switch n.op {
+		case "=":
+			return strings.ToLower(value) == n.text
+		case "!=":
+			return strings.ToLower(value) != n.text
+		case ":":
+			return strings.Contains(strings.ToLower(value), n.text)
+		case "~":
+			return n.re.MatchString(value)
+		case "!~":
+			return !n.re.MatchString(value)
+		}
+		return false
+	}
+
+	value, known := n.field.num(p)
+	if !known {
+		return false
+	}
+	switch n.op {
+	case "=":
+		return value == n.num
+	case "!=":
+		return value != n.num
+	case ">":
+		return value > n.num
+	case ">=":
+		return value >= n.num
+	case "<":
+		return value < n.num
+	case "<=":
+		return value <= n.num
+	case ":":
+		for _, r := range n.ranges {
+			if value >= r.lo && value <= r.hi {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Package query implements the filter expression language shared by
+// `--filter`, kill-by-filter targeting and the TUI filter bar.
+//
+// A query is a sequence of terms combined with and/or/not and parentheses;
+// adjacent terms are implicitly and-ed. A term is either a bare word,
+// matched as a case-insensitive substring of the process name, user,
+// command line, label or port, or a field comparison:
+//
+//	port=3000  port>=3000  port:3000-3999  port:80,443
+//	proc=node  user!=root  cmd:vite  cmd~/vite|next/  cwd!~^/tmp
+//	age>1h  age<5m  age:1h-2d  container=db  image:postgres  runtime=podman
+//	unit=nginx.service  restart!=no  app=vite  project:acme
+//
+// Fields are port, pid, conns, cpu, threads, fds, proc, user, proto, addr,
+// cmd, cwd, container (name, or ID if unnamed), image, runtime, pod, slice,
+// unit, restart, netns, label, app, project, state and age.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// Error describes an invalid query, with the byte offset where it went wrong
+type Error struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+// Error returns the message with its position in the query
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// Caret returns the query with a ^ marker line under the error position
+func (e *Error) Caret() string {
+	return e.Input + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
+
+// errorf creates an *Error at pos
+func errorf(input string, pos int, format string, args ...any) error {
+	return &Error{Input: input, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// WordMatcher decides whether a bare word matches an entry
+type WordMatcher func(p ports.PortInfo, word string) bool
+
+// Query is a parsed filter expression
+type Query struct {
+	source string
+	root   node // nil for an empty query
+	words  []string
+
+	// MatchWord, if set, replaces the default substring matching of bare words
+	MatchWord WordMatcher
+}
+
+// Parse parses a query. An empty query matches everything.
+func Parse(input string) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{input: input, tokens: tokens}
+	q := &Query{source: input}
+	if p.peek().kind == tokEOF {
+		return q, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, errorf(input, tok.pos, "unexpected ) without matching (")
+		}
+		return nil, errorf(input, tok.pos, "unexpected %q", tok.text)
+	}
+
+	q.root = root
+	q.words = p.words
+	return q, nil
+}
+
+// MustParse is like Parse but panics on error. Intended for tests and
+// package-level queries.
+func MustParse(input string) *Query {
+	q, err := Parse(input)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the query source
+func (q *Query) String() string {
+	return q.source
+}
+
+// Empty reports whether the query has no terms and so matches everything
+func (q *Query) Empty() bool {
+	return q.root == nil
+}
+
+// Words returns the bare words that must be present for a match, i.e.
+// those not under a negation. Callers use them for highlighting.
+func (q *Query) Words() []string {
+	return q.words
+}
+
+// Match reports whether p satisfies the query
+func (q *Query) Match(p ports.PortInfo) bool {
+	if q.root == nil {
+		return true
+	}
+	matchWord := q.MatchWord
+	if matchWord == nil {
+		matchWord = MatchWordSubstring
+	}
+	return q.root.eval(p, matchWord)
+}
+
+// Filter returns the entries of portList that satisfy the query
+func (q *Query) Filter(portList []ports.PortInfo) []ports.PortInfo {
+	var result []ports.PortInfo
+	for _, p := range portList {
+		if q.Match(p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// MatchWordSubstring is the default bare word matcher: a case-insensitive
+// substring of the process name, user, command line, label, and port or Unix
+// socket path
+func MatchWordSubstring(p ports.PortInfo, word string) bool {
+	word = strings.ToLower(word)
+	where := strconv.Itoa(p.Port)
+	if p.Unix() {
+		where = strings.ToLower(p.Address)
+	}
+	return strings.Contains(strings.ToLower(p.Process), word) ||
+		strings.Contains(strings.ToLower(p.User), word) ||
+		strings.Contains(strings.ToLower(p.Cmdline), word) ||
+		strings.Contains(strings.ToLower(p.Label()), word) ||
+		strings.Contains(where, word)
+}
+
+// parser is a recursive descent parser over lexed tokens:
+//
+//	or    := and { ("or" | "||") and }
+//	and   := unary { ["and" | "&&"] unary }
+//	unary := ("not" | "!") unary | "(" or ")" | term | word
+type parser struct {
+	input   string
+	tokens  []token
+	pos     int
+	negated int // depth of enclosing negations
+	words   []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.parseOperand(op)
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			op := p.next()
+			right, err := p.parseOperand(op)
+			if err != nil {
+				return nil, err
+			}
+			left = andNode{left, right}
+		case tokNot, tokLParen, tokTerm, tokWord:
+			// Implicit and
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			left = andNode{left, right}
+		default:
+			return left, nil
+		}
+	}
+}
+
+// parseOperand parses the right-hand side of a binary operator, with an
+// error that names the operator if it is missing
+func (p *parser) parseOperand(op token) (node, error) {
+	switch p.peek().kind {
+	case tokEOF, tokRParen, tokAnd, tokOr:
+		return nil, errorf(p.input, op.pos, "expected a term after %q", op.text)
+	}
+	if op.kind == tokOr {
+		return p.parseAnd()
+	}
+	return p.parseUnary()
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNot:
+		switch p.peek().kind {
+		case tokEOF, tokRParen, tokAnd, tokOr:
+			return nil, errorf(p.input, tok.pos, "expected a term after %q", tok.text)
+		}
+		p.negated++
+		inner, err := p.parseUnary()
+		p.negated--
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, errorf(p.input, tok.pos, "empty parentheses")
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, errorf(p.input, tok.pos, "unclosed (")
+		}
+		p.next()
+		return inner, nil
+
+	case tokTerm:
+		return newTermNode(p.input, tok)
+
+	case tokWord:
+		if p.negated%2 == 0 {
+			p.words = append(p.words, tok.value)
+		}
+		return wordNode{tok.value}, nil
+
+	case tokRParen:
+		return nil, errorf(p.input, tok.pos, "unexpected ) without matching (")
+
+	case tokEOF:
+		return nil, errorf(p.input, tok.pos, "unexpected end of query")
+
+	default:
+		return nil, errorf(p.input, tok.pos, "expected a term before %q", tok.text)
+	}
+}
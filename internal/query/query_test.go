@@ -0,0 +1,381 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var testPorts = []ports.PortInfo{
+	{Port: 22, PID: 1, Process: "sshd", User: "root", Proto: "tcp", Address: "0.0.0.0",
+		Cmdline: "/usr/sbin/sshd -D", Cwd: "/", Unit: &ports.Unit{Name: "ssh.service", Restart: "on-failure"}, StartTime: time.Now().Add(-48 * time.Hour)},
+	{Port: 3000, PID: 100, Process: "node", User: "alice", Proto: "tcp", Address: "127.0.0.1",
+		Cmdline: "node server.js", Cwd: "/home/alice/api", Slice: "user-1000.slice", StartTime: time.Now().Add(-2 * time.Hour)},
+	{Port: 5173, PID: 200, Process: "node", User: "alice", Proto: "tcp6", Address: "::1",
+		Cmdline: "node node_modules/.bin/vite", Cwd: "/home/alice/web", StartTime: time.Now().Add(-5 * time.Minute)},
+	{Port: 5432, PID: 300, Process: "postgres", User: "postgres", Proto: "tcp", Address: "127.0.0.1",
+		Cmdline: "/usr/lib/postgresql/16/bin/postgres", Cwd: "/var/lib/postgresql",
+		Container: &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b", Name: "db", Image: "postgres:16"}},
+	{Port: 8080, PID: 400, Process: "java", User: "ci", Proto: "tcp6", Address: "::",
+		Cmdline: "java -jar app.jar", Cwd: "/srv/app", StartTime: time.Now().Add(-30 * time.Second),
+		Slice:     "kubepods-pod0d3c6f2a_7b1e.slice",
+		Netns:     "net:[4026532301]",
+		Container: &ports.Container{Runtime: "cri-o", ID: "9a8b7c6d5e4f", Pod: "0d3c6f2a-7b1e"}},
+}
+
+// matchPorts returns the ports of the entries matching query
+func matchPorts(t *testing.T, query string) []int {
+	t.Helper()
+	q, err := Parse(query)
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", query, err)
+	}
+	var result []int
+	for _, p := range q.Filter(testPorts) {
+		result = append(result, p.Port)
+	}
+	return result
+}
+
+func TestQueryMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{22, 3000, 5173, 5432, 8080}},
+		{"node", []int{3000, 5173}},
+		{"NODE", []int{3000, 5173}},
+		{"vite", []int{5173}},
+		{"543", []int{5432}},
+		{"port=3000", []int{3000}},
+		{"port!=3000", []int{22, 5173, 5432, 8080}},
+		{"port>=5000", []int{5173, 5432, 8080}},
+		{"port>5432", []int{8080}},
+		{"port<1024", []int{22}},
+		{"port<=3000", []int{22, 3000}},
+		{"port:3000-5999", []int{3000, 5173, 5432}},
+		{"port:22,8080", []int{22, 8080}},
+		{"port:22,5000-5500", []int{22, 5173, 5432}},
+		{"pid=300", []int{5432}},
+		{"proc=node", []int{3000, 5173}},
+		{"process=POSTGRES", []int{5432}},
+		{"proc:post", []int{5432}},
+		{"user=alice", []int{3000, 5173}},
+		{"user!=root", []int{3000, 5173, 5432, 8080}},
+		{"proto=tcp6", []int{5173, 8080}},
+		{"addr=127.0.0.1", []int{3000, 5432}},
+		{"addr:\"::\"", []int{5173, 8080}},
+		{"cmd~/vite/", []int{5173}},
+		{"cmd~/vite|jar/", []int{5173, 8080}},
+		{"cmd~^node", []int{3000, 5173}},
+		{"cmd!~/node/", []int{22, 5432, 8080}},
+		{`cmd~/\/bin\//`, []int{5432}},
+		{"cwd:/home/alice", []int{3000, 5173}},
+		{"container=db", []int{5432}},
+		{"image:postgres", []int{5432}},
+		{"container!=db and port>5000", []int{5173, 8080}},
+		{"container:9a8b", []int{8080}},
+		{"runtime=docker", []int{5432}},
+		{"runtime:cri or runtime=docker", []int{5432, 8080}},
+		{"pod:0d3c", []int{8080}},
+		{"slice=user-1000.slice", []int{3000}},
+		{"slice:kubepods", []int{8080}},
+		{"unit=ssh.service", []int{22}},
+		{"restart!=no and restart:fail", []int{22}},
+		{"netns:4026532301", []int{8080}},
+		{"not netns:net", []int{22, 3000, 5173, 5432}},
+		{"age>1h", []int{22, 3000}},
+		{"age<10m", []int{5173, 8080}},
+		{"age>1d", []int{22}},
+		{"age:1m-3h", []int{3000, 5173}},
+		{"node port>4000", []int{5173}},
+		{"node and port>4000", []int{5173}},
+		{"node && port>4000", []int{5173}},
+		{"proc=sshd or proc=java", []int{22, 8080}},
+		{"proc=sshd || proc=java", []int{22, 8080}},
+		{"not node", []int{22, 5432, 8080}},
+		{"!node", []int{22, 5432, 8080}},
+		{"NOT user=alice", []int{22, 5432, 8080}},
+		{"user=alice and not vite", []int{3000}},
+		{"(proc=sshd or proc=java) and proto=tcp6", []int{8080}},
+		{"proc=sshd or proc=java and proto=tcp6", []int{22, 8080}},
+		{"!(port<1024 or user=ci)", []int{3000, 5173, 5432}},
+		{`"server.js"`, []int{3000}},
+		{"localhost:3000", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := matchPorts(t, tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query %q matched %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryUnixSockets(t *testing.T) {
+	sock := ports.PortInfo{PID: 500, Process: "php-fpm", User: "www-data", Proto: "unix", Address: "/run/php/php-fpm.sock"}
+	tests := map[string]bool{
+		"proto=unix":          true,
+		"addr:php-fpm.sock":   true,
+		"fpm.sock":            true,
+		"port<1024":           false,
+		"port!=3000":          false,
+		"0":                   false,
+		"not proto=unix":      false,
+		"proc=php-fpm port>0": false,
+	}
+	for query, want := range tests {
+		if got := MustParse(query).Match(sock); got != want {
+			t.Errorf("%q matches socket = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestQueryConns(t *testing.T) {
+	busy := ports.PortInfo{Port: 5432, Process: "postgres", Proto: "tcp",
+		Connections: []ports.Connection{{Remote: "10.0.0.5:51234", State: "ESTABLISHED"}, {Remote: "10.0.0.6:40000", State: "CLOSE_WAIT"}}}
+	idle := ports.PortInfo{Port: 3000, Process: "node", Proto: "tcp"}
+	tests := []struct {
+		query      string
+		busy, idle bool
+	}{
+		{"conns=0", false, true},
+		{"conns>0", true, false},
+		{"connections>=2", true, false},
+		{"conns:1-5", true, false},
+	}
+	for _, tt := range tests {
+		q := MustParse(tt.query)
+		if got := q.Match(busy); got != tt.busy {
+			t.Errorf("%q matches busy listener = %v, want %v", tt.query, got, tt.busy)
+		}
+		if got := q.Match(idle); got != tt.idle {
+			t.Errorf("%q matches idle listener = %v, want %v", tt.query, got, tt.idle)
+		}
+	}
+}
+
+func TestQueryLabels(t *testing.T) {
+	vite := ports.PortInfo{Port: 5173, Process: "node", App: "vite", Project: "acme-web"}
+	api := ports.PortInfo{Port: 3000, Process: "node", Project: "acme-api"}
+	tests := []struct {
+		query     string
+		vite, api bool
+	}{
+		{"vite", true, false},
+		{"acme", true, true},
+		{"label=\"vite · acme-web\"", true, false},
+		{"label:\"node · acme\"", false, true},
+		{"app=vite", true, false},
+		{"project:acme", true, true},
+		{"project=acme-api", false, true},
+	}
+	for _, tt := range tests {
+		q := MustParse(tt.query)
+		if got := q.Match(vite); got != tt.vite {
+			t.Errorf("%q matches vite = %v, want %v", tt.query, got, tt.vite)
+		}
+		if got := q.Match(api); got != tt.api {
+			t.Errorf("%q matches api = %v, want %v", tt.query, got, tt.api)
+		}
+	}
+}
+
+func TestQueryResources(t *testing.T) {
+	busy := ports.PortInfo{Port: 8080, Process: "java", StartTime: time.Now().Add(-time.Hour), CPU: 87.6, Threads: 64, FDs: 900, State: "R"}
+	zombie := ports.PortInfo{Port: 3000, Process: "node", State: "Z"}
+	tests := []struct {
+		query        string
+		busy, zombie bool
+	}{
+		{"cpu>50", true, false},
+		{"cpu=88", true, false},
+		{"cpu<1", false, false}, // unknown CPU matches no comparison
+		{"threads>=64 fds>500", true, false},
+		{"state=Z", false, true},
+		{"state!=Z", true, false},
+	}
+	for _, tt := range tests {
+		q := MustParse(tt.query)
+		if got := q.Match(busy); got != tt.busy {
+			t.Errorf("%q matches busy listener = %v, want %v", tt.query, got, tt.busy)
+		}
+		if got := q.Match(zombie); got != tt.zombie {
+			t.Errorf("%q matches zombie listener = %v, want %v", tt.query, got, tt.zombie)
+		}
+	}
+}
+
+func TestQueryAgeUnknown(t *testing.T) {
+	// postgres has no start time, so no age comparison matches it
+	for _, query := range []string{"age>0s", "age<100d", "age!=1s"} {
+		for _, port := range matchPorts(t, query) {
+			if port == 5432 {
+				t.Errorf("query %q should not match an entry with unknown age", query)
+			}
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		contains string
+		pos      int
+	}{
+		{"protoc=tcp", `unknown field "protoc" (did you mean "proto"?)`, 0},
+		{"node colour=red", `unknown field "colour"`, 5},
+		{"port>=", "missing value after port>=", 6},
+		{"port=abc", `invalid port value: "abc" is not a number`, 5},
+		{"port:5000-3000", "start is greater than end", 5},
+		{"port:3000-x", `"x" is not a number`, 5},
+		{"age>soon", "is not a duration", 4},
+		{"user>bob", "operator > is not supported for text field user", 0},
+		{"port~80", "operator ~ is not supported for port", 0},
+		{"cmd~/[/", "invalid regex for cmd", 4},
+		{"cmd~/vite", "unterminated regex", 4},
+		{`"server`, "unterminated quoted string", 0},
+		{"(node", "unclosed (", 0},
+		{"node)", "unexpected ) without matching (", 4},
+		{"()", "empty parentheses", 0},
+		{"node and", `expected a term after "and"`, 5},
+		{"node or", `expected a term after "or"`, 5},
+		{"not", `expected a term after "not"`, 0},
+		{"and node", `expected a term before "and"`, 0},
+		{"node or or vite", `expected a term after "or"`, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			if err == nil {
+				t.Fatalf("Parse(%q) should fail", tt.query)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.query, err, tt.contains)
+			}
+			var qerr *Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("Parse(%q) error should be *Error, got %T", tt.query, err)
+			}
+			if qerr.Pos != tt.pos {
+				t.Errorf("Parse(%q) error position = %d, want %d", tt.query, qerr.Pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestErrorCaret(t *testing.T) {
+	_, err := Parse("node port=abc")
+	var qerr *Error
+	if !errors.As(err, &qerr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	want := "node port=abc\n          ^"
+	if got := qerr.Caret(); got != want {
+		t.Errorf("Caret() = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(err.Error(), "invalid query at position 11:") {
+		t.Errorf("Error() = %q, should report a 1-based position", err)
+	}
+}
+
+func TestQueryWords(t *testing.T) {
+	q := MustParse("node port>3000 (vite or next) not server !debug")
+	want := []string{"node", "vite", "next"}
+	if !reflect.DeepEqual(q.Words(), want) {
+		t.Errorf("Words() = %v, want %v", q.Words(), want)
+	}
+
+	// Double negation is positive again
+	q = MustParse("not not node")
+	if !reflect.DeepEqual(q.Words(), []string{"node"}) {
+		t.Errorf("Words() = %v, want [node]", q.Words())
+	}
+}
+
+func TestQueryCustomWordMatcher(t *testing.T) {
+	q := MustParse("nd port>4000")
+	if len(q.Filter(testPorts)) != 0 {
+		t.Error("default substring matcher should not match 'nd'")
+	}
+
+	q.MatchWord = func(p ports.PortInfo, word string) bool {
+		return strings.HasPrefix(p.Process, word[:1])
+	}
+	got := q.Filter(testPorts)
+	if len(got) != 1 || got[0].Port != 5173 {
+		t.Errorf("custom matcher result = %+v, want port 5173", got)
+	}
+}
+
+func TestQueryEmptyAndString(t *testing.T) {
+	q := MustParse("   ")
+	if !q.Empty() {
+		t.Error("whitespace query should be empty")
+	}
+	if MustParse("node").Empty() {
+		t.Error("query with a term should not be empty")
+	}
+	if s := MustParse("port=80 or node").String(); s != "port=80 or node" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestMustParsePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParse should panic on invalid query")
+		}
+	}()
+	MustParse("(")
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"30s", 30 * time.Second, true},
+		{"5m", 5 * time.Minute, true},
+		{"2d", 48 * time.Hour, true},
+		{"1w", 7 * 24 * time.Hour, true},
+		{"1d12h", 36 * time.Hour, true},
+		{"1w2d3h", (9*24 + 3) * time.Hour, true},
+		{"", 0, false},
+		{"d", 0, false},
+		{"soon", 0, false},
+		{"3x", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v, ok=%v", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"proto", "proto", 0},
+		{"prot", "proto", 1},
+		{"usr", "user", 1},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package respawn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/killer"
+)
+
+// ReadProcess looks up pid using /proc on Linux and ps elsewhere, where
+// the environment and working directory are not available
+func ReadProcess(pid int) (Process, error) {
+	info, err := killer.ReadProcInfo(pid)
+	if err != nil {
+		return Process{}, err
+	}
+	p := Process{PID: pid, PPID: info.PPID, Name: info.Name}
+	if runtime.GOOS != "linux" {
+		if out, err := exec.Command("ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output(); err == nil {
+			p.Args = strings.Fields(string(out))
+		}
+		return p, nil
+	}
+
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		p.Args = splitNul(data)
+	}
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid)); err == nil {
+		p.Env = parseEnviron(data)
+	}
+	if cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid)); err == nil {
+		p.Cwd = cwd
+	}
+	return p, nil
+}
+
+// splitNul splits NUL-separated /proc data such as cmdline. A process that
+// rewrote its title, like the pm2 daemon, may use spaces instead.
+func splitNul(data []byte) []string {
+	s := strings.TrimRight(string(data), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+// parseEnviron parses the contents of /proc/<pid>/environ
+func parseEnviron(data []byte) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range splitNul(data) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
@@ -0,0 +1,312 @@
+// Package respawn watches the ports of a killed process for a new process
+// taking them over, as pm2, supervisord, nodemon, foreman, s6, runit, a
+// container's restart policy or a systemd unit would, and names the
+// supervisor along with the command that stops it for good.
+package respawn
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// DefaultInterval is how often the ports are scanned while watching
+const DefaultInterval = 250 * time.Millisecond
+
+// startSlack allows for the start time of a process being known only to
+// the second: a listener started up to this long before the kill may still
+// be its replacement
+const startSlack = time.Second
+
+// maxDepth bounds the walk up the process tree
+const maxDepth = 64
+
+// Respawn is a process that took over the ports of a killed one
+type Respawn struct {
+	PID        int
+	Process    string
+	Ports      []int
+	Supervisor *Supervisor // nil if none was recognized
+}
+
+// String describes the respawn and how to stop it, e.g. "node (PID 456)
+// took port 3000 again, restarted by pm2 (PID 100); stop it with: pm2 stop
+// api"
+func (r Respawn) String() string {
+	portList := make([]string, len(r.Ports))
+	for i, p := range r.Ports {
+		portList[i] = strconv.Itoa(p)
+	}
+	noun := "port"
+	if len(r.Ports) > 1 {
+		noun = "ports"
+	}
+	s := fmt.Sprintf("%s (PID %d) took %s %s again", r.Process, r.PID, noun, strings.Join(portList, ", "))
+	switch {
+	case r.Supervisor == nil:
+		return s + "; no known supervisor restarted it"
+	case r.Supervisor.Stop == "":
+		return s + ", restarted by " + r.Supervisor.String()
+	}
+	return s + ", restarted by " + r.Supervisor.String() + "; stop it with: " + r.Supervisor.Stop
+}
+
+// Supervisor is what brought a process back
+type Supervisor struct {
+	Name    string // e.g. "pm2", "supervisord", "docker" or "systemd"
+	PID     int    // 0 for a container runtime or systemd unit
+	Program string // the supervised program, container or unit, if known
+	Stop    string // the command that stops it for good, if known
+}
+
+// String names the supervisor, e.g. "pm2 (PID 100)" or "docker"
+func (s Supervisor) String() string {
+	if s.PID > 0 {
+		return fmt.Sprintf("%s (PID %d)", s.Name, s.PID)
+	}
+	return s.Name
+}
+
+// Process is what Identify needs to know about a process
+type Process struct {
+	PID  int
+	PPID int
+	Name string            // short command name
+	Args []string          // command line, empty if unreadable
+	Env  map[string]string // environment, empty if unreadable
+	Cwd  string            // working directory, empty if unreadable
+}
+
+// Lookup reads a process, such as ReadProcess
+type Lookup func(pid int) (Process, error)
+
+// Options configures Watch
+type Options struct {
+	Window   time.Duration // how long to watch
+	Interval time.Duration // time between scans, DefaultInterval if zero
+	// Since is when the kill began. Listeners started well before it were
+	// there all along and are not respawns.
+	Since  time.Time
+	Scan   func(ctx context.Context) ([]ports.PortInfo, error)
+	Lookup Lookup // ReadProcess if nil
+}
+
+// Watch scans for listeners on portList other than the killed PIDs until
+// one appears or opts.Window has passed. It returns one Respawn per new
+// process found in the first scan that has any, or nil.
+func Watch(ctx context.Context, portList []int, killed []int, opts Options) ([]Respawn, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Lookup == nil {
+		opts.Lookup = ReadProcess
+	}
+	deadline := time.Now().Add(opts.Window)
+	for {
+		list, err := opts.Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if found := find(list, portList, killed, opts); len(found) > 0 {
+			return found, nil
+		}
+		if !time.Now().Add(opts.Interval).Before(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// find returns the new processes listening on portList in list
+func find(list []ports.PortInfo, portList []int, killed []int, opts Options) []Respawn {
+	watched := make(map[int]bool)
+	for _, port := range portList {
+		watched[port] = true
+	}
+	skip := make(map[int]bool)
+	for _, pid := range killed {
+		skip[pid] = true
+	}
+
+	var result []Respawn
+	index := make(map[int]int)
+	for _, l := range list {
+		if !watched[l.Port] || skip[l.PID] {
+			continue
+		}
+		if !l.StartTime.IsZero() && !opts.Since.IsZero() && l.StartTime.Before(opts.Since.Add(-startSlack)) {
+			continue
+		}
+		i, ok := index[l.PID]
+		if !ok {
+			i = len(result)
+			index[l.PID] = i
+			result = append(result, Respawn{PID: l.PID, Process: l.Process, Supervisor: Identify(l, opts.Lookup)})
+		}
+		if !containsPort(result[i].Ports, l.Port) {
+			result[i].Ports = append(result[i].Ports, l.Port)
+		}
+	}
+	return result
+}
+
+// containsPort reports whether portList contains port
+func containsPort(portList []int, port int) bool {
+	for _, p := range portList {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Identify finds the supervisor of the listener l by walking up its
+// process tree, falling back to the container or systemd unit it runs in.
+// It returns nil if nothing is recognized.
+func Identify(l ports.PortInfo, lookup Lookup) *Supervisor {
+	var env map[string]string
+	seen := make(map[int]bool)
+	for pid, depth := l.PID, 0; pid > 1 && depth < maxDepth && !seen[pid]; depth++ {
+		seen[pid] = true
+		p, err := lookup(pid)
+		if err != nil {
+			break
+		}
+		if env == nil {
+			// The supervised program's own environment names it
+			env = p.Env
+		}
+		if s := recognize(p, env); s != nil {
+			return s
+		}
+		pid = p.PPID
+	}
+
+	if c := l.Container; c != nil && (c.Runtime == "docker" || c.Runtime == "podman") {
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		return &Supervisor{Name: c.Runtime, Program: name, Stop: c.Runtime + " stop " + quote(name)}
+	}
+	if u := l.Unit; u != nil && !strings.HasSuffix(u.Name, ".socket") {
+		stop := "systemctl stop " + quote(u.Name)
+		if u.User {
+			stop = "systemctl --user stop " + quote(u.Name)
+		}
+		return &Supervisor{Name: "systemd", Program: u.Name, Stop: stop}
+	}
+	return nil
+}
+
+// Supervised reports whether Identify recognizes a supervisor that may
+// restart l. The walk up the process tree needs l's process, so it is
+// called before the kill.
+func Supervised(l ports.PortInfo) bool {
+	return Identify(l, ReadProcess) != nil
+}
+
+// recognize returns the supervisor p is, if any. env is the environment of
+// the process that respawned.
+func recognize(p Process, env map[string]string) *Supervisor {
+	if len(p.Args) > 0 && strings.HasPrefix(p.Args[0], "PM2 ") && strings.Contains(p.Args[0], "God Daemon") {
+		s := &Supervisor{Name: "pm2", PID: p.PID}
+		switch {
+		case env["name"] != "":
+			s.Program = env["name"]
+		case env["pm_id"] != "":
+			s.Program = env["pm_id"]
+		}
+		if s.Program != "" {
+			s.Stop = "pm2 stop " + quote(s.Program)
+		}
+		return s
+	}
+
+	switch command(p) {
+	case "supervisord":
+		s := &Supervisor{Name: "supervisord", PID: p.PID}
+		name, group := env["SUPERVISOR_PROCESS_NAME"], env["SUPERVISOR_GROUP_NAME"]
+		switch {
+		case name == "":
+		case group == "" || group == name:
+			s.Program = name
+		default:
+			s.Program = group + ":" + name
+		}
+		if s.Program != "" {
+			s.Stop = "supervisorctl stop " + quote(s.Program)
+		}
+		return s
+	case "nodemon", "foreman":
+		// Stopping the watcher stops what it runs
+		return &Supervisor{Name: command(p), PID: p.PID, Stop: fmt.Sprintf("kill %d", p.PID)}
+	case "s6-supervise":
+		return serviceDir(p, "s6-supervise", "s6-svc -d ")
+	case "runsv":
+		return serviceDir(p, "runsv", "sv down ")
+	}
+	return nil
+}
+
+// serviceDir describes an s6 or runit supervisor, which runs in its
+// service directory and is given its name as its argument
+func serviceDir(p Process, name, stop string) *Supervisor {
+	dir := p.Cwd
+	if dir == "" && len(p.Args) > 1 {
+		dir = p.Args[1]
+	}
+	s := &Supervisor{Name: name, PID: p.PID}
+	if dir != "" {
+		s.Program = filepath.Base(dir)
+		s.Stop = stop + quote(dir)
+	}
+	return s
+}
+
+// interpreters run the script named by their first argument
+var interpreters = map[string]bool{
+	"node": true, "nodejs": true, "ruby": true, "python": true, "python3": true,
+	"perl": true, "sh": true, "bash": true,
+}
+
+// scriptExts are dropped from script names, as in nodemon/bin/nodemon.js
+var scriptExts = map[string]bool{".js": true, ".cjs": true, ".mjs": true, ".py": true, ".rb": true}
+
+// command returns the program p runs: the script for an interpreter such
+// as node or python, else the executable
+func command(p Process) string {
+	if len(p.Args) == 0 {
+		return p.Name
+	}
+	name := filepath.Base(p.Args[0])
+	if interpreters[strings.TrimRight(name, "0123456789.")] || interpreters[name] {
+		for _, arg := range p.Args[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				script := filepath.Base(arg)
+				if scriptExts[filepath.Ext(script)] {
+					script = strings.TrimSuffix(script, filepath.Ext(script))
+				}
+				return script
+			}
+		}
+	}
+	return name
+}
+
+// quote quotes s for a POSIX shell if it needs it
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_./:@%+=,-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
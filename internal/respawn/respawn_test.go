@@ -0,0 +1,317 @@
+package respawn
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// processTable is a fake process tree for Identify
+type processTable map[int]Process
+
+func (t processTable) lookup(pid int) (Process, error) {
+	p, ok := t[pid]
+	if !ok {
+		return Process{}, errors.New("no such process")
+	}
+	return p, nil
+}
+
+// table builds a processTable in which each process is the parent of the
+// next, the first being a child of init
+func table(chain ...Process) processTable {
+	t := make(processTable)
+	ppid := 1
+	for _, p := range chain {
+		p.PPID = ppid
+		t[p.PID] = p
+		ppid = p.PID
+	}
+	return t
+}
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		name  string
+		procs processTable
+		l     ports.PortInfo
+		want  *Supervisor
+	}{
+		{"pm2 by name",
+			table(
+				Process{PID: 100, Name: "PM2 v5.3.0: God", Args: []string{"PM2 v5.3.0: God Daemon (/home/dev/.pm2)"}},
+				Process{PID: 456, Name: "node", Args: []string{"node", "/srv/api/server.js"}, Env: map[string]string{"name": "api", "pm_id": "0"}},
+			),
+			ports.PortInfo{PID: 456},
+			&Supervisor{Name: "pm2", PID: 100, Program: "api", Stop: "pm2 stop api"}},
+		{"pm2 without an environment",
+			table(
+				Process{PID: 100, Args: []string{"PM2 v5.3.0: God Daemon (/home/dev/.pm2)"}},
+				Process{PID: 456, Name: "node"},
+			),
+			ports.PortInfo{PID: 456},
+			&Supervisor{Name: "pm2", PID: 100}},
+		{"supervisord program",
+			table(
+				Process{PID: 50, Name: "supervisord", Args: []string{"/usr/bin/python3", "/usr/bin/supervisord", "-n"}},
+				Process{PID: 457, Name: "gunicorn", Env: map[string]string{"SUPERVISOR_PROCESS_NAME": "web", "SUPERVISOR_GROUP_NAME": "web"}},
+			),
+			ports.PortInfo{PID: 457},
+			&Supervisor{Name: "supervisord", PID: 50, Program: "web", Stop: "supervisorctl stop web"}},
+		{"supervisord group",
+			table(
+				Process{PID: 50, Name: "supervisord", Args: []string{"/usr/bin/supervisord"}},
+				Process{PID: 458, Name: "gunicorn", Env: map[string]string{"SUPERVISOR_PROCESS_NAME": "web_01", "SUPERVISOR_GROUP_NAME": "web"}},
+			),
+			ports.PortInfo{PID: 458},
+			&Supervisor{Name: "supervisord", PID: 50, Program: "web:web_01", Stop: "supervisorctl stop web:web_01"}},
+		{"nodemon through a shell",
+			table(
+				Process{PID: 200, Name: "node", Args: []string{"node", "/usr/lib/node_modules/nodemon/bin/nodemon.js", "server.js"}},
+				Process{PID: 201, Name: "sh", Args: []string{"sh", "-c", "node server.js"}},
+				Process{PID: 459, Name: "node", Args: []string{"node", "server.js"}},
+			),
+			ports.PortInfo{PID: 459},
+			&Supervisor{Name: "nodemon", PID: 200, Stop: "kill 200"}},
+		{"foreman",
+			table(
+				Process{PID: 300, Name: "ruby", Args: []string{"ruby", "/usr/local/bin/foreman", "start"}},
+				Process{PID: 460, Name: "puma"},
+			),
+			ports.PortInfo{PID: 460},
+			&Supervisor{Name: "foreman", PID: 300, Stop: "kill 300"}},
+		{"s6",
+			table(
+				Process{PID: 10, Name: "s6-svscan", Args: []string{"s6-svscan", "/run/service"}},
+				Process{PID: 11, Name: "s6-supervise", Args: []string{"s6-supervise", "web"}, Cwd: "/run/service/web"},
+				Process{PID: 461, Name: "nginx"},
+			),
+			ports.PortInfo{PID: 461},
+			&Supervisor{Name: "s6-supervise", PID: 11, Program: "web", Stop: "s6-svc -d /run/service/web"}},
+		{"runit without a readable cwd",
+			table(
+				Process{PID: 20, Name: "runsv", Args: []string{"runsv", "my app"}},
+				Process{PID: 462, Name: "nginx"},
+			),
+			ports.PortInfo{PID: 462},
+			&Supervisor{Name: "runsv", PID: 20, Program: "my app", Stop: "sv down 'my app'"}},
+		{"docker restart policy",
+			table(Process{PID: 463, Name: "nginx"}),
+			ports.PortInfo{PID: 463, Container: &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b", Name: "web"}},
+			&Supervisor{Name: "docker", Program: "web", Stop: "docker stop web"}},
+		{"systemd user unit",
+			table(Process{PID: 464, Name: "api"}),
+			ports.PortInfo{PID: 464, Unit: &ports.Unit{Name: "api.service", User: true}},
+			&Supervisor{Name: "systemd", Program: "api.service", Stop: "systemctl --user stop api.service"}},
+		{"a supervisor in the tree beats the unit",
+			table(
+				Process{PID: 50, Name: "supervisord", Args: []string{"supervisord"}},
+				Process{PID: 465, Name: "gunicorn", Env: map[string]string{"SUPERVISOR_PROCESS_NAME": "web"}},
+			),
+			ports.PortInfo{PID: 465, Unit: &ports.Unit{Name: "supervisor.service"}},
+			&Supervisor{Name: "supervisord", PID: 50, Program: "web", Stop: "supervisorctl stop web"}},
+		{"nothing recognized",
+			table(
+				Process{PID: 30, Name: "bash", Args: []string{"-bash"}},
+				Process{PID: 466, Name: "python3", Args: []string{"python3", "-m", "http.server"}},
+			),
+			ports.PortInfo{PID: 466},
+			nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Identify(tt.l, tt.procs.lookup)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Identify = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifyStopsOnLoops(t *testing.T) {
+	procs := processTable{
+		7: {PID: 7, PPID: 8, Name: "a"},
+		8: {PID: 8, PPID: 7, Name: "b"},
+	}
+	if got := Identify(ports.PortInfo{PID: 7}, procs.lookup); got != nil {
+		t.Errorf("Identify = %+v, want nil", got)
+	}
+}
+
+func TestSupervised(t *testing.T) {
+	l := ports.PortInfo{Port: 3000, PID: 999999999, Process: "node"}
+	if Supervised(l) {
+		t.Error("a process that cannot be read has no supervisor")
+	}
+	l.Container = &ports.Container{Runtime: "docker", Name: "web"}
+	if !Supervised(l) {
+		t.Error("a container's restart policy may bring it back")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	since := time.Now()
+	procs := table(
+		Process{PID: 100, Args: []string{"PM2 v5.3.0: God Daemon (/root/.pm2)"}},
+		Process{PID: 456, Name: "node", Env: map[string]string{"name": "api"}},
+	)
+	scans := 0
+	scan := func(ctx context.Context) ([]ports.PortInfo, error) {
+		scans++
+		list := []ports.PortInfo{
+			// Listening all along on a port that is not watched, and on one
+			// that is
+			{Port: 22, PID: 40, Process: "sshd", StartTime: since.Add(-time.Hour)},
+			{Port: 3000, PID: 41, Process: "envoy", StartTime: since.Add(-time.Hour)},
+		}
+		if scans < 3 {
+			return list, nil
+		}
+		return append(list,
+			ports.PortInfo{Port: 3000, PID: 456, Process: "node", Proto: "tcp", StartTime: since},
+			ports.PortInfo{Port: 3000, PID: 456, Process: "node", Proto: "tcp6", StartTime: since},
+			ports.PortInfo{Port: 3001, PID: 456, Process: "node", StartTime: since},
+		), nil
+	}
+
+	opts := Options{Window: time.Second, Interval: time.Millisecond, Since: since, Scan: scan, Lookup: procs.lookup}
+	got, err := Watch(context.Background(), []int{3000, 3001}, []int{123}, opts)
+	if err != nil {
+		t.Fatalf("Watch error: %v", err)
+	}
+	want := []Respawn{{PID: 456, Process: "node", Ports: []int{3000, 3001},
+		Supervisor: &Supervisor{Name: "pm2", PID: 100, Program: "api", Stop: "pm2 stop api"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Watch = %+v, want %+v", got, want)
+	}
+	if scans != 3 {
+		t.Errorf("scanned %d times, want 3", scans)
+	}
+}
+
+func TestWatchNoRespawn(t *testing.T) {
+	scans := 0
+	scan := func(ctx context.Context) ([]ports.PortInfo, error) {
+		scans++
+		return []ports.PortInfo{{Port: 3000, PID: 123, Process: "node"}}, nil
+	}
+	start := time.Now()
+	opts := Options{Window: 50 * time.Millisecond, Interval: 10 * time.Millisecond, Since: start, Scan: scan}
+	got, err := Watch(context.Background(), []int{3000}, []int{123}, opts)
+	if got != nil || err != nil {
+		t.Errorf("Watch = %+v, %v; want nil, nil", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Watch took %v for a 50ms window", elapsed)
+	}
+	if scans < 2 {
+		t.Errorf("scanned %d times, want several", scans)
+	}
+
+	// A zero window scans once
+	scans = 0
+	opts.Window = 0
+	if got, _ := Watch(context.Background(), []int{3000}, []int{123}, opts); got != nil || scans != 1 {
+		t.Errorf("Watch with no window = %+v after %d scans", got, scans)
+	}
+}
+
+func TestWatchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	scan := func(context.Context) ([]ports.PortInfo, error) {
+		cancel()
+		return nil, nil
+	}
+	_, err := Watch(ctx, []int{3000}, nil, Options{Window: time.Minute, Scan: scan})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch error = %v, want context.Canceled", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		p    Process
+		want string
+	}{
+		{Process{Name: "nginx"}, "nginx"},
+		{Process{Args: []string{"/usr/sbin/runsv", "web"}}, "runsv"},
+		{Process{Args: []string{"/usr/bin/python3.11", "-u", "/usr/bin/supervisord"}}, "supervisord"},
+		{Process{Args: []string{"node", "/usr/bin/nodemon"}}, "nodemon"},
+		{Process{Args: []string{"node"}}, "node"},
+	}
+	for _, tt := range tests {
+		if got := command(tt.p); got != tt.want {
+			t.Errorf("command(%v) = %q, want %q", tt.p.Args, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"api":          "api",
+		"web:web_01":   "web:web_01",
+		"/run/svc/web": "/run/svc/web",
+		"my app":       "'my app'",
+		"it's":         `'it'\''s'`,
+		"":             "''",
+		"$(rm -rf ~)":  "'$(rm -rf ~)'",
+	}
+	for s, want := range tests {
+		if got := quote(s); got != want {
+			t.Errorf("quote(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestReadProcessSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads /proc")
+	}
+	p, err := ReadProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("ReadProcess error: %v", err)
+	}
+	if p.PPID != os.Getppid() || len(p.Args) == 0 || p.Cwd == "" {
+		t.Errorf("ReadProcess = %+v", p)
+	}
+	if _, err := ReadProcess(1 << 30); err == nil {
+		t.Error("ReadProcess(missing) should fail")
+	}
+}
+
+func TestParseEnviron(t *testing.T) {
+	got := parseEnviron([]byte("name=api\x00pm_id=0\x00EMPTY=\x00junk\x00"))
+	want := map[string]string{"name": "api", "pm_id": "0", "EMPTY": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnviron = %v, want %v", got, want)
+	}
+}
+
+func TestRespawnString(t *testing.T) {
+	r := Respawn{PID: 456, Process: "node", Ports: []int{3000},
+		Supervisor: &Supervisor{Name: "pm2", PID: 100, Program: "api", Stop: "pm2 stop api"}}
+	want := "node (PID 456) took port 3000 again, restarted by pm2 (PID 100); stop it with: pm2 stop api"
+	if got := r.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	r.Ports = []int{3000, 3001}
+	r.Supervisor = &Supervisor{Name: "pm2", PID: 100}
+	want = "node (PID 456) took ports 3000, 3001 again, restarted by pm2 (PID 100)"
+	if got := r.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+
+	r.Supervisor = nil
+	if got := r.String(); !strings.HasSuffix(got, "again; no known supervisor restarted it") {
+		t.Errorf("String = %q", got)
+	}
+}
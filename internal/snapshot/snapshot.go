@@ -0,0 +1,207 @@
+// Package snapshot saves the listening ports to a file so a later scan can
+// be compared against them. A snapshot is JSON:
+//
+//	{
+//	  "version": 1,
+//	  "taken": "2025-01-02T03:04:05Z",
+//	  "hostname": "ci-runner-7",
+//	  "listeners": [{"port": 5432, "pid": 812, "process": "postgres", ...}]
+//	}
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// Version is the snapshot format written by this version of tsunami
+const Version = 1
+
+// Snapshot is the set of listeners at one point in time
+type Snapshot struct {
+	Version   int        `json:"version"`
+	Taken     time.Time  `json:"taken"`
+	Hostname  string     `json:"hostname,omitempty"`
+	Listeners []Listener `json:"listeners"`
+}
+
+// Listener is a saved ports.PortInfo
+type Listener struct {
+	Port      int        `json:"port"`
+	PID       int        `json:"pid"`
+	Process   string     `json:"process"`
+	User      string     `json:"user"`
+	Proto     string     `json:"proto"`
+	Address   string     `json:"address,omitempty"`
+	Cmdline   string     `json:"cmdline,omitempty"`
+	Cwd       string     `json:"cwd,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	Memory    uint64     `json:"memory,omitempty"`
+}
+
+// New creates a snapshot of listeners taken at the given time
+func New(listeners []ports.PortInfo, taken time.Time) *Snapshot {
+	s := &Snapshot{Version: Version, Taken: taken.UTC(), Listeners: make([]Listener, len(listeners))}
+	s.Hostname, _ = os.Hostname()
+	for i, p := range listeners {
+		s.Listeners[i] = Listener{
+			Port:    p.Port,
+			PID:     p.PID,
+			Process: p.Process,
+			User:    p.User,
+			Proto:   p.Proto,
+			Address: p.Address,
+			Cmdline: p.Cmdline,
+			Cwd:     p.Cwd,
+			Memory:  p.Memory,
+		}
+		if !p.StartTime.IsZero() {
+			start := p.StartTime.UTC()
+			s.Listeners[i].StartTime = &start
+		}
+	}
+	return s
+}
+
+// Ports returns the saved listeners
+func (s *Snapshot) Ports() []ports.PortInfo {
+	result := make([]ports.PortInfo, len(s.Listeners))
+	for i, l := range s.Listeners {
+		result[i] = ports.PortInfo{
+			Port:    l.Port,
+			PID:     l.PID,
+			Process: l.Process,
+			User:    l.User,
+			Proto:   l.Proto,
+			Address: l.Address,
+			Cmdline: l.Cmdline,
+			Cwd:     l.Cwd,
+			Memory:  l.Memory,
+		}
+		if l.StartTime != nil {
+			result[i].StartTime = *l.StartTime
+		}
+	}
+	return result
+}
+
+// Write writes s to w as indented JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Save writes s to path, replacing any existing file
+func (s *Snapshot) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read parses a snapshot from r. Fields it does not know are ignored, so
+// a later tsunami can add some without changing the version.
+func Read(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Load reads the snapshot saved at path
+func Load(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate checks the version and every listener
+func (s *Snapshot) Validate() error {
+	if s.Version == 0 {
+		return errors.New("not a tsunami snapshot: no version")
+	}
+	if s.Version != Version {
+		return fmt.Errorf("unsupported snapshot version %d (expected %d)", s.Version, Version)
+	}
+	for i, l := range s.Listeners {
+		if l.Proto == "unix" {
+			if l.Address == "" {
+				return fmt.Errorf("listener %d: Unix socket without a path", i+1)
+			}
+		} else if l.Port < 1 || l.Port > 65535 {
+			return fmt.Errorf("listener %d: invalid port: %d", i+1, l.Port)
+		}
+		if l.PID < 1 {
+			return fmt.Errorf("listener %d: invalid PID: %d", i+1, l.PID)
+		}
+	}
+	return nil
+}
+
+// Kinds of change
+const (
+	Added        = "added"
+	Removed      = "removed"
+	OwnerChanged = "owner_changed"
+)
+
+// Change is one difference between two sets of listeners
+type Change struct {
+	Kind     string         // Added, Removed or OwnerChanged
+	Listener ports.PortInfo // the listener added or removed, or the new owner
+	Previous *ports.PortInfo
+}
+
+// Diff returns the listeners added to and removed from before, and those
+// taken over by another process, in port order
+func Diff(before, after []ports.PortInfo) []Change {
+	events := ports.Diff(before, after)
+	changes := make([]Change, len(events))
+	for i, e := range events {
+		changes[i] = Change{Listener: e.Listener, Previous: e.Previous}
+		switch e.Kind {
+		case ports.Opened:
+			changes[i].Kind = Added
+		case ports.Closed:
+			changes[i].Kind = Removed
+		case ports.OwnerChanged:
+			changes[i].Kind = OwnerChanged
+		}
+	}
+	return changes
+}
+
+// NewListeners returns the listeners in after that are not in before: the
+// ones that were added or taken over by another process
+func NewListeners(before, after []ports.PortInfo) []ports.PortInfo {
+	var result []ports.PortInfo
+	for _, c := range Diff(before, after) {
+		if c.Kind != Removed {
+			result = append(result, c.Listener)
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+var (
+	started  = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	postgres = ports.PortInfo{Port: 5432, PID: 812, Process: "postgres", User: "postgres", Proto: "tcp", Address: "127.0.0.1",
+		Cmdline: "postgres -D /var/lib/postgres", Cwd: "/var/lib/postgres", StartTime: started, Memory: 1 << 20}
+	node = ports.PortInfo{Port: 3000, PID: 4242, Process: "node", User: "ci", Proto: "tcp6", Address: "::"}
+	fpm  = ports.PortInfo{PID: 900, Process: "php-fpm", User: "www-data", Proto: "unix", Address: "/run/php/php-fpm.sock"}
+)
+
+func TestRoundTrip(t *testing.T) {
+	s := New([]ports.PortInfo{postgres, node, fpm}, started)
+	path := filepath.Join(t.TempDir(), "before.json")
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if !loaded.Taken.Equal(started) || loaded.Version != Version {
+		t.Errorf("loaded header = %+v", loaded)
+	}
+	if got := loaded.Ports(); !reflect.DeepEqual(got, []ports.PortInfo{postgres, node, fpm}) {
+		t.Errorf("Ports() = %+v", got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"not json", "nope", "invalid snapshot"},
+		{"no version", `{"listeners": []}`, "no version"},
+		{"wrong version", `{"version": 2, "listeners": []}`, "unsupported snapshot version 2"},
+		{"bad port", `{"version": 1, "listeners": [{"port": 70000, "pid": 1}]}`, "listener 1: invalid port"},
+		{"bad pid", `{"version": 1, "listeners": [{"port": 80, "pid": 0}]}`, "listener 1: invalid PID"},
+		{"socket without path", `{"version": 1, "listeners": [{"port": 0, "pid": 1, "proto": "unix"}]}`, "listener 1: Unix socket without a path"},
+		{"port 0", `{"version": 1, "listeners": [{"port": 0, "pid": 1, "proto": "tcp"}]}`, "listener 1: invalid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	extra := `{"version": 1, "listeners": [{"port": 80, "pid": 1, "labels": ["web"]}], "source": "ci"}`
+	if s, err := Read(strings.NewReader(extra)); err != nil || len(s.Listeners) != 1 {
+		t.Errorf("Read with unknown fields = %+v, %v", s, err)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("Load of a missing file = %v", err)
+	}
+}
+
+func TestWriteOmitsUnknownStartTime(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New([]ports.PortInfo{node}, started).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "start_time") {
+		t.Errorf("snapshot has a start time for a listener without one:\n%s", buf.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	restarted := postgres
+	restarted.StartTime = started.Add(time.Hour)
+	vite := ports.PortInfo{Port: 5173, PID: 5000, Process: "vite", Proto: "tcp", Address: "127.0.0.1"}
+
+	changes := Diff([]ports.PortInfo{postgres, node}, []ports.PortInfo{restarted, vite})
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Kind+" "+c.Listener.Process)
+	}
+	want := []string{"removed node", "added vite", "owner_changed postgres"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %v, want %v", got, want)
+	}
+	if changes[2].Previous == nil || !changes[2].Previous.StartTime.Equal(started) {
+		t.Errorf("owner change previous = %+v", changes[2].Previous)
+	}
+
+	fresh := NewListeners([]ports.PortInfo{postgres, node}, []ports.PortInfo{restarted, vite})
+	if len(fresh) != 2 || fresh[0].Process != "vite" || fresh[1].Process != "postgres" {
+		t.Errorf("NewListeners = %+v", fresh)
+	}
+}
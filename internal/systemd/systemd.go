@@ -0,0 +1,271 @@
+// Package systemd finds the systemd units behind listeners with systemctl
+// and stops those units instead of killing their processes, which a
+// service with Restart=always would simply bring back.
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// IsManager reports whether p is held by a service manager, PID 1 or a
+// user's systemd, which is the case for socket-activated listeners
+func IsManager(p ports.PortInfo) bool {
+	return p.Process == "systemd" && p.Container == nil
+}
+
+// IsSocket reports whether u is a socket unit
+func IsSocket(u ports.Unit) bool {
+	return strings.HasSuffix(u.Name, ".socket")
+}
+
+// HeldSocket returns the socket unit of a listener the service manager
+// holds, to be checked against the protection policy in place of the
+// manager itself, or "" for any other listener
+func HeldSocket(p ports.PortInfo) string {
+	if p.Unit == nil || !IsManager(p) || !IsSocket(*p.Unit) {
+		return ""
+	}
+	return p.Unit.Name
+}
+
+// Describe names a unit, e.g. "unit nginx.service" or "user unit api.service"
+func Describe(u ports.Unit) string {
+	if u.User {
+		return "user unit " + u.Name
+	}
+	return "unit " + u.Name
+}
+
+// Stoppable returns the unit to stop in place of killing p, or nil if p
+// should be killed as usual. A service is only stopped when p is its main
+// process or the service restarts, since killing any other process of it
+// (a shell in a session, a worker) leaves the service running. p is also
+// killed when it runs in a container, or when its service also contains
+// tsunami, which stopping would take down along with the shell that ran it.
+func Stoppable(p ports.PortInfo) *ports.Unit {
+	u := p.Unit
+	if u == nil || p.Container != nil {
+		return nil
+	}
+	if IsSocket(*u) {
+		return u
+	}
+	if self := ports.UnitOf(os.Getpid()); self != nil && self.Name == u.Name && self.User == u.User {
+		return nil
+	}
+	if p.PID == u.MainPID || (u.Restart != "" && u.Restart != "no") {
+		return u
+	}
+	return nil
+}
+
+// Stop stops u with systemctl stop, along with the services a socket unit
+// has started, which may hold the listening socket too
+func Stop(ctx context.Context, u ports.Unit) error {
+	args := append([]string{"stop", "--", u.Name}, u.Activates...)
+	_, err := systemctl(ctx, u.User, args...)
+	return err
+}
+
+// Kill sends signal (e.g. "HUP") to the processes of u
+func Kill(ctx context.Context, u ports.Unit, signal string) error {
+	_, err := systemctl(ctx, u.User, "kill", "--signal=SIG"+signal, "--", u.Name)
+	return err
+}
+
+// Annotate sets Unit on the listeners in list held by a service manager to
+// the socket unit that owns the port, and fills in the restart policy and
+// main process of every unit. systemctl is only run when list has such listeners; the
+// first error is returned after annotating what could be.
+func Annotate(ctx context.Context, list []ports.PortInfo) error {
+	var firstErr error
+	record := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, user := range []bool{false, true} {
+		var held []int
+		for i, p := range list {
+			if IsManager(p) && (p.PID != 1) == user {
+				held = append(held, i)
+			}
+		}
+		if len(held) == 0 {
+			continue
+		}
+		sockets, err := listSockets(ctx, user)
+		if err != nil {
+			record(err)
+			continue
+		}
+		for _, i := range held {
+			if s, ok := sockets[listenKey(list[i])]; ok {
+				list[i].Unit = &s
+			}
+		}
+	}
+
+	for _, user := range []bool{false, true} {
+		var names []string
+		seen := make(map[string]bool)
+		for _, p := range list {
+			if u := p.Unit; u != nil && u.User == user && !IsSocket(*u) && !seen[u.Name] {
+				seen[u.Name] = true
+				names = append(names, u.Name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		props, err := unitProperties(ctx, user, names)
+		if err != nil {
+			record(err)
+			continue
+		}
+		for i, p := range list {
+			if u := p.Unit; u != nil && u.User == user {
+				if shown, ok := props[u.Name]; ok {
+					withProps := *u
+					withProps.Restart, withProps.MainPID = shown.Restart, shown.MainPID
+					list[i].Unit = &withProps
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+// listenKey is how parseListSockets keys the listener p: its port, or the
+// path of a Unix socket
+func listenKey(p ports.PortInfo) string {
+	if p.Unix() {
+		return p.Address
+	}
+	return strconv.Itoa(p.Port)
+}
+
+// listSockets maps each listening port and Unix socket path to its socket
+// unit, from `systemctl list-sockets`
+func listSockets(ctx context.Context, user bool) (map[string]ports.Unit, error) {
+	out, err := systemctl(ctx, user, "list-sockets", "--all", "--no-legend", "--no-pager")
+	if err != nil {
+		return nil, err
+	}
+	return parseListSockets(string(out), user), nil
+}
+
+// parseListSockets parses `systemctl list-sockets --no-legend` output:
+// LISTEN UNIT ACTIVATES, where LISTEN may itself contain spaces. Ports and
+// Unix socket paths are keyed as by listenKey.
+// Example line: [::]:22  ssh.socket  ssh.service
+func parseListSockets(output string, user bool) map[string]ports.Unit {
+	sockets := make(map[string]ports.Unit)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		unit := -1
+		for i, f := range fields {
+			if strings.HasSuffix(f, ".socket") {
+				unit = i
+				break
+			}
+		}
+		if unit != 1 {
+			continue // not an address, which has no spaces
+		}
+		listen := fields[0]
+		key := listen
+		if !strings.HasPrefix(listen, "/") && !strings.HasPrefix(listen, "@") {
+			idx := strings.LastIndex(listen, ":")
+			if idx == -1 {
+				continue
+			}
+			port, err := strconv.Atoi(listen[idx+1:])
+			if err != nil {
+				continue
+			}
+			key = strconv.Itoa(port)
+		}
+		u := ports.Unit{Name: fields[unit], User: user}
+		for _, a := range fields[unit+1:] {
+			if a = strings.Trim(a, ","); a != "" && a != "-" {
+				u.Activates = append(u.Activates, a)
+			}
+		}
+		if _, ok := sockets[key]; !ok {
+			sockets[key] = u
+		}
+	}
+	return sockets
+}
+
+// unitProperties looks up the Restart= setting and main PID of each unit
+// in names
+func unitProperties(ctx context.Context, user bool, names []string) (map[string]ports.Unit, error) {
+	args := append([]string{"show", "--property=Restart,MainPID", "--"}, names...)
+	out, err := systemctl(ctx, user, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseShow(string(out), names), nil
+}
+
+// parseShow parses `systemctl show --property=Restart,MainPID` output for
+// names: one block of key=value lines per unit, in order, separated by
+// blank lines. A MainPID of 0 means the unit has no main process.
+func parseShow(output string, names []string) map[string]ports.Unit {
+	result := make(map[string]ports.Unit)
+	blocks := strings.Split(strings.TrimSpace(output), "\n\n")
+	for i, block := range blocks {
+		if i >= len(names) {
+			break
+		}
+		u := ports.Unit{Name: names[i]}
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+			switch key {
+			case "Restart":
+				u.Restart = value
+			case "MainPID":
+				u.MainPID, _ = strconv.Atoi(value)
+			}
+		}
+		result[names[i]] = u
+	}
+	return result
+}
+
+// systemctl runs systemctl, for the user's manager if user is set, and
+// turns a failure into an error carrying its message
+func systemctl(ctx context.Context, user bool, args ...string) ([]byte, error) {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); errors.As(err, &exitErr) && msg != "" {
+			return nil, fmt.Errorf("systemctl: %s", msg)
+		}
+		return nil, fmt.Errorf("systemctl: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,248 @@
+package systemd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+// fakeSystemctl is a systemctl that logs its arguments to $SYSTEMCTL_LOG
+// and answers list-sockets and show like a system with nginx and
+// socket-activated cups
+const fakeSystemctl = `#!/bin/sh
+echo "$*" >> "$SYSTEMCTL_LOG"
+case "$*" in
+*"--user list-sockets"*)
+	echo "failed to connect to bus" >&2; exit 1 ;;
+*list-sockets*)
+	echo "/run/dbus/system_bus_socket dbus.socket   dbus.service"
+	echo "kobject-uevent 1            systemd-udevd-kernel.socket systemd-udevd.service"
+	echo "[::]:631                    cups.socket   cups.service, cups-browsed.service"
+	echo "0.0.0.0:631                 cups.socket   cups.service, cups-browsed.service" ;;
+*show*)
+	for arg; do
+		case "$arg" in
+		*.service) [ -n "$sep" ] && echo; sep=1
+			case "$arg" in
+			nginx.service) echo "Restart=always"; echo "MainPID=800" ;;
+			*) echo "Restart=no"; echo "MainPID=0" ;;
+			esac ;;
+		esac
+	done ;;
+*"stop -- broken.service"*)
+	echo "Failed to stop broken.service: Access denied" >&2; exit 1 ;;
+esac
+`
+
+// installFakeSystemctl puts fakeSystemctl first on PATH and returns the
+// file its invocations are logged to
+func installFakeSystemctl(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "systemctl"), []byte(fakeSystemctl), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "log")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SYSTEMCTL_LOG", log)
+	return log
+}
+
+// calls returns the logged systemctl invocations
+func calls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+var (
+	nginx = ports.PortInfo{Port: 80, PID: 800, Process: "nginx", User: "root",
+		Unit: &ports.Unit{Name: "nginx.service"}}
+	cupsd = ports.PortInfo{Port: 631, PID: 1, Process: "systemd", User: "root"}
+	vite  = ports.PortInfo{Port: 5173, PID: 900, Process: "node", User: "dev"}
+)
+
+func TestParseListSockets(t *testing.T) {
+	output := "/run/dbus/system_bus_socket dbus.socket dbus.service\n" +
+		"kobject-uevent 1 systemd-udevd-kernel.socket systemd-udevd.service\n" +
+		"[::]:22 ssh.socket ssh.service\n" +
+		"127.0.0.1:8080 web.socket -\n"
+	got := parseListSockets(output, true)
+	want := map[string]ports.Unit{
+		"/run/dbus/system_bus_socket": {Name: "dbus.socket", User: true, Activates: []string{"dbus.service"}},
+		"22":                          {Name: "ssh.socket", User: true, Activates: []string{"ssh.service"}},
+		"8080":                        {Name: "web.socket", User: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseListSockets = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseShow(t *testing.T) {
+	output := "Restart=always\nMainPID=800\n\nMainPID=0\nRestart=no\n\nRestart=on-failure\n"
+	got := parseShow(output, []string{"a.service", "b.service", "c.service"})
+	want := map[string]ports.Unit{
+		"a.service": {Name: "a.service", Restart: "always", MainPID: 800},
+		"b.service": {Name: "b.service", Restart: "no"},
+		"c.service": {Name: "c.service", Restart: "on-failure"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseShow = %v, want %v", got, want)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	log := installFakeSystemctl(t)
+	userManager := cupsd
+	userManager.PID, userManager.Port = 1200, 9000
+	dbus := ports.PortInfo{PID: 1, Process: "systemd", User: "root", Proto: "unix", Address: "/run/dbus/system_bus_socket"}
+	list := []ports.PortInfo{nginx, cupsd, vite, userManager, dbus}
+	err := Annotate(context.Background(), list)
+	if err == nil || !strings.Contains(err.Error(), "failed to connect to bus") {
+		t.Errorf("Annotate error = %v, want the --user failure", err)
+	}
+
+	if u := list[0].Unit; u == nil || u.Restart != "always" || u.MainPID != 800 {
+		t.Errorf("nginx unit = %+v, want Restart=always and MainPID 800", u)
+	}
+	if nginx.Unit.Restart != "" {
+		t.Error("Annotate modified the scanned unit in place")
+	}
+	want := ports.Unit{Name: "cups.socket", Activates: []string{"cups.service", "cups-browsed.service"}}
+	if u := list[1].Unit; u == nil || !reflect.DeepEqual(*u, want) {
+		t.Errorf("PID 1 listener unit = %+v, want %+v", u, want)
+	}
+	if u := list[4].Unit; u == nil || u.Name != "dbus.socket" {
+		t.Errorf("Unix socket unit = %+v, want dbus.socket", u)
+	}
+	if list[2].Unit != nil || list[3].Unit != nil {
+		t.Errorf("units = %+v, %+v; want nil", list[2].Unit, list[3].Unit)
+	}
+
+	got := calls(t, log)
+	if len(got) != 3 || !strings.HasPrefix(got[2], "show --property=Restart,MainPID -- nginx.service") {
+		t.Errorf("systemctl calls = %q", got)
+	}
+}
+
+func TestAnnotateWithoutUnits(t *testing.T) {
+	log := installFakeSystemctl(t)
+	if err := Annotate(context.Background(), []ports.PortInfo{vite}); err != nil {
+		t.Errorf("Annotate error: %v", err)
+	}
+	if got := calls(t, log); got != nil {
+		t.Errorf("systemctl run for listeners without units: %q", got)
+	}
+}
+
+func TestStopAndKill(t *testing.T) {
+	log := installFakeSystemctl(t)
+	ctx := context.Background()
+	if err := Stop(ctx, ports.Unit{Name: "cups.socket", Activates: []string{"cups.service"}}); err != nil {
+		t.Errorf("Stop error: %v", err)
+	}
+	if err := Stop(ctx, ports.Unit{Name: "api.service", User: true}); err != nil {
+		t.Errorf("Stop error: %v", err)
+	}
+	if err := Kill(ctx, *nginx.Unit, "HUP"); err != nil {
+		t.Errorf("Kill error: %v", err)
+	}
+	want := []string{
+		"stop -- cups.socket cups.service",
+		"--user stop -- api.service",
+		"kill --signal=SIGHUP -- nginx.service",
+	}
+	if got := calls(t, log); !reflect.DeepEqual(got, want) {
+		t.Errorf("systemctl calls = %q, want %q", got, want)
+	}
+
+	err := Stop(ctx, ports.Unit{Name: "broken.service"})
+	if err == nil || err.Error() != "systemctl: Failed to stop broken.service: Access denied" {
+		t.Errorf("Stop(broken) error = %v", err)
+	}
+}
+
+func TestStoppable(t *testing.T) {
+	mainProc := nginx
+	mainProc.Unit = &ports.Unit{Name: "nginx.service", Restart: "no", MainPID: 800}
+	if u := Stoppable(mainProc); u == nil || u.Name != "nginx.service" {
+		t.Errorf("Stoppable(main process) = %+v", u)
+	}
+	restarting := nginx
+	restarting.Unit = &ports.Unit{Name: "nginx.service", Restart: "always", MainPID: 700}
+	if u := Stoppable(restarting); u == nil || u.Name != "nginx.service" {
+		t.Errorf("Stoppable(Restart=always) = %+v", u)
+	}
+
+	// Other processes of a service that does not restart are killed, as is
+	// a process of a unit whose properties are unknown
+	for _, unit := range []ports.Unit{
+		{Name: "nginx.service", Restart: "no", MainPID: 700},
+		{Name: "session-3.scope"},
+		{Name: "nginx.service"},
+	} {
+		worker := nginx
+		worker.Unit = &unit
+		if u := Stoppable(worker); u != nil {
+			t.Errorf("Stoppable(%+v) = %+v, want nil", unit, u)
+		}
+	}
+	held := cupsd
+	held.Unit = &ports.Unit{Name: "cups.socket"}
+	if u := Stoppable(held); u == nil || u.Name != "cups.socket" {
+		t.Errorf("Stoppable(socket unit) = %+v", u)
+	}
+	if u := Stoppable(vite); u != nil {
+		t.Errorf("Stoppable(no unit) = %+v, want nil", u)
+	}
+	inContainer := mainProc
+	inContainer.Container = &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b"}
+	if u := Stoppable(inContainer); u != nil {
+		t.Errorf("Stoppable(in a container) = %+v, want nil", u)
+	}
+
+	// The unit tsunami itself runs in, if any, is never stopped
+	if self := ports.UnitOf(os.Getpid()); self != nil {
+		mine := vite
+		withMain := *self
+		withMain.MainPID = mine.PID
+		mine.Unit = &withMain
+		if u := Stoppable(mine); u != nil {
+			t.Errorf("Stoppable(own unit %s) = %+v, want nil", self.Name, u)
+		}
+	}
+}
+
+func TestHeldSocket(t *testing.T) {
+	held := cupsd
+	held.Unit = &ports.Unit{Name: "cups.socket"}
+	if got := HeldSocket(held); got != "cups.socket" {
+		t.Errorf("HeldSocket(PID 1 listener) = %q, want cups.socket", got)
+	}
+	if got := HeldSocket(nginx); got != "" {
+		t.Errorf("HeldSocket(service) = %q, want \"\"", got)
+	}
+	if got := HeldSocket(cupsd); got != "" {
+		t.Errorf("HeldSocket(unknown socket) = %q, want \"\"", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if got := Describe(ports.Unit{Name: "nginx.service"}); got != "unit nginx.service" {
+		t.Errorf("Describe = %q", got)
+	}
+	if got := Describe(ports.Unit{Name: "api.service", User: true}); got != "user unit api.service" {
+		t.Errorf("Describe = %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+// Package theme defines the TUI's color palettes and the color overrides
+// accepted from the config file.
+package theme
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Theme is the TUI color palette. Colors are lipgloss colors ("#FF79C6",
+// "212"); an empty color leaves the terminal default.
+type Theme struct {
+	Name       string
+	Title      string
+	Text       string
+	Dim        string
+	Accent     string // filter text and match highlights
+	SelectedBg string
+	Button     string // inactive button background
+	Error      string // also system ports
+	Warning    string // also ephemeral ports
+	Success    string // also user ports
+}
+
+// Builtin are the built-in palettes
+var Builtin = map[string]Theme{
+	"default": {
+		Name:       "default",
+		Title:      "#00FFFF",
+		Text:       "#FFFFFF",
+		Dim:        "#6272A4",
+		Accent:     "#FF79C6",
+		SelectedBg: "#1E3A5F",
+		Button:     "#44475A",
+		Error:      "#FF6B6B",
+		Warning:    "#FFFC58",
+		Success:    "#69FF94",
+	},
+	"light": {
+		Name:       "light",
+		Title:      "#005F87",
+		Text:       "#000000",
+		Dim:        "#6C6C6C",
+		Accent:     "#AF005F",
+		SelectedBg: "#D7E6F5",
+		Button:     "#D0D0D0",
+		Error:      "#D70000",
+		Warning:    "#AF8700",
+		Success:    "#008700",
+	},
+	"mono": {Name: "mono"},
+}
+
+// Names returns the built-in theme names, sorted
+func Names() []string {
+	names := make([]string, 0, len(Builtin))
+	for name := range Builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// themeColorKeys maps the color names accepted by WithColors to fields
+var themeColorKeys = map[string]func(*Theme) *string{
+	"title":       func(t *Theme) *string { return &t.Title },
+	"text":        func(t *Theme) *string { return &t.Text },
+	"dim":         func(t *Theme) *string { return &t.Dim },
+	"accent":      func(t *Theme) *string { return &t.Accent },
+	"selected_bg": func(t *Theme) *string { return &t.SelectedBg },
+	"button":      func(t *Theme) *string { return &t.Button },
+	"error":       func(t *Theme) *string { return &t.Error },
+	"warning":     func(t *Theme) *string { return &t.Warning },
+	"success":     func(t *Theme) *string { return &t.Success },
+}
+
+// Lookup returns the built-in theme called name ("" is the default)
+func Lookup(name string) (Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+	t, ok := Builtin[strings.ToLower(name)]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme: %s (valid: %s)", name, strings.Join(Names(), ", "))
+	}
+	return t, nil
+}
+
+// WithColors returns a copy of t with individual colors replaced, keyed by
+// title, text, dim, accent, selected_bg, button, error, warning or success
+func (t Theme) WithColors(colors map[string]string) (Theme, error) {
+	for key, color := range colors {
+		field, ok := themeColorKeys[strings.ToLower(key)]
+		if !ok {
+			var keys []string
+			for k := range themeColorKeys {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return Theme{}, fmt.Errorf("unknown theme color: %s (valid: %s)", key, strings.Join(keys, ", "))
+		}
+		*field(&t) = color
+	}
+	return t, nil
+}
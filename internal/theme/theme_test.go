@@ -0,0 +1,35 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"", "default", "Light", "mono"} {
+		if _, err := Lookup(name); err != nil {
+			t.Errorf("Lookup(%q): %v", name, err)
+		}
+	}
+	if _, err := Lookup("neon"); err == nil || !strings.Contains(err.Error(), "default, light, mono") {
+		t.Errorf("Lookup(neon) error = %v", err)
+	}
+}
+
+func TestWithColors(t *testing.T) {
+	base := Builtin["default"]
+	theme, err := base.WithColors(map[string]string{"accent": "#000001", "Selected_BG": "17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Accent != "#000001" || theme.SelectedBg != "17" {
+		t.Errorf("colors not applied: %+v", theme)
+	}
+	if base.Accent == theme.Accent {
+		t.Error("WithColors modified the original theme")
+	}
+
+	if _, err := base.WithColors(map[string]string{"sparkle": "#fff"}); err == nil {
+		t.Error("expected error for unknown color")
+	}
+}
@@ -0,0 +1,46 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wusher/tsunami/internal/keymap"
+	"github.com/wusher/tsunami/internal/ports"
+)
+
+func TestCustomKeymap(t *testing.T) {
+	k, err := keymap.Default().WithBindings(map[string][]string{"down": {"ctrl+n"}, "reverse": {"ctrl+o"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewModel()
+	m.SetSize(160, 24)
+	m.ApplyOptions(Options{Keymap: k})
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node"},
+		{Port: 8080, PID: 200, Process: "java"},
+	})
+
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlN})
+	updated := newModel.(Model)
+	if updated.cursor != 1 {
+		t.Errorf("cursor after ctrl+n = %d, want 1", updated.cursor)
+	}
+
+	newModel, _ = updated.Update(tea.KeyMsg{Type: tea.KeyDown})
+	updated = newModel.(Model)
+	if updated.cursor != 1 {
+		t.Errorf("unbound down arrow moved the cursor to %d", updated.cursor)
+	}
+
+	newModel, _ = updated.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+	updated = newModel.(Model)
+	if !updated.reverse {
+		t.Error("ctrl+o should reverse the sort")
+	}
+
+	if view := updated.View(); !strings.Contains(view, "ctrl+o reverse") {
+		t.Errorf("footer should show the rebound key:\n%s", view)
+	}
+}
@@ -4,7 +4,21 @@
 package tui
 
 import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/docker"
+	"github.com/wusher/tsunami/internal/keymap"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/labels"
+	"github.com/wusher/tsunami/internal/match"
 	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/query"
+	"github.com/wusher/tsunami/internal/systemd"
+	"github.com/wusher/tsunami/internal/theme"
 )
 
 // State represents the current TUI state
@@ -18,6 +32,35 @@ const (
 	StateQuit
 )
 
+// Options configures the TUI at startup
+type Options struct {
+	Columns []columns.Column // defaults to columns.Default()
+	SortKey ports.SortKey    // defaults to ports.SortByPort
+	Reverse bool
+	Policy  *killer.Policy // protected processes; nil protects nothing
+	Theme   theme.Theme    // applied when Name is set
+	Keymap  keymap.Keymap  // defaults to keymap.Default()
+	Filter  string         // initial filter query
+	// Signal is sent to a killed process; SIGTERM, the default, escalates
+	// to SIGKILL after Timeout
+	Signal killer.Signal
+	// Timeout is how long a process or container gets to stop before it is
+	// killed; defaults to killer.DefaultTimeout
+	Timeout time.Duration
+	// RespawnWindow is how long to watch a killed process's port for a
+	// supervisor restarting it; zero skips the watch
+	RespawnWindow time.Duration
+	// RespawnUnsupervised watches for a respawn after every kill, not only
+	// of processes with a recognized supervisor
+	RespawnUnsupervised bool
+	// Scan lists the listeners, e.g. in other network namespaces;
+	// ports.ScanContext if nil
+	Scan func(ctx context.Context) ([]ports.PortInfo, error)
+	// Labels labels the listeners' apps and projects; the built-in rules
+	// if nil
+	Labels *labels.Labeler
+}
+
 // Model represents the TUI state
 type Model struct {
 	ports      []ports.PortInfo
@@ -27,10 +70,61 @@ type Model struct {
 	state      State
 	selected   *ports.PortInfo
 	confirmYes bool
+	onlyPID    bool // kill the selected process, not the unit it is in
 	err        error
 	width      int
 	height     int
 	message    string
+
+	// Filter matching
+	matchMode match.Mode
+	matches   []rowMatch // parallel to filtered
+	filterErr error
+
+	// Table layout
+	columns []columns.Column
+	sortKey ports.SortKey
+	reverse bool
+
+	keymap keymap.Keymap
+
+	// Protection
+	policy    *killer.Policy
+	protected map[listener]error
+
+	// Kill in progress
+	escalation *killer.Escalation
+	progress   *killer.Event
+	spinner    int
+
+	// Lists the listeners; ports.ScanContext if nil
+	scan func(ctx context.Context) ([]ports.PortInfo, error)
+
+	// Labels the apps and projects of scanned listeners
+	labels *labels.Labeler
+
+	// Why the Docker daemon could not name the containers of proxies
+	dockerErr error
+
+	// How a process is killed and how long it gets to exit
+	signal  killer.Signal
+	timeout time.Duration
+
+	// Watch for a respawn after a kill
+	respawnWindow       time.Duration
+	respawnUnsupervised bool
+	watchRespawnAfter   bool // the process being killed may be restarted
+	killedAt            time.Time
+	watchingPort        bool
+
+	// Set by Run and cancelled by ctrl+c to interrupt a scan, a kill or the
+	// live refresh. Without it the list is scanned only once.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	watching bool
+
+	// Measures CPU usage between resource refreshes
+	cpu *ports.CPUSampler
 }
 
 // NewModel creates a new TUI model
@@ -38,28 +132,243 @@ func NewModel() Model {
 	return Model{
 		state:      StateList,
 		confirmYes: true, // Default to "Yes" selected
+		columns:    columns.Default(),
+		sortKey:    ports.SortByPort,
+		keymap:     keymap.Default(),
+		signal:     killer.SIGTERM,
+		timeout:    killer.DefaultTimeout,
+		cpu:        &ports.CPUSampler{},
+		labels:     labels.New(nil),
 	}
 }
 
+// ApplyOptions applies startup options to the model
+func (m *Model) ApplyOptions(opts Options) {
+	if len(opts.Columns) > 0 {
+		m.columns = opts.Columns
+	}
+	if opts.SortKey != "" {
+		m.sortKey = opts.SortKey
+	}
+	m.reverse = opts.Reverse
+	if opts.Keymap != nil {
+		m.keymap = opts.Keymap
+	}
+	if opts.Theme.Name != "" {
+		applyTheme(opts.Theme)
+	}
+	m.policy = opts.Policy
+	if opts.Signal != "" {
+		m.signal = opts.Signal
+	}
+	if opts.Timeout > 0 {
+		m.timeout = opts.Timeout
+	}
+	m.respawnWindow = opts.RespawnWindow
+	m.respawnUnsupervised = opts.RespawnUnsupervised
+	m.scan = opts.Scan
+	if opts.Labels != nil {
+		m.labels = opts.Labels
+	}
+	if opts.Filter != "" {
+		m.filter = opts.Filter
+	}
+	m.checkProtection()
+	m.applyFilter()
+}
+
 // SetPorts sets the port list and initializes filtered view
 func (m *Model) SetPorts(p []ports.PortInfo) {
 	m.ports = p
+	m.checkProtection()
 	m.applyFilter()
 }
 
-// applyFilter filters ports based on current filter string
-func (m *Model) applyFilter() {
-	if m.filter == "" {
-		m.filtered = m.ports
+// ApplyChanges updates the port list with watch events, keeping the
+// cursor on the same listener when it is still shown
+func (m *Model) ApplyChanges(events []ports.Event) {
+	selected := m.selectedKey()
+
+	for _, e := range events {
+		switch e.Kind {
+		case ports.Opened:
+			m.ports = append(removeListener(m.ports, e.Listener.Key()), e.Listener)
+		case ports.ConnectionsChanged:
+			for i := range m.ports {
+				if m.ports[i].Key() == e.Listener.Key() {
+					m.ports[i].Connections = e.Listener.Connections
+				}
+			}
+		case ports.Closed:
+			m.ports = removeListener(m.ports, e.Listener.Key())
+		case ports.OwnerChanged:
+			if e.Previous != nil {
+				m.ports = removeListener(m.ports, e.Previous.Key())
+			}
+			m.ports = append(removeListener(m.ports, e.Listener.Key()), e.Listener)
+		}
+	}
+	m.checkProtection()
+	m.applyFilter()
+	m.reselect(selected)
+}
+
+// ApplyResources updates the CPU, memory, threads, open files and state
+// of the listed processes from a resource refresh, keeping the cursor on
+// the same listener
+func (m *Model) ApplyResources(list []ports.PortInfo) {
+	selected := m.selectedKey()
+
+	byKey := make(map[ports.ListenerKey]ports.PortInfo, len(list))
+	for _, p := range list {
+		byKey[p.Key()] = p
+	}
+	for i := range m.ports {
+		r, ok := byKey[m.ports[i].Key()]
+		if !ok || !ports.SameProcess(r, m.ports[i]) {
+			continue
+		}
+		p := &m.ports[i]
+		p.CPU, p.CPUTime, p.Memory = r.CPU, r.CPUTime, r.Memory
+		p.Threads, p.FDs, p.State = r.Threads, r.FDs, r.State
+	}
+	m.applyFilter()
+	m.reselect(selected)
+}
+
+// selectedKey returns the key of the selected listener, or nil if there
+// is none
+func (m *Model) selectedKey() *ports.ListenerKey {
+	p := m.SelectedPort()
+	if p == nil {
+		return nil
+	}
+	k := p.Key()
+	return &k
+}
+
+// reselect moves the cursor back to the listener k if it is still shown
+func (m *Model) reselect(k *ports.ListenerKey) {
+	if k == nil {
 		return
 	}
+	for i, p := range m.filtered {
+		if p.Key() == *k {
+			m.cursor = i
+			return
+		}
+	}
+}
 
-	m.filtered = nil
+// removeListener returns list without the listener k
+func removeListener(list []ports.PortInfo, k ports.ListenerKey) []ports.PortInfo {
+	result := list[:0:0]
+	for _, p := range list {
+		if p.Key() != k {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// listener identifies one row of the port list
+type listener struct{ pid, port int }
+
+// checkProtection records which rows the policy refuses to kill
+func (m *Model) checkProtection() {
+	m.protected = nil
+	if m.policy == nil {
+		return
+	}
 	for _, p := range m.ports {
-		if matchesFilter(p, m.filter) {
-			m.filtered = append(m.filtered, p)
+		err := m.policy.Check(killer.Target{PID: p.PID, Port: p.Port, Name: p.Process, User: p.User, Unit: systemd.HeldSocket(p)})
+		if err != nil {
+			if m.protected == nil {
+				m.protected = make(map[listener]error)
+			}
+			m.protected[listener{p.PID, p.Port}] = err
 		}
 	}
+}
+
+// Protection returns why p may not be killed, or nil if it may
+func (m *Model) Protection(p ports.PortInfo) error {
+	if err := m.protected[listener{p.PID, p.Port}]; err != nil {
+		return err
+	}
+	return docker.CheckProxy(p, m.dockerErr)
+}
+
+// searchFields are the fields the filter matches against, keyed by the
+// column that displays them
+var searchFields = []struct {
+	key   string
+	value func(ports.PortInfo) string
+}{
+	{"process", func(p ports.PortInfo) string { return p.Process }},
+	{"cmdline", func(p ports.PortInfo) string { return p.Cmdline }},
+	{"label", ports.PortInfo.Label},
+	{"user", func(p ports.PortInfo) string { return p.User }},
+	{"port", func(p ports.PortInfo) string {
+		if p.Unix() {
+			return ""
+		}
+		return strconv.Itoa(p.Port)
+	}},
+	{"address", func(p ports.PortInfo) string { return p.Address }},
+	{"container", columns.ContainerName},
+	{"unit", func(p ports.PortInfo) string {
+		if p.Unit == nil {
+			return ""
+		}
+		return p.Unit.Name
+	}},
+}
+
+// rowMatch records how a row matched the filter
+type rowMatch struct {
+	score     int
+	positions map[string][]int // column key → matched rune positions
+}
+
+// applyFilter filters ports based on current filter string. Rows are
+// ordered by the current sort key and, while filtering, ranked by score.
+func (m *Model) applyFilter() {
+	m.filtered = nil
+	m.matches = nil
+	m.filterErr = nil
+
+	include, matchers, err := compileFilter(m.matchMode, m.filter)
+	if err != nil {
+		m.filterErr = err
+		m.cursor = 0
+		return
+	}
+
+	sorted := append([]ports.PortInfo(nil), m.ports...)
+	ports.Sort(sorted, m.sortKey, m.reverse)
+
+	type scoredRow struct {
+		port  ports.PortInfo
+		match rowMatch
+	}
+	var rows []scoredRow
+	for _, p := range sorted {
+		if include(p) {
+			rm, _ := scoreRow(matchers, p)
+			rows = append(rows, scoredRow{p, rm})
+		}
+	}
+	if len(matchers) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].match.score > rows[j].match.score
+		})
+	}
+
+	for _, r := range rows {
+		m.filtered = append(m.filtered, r.port)
+		m.matches = append(m.matches, r.match)
+	}
 
 	// Reset cursor if out of bounds
 	if m.cursor >= len(m.filtered) {
@@ -67,51 +376,122 @@ func (m *Model) applyFilter() {
 	}
 }
 
-// matchesFilter checks if a port matches the filter string
-func matchesFilter(p ports.PortInfo, filter string) bool {
-	// Match against port number, process name, or user
-	portStr := string(rune('0' + p.Port%10))
-	for n := p.Port / 10; n > 0; n /= 10 {
-		portStr = string(rune('0'+n%10)) + portStr
+// compileFilter turns the filter text into a row predicate and the
+// matchers used to score and highlight the rows it keeps. In regex mode
+// the whole filter is one pattern; otherwise it is a query (see the query
+// package) whose bare words are matched using mode.
+func compileFilter(mode match.Mode, filter string) (func(ports.PortInfo) bool, []*match.Matcher, error) {
+	if mode == match.Regex {
+		matcher, err := match.New(mode, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		if matcher.Empty() {
+			return func(ports.PortInfo) bool { return true }, nil, nil
+		}
+		include := func(p ports.PortInfo) bool {
+			_, ok := matchRow(matcher, p)
+			return ok
+		}
+		return include, []*match.Matcher{matcher}, nil
 	}
 
-	return contains(portStr, filter) ||
-		containsIgnoreCase(p.Process, filter) ||
-		containsIgnoreCase(p.User, filter)
-}
+	q, err := query.Parse(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Fuzzy and exact matchers never fail to compile
+	wordMatchers := make(map[string]*match.Matcher)
+	matcherFor := func(word string) *match.Matcher {
+		if mt, ok := wordMatchers[word]; ok {
+			return mt
+		}
+		mt, _ := match.New(mode, word)
+		wordMatchers[word] = mt
+		return mt
+	}
+	q.MatchWord = func(p ports.PortInfo, word string) bool {
+		_, ok := matchRow(matcherFor(word), p)
+		return ok
+	}
 
-// contains checks if substr is present in s.
-func contains(s, substr string) bool {
-	return len(substr) <= len(s) && findSubstring(s, substr) != -1
+	var matchers []*match.Matcher
+	for _, word := range q.Words() {
+		matchers = append(matchers, matcherFor(word))
+	}
+	return q.Match, matchers, nil
 }
 
-// containsIgnoreCase checks if substr is present in s, ignoring case.
-func containsIgnoreCase(s, substr string) bool {
-	return contains(toLower(s), toLower(substr))
+// matchRow matches every search field of p, scoring the row by its best field
+func matchRow(matcher *match.Matcher, p ports.PortInfo) (rowMatch, bool) {
+	if matcher.Empty() {
+		return rowMatch{}, true
+	}
+
+	rm := rowMatch{positions: make(map[string][]int)}
+	matched := false
+	for _, f := range searchFields {
+		res, ok := matcher.Match(f.value(p))
+		if !ok {
+			continue
+		}
+		if !matched || res.Score > rm.score {
+			rm.score = res.Score
+		}
+		matched = true
+		rm.positions[f.key] = res.Positions
+	}
+	return rm, matched
 }
 
-// toLower converts ASCII characters to lowercase.
-func toLower(s string) string {
-	b := make([]byte, len(s))
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			b[i] = c + 32
-		} else {
-			b[i] = c
+// scoreRow combines the matches of several words against p: scores add up
+// and highlighted positions are merged
+func scoreRow(matchers []*match.Matcher, p ports.PortInfo) (rowMatch, bool) {
+	combined := rowMatch{}
+	matched := false
+	for _, matcher := range matchers {
+		rm, ok := matchRow(matcher, p)
+		if !ok {
+			continue
+		}
+		matched = true
+		combined.score += rm.score
+		for key, pos := range rm.positions {
+			if combined.positions == nil {
+				combined.positions = make(map[string][]int)
+			}
+			combined.positions[key] = mergePositions(combined.positions[key], pos)
 		}
 	}
-	return string(b)
+	return combined, matched
 }
 
-// findSubstring returns the index of substr in s, or -1 if not found.
-func findSubstring(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
+// mergePositions returns the sorted union of two sorted position lists
+func mergePositions(a, b []int) []int {
+	result := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var next int
+		switch {
+		case j >= len(b) || (i < len(a) && a[i] < b[j]):
+			next, i = a[i], i+1
+		case i >= len(a) || b[j] < a[i]:
+			next, j = b[j], j+1
+		default:
+			next, i, j = a[i], i+1, j+1
 		}
+		result = append(result, next)
+	}
+	return result
+}
+
+// highlights returns the matched positions for the filtered row at index i
+func (m *Model) highlights(i int) map[string][]int {
+	if i < 0 || i >= len(m.matches) {
+		return nil
 	}
-	return -1
+	return m.matches[i].positions
 }
 
 // SelectedPort returns the currently selected port
@@ -145,7 +525,8 @@ func (m *Model) AddFilterChar(c rune) {
 // DeleteFilterChar removes the last character from filter
 func (m *Model) DeleteFilterChar() {
 	if len(m.filter) > 0 {
-		m.filter = m.filter[:len(m.filter)-1]
+		runes := []rune(m.filter)
+		m.filter = string(runes[:len(runes)-1])
 		m.applyFilter()
 	}
 }
@@ -156,6 +537,36 @@ func (m *Model) ClearFilter() {
 	m.applyFilter()
 }
 
+// CycleMatchMode switches between fuzzy, exact and regex filtering
+func (m *Model) CycleMatchMode() {
+	m.matchMode = m.matchMode.Next()
+	m.applyFilter()
+}
+
+// CycleSort moves to the next (or previous) sort key
+func (m *Model) CycleSort(forward bool) {
+	idx := 0
+	for i, k := range ports.SortKeys {
+		if k == m.sortKey {
+			idx = i
+			break
+		}
+	}
+	if forward {
+		idx = (idx + 1) % len(ports.SortKeys)
+	} else {
+		idx = (idx - 1 + len(ports.SortKeys)) % len(ports.SortKeys)
+	}
+	m.sortKey = ports.SortKeys[idx]
+	m.applyFilter()
+}
+
+// ToggleReverse flips the sort order
+func (m *Model) ToggleReverse() {
+	m.reverse = !m.reverse
+	m.applyFilter()
+}
+
 // EnterConfirm transitions to confirm state
 func (m *Model) EnterConfirm() {
 	if p := m.SelectedPort(); p != nil {
@@ -176,9 +587,10 @@ func (m *Model) CancelConfirm() {
 	m.selected = nil
 }
 
-// Confirm confirms the action and returns selected port
+// Confirm confirms the action and returns selected port. Protected
+// processes are never returned.
 func (m *Model) Confirm() *ports.PortInfo {
-	if m.confirmYes && m.selected != nil {
+	if m.confirmYes && m.selected != nil && m.Protection(*m.selected) == nil {
 		return m.selected
 	}
 	return nil
@@ -195,6 +607,11 @@ func (m *Model) SetMessage(msg string) {
 	m.message = msg
 }
 
+// SetProgress records the latest escalation event of the kill in progress
+func (m *Model) SetProgress(e killer.Event) {
+	m.progress = &e
+}
+
 // Quit transitions to quit state
 func (m *Model) Quit() {
 	m.state = StateQuit
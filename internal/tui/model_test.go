@@ -1,8 +1,14 @@
 package tui
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/match"
 	"github.com/wusher/tsunami/internal/ports"
 )
 
@@ -154,6 +160,24 @@ func TestFilterByUser(t *testing.T) {
 	}
 }
 
+func TestFilterByLabel(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", Proto: "tcp", App: "next", Project: "acme-docs"},
+		{Port: 5173, PID: 200, Process: "node", Proto: "tcp", App: "vite", Project: "acme-web"},
+	})
+
+	for _, c := range "acmeweb" {
+		m.AddFilterChar(c)
+	}
+	if len(m.filtered) != 1 || m.filtered[0].PID != 200 {
+		t.Fatalf("filter 'acmeweb': filtered = %+v, expected vite only", m.filtered)
+	}
+	if pos := m.highlights(0)["label"]; len(pos) == 0 {
+		t.Error("filter 'acmeweb' should highlight the label")
+	}
+}
+
 func TestFilterCursorReset(t *testing.T) {
 	m := NewModel()
 	m.SetPorts([]ports.PortInfo{
@@ -316,125 +340,394 @@ func TestSetSize(t *testing.T) {
 	}
 }
 
-func TestContains(t *testing.T) {
+func TestApplyFilterFuzzy(t *testing.T) {
+	port := ports.PortInfo{
+		Port:    3000,
+		PID:     100,
+		Process: "node",
+		User:    "mike",
+		Proto:   "tcp",
+	}
+
 	tests := []struct {
-		s, substr string
-		expected  bool
+		filter   string
+		expected bool
 	}{
-		{"hello", "ell", true},
-		{"hello", "world", false},
-		{"hello", "hello", true},
-		{"hello", "", true},
-		{"", "", true},
-		{"", "a", false},
-		{"abc", "abcd", false},
+		{"3000", true},
+		{"300", true},
+		{"30", true},
+		{"node", true},
+		{"NODE", true},
+		{"mike", true},
+		{"MIKE", true},
+		{"java", false},
+		{"alice", false},
+		{"999", false},
+		{"nd", true},
+		{"mk", true},
 	}
 
 	for _, tt := range tests {
-		result := contains(tt.s, tt.substr)
-		if result != tt.expected {
-			t.Errorf("contains(%q, %q) = %v, expected %v", tt.s, tt.substr, result, tt.expected)
+		m := NewModel()
+		m.SetPorts([]ports.PortInfo{port})
+		m.filter = tt.filter
+		m.applyFilter()
+		if result := len(m.filtered) == 1; result != tt.expected {
+			t.Errorf("filter %q matched = %v, expected %v", tt.filter, result, tt.expected)
 		}
 	}
 }
 
-func TestContainsIgnoreCase(t *testing.T) {
-	tests := []struct {
-		s, substr string
-		expected  bool
-	}{
-		{"Hello", "ell", true},
-		{"HELLO", "ell", true},
-		{"hello", "ELL", true},
-		{"HeLLo", "eLl", true},
-		{"hello", "world", false},
+type testError struct {
+	msg string
+}
+
+func (e *testError) Error() string {
+	return e.msg
+}
+
+func TestCycleSort(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 300, Process: "node"},
+		{Port: 8080, PID: 100, Process: "apache"},
+	})
+
+	if m.filtered[0].Port != 3000 {
+		t.Fatalf("default sort should be by port")
 	}
 
-	for _, tt := range tests {
-		result := containsIgnoreCase(tt.s, tt.substr)
-		if result != tt.expected {
-			t.Errorf("containsIgnoreCase(%q, %q) = %v, expected %v", tt.s, tt.substr, result, tt.expected)
-		}
+	m.CycleSort(true)
+	if m.sortKey != ports.SortByPID {
+		t.Errorf("sortKey = %q, expected pid", m.sortKey)
+	}
+	if m.filtered[0].PID != 100 {
+		t.Errorf("filtered should be resorted by PID, got %+v", m.filtered)
+	}
+
+	m.CycleSort(false)
+	m.CycleSort(false)
+	if m.sortKey != ports.SortKeys[len(ports.SortKeys)-1] {
+		t.Errorf("cycling back from port should wrap to %q, got %q", ports.SortKeys[len(ports.SortKeys)-1], m.sortKey)
 	}
 }
 
-func TestToLower(t *testing.T) {
-	tests := []struct {
-		input, expected string
-	}{
-		{"HELLO", "hello"},
-		{"hello", "hello"},
-		{"HeLLo", "hello"},
-		{"123ABC", "123abc"},
-		{"", ""},
+func TestToggleReverse(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 300},
+		{Port: 8080, PID: 100},
+	})
+
+	m.ToggleReverse()
+	if !m.reverse || m.filtered[0].Port != 8080 {
+		t.Errorf("reverse should put 8080 first, got %+v", m.filtered)
 	}
+}
 
-	for _, tt := range tests {
-		result := toLower(tt.input)
-		if result != tt.expected {
-			t.Errorf("toLower(%q) = %q, expected %q", tt.input, result, tt.expected)
-		}
+func TestApplyOptions(t *testing.T) {
+	m := NewModel()
+	cols, _ := columns.Parse("port,cmdline")
+	m.ApplyOptions(Options{Columns: cols, SortKey: ports.SortByMemory, Reverse: true})
+
+	if len(m.columns) != 2 || m.columns[1].Key != "cmdline" {
+		t.Errorf("columns = %+v, expected port,cmdline", m.columns)
+	}
+	if m.sortKey != ports.SortByMemory || !m.reverse {
+		t.Errorf("sort = %q reverse=%v, expected memory reversed", m.sortKey, m.reverse)
+	}
+
+	// Empty options keep defaults
+	m = NewModel()
+	m.ApplyOptions(Options{})
+	if len(m.columns) != len(columns.DefaultKeys) || m.sortKey != ports.SortByPort {
+		t.Error("empty options should keep default columns and sort")
+	}
+	if m.signal != killer.SIGTERM || m.timeout != killer.DefaultTimeout {
+		t.Errorf("signal = %s timeout = %v, expected SIGTERM after %v", m.signal, m.timeout, killer.DefaultTimeout)
+	}
+
+	m.ApplyOptions(Options{Signal: killer.SIGINT, Timeout: 5 * time.Second})
+	if m.signal != killer.SIGINT || m.timeout != 5*time.Second {
+		t.Errorf("signal = %s timeout = %v, expected INT and 5s", m.signal, m.timeout)
+	}
+}
+
+func TestApplyOptionsFilter(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node"},
+		{Port: 5432, PID: 200, Process: "postgres"},
+		{Port: 8080, PID: 300, Process: "java"},
+	})
+	m.ApplyOptions(Options{Filter: "port:8080,5000-5500"})
+
+	if m.filter != "port:8080,5000-5500" {
+		t.Errorf("filter = %q", m.filter)
+	}
+	if len(m.filtered) != 2 || m.filtered[0].Port != 5432 || m.filtered[1].Port != 8080 {
+		t.Errorf("filtered = %+v, want 5432 and 8080", m.filtered)
+	}
+}
+
+func TestFilterFuzzyRanking(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "server", Cmdline: "node /srv/very/inactive/terminal/emulator"},
+		{Port: 5173, PID: 200, Process: "node", Cmdline: "node node_modules/.bin/vite"},
+	})
+
+	for _, r := range "vite" {
+		m.AddFilterChar(r)
+	}
+
+	if len(m.filtered) != 2 {
+		t.Fatalf("len(filtered) = %d, expected 2", len(m.filtered))
+	}
+	if m.filtered[0].Port != 5173 {
+		t.Errorf("best match should be ranked first, got port %d", m.filtered[0].Port)
+	}
+	if len(m.highlights(0)["cmdline"]) != 4 {
+		t.Errorf("highlights = %v, expected 4 cmdline positions", m.highlights(0))
+	}
+	if m.highlights(5) != nil {
+		t.Error("highlights out of range should be nil")
+	}
+}
+
+func TestFilterMatchModes(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node"},
+		{Port: 8080, PID: 200, Process: "nginx"},
+	})
+
+	m.AddFilterChar('n')
+	m.AddFilterChar('d')
+	if len(m.filtered) != 1 {
+		t.Errorf("fuzzy 'nd': len(filtered) = %d, expected 1", len(m.filtered))
+	}
+
+	m.CycleMatchMode()
+	if m.matchMode != match.Exact {
+		t.Fatalf("matchMode = %v, expected exact", m.matchMode)
+	}
+	if len(m.filtered) != 0 {
+		t.Errorf("exact 'nd': len(filtered) = %d, expected 0", len(m.filtered))
+	}
+
+	m.CycleMatchMode()
+	m.ClearFilter()
+	for _, r := range "^n.*x$" {
+		m.AddFilterChar(r)
+	}
+	if len(m.filtered) != 1 || m.filtered[0].Process != "nginx" {
+		t.Errorf("regex '^n.*x$': filtered = %+v, expected nginx", m.filtered)
+	}
+}
+
+func TestFilterInvalidRegex(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 100, Process: "node"}})
+	m.matchMode = match.Regex
+
+	m.AddFilterChar('(')
+	if m.filterErr == nil {
+		t.Error("invalid regex should set filterErr")
+	}
+	if len(m.filtered) != 0 {
+		t.Error("invalid regex should match nothing")
+	}
+
+	m.DeleteFilterChar()
+	if m.filterErr != nil || len(m.filtered) != 1 {
+		t.Error("clearing the bad pattern should restore the list")
+	}
+}
+
+func TestFilterUnicode(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "Ärger-service"},
+		{Port: 4000, PID: 200, Process: "node"},
+	})
+
+	m.AddFilterChar('ä')
+	if len(m.filtered) != 1 || m.filtered[0].Port != 3000 {
+		t.Errorf("filter 'ä' should match 'Ärger-service', got %+v", m.filtered)
+	}
+
+	// Deleting removes the whole rune, not a byte
+	m.DeleteFilterChar()
+	if m.filter != "" {
+		t.Errorf("filter after delete = %q, expected empty", m.filter)
 	}
 }
 
-func TestFindSubstring(t *testing.T) {
+func TestFilterQuery(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "alice"},
+		{Port: 5173, PID: 200, Process: "node", User: "alice", Cmdline: "node vite"},
+		{Port: 8080, PID: 300, Process: "java", User: "ci"},
+	})
+
 	tests := []struct {
-		s, substr string
-		expected  int
+		filter string
+		want   []int
 	}{
-		{"hello", "ell", 1},
-		{"hello", "world", -1},
-		{"hello", "hello", 0},
-		{"hello", "o", 4},
-		{"hello", "", 0},
-		{"", "", 0},
+		{"port>4000", []int{5173, 8080}},
+		{"nd port>4000", []int{5173}},
+		{"user=alice not vite", []int{3000}},
+		{"proc=java or vite", []int{5173, 8080}},
 	}
-
 	for _, tt := range tests {
-		result := findSubstring(tt.s, tt.substr)
-		if result != tt.expected {
-			t.Errorf("findSubstring(%q, %q) = %d, expected %d", tt.s, tt.substr, result, tt.expected)
+		m.filter = tt.filter
+		m.applyFilter()
+		if m.filterErr != nil {
+			t.Errorf("filter %q: unexpected error %v", tt.filter, m.filterErr)
+			continue
+		}
+		var got []int
+		for _, p := range m.filtered {
+			got = append(got, p.Port)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filter %q: ports = %v, expected %v", tt.filter, got, tt.want)
 		}
 	}
 }
 
-func TestMatchesFilter(t *testing.T) {
-	port := ports.PortInfo{
-		Port:    3000,
-		PID:     100,
-		Process: "node",
-		User:    "mike",
-		Proto:   "tcp",
+func TestFilterQueryHighlights(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 5173, PID: 200, Process: "node", Cmdline: "node vite"}})
+	m.matchMode = match.Exact
+	m.filter = "vite node port>1000 not java"
+	m.applyFilter()
+
+	if len(m.filtered) != 1 {
+		t.Fatalf("len(filtered) = %d, expected 1", len(m.filtered))
 	}
+	// Both words are highlighted in the command line, in order
+	want := []int{0, 1, 2, 3, 5, 6, 7, 8}
+	if got := m.highlights(0)["cmdline"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("cmdline highlights = %v, expected %v", got, want)
+	}
+}
 
+func TestFilterInvalidQuery(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 100, Process: "node"}})
+
+	m.filter = "port>="
+	m.applyFilter()
+	if m.filterErr == nil {
+		t.Fatal("incomplete query should set filterErr")
+	}
+	if !strings.Contains(m.filterErr.Error(), "missing value") {
+		t.Errorf("filterErr = %v, expected a missing value error", m.filterErr)
+	}
+	if len(m.filtered) != 0 {
+		t.Error("invalid query should match nothing")
+	}
+
+	// In regex mode the whole filter is one pattern, not a query
+	m.matchMode = match.Regex
+	m.filter = "no|port"
+	m.applyFilter()
+	if m.filterErr != nil || len(m.filtered) != 1 {
+		t.Errorf("regex 'no|port': err = %v, len(filtered) = %d", m.filterErr, len(m.filtered))
+	}
+}
+
+func TestMergePositions(t *testing.T) {
 	tests := []struct {
-		filter   string
-		expected bool
+		a, b, want []int
 	}{
-		{"3000", true},
-		{"300", true},
-		{"30", true},
-		{"node", true},
-		{"NODE", true},
-		{"mike", true},
-		{"MIKE", true},
-		{"java", false},
-		{"alice", false},
-		{"999", false},
+		{nil, nil, []int{}},
+		{[]int{1, 3}, nil, []int{1, 3}},
+		{[]int{0, 2, 4}, []int{1, 2, 5}, []int{0, 1, 2, 4, 5}},
 	}
-
 	for _, tt := range tests {
-		result := matchesFilter(port, tt.filter)
-		if result != tt.expected {
-			t.Errorf("matchesFilter(port, %q) = %v, expected %v", tt.filter, result, tt.expected)
+		if got := mergePositions(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mergePositions(%v, %v) = %v, expected %v", tt.a, tt.b, got, tt.want)
 		}
 	}
 }
 
-type testError struct {
-	msg string
+func TestApplyResources(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	node := ports.PortInfo{Port: 3000, PID: 100, Process: "node", Proto: "tcp", StartTime: start, Slice: "app.slice"}
+	java := ports.PortInfo{Port: 8080, PID: 300, Process: "java", Proto: "tcp", StartTime: start}
+
+	m := NewModel()
+	m.sortKey = ports.SortByCPU
+	m.SetPorts([]ports.PortInfo{node, java})
+	m.MoveDown() // java
+
+	busy := node
+	busy.Slice = ""
+	busy.CPU, busy.Threads, busy.FDs, busy.State, busy.Memory = 95, 12, 40, "R", 4096
+	reused := java
+	reused.StartTime = time.Now() // a different process got the PID
+	reused.CPU = 50
+	m.ApplyResources([]ports.PortInfo{busy, reused})
+
+	p := m.filtered[0]
+	if p.PID != 100 || p.CPU != 95 || p.Threads != 12 || p.FDs != 40 || p.State != "R" || p.Memory != 4096 || p.Slice != "app.slice" {
+		t.Errorf("filtered[0] = %+v, want node refreshed and sorted first", p)
+	}
+	if m.filtered[1].CPU != 0 {
+		t.Errorf("java CPU = %v, want it left alone for a reused PID", m.filtered[1].CPU)
+	}
+	if s := m.SelectedPort(); s == nil || s.PID != 300 {
+		t.Errorf("selection moved to %+v, expected java", s)
+	}
 }
 
-func (e *testError) Error() string {
-	return e.msg
+func TestApplyChanges(t *testing.T) {
+	node := ports.PortInfo{Port: 3000, PID: 100, Process: "node", Proto: "tcp"}
+	vite := ports.PortInfo{Port: 5173, PID: 200, Process: "vite", Proto: "tcp"}
+	java := ports.PortInfo{Port: 8080, PID: 300, Process: "java", Proto: "tcp"}
+	newJava := ports.PortInfo{Port: 8080, PID: 301, Process: "java", Proto: "tcp"}
+
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{node, java})
+	m.MoveDown() // java
+
+	m.ApplyChanges([]ports.Event{
+		{Kind: ports.Opened, Listener: vite},
+		{Kind: ports.Opened, Listener: node}, // already shown
+	})
+	if len(m.filtered) != 3 {
+		t.Fatalf("len(filtered) = %d, expected 3", len(m.filtered))
+	}
+	if p := m.SelectedPort(); p == nil || p.PID != 300 {
+		t.Errorf("selection moved to %+v, expected java", p)
+	}
+
+	m.ApplyChanges([]ports.Event{
+		{Kind: ports.OwnerChanged, Listener: newJava, Previous: &java},
+		{Kind: ports.Closed, Listener: node},
+	})
+	var pids []int
+	for _, p := range m.filtered {
+		pids = append(pids, p.PID)
+	}
+	if !reflect.DeepEqual(pids, []int{200, 301}) {
+		t.Errorf("PIDs = %v, expected [200 301]", pids)
+	}
+	if m.cursor != 1 {
+		t.Errorf("cursor = %d, expected it clamped to the last row", m.cursor)
+	}
+
+	// A connection change keeps what the model knows of the listener
+	m.ports[0].Slice = "app.slice"
+	busy := m.ports[0]
+	busy.Slice = ""
+	busy.Connections = []ports.Connection{{Remote: "127.0.0.1:51000", State: "ESTABLISHED"}}
+	m.ApplyChanges([]ports.Event{{Kind: ports.ConnectionsChanged, Listener: busy}})
+	if p := m.ports[0]; len(p.Connections) != 1 || p.Slice != "app.slice" || len(m.ports) != 2 {
+		t.Errorf("after a connection change ports = %+v", m.ports)
+	}
 }
@@ -0,0 +1,48 @@
+package tui
+
+import (
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/wusher/tsunami/internal/theme"
+)
+
+// applyTheme rebuilds the package styles from t
+func applyTheme(t theme.Theme) {
+	color := func(c string) lipgloss.TerminalColor {
+		if c == "" {
+			return lipgloss.NoColor{}
+		}
+		return lipgloss.Color(c)
+	}
+
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(color(t.Title))
+	subtitleStyle = lipgloss.NewStyle().Foreground(color(t.Dim))
+	selectedStyle = lipgloss.NewStyle().
+		Background(color(t.SelectedBg)).
+		Foreground(color(t.Text)).
+		Bold(true)
+	if t.SelectedBg == "" {
+		// Without colors the selection still needs to stand out
+		selectedStyle = selectedStyle.Reverse(true)
+	}
+	systemPortStyle = lipgloss.NewStyle().Foreground(color(t.Error))
+	userPortStyle = lipgloss.NewStyle().Foreground(color(t.Success))
+	ephemeralPortStyle = lipgloss.NewStyle().Foreground(color(t.Warning))
+	zombieStyle = lipgloss.NewStyle().Foreground(color(t.Error))
+	stoppedStyle = lipgloss.NewStyle().Foreground(color(t.Warning))
+	matchStyle = lipgloss.NewStyle().Foreground(color(t.Accent)).Bold(true).Underline(true)
+	selectedMatchStyle = selectedStyle.Foreground(color(t.Accent)).Underline(true)
+	filterStyle = lipgloss.NewStyle().Foreground(color(t.Accent))
+	dimStyle = lipgloss.NewStyle().Foreground(color(t.Dim))
+	headerStyle = lipgloss.NewStyle().Bold(true).Foreground(color(t.Text))
+	warningStyle = lipgloss.NewStyle().Foreground(color(t.Warning)).Bold(true)
+	errorStyle = lipgloss.NewStyle().Foreground(color(t.Error)).Bold(true)
+	successStyle = lipgloss.NewStyle().Foreground(color(t.Success)).Bold(true)
+	activeButtonStyle = buttonStyle.
+		Background(color(t.SelectedBg)).
+		Foreground(color(t.Text)).
+		Bold(true)
+	inactiveButtonStyle = buttonStyle.
+		Background(color(t.Button)).
+		Foreground(color(t.Dim))
+}
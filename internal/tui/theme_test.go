@@ -0,0 +1,26 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/wusher/tsunami/internal/theme"
+)
+
+func TestApplyTheme(t *testing.T) {
+	defer applyTheme(theme.Builtin["default"])
+
+	m := NewModel()
+	m.ApplyOptions(Options{Theme: theme.Builtin["light"]})
+	if got := filterStyle.GetForeground(); got != lipgloss.Color("#AF005F") {
+		t.Errorf("filter color = %v, want light accent", got)
+	}
+
+	applyTheme(theme.Builtin["mono"])
+	if _, ok := filterStyle.GetForeground().(lipgloss.NoColor); !ok {
+		t.Errorf("mono filter color = %v, want none", filterStyle.GetForeground())
+	}
+	if !selectedStyle.GetReverse() {
+		t.Error("mono selection should use reverse video")
+	}
+}
@@ -1,13 +1,24 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	"github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/docker"
+	"github.com/wusher/tsunami/internal/keymap"
 	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/labels"
 	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/respawn"
+	"github.com/wusher/tsunami/internal/systemd"
 )
 
 // Styles
@@ -33,6 +44,24 @@ var (
 	ephemeralPortStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("#FFFC58"))
 
+	plainStyle = lipgloss.NewStyle()
+
+	// Rows of zombie and stopped processes
+	zombieStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF6B6B"))
+
+	stoppedStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FFFC58"))
+
+	matchStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF79C6")).
+			Bold(true).
+			Underline(true)
+
+	selectedMatchStyle = selectedStyle.
+				Foreground(lipgloss.Color("#FF79C6")).
+				Underline(true)
+
 	filterStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#FF79C6"))
 
@@ -70,9 +99,22 @@ var (
 )
 
 // Messages
-type portsScannedMsg struct {
+type resourcesMsg struct {
 	ports []ports.PortInfo
-	err   error
+}
+
+type portsScannedMsg struct {
+	ports     []ports.PortInfo
+	err       error
+	dockerErr error // why the Docker daemon could not be asked
+}
+
+// portsChangedMsg carries watch events together with the channel they
+// came from so the next read can be scheduled
+type portsChangedMsg struct {
+	events    []ports.Event
+	changes   <-chan ports.Event
+	dockerErr error
 }
 
 type killResultMsg struct {
@@ -80,25 +122,339 @@ type killResultMsg struct {
 	err     error
 }
 
+// respawnMsg carries the processes that took a killed process's port back
+type respawnMsg struct {
+	found []respawn.Respawn
+}
+
+// progressMsg carries an escalation event together with the channel it
+// came from so the next read can be scheduled
+type progressMsg struct {
+	event  killer.Event
+	events <-chan killer.Event
+}
+
+type spinnerTickMsg struct{}
+
+// spinnerFrames are cycled while a kill is in progress
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
 // Init initializes the TUI
 func (m Model) Init() tea.Cmd {
-	return scanPorts
+	return scanPorts(m.context(), m.scan, m.labels)
+}
+
+// context returns the context that interrupts scans and kills
+func (m Model) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// scanPorts scans for listening ports with scan, or ports.ScanContext if
+// it is nil, until ctx is done, labelling them with l
+func scanPorts(ctx context.Context, scan func(context.Context) ([]ports.PortInfo, error), l *labels.Labeler) tea.Cmd {
+	if scan == nil {
+		scan = ports.ScanContext
+	}
+	return func() tea.Msg {
+		p, err := scan(ctx)
+		var dockerErr error
+		if err == nil {
+			dockerErr = annotateListeners(ctx, p, l)
+		}
+		return portsScannedMsg{ports: p, err: err, dockerErr: dockerErr}
+	}
+}
+
+// annotateListeners names the containers behind docker-proxy listeners
+// and the Docker containers listeners run in, if the daemon can be
+// reached, adds the socket units and restart policies systemctl knows,
+// and labels the apps and projects with l. It returns the error of asking
+// the Docker daemon.
+func annotateListeners(ctx context.Context, list []ports.PortInfo, l *labels.Labeler) error {
+	dockerErr := docker.Annotate(ctx, list)
+	_ = systemd.Annotate(ctx, list)
+	l.Annotate(list)
+	return dockerErr
+}
+
+// refreshResources re-reads the resources of the processes in list once
+// the watch interval has passed, measuring their CPU usage since the
+// previous refresh with cpu
+func refreshResources(ctx context.Context, list []ports.PortInfo, cpu *ports.CPUSampler) tea.Cmd {
+	list = append([]ports.PortInfo(nil), list...)
+	return tea.Tick(ports.DefaultWatchInterval, func(time.Time) tea.Msg {
+		ports.RefreshResources(ctx, list)
+		cpu.Sample(list, time.Now())
+		return resourcesMsg{ports: list}
+	})
+}
+
+// watchPorts starts watching for listeners that open, close, change owner
+// or gain or lose connections. The first events re-report the listeners
+// already shown, which covers any change since the initial scan. A nil
+// scan uses the default scanner.
+func watchPorts(ctx context.Context, scan func(context.Context) ([]ports.PortInfo, error), l *labels.Labeler) tea.Cmd {
+	return func() tea.Msg {
+		changes, err := ports.Watch(ctx, ports.WatchOptions{Initial: true, Connections: true, Scan: scan})
+		if err != nil {
+			return nil // keep the list from the initial scan
+		}
+		return waitForChanges(ctx, changes, l)()
+	}
+}
+
+// waitForChanges delivers the next watch events as a message, batching
+// the events that are already waiting
+func waitForChanges(ctx context.Context, changes <-chan ports.Event, l *labels.Labeler) tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-changes
+		if !ok {
+			return nil
+		}
+		events := []ports.Event{e}
+		for {
+			select {
+			case e, ok := <-changes:
+				if !ok {
+					dockerErr := annotateEvents(ctx, events, l)
+					return portsChangedMsg{events: events, dockerErr: dockerErr}
+				}
+				events = append(events, e)
+			default:
+				dockerErr := annotateEvents(ctx, events, l)
+				return portsChangedMsg{events: events, changes: changes, dockerErr: dockerErr}
+			}
+		}
+	}
+}
+
+// annotateEvents annotates new listeners like the initial scan, returning
+// the error of asking the Docker daemon
+func annotateEvents(ctx context.Context, events []ports.Event, l *labels.Labeler) error {
+	var listeners []ports.PortInfo
+	var annotated []int
+	for i, e := range events {
+		// The model keeps what it knows of a listener whose connections changed
+		if e.Kind == ports.ConnectionsChanged {
+			continue
+		}
+		listeners = append(listeners, e.Listener)
+		annotated = append(annotated, i)
+	}
+	if len(listeners) == 0 {
+		return nil
+	}
+	dockerErr := annotateListeners(ctx, listeners, l)
+	for j, i := range annotated {
+		events[i].Listener = listeners[j]
+	}
+	return dockerErr
+}
+
+// killProcess kills the selected process, streaming escalation progress
+// back to the model until the kill finishes or ctx is done
+func killProcess(ctx context.Context, esc *killer.Escalation) tea.Cmd {
+	events := make(chan killer.Event, 16)
+	esc.OnEvent = forwardEvent(ctx, events)
+
+	run := func() tea.Msg {
+		err := esc.RunContext(ctx)
+		close(events)
+		return killResultMsg{success: err == nil, err: err}
+	}
+
+	return tea.Batch(run, waitForProgress(events), spinnerTick())
+}
+
+// forwardEvent returns an escalation callback sending events to the UI.
+// Countdown updates are dropped rather than stall the kill if the UI falls
+// behind, as the next one supersedes them; signals, the exit and the
+// port's release are always delivered unless ctx is done.
+func forwardEvent(ctx context.Context, events chan<- killer.Event) func(killer.Event) {
+	return func(e killer.Event) {
+		if e.Kind == killer.EventWaiting {
+			select {
+			case events <- e:
+			default:
+			}
+			return
+		}
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// waitForProgress delivers the next escalation event as a message
+func waitForProgress(events <-chan killer.Event) tea.Cmd {
+	return func() tea.Msg {
+		e, ok := <-events
+		if !ok {
+			return nil
+		}
+		return progressMsg{event: e, events: events}
+	}
+}
+
+// spinnerTick schedules the next spinner frame
+func spinnerTick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(time.Time) tea.Msg {
+		return spinnerTickMsg{}
+	})
+}
+
+// watchRespawn watches port for window after pid was killed at since, for
+// a supervisor bringing the process back, scanning with m.scan
+func (m Model) watchRespawn(ctx context.Context, pid, port int, window time.Duration, since time.Time) tea.Cmd {
+	listPorts, l := m.scan, m.labels
+	if listPorts == nil {
+		listPorts = ports.ScanContext
+	}
+	return func() tea.Msg {
+		scan := func(ctx context.Context) ([]ports.PortInfo, error) {
+			list, err := listPorts(ctx)
+			if err == nil {
+				_ = annotateListeners(ctx, list, l)
+			}
+			return list, err
+		}
+		found, _ := respawn.Watch(ctx, []int{port}, []int{pid}, respawn.Options{Window: window, Since: since, Scan: scan})
+		return respawnMsg{found: found}
+	}
+}
+
+// stopContainer stops a container published by a docker-proxy through the
+// Docker API, instead of killing the proxy, giving it timeout to exit.
+// Signals other than TERM are sent to the container as they are.
+func stopContainer(ctx context.Context, c ports.Container, sig killer.Signal, timeout time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		client := docker.NewClient(docker.SocketPath())
+		var err error
+		if sig == killer.SIGTERM {
+			err = client.Stop(ctx, c.ID, timeout)
+		} else {
+			err = client.Kill(ctx, c.ID, string(sig))
+		}
+		return killResultMsg{success: err == nil, err: err}
+	}
+}
+
+// stopUnit stops the systemd unit a process belongs to with systemctl,
+// instead of killing a process the unit may restart. Signals other than
+// TERM are sent to the unit's processes with systemctl kill.
+func stopUnit(ctx context.Context, u ports.Unit, sig killer.Signal) tea.Cmd {
+	return func() tea.Msg {
+		var err error
+		if sig == killer.SIGTERM {
+			err = systemd.Stop(ctx, u)
+		} else {
+			err = systemd.Kill(ctx, u, string(sig))
+		}
+		return killResultMsg{success: err == nil, err: err}
+	}
+}
+
+// stopDescription describes what is stopped in place of killing p: the
+// container a docker-proxy publishes or the systemd unit p belongs to. It
+// is "" when p is killed.
+func stopDescription(p ports.PortInfo) string {
+	if c := docker.Published(p); c != nil {
+		return docker.Describe(*c)
+	}
+	if u := systemd.Stoppable(p); u != nil {
+		return systemd.Describe(*u)
+	}
+	return ""
+}
+
+// stopping describes what the kill in progress stops in place of the
+// selected process, or is "" when the process itself is killed
+func (m Model) stopping() string {
+	if m.onlyPID {
+		return ""
+	}
+	return stopDescription(*m.selected)
+}
+
+// processOnlyChoice reports whether the confirmation for p offers to kill
+// the process itself instead of stopping its service. A socket unit's
+// listener is the service manager, which is never killed.
+func processOnlyChoice(p ports.PortInfo) bool {
+	u := systemd.Stoppable(p)
+	return u != nil && !systemd.IsSocket(*u) && docker.Published(p) == nil
+}
+
+// startKill begins killing the selected process, or stopping the container
+// it publishes if it is a docker-proxy or the unit it belongs to
+func (m *Model) startKill(p *ports.PortInfo) tea.Cmd {
+	m.state = StateKilling
+	m.onlyPID = false
+	if c := docker.Published(*p); c != nil {
+		m.escalation = nil
+		m.progress = nil
+		m.spinner = 0
+		return tea.Batch(stopContainer(m.context(), *c, m.signal, m.timeout), spinnerTick())
+	}
+	if u := systemd.Stoppable(*p); u != nil {
+		m.escalation = nil
+		m.progress = nil
+		m.spinner = 0
+		return tea.Batch(stopUnit(m.context(), *u, m.signal), spinnerTick())
+	}
+	return m.startKillProcess(p)
 }
 
-// scanPorts scans for listening ports
-func scanPorts() tea.Msg {
-	p, err := ports.Scan()
-	return portsScannedMsg{ports: p, err: err}
+// startKillProcess begins killing the selected process itself, even if it
+// belongs to a unit that startKill would stop. Only SIGTERM is escalated;
+// other signals are sent once.
+func (m *Model) startKillProcess(p *ports.PortInfo) tea.Cmd {
+	m.state = StateKilling
+	m.progress = nil
+	m.spinner = 0
+	// Whether to watch for a respawn is decided while the process runs
+	m.watchRespawnAfter = m.respawnWindow > 0 && !p.Unix() && (m.respawnUnsupervised || respawn.Supervised(*p))
+	m.killedAt = time.Now()
+	if m.signal != killer.SIGTERM {
+		m.escalation = nil
+		return tea.Batch(signalProcess(p.PID, m.signal), spinnerTick())
+	}
+	m.escalation = killer.NewEscalation(p.PID, m.timeout)
+	m.escalation.Released = portReleased(m.context(), m.scan, *p)
+	return killProcess(m.context(), m.escalation)
 }
 
-// killProcess kills the selected process
-func killProcess(pid int) tea.Cmd {
+// signalProcess sends sig to pid without escalating
+func signalProcess(pid int, sig killer.Signal) tea.Cmd {
 	return func() tea.Msg {
-		err := killer.KillWithEscalation(pid)
+		err := killer.Kill(pid, sig)
 		return killResultMsg{success: err == nil, err: err}
 	}
 }
 
+// portReleased returns a check that p's process no longer listens on its
+// port or Unix socket, scanning with scan, or ports.ScanContext if nil
+func portReleased(ctx context.Context, scan func(context.Context) ([]ports.PortInfo, error), p ports.PortInfo) func() bool {
+	if scan == nil {
+		scan = ports.ScanContext
+	}
+	return func() bool {
+		list, err := scan(ctx)
+		if err != nil {
+			return false
+		}
+		for _, l := range list {
+			if l.PID == p.PID && l.Where() == p.Where() {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // Update handles events
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
@@ -114,18 +470,84 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.SetError(msg.err)
 			return m, nil
 		}
+		m.dockerErr = msg.dockerErr
 		m.SetPorts(msg.ports)
+		if m.ctx != nil && !m.watching {
+			m.watching = true
+			m.cpu.Sample(m.ports, time.Now())
+			return m, tea.Batch(watchPorts(m.ctx, m.scan, m.labels), refreshResources(m.ctx, m.ports, m.cpu))
+		}
 		return m, nil
 
+	case resourcesMsg:
+		m.ApplyResources(msg.ports)
+		if m.ctx == nil || m.ctx.Err() != nil {
+			return m, nil
+		}
+		return m, refreshResources(m.ctx, m.ports, m.cpu)
+
+	case portsChangedMsg:
+		if msg.dockerErr != nil {
+			// Listeners identified before keep their containers
+			m.dockerErr = msg.dockerErr
+		}
+		m.ApplyChanges(msg.events)
+		if msg.changes == nil {
+			return m, nil
+		}
+		return m, waitForChanges(m.context(), msg.changes, m.labels)
+
+	case progressMsg:
+		m.SetProgress(msg.event)
+		return m, waitForProgress(msg.events)
+
+	case spinnerTickMsg:
+		if m.state != StateKilling {
+			return m, nil
+		}
+		m.spinner = (m.spinner + 1) % len(spinnerFrames)
+		return m, spinnerTick()
+
 	case killResultMsg:
+		m.escalation = nil
+		if errors.Is(msg.err, killer.ErrAborted) {
+			m.SetMessage(fmt.Sprintf("Stopped waiting for %s (PID %d); SIGTERM was sent",
+				m.selected.Process, m.selected.PID))
+			m.CancelConfirm()
+			return m, nil
+		}
 		if msg.err != nil {
 			m.SetError(msg.err)
+		} else if desc := m.stopping(); desc != "" {
+			m.SetMessage(fmt.Sprintf("Stopped %s on %s", desc, m.selected.Where()))
+			m.state = StateQuit
+		} else if m.watchRespawnAfter {
+			// A supervisor may bring it straight back
+			m.watchingPort = true
+			return m, tea.Batch(m.watchRespawn(m.context(), m.selected.PID, m.selected.Port, m.respawnWindow, m.killedAt), spinnerTick())
 		} else {
-			m.SetMessage(fmt.Sprintf("Killed %s (PID %d) on port %d",
-				m.selected.Process, m.selected.PID, m.selected.Port))
+			m.SetMessage(m.killedMessage())
 			m.state = StateQuit
 		}
 		return m, tea.Quit
+
+	case respawnMsg:
+		if m.state != StateKilling || !m.watchingPort {
+			return m, nil
+		}
+		m.watchingPort = false
+		if len(msg.found) == 0 {
+			m.SetMessage(m.killedMessage())
+			m.state = StateQuit
+			return m, tea.Quit
+		}
+		lines := make([]string, len(msg.found))
+		for i, r := range msg.found {
+			lines[i] = r.String()
+		}
+		m.SetMessage(strings.Join(lines, "\n"))
+		m.CancelConfirm()
+		return m, nil
 	}
 
 	return m, nil
@@ -133,8 +555,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // handleKey handles keyboard input
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// Global quit keys
+	// Global quit keys; ctrl+c also stops a scan or kill in progress
 	if msg.String() == "ctrl+c" {
+		if m.cancel != nil {
+			m.cancel()
+		}
 		m.Quit()
 		return m, tea.Quit
 	}
@@ -144,6 +569,8 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleListKey(msg)
 	case StateConfirm:
 		return m.handleConfirmKey(msg)
+	case StateKilling:
+		return m.handleKillingKey(msg)
 	case StateError:
 		return m, tea.Quit
 	}
@@ -153,27 +580,41 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // handleListKey handles keys in list state
 func (m Model) handleListKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.Type {
-	case tea.KeyEsc:
+	action, bound := m.keymap.Lookup(msg.String())
+	if !bound {
+		if msg.Type == tea.KeyRunes {
+			// Any character typing adds to filter
+			for _, r := range msg.Runes {
+				m.AddFilterChar(r)
+			}
+		}
+		return m, nil
+	}
+
+	switch action {
+	case keymap.ActionClear:
 		if m.filter != "" {
 			m.ClearFilter()
 		} else {
 			m.Quit()
 			return m, tea.Quit
 		}
-	case tea.KeyBackspace:
+	case keymap.ActionDelete:
 		m.DeleteFilterChar()
-	case tea.KeyEnter:
+	case keymap.ActionSelect:
 		m.EnterConfirm()
-	case tea.KeyUp:
+	case keymap.ActionUp:
 		m.MoveUp()
-	case tea.KeyDown:
+	case keymap.ActionDown:
 		m.MoveDown()
-	case tea.KeyRunes:
-		// Any character typing adds to filter
-		for _, r := range msg.Runes {
-			m.AddFilterChar(r)
-		}
+	case keymap.ActionSortNext:
+		m.CycleSort(true)
+	case keymap.ActionSortPrev:
+		m.CycleSort(false)
+	case keymap.ActionReverse:
+		m.ToggleReverse()
+	case keymap.ActionMatchMode:
+		m.CycleMatchMode()
 	}
 
 	return m, nil
@@ -181,28 +622,68 @@ func (m Model) handleListKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // handleConfirmKey handles keys in confirm state
 func (m Model) handleConfirmKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.selected != nil {
+		if err := m.Protection(*m.selected); err != nil {
+			// The dialog only explains why; any dismiss key closes it
+			switch msg.String() {
+			case "enter", "esc", "n", "q", "y":
+				m.CancelConfirm()
+				m.SetMessage(err.Error())
+			}
+			return m, nil
+		}
+	}
+
 	switch msg.String() {
 	case "left", "right", "h", "l", "tab":
 		m.ToggleConfirm()
 	case "enter":
 		if p := m.Confirm(); p != nil {
-			m.state = StateKilling
-			return m, killProcess(p.PID)
+			return m, m.startKill(p)
 		}
 		m.CancelConfirm()
 	case "esc", "n", "q":
 		m.CancelConfirm()
+	case "p":
+		if m.selected != nil && processOnlyChoice(*m.selected) {
+			m.onlyPID = true
+			return m, m.startKillProcess(m.selected)
+		}
 	case "y":
 		m.confirmYes = true
 		if p := m.Confirm(); p != nil {
-			m.state = StateKilling
-			return m, killProcess(p.PID)
+			return m, m.startKill(p)
 		}
 	}
 
 	return m, nil
 }
 
+// handleKillingKey handles keys while a kill is in progress
+func (m Model) handleKillingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.watchingPort {
+		if msg.String() == "esc" {
+			m.watchingPort = false
+			m.SetMessage(m.killedMessage())
+			m.state = StateQuit
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+	if m.escalation == nil {
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "k", "K":
+		m.escalation.EscalateNow()
+	case "esc", "a":
+		m.escalation.Abort()
+	}
+
+	return m, nil
+}
+
 // View renders the TUI
 func (m Model) View() string {
 	if m.width == 0 {
@@ -240,14 +721,18 @@ func (m Model) viewList() string {
 	filterLabel := "Filter: "
 	b.WriteString(filterStyle.Render(filterLabel))
 	b.WriteString(filterStyle.Render(m.filter + "_"))
+	b.WriteString(dimStyle.Render(fmt.Sprintf("  [%s]", m.matchMode)))
+	if m.filterErr != nil {
+		b.WriteString("  ")
+		b.WriteString(errorStyle.Render(m.filterErr.Error()))
+	}
 	b.WriteString("\n\n")
 
 	// Table header
-	header := fmt.Sprintf("  %-8s %-10s %-20s %-15s %s",
-		"PORT", "PID", "PROCESS", "USER", "PROTO")
-	b.WriteString(headerStyle.Render(header))
+	widths := m.columnWidths(m.filtered)
+	b.WriteString(headerStyle.Render("   " + m.formatHeader(widths)))
 	b.WriteString("\n")
-	b.WriteString(dimStyle.Render(strings.Repeat("─", min(m.width-4, 70))))
+	b.WriteString(dimStyle.Render(strings.Repeat("─", min(m.width-4, columns.TotalWidth(widths)))))
 	b.WriteString("\n")
 
 	// Port list
@@ -268,48 +753,150 @@ func (m Model) viewList() string {
 
 		for i := start; i < end; i++ {
 			p := m.filtered[i]
-			line := m.formatPortLine(p, i == m.cursor)
+			line := m.renderRow(p, m.highlights(i), widths, i == m.cursor)
 			b.WriteString(line)
 			b.WriteString("\n")
 		}
 	}
 
+	// Status message from the last action
+	if m.message != "" {
+		b.WriteString("\n")
+		b.WriteString(warningStyle.Render(m.message))
+		b.WriteString("\n")
+	}
+
 	// Footer
 	b.WriteString("\n")
-	footer := dimStyle.Render("↑/↓ navigate  │  enter select  │  esc clear/quit")
+	k := m.keymap
+	footer := dimStyle.Render(fmt.Sprintf("%s/%s navigate  │  %s select  │  %s sort  │  %s reverse  │  %s match mode  │  %s clear/quit",
+		k.Help(keymap.ActionUp), k.Help(keymap.ActionDown), k.Help(keymap.ActionSelect), k.Help(keymap.ActionSortNext),
+		k.Help(keymap.ActionReverse), k.Help(keymap.ActionMatchMode), k.Help(keymap.ActionClear)))
 	b.WriteString(footer)
 
 	return b.String()
 }
 
-// formatPortLine formats a single port line
-func (m Model) formatPortLine(p ports.PortInfo, selected bool) string {
-	// Truncate process name if needed
-	process := p.Process
-	if len(process) > 20 {
-		process = process[:17] + "..."
+// columnWidths fits the configured columns to the terminal, leaving room
+// for the cursor and lock gutter and the sort arrow
+func (m Model) columnWidths(rows []ports.PortInfo) []int {
+	widths := columns.Widths(m.columns, rows, m.width-3)
+	for i, c := range m.columns {
+		if c.SortKey != "" && c.SortKey == m.sortKey {
+			widths[i] = max(widths[i], lipgloss.Width(c.Header)+1)
+		}
 	}
+	return widths
+}
 
-	line := fmt.Sprintf("  %-8d %-10d %-20s %-15s %s",
-		p.Port, p.PID, process, p.User, p.Proto)
-
-	if selected {
-		return selectedStyle.Render("▸" + line[1:])
+// formatHeader renders the table header, marking the sorted column
+func (m Model) formatHeader(widths []int) string {
+	headers := columns.Headers(m.columns, widths)
+	for i, c := range m.columns {
+		if c.SortKey != "" && c.SortKey == m.sortKey {
+			arrow := "▲"
+			if m.reverse {
+				arrow = "▼"
+			}
+			headers[i] = columns.Fit(c.Header+arrow, widths[i])
+		}
 	}
+	return strings.Join(headers, " ")
+}
 
-	// Color by port range
-	portStr := fmt.Sprintf("%-8d", p.Port)
-	var styledPort string
-	if p.Port < 1024 {
-		styledPort = systemPortStyle.Render(portStr)
-	} else if p.Port <= 49151 {
-		styledPort = userPortStyle.Render(portStr)
+// renderRow renders a port as a table row with the given column widths,
+// highlighting the characters that matched the filter
+func (m Model) renderRow(p ports.PortInfo, highlights map[string][]int, widths []int, selected bool) string {
+	base, hl, gutter := rowStyles(p, selected)
+	if m.Protection(p) != nil {
+		gutter += "🔒"
 	} else {
-		styledPort = ephemeralPortStyle.Render(portStr)
+		gutter += "  "
+	}
+
+	var b strings.Builder
+	b.WriteString(base.Render(gutter))
+	for i, c := range m.columns {
+		if i > 0 {
+			b.WriteString(base.Render(" "))
+		}
+
+		cellStyle := base
+		if c.Key == "port" && !selected && !p.Unix() {
+			// Color by port range
+			if p.Port < 1024 {
+				cellStyle = systemPortStyle
+			} else if p.Port <= 49151 {
+				cellStyle = userPortStyle
+			} else {
+				cellStyle = ephemeralPortStyle
+			}
+		}
+
+		b.WriteString(renderCell(c.Value(p), widths[i], highlights[c.Key], cellStyle, hl))
+	}
+
+	return b.String()
+}
+
+// rowStyles returns the base and match styles and the gutter of a row,
+// coloring the rows of zombie and stopped processes
+func rowStyles(p ports.PortInfo, selected bool) (base, hl lipgloss.Style, gutter string) {
+	switch {
+	case selected:
+		return selectedStyle, selectedMatchStyle, "▸"
+	case p.State == "Z":
+		return zombieStyle, matchStyle, " "
+	case p.Troubled():
+		return stoppedStyle, matchStyle, " "
+	}
+	return plainStyle, matchStyle, " "
+}
+
+// renderCell fits value to width w and renders it with base, switching to
+// hl for the runes at positions
+func renderCell(value string, w int, positions []int, base, hl lipgloss.Style) string {
+	fitted := columns.Fit(value, w)
+	if len(positions) == 0 {
+		return base.Render(fitted)
+	}
+
+	// Only runes kept from value can be highlighted, not the "..." tail
+	kept := utf8.RuneCountInString(value)
+	if runewidth.StringWidth(value) > w {
+		kept = utf8.RuneCountInString(runewidth.Truncate(value, w-3, ""))
+	}
+	marked := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		if pos < kept {
+			marked[pos] = true
+		}
+	}
+
+	var b strings.Builder
+	var run []rune
+	runHighlighted := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if runHighlighted {
+			b.WriteString(hl.Render(string(run)))
+		} else {
+			b.WriteString(base.Render(string(run)))
+		}
+		run = run[:0]
+	}
+	for i, r := range []rune(fitted) {
+		if marked[i] != runHighlighted {
+			flush()
+			runHighlighted = marked[i]
+		}
+		run = append(run, r)
 	}
+	flush()
 
-	return fmt.Sprintf("  %s %-10d %-20s %-15s %s",
-		styledPort, p.PID, process, p.User, p.Proto)
+	return b.String()
 }
 
 // viewConfirm renders the confirmation view
@@ -332,8 +919,18 @@ func (m Model) viewConfirm() string {
 		b.WriteString("\n")
 	}
 
+	protectedErr := m.Protection(*m.selected)
+
 	// Title
 	title := warningStyle.Render("⚠  KILL PROCESS?")
+	if docker.Published(*m.selected) != nil {
+		title = warningStyle.Render("⚠  STOP CONTAINER?")
+	} else if systemd.Stoppable(*m.selected) != nil {
+		title = warningStyle.Render("⚠  STOP UNIT?")
+	}
+	if protectedErr != nil {
+		title = errorStyle.Render("🔒  PROTECTED PROCESS")
+	}
 	b.WriteString(m.centerText(title))
 	b.WriteString("\n\n")
 
@@ -341,6 +938,9 @@ func (m Model) viewConfirm() string {
 	processInfo := fmt.Sprintf("Process:  %s", m.selected.Process)
 	pidInfo := fmt.Sprintf("PID:      %d", m.selected.PID)
 	portInfo := fmt.Sprintf("Port:     %d", m.selected.Port)
+	if m.selected.Unix() {
+		portInfo = fmt.Sprintf("Socket:   %s", m.selected.Address)
+	}
 	userInfo := fmt.Sprintf("User:     %s", m.selected.User)
 
 	b.WriteString(m.centerText(processInfo))
@@ -350,7 +950,31 @@ func (m Model) viewConfirm() string {
 	b.WriteString(m.centerText(portInfo))
 	b.WriteString("\n")
 	b.WriteString(m.centerText(userInfo))
-	b.WriteString("\n\n")
+	b.WriteString("\n")
+	for _, line := range detailLines(*m.selected) {
+		b.WriteString(m.centerText(line))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	if protectedErr != nil {
+		// Killing is blocked; explain why instead of offering Yes/No
+		var perr *killer.ProtectedError
+		reason := protectedErr.Error()
+		if errors.As(protectedErr, &perr) {
+			reason = "Refusing to kill: " + perr.Reason
+		}
+		b.WriteString(m.centerText(errorStyle.Render(reason)))
+		b.WriteString("\n\n")
+		b.WriteString(m.centerText(activeButtonStyle.Render("[ OK ]")))
+		b.WriteString("\n\n")
+		help := "enter/esc close  │  run tsunami --override-protection to allow"
+		if !errors.As(protectedErr, &perr) {
+			help = "enter/esc close"
+		}
+		b.WriteString(m.centerText(dimStyle.Render(help)))
+		return b.String()
+	}
 
 	// Buttons
 	var yesBtn, noBtn string
@@ -366,12 +990,67 @@ func (m Model) viewConfirm() string {
 	b.WriteString("\n\n")
 
 	// Help text
-	help := dimStyle.Render("←/→ select  │  enter confirm  │  esc cancel")
+	help := "←/→ select  │  enter confirm  │  esc cancel"
+	if processOnlyChoice(*m.selected) {
+		help = "←/→ select  │  enter stop unit  │  p kill process only  │  esc cancel"
+	}
+	help = dimStyle.Render(help)
 	b.WriteString(m.centerText(help))
 
 	return b.String()
 }
 
+// maxClientLines is how many of a listener's clients the confirmation view
+// lists before summing up the rest
+const maxClientLines = 5
+
+// detailLines describes the container p runs in or publishes, its systemd
+// unit and slice, its network namespace and the clients connected to it,
+// for the confirmation view
+func detailLines(p ports.PortInfo) []string {
+	var lines []string
+	if c := p.Container; c != nil {
+		name := columns.ContainerName(p)
+		if c.Runtime != "" {
+			name += " (" + c.Runtime + ")"
+		}
+		lines = append(lines, fmt.Sprintf("Container: %s", name))
+		if c.Image != "" {
+			lines = append(lines, fmt.Sprintf("Image:    %s", c.Image))
+		}
+		if c.Pod != "" {
+			lines = append(lines, fmt.Sprintf("Pod:      %s", c.Pod))
+		}
+	}
+	if u := p.Unit; u != nil {
+		name := u.Name
+		if u.User {
+			name += " (user)"
+		}
+		lines = append(lines, fmt.Sprintf("Unit:     %s", name))
+		if u.Restart != "" {
+			lines = append(lines, fmt.Sprintf("Restart:  %s", u.Restart))
+		}
+	}
+	if p.Slice != "" {
+		lines = append(lines, fmt.Sprintf("Slice:    %s", p.Slice))
+	}
+	if p.Netns != "" {
+		lines = append(lines, fmt.Sprintf("Netns:    %s", p.Netns))
+	}
+	if n := len(p.Connections); n > 0 {
+		lines = append(lines, fmt.Sprintf("Clients:  %d", n))
+		for i, c := range p.Connections {
+			if i == maxClientLines {
+				lines = append(lines, fmt.Sprintf("  and %d more", n-i))
+				break
+			}
+			lines = append(lines, "  "+c.String())
+		}
+	}
+	return lines
+}
+
 // centerText centers text horizontally based on terminal width
 func (m Model) centerText(text string) string {
 	textWidth := lipgloss.Width(text)
@@ -387,15 +1066,74 @@ func (m Model) viewError() string {
 	return errorStyle.Render("Error: "+m.err.Error()) + "\n"
 }
 
-// viewKilling renders killing state
+// viewKilling renders killing state with a live spinner and countdown
 func (m Model) viewKilling() string {
-	return fmt.Sprintf("Killing %s (PID %d)...\n",
-		m.selected.Process, m.selected.PID)
+	var b strings.Builder
+
+	spinner := filterStyle.Render(spinnerFrames[m.spinner])
+	if m.watchingPort {
+		b.WriteString(fmt.Sprintf("%s %s; watching for a restart...\n", spinner, m.killedMessage()))
+		b.WriteString("\n")
+		b.WriteString(dimStyle.Render("esc stop watching"))
+		b.WriteString("\n")
+		return b.String()
+	}
+	if desc := m.stopping(); desc != "" {
+		b.WriteString(fmt.Sprintf("%s Stopping %s...\n", spinner, desc))
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf("%s Killing %s (PID %d)...\n",
+		spinner, m.selected.Process, m.selected.PID))
+
+	if m.progress != nil {
+		b.WriteString("\n")
+		b.WriteString("  " + m.progressLine(*m.progress))
+		b.WriteString("\n")
+	}
+
+	if m.escalation != nil {
+		b.WriteString("\n")
+		b.WriteString(dimStyle.Render("k kill now  │  esc stop waiting"))
+		b.WriteString("\n")
+	}
+
+	return b.String()
 }
 
-// Run starts the TUI
-func Run() error {
-	p := tea.NewProgram(NewModel(), tea.WithAltScreen())
+// killedMessage reports the selected process as killed
+func (m Model) killedMessage() string {
+	return fmt.Sprintf("Killed %s (PID %d) on %s", m.selected.Process, m.selected.PID, m.selected.Where())
+}
+
+// progressLine renders the latest escalation event
+func (m Model) progressLine(e killer.Event) string {
+	switch e.Kind {
+	case killer.EventWaiting:
+		remaining := e.Timeout - e.Elapsed
+		if remaining < 0 {
+			remaining = 0
+		}
+		return fmt.Sprintf("%s  %s",
+			e.String(),
+			warningStyle.Render(fmt.Sprintf("SIGKILL in %.1fs", remaining.Seconds())))
+	case killer.EventEscalated:
+		return warningStyle.Render(e.String())
+	case killer.EventExited, killer.EventPortReleased:
+		return successStyle.Render(e.String())
+	default:
+		return e.String()
+	}
+}
+
+// Run starts the TUI. The list refreshes as listeners open and close.
+func Run(opts Options) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewModel()
+	m.ApplyOptions(opts)
+	m.ctx, m.cancel = ctx, cancel
+	p := tea.NewProgram(m, tea.WithAltScreen())
 	_, err := p.Run()
 	return err
 }
@@ -1,11 +1,29 @@
 package tui
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/wusher/tsunami/internal/columns"
+	"github.com/wusher/tsunami/internal/killer"
+	"github.com/wusher/tsunami/internal/labels"
+	"github.com/wusher/tsunami/internal/match"
 	"github.com/wusher/tsunami/internal/ports"
+	"github.com/wusher/tsunami/internal/respawn"
+	"github.com/wusher/tsunami/internal/theme"
 )
 
 func TestInit(t *testing.T) {
@@ -76,6 +94,40 @@ func TestUpdateCtrlC(t *testing.T) {
 	}
 }
 
+func TestUpdateCtrlCCancelsWork(t *testing.T) {
+	m := NewModel()
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.state = StateKilling
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if m.ctx.Err() == nil {
+		t.Error("Ctrl+C should cancel the scan or kill in progress")
+	}
+}
+
+func TestScanPortsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg, ok := scanPorts(ctx, nil, labels.New(nil))().(portsScannedMsg)
+	if !ok || !errors.Is(msg.err, context.Canceled) {
+		t.Errorf("scanPorts(cancelled) = %#v, expected context.Canceled", msg)
+	}
+}
+
+func TestScanPortsLabels(t *testing.T) {
+	rule, err := labels.NewRule("frontend", "vite", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := func(context.Context) ([]ports.PortInfo, error) {
+		return []ports.PortInfo{{Port: 5173, PID: 9000200, Process: "node", Cmdline: "node node_modules/.bin/vite"}}, nil
+	}
+	msg := scanPorts(context.Background(), scan, labels.New([]labels.Rule{rule}))().(portsScannedMsg)
+	if len(msg.ports) != 1 || msg.ports[0].App != "frontend" {
+		t.Errorf("scanPorts = %+v, want the listener labelled frontend", msg.ports)
+	}
+}
+
 func TestHandleListKeyNavigation(t *testing.T) {
 	m := NewModel()
 	m.SetPorts([]ports.PortInfo{
@@ -281,6 +333,45 @@ func TestViewList(t *testing.T) {
 	}
 }
 
+func TestRowStyles(t *testing.T) {
+	defer applyTheme(theme.Builtin["default"])
+	applyTheme(theme.Builtin["default"])
+
+	tests := []struct {
+		state    string
+		selected bool
+		want     lipgloss.Style
+	}{
+		{"Z", false, zombieStyle},
+		{"T", false, stoppedStyle},
+		{"t", false, stoppedStyle},
+		{"S", false, plainStyle},
+		{"Z", true, selectedStyle},
+	}
+	for _, tt := range tests {
+		base, _, _ := rowStyles(ports.PortInfo{State: tt.state}, tt.selected)
+		if base.GetForeground() != tt.want.GetForeground() || base.GetBackground() != tt.want.GetBackground() {
+			t.Errorf("rowStyles(%q, selected=%v) foreground = %v, want %v", tt.state, tt.selected, base.GetForeground(), tt.want.GetForeground())
+		}
+	}
+	if zombieStyle.GetForeground() == stoppedStyle.GetForeground() {
+		t.Error("zombie and stopped rows should use different colors")
+	}
+}
+
+func TestUpdateResources(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 100, Process: "node", Proto: "tcp"}})
+
+	updated, cmd := m.Update(resourcesMsg{ports: []ports.PortInfo{{Port: 3000, PID: 100, Process: "node", Proto: "tcp", Threads: 7}}})
+	if cmd != nil {
+		t.Error("a model without a context should not refresh again")
+	}
+	if p := updated.(Model).ports[0]; p.Threads != 7 {
+		t.Errorf("Threads = %d, want 7", p.Threads)
+	}
+}
+
 func TestViewListEmpty(t *testing.T) {
 	m := NewModel()
 	m.SetSize(80, 24)
@@ -379,7 +470,13 @@ func TestViewQuitNoMessage(t *testing.T) {
 	}
 }
 
-func TestFormatPortLine(t *testing.T) {
+// renderOnlyRow renders p as the only row of m's list
+func renderOnlyRow(m Model, p ports.PortInfo, selected bool) string {
+	m.SetPorts([]ports.PortInfo{p})
+	return m.renderRow(p, nil, m.columnWidths(m.filtered), selected)
+}
+
+func TestRenderRow(t *testing.T) {
 	m := NewModel()
 	m.SetSize(80, 24)
 
@@ -393,16 +490,17 @@ func TestFormatPortLine(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		line := m.formatPortLine(tt.port, tt.selected)
+		line := renderOnlyRow(m, tt.port, tt.selected)
 		if !strings.Contains(line, tt.port.Process) {
-			t.Errorf("formatPortLine should contain process name %q", tt.port.Process)
+			t.Errorf("renderRow should contain process name %q", tt.port.Process)
 		}
 	}
 }
 
-func TestFormatPortLineLongProcess(t *testing.T) {
+func TestRenderRowLongProcess(t *testing.T) {
 	m := NewModel()
-	m.SetSize(80, 24)
+	// Narrow enough that the process column has to shrink
+	m.SetSize(50, 24)
 
 	port := ports.PortInfo{
 		Port:    3000,
@@ -412,7 +510,7 @@ func TestFormatPortLineLongProcess(t *testing.T) {
 		Proto:   "tcp",
 	}
 
-	line := m.formatPortLine(port, false)
+	line := renderOnlyRow(m, port, false)
 
 	if strings.Contains(line, "very-long-process-name-that-exceeds-limit") {
 		t.Error("Long process name should be truncated")
@@ -422,6 +520,25 @@ func TestFormatPortLineLongProcess(t *testing.T) {
 	}
 }
 
+func TestRenderRowWideTerminal(t *testing.T) {
+	m := NewModel()
+	m.SetSize(120, 24)
+
+	port := ports.PortInfo{
+		Port:    3000,
+		PID:     100,
+		Process: "very-long-process-name-that-exceeds-limit",
+		User:    "user",
+		Proto:   "tcp",
+	}
+
+	line := renderOnlyRow(m, port, false)
+
+	if !strings.Contains(line, "very-long-process-name-that-exceeds-limit") {
+		t.Error("Process name should not be truncated when the terminal is wide enough")
+	}
+}
+
 func TestUpdateKillResult(t *testing.T) {
 	m := NewModel()
 	m.SetPorts([]ports.PortInfo{
@@ -446,6 +563,111 @@ func TestUpdateKillResult(t *testing.T) {
 	}
 }
 
+func TestUpdateKillResultWatchesForRespawn(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.ApplyOptions(Options{RespawnWindow: time.Second})
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+	})
+	m.EnterConfirm()
+	m.state = StateKilling
+
+	// No supervisor was recognized before the kill
+	newModel, cmd := m.Update(killResultMsg{success: true})
+	if updated := newModel.(Model); updated.state != StateQuit || updated.watchingPort || cmd == nil {
+		t.Errorf("state = %v, watching %v; expected to quit without a watch", updated.state, updated.watchingPort)
+	}
+
+	m.watchRespawnAfter = true
+	newModel, cmd = m.Update(killResultMsg{success: true})
+	watching := newModel.(Model)
+	if watching.state != StateKilling || !watching.watchingPort || cmd == nil {
+		t.Fatalf("state = %v, watching %v; expected a respawn watch", watching.state, watching.watchingPort)
+	}
+	if view := watching.View(); !strings.Contains(view, "Killed node (PID 100) on port 3000; watching for a restart") {
+		t.Errorf("killing view = %q", view)
+	}
+
+	// Nothing came back
+	newModel, cmd = watching.Update(respawnMsg{})
+	if updated := newModel.(Model); updated.state != StateQuit || updated.message != "Killed node (PID 100) on port 3000" || cmd == nil {
+		t.Errorf("state = %v, message %q after no respawn", updated.state, updated.message)
+	}
+
+	// pm2 brought it back
+	found := []respawn.Respawn{{PID: 200, Process: "node", Ports: []int{3000},
+		Supervisor: &respawn.Supervisor{Name: "pm2", PID: 50, Program: "api", Stop: "pm2 stop api"}}}
+	newModel, _ = watching.Update(respawnMsg{found: found})
+	updated := newModel.(Model)
+	if updated.state != StateList || updated.selected != nil {
+		t.Errorf("state = %v after a respawn, expected the list", updated.state)
+	}
+	if view := updated.View(); !strings.Contains(view, "stop it with: pm2 stop api") {
+		t.Errorf("list view after a respawn = %q", view)
+	}
+
+	// esc stops watching
+	newModel, cmd = watching.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if updated := newModel.(Model); updated.state != StateQuit || updated.watchingPort || cmd == nil {
+		t.Errorf("state = %v after esc, expected to quit", updated.state)
+	}
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.ApplyOptions(Options{RespawnWindow: time.Second})
+	m.SetPorts([]ports.PortInfo{
+		{PID: 100, Process: "gunicorn", User: "www", Proto: "unix", Address: "/run/app.sock"},
+	})
+	if view := m.View(); !strings.Contains(view, "unix") {
+		t.Errorf("list view = %q, want the unix listener", view)
+	}
+
+	m.EnterConfirm()
+	if view := m.View(); !strings.Contains(view, "Socket:   /run/app.sock") {
+		t.Errorf("confirm view = %q, want the socket path", view)
+	}
+
+	// Sockets are not watched for a respawn
+	m.state = StateKilling
+	newModel, _ := m.Update(killResultMsg{success: true})
+	if updated := newModel.(Model); updated.state != StateQuit || updated.message != "Killed gunicorn (PID 100) on /run/app.sock" {
+		t.Errorf("state = %v, message %q after killing a socket listener", updated.state, updated.message)
+	}
+}
+
+func TestConfirmShowsClients(t *testing.T) {
+	p := ports.PortInfo{Port: 5432, PID: 100, Process: "postgres", User: "postgres", Proto: "tcp"}
+	for i := 0; i < 7; i++ {
+		p.Connections = append(p.Connections, ports.Connection{Remote: fmt.Sprintf("10.0.0.%d:40000", i+1), State: "ESTABLISHED"})
+	}
+	p.Connections[0] = ports.Connection{Remote: "127.0.0.1:51000", State: "ESTABLISHED", PID: 4242, Process: "psql"}
+
+	m := NewModel()
+	m.SetSize(100, 40)
+	m.SetPorts([]ports.PortInfo{p})
+	m.EnterConfirm()
+	view := m.View()
+	for _, want := range []string{"Clients:  7", "127.0.0.1:51000 psql (PID 4242)", "10.0.0.5:40000", "and 2 more"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("confirm view missing %q:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "10.0.0.6:40000") {
+		t.Errorf("confirm view lists more than %d clients:\n%s", maxClientLines, view)
+	}
+
+	// An idle listener has no client lines
+	p.Connections = nil
+	m.SetPorts([]ports.PortInfo{p})
+	m.EnterConfirm()
+	if view := m.View(); strings.Contains(view, "Clients:") {
+		t.Errorf("confirm view for an idle listener = %q", view)
+	}
+}
+
 func TestUpdateKillResultError(t *testing.T) {
 	m := NewModel()
 	m.SetPorts([]ports.PortInfo{
@@ -650,28 +872,733 @@ func TestViewScrolling(t *testing.T) {
 	}
 }
 
-func TestFormatPortLineSystemPort(t *testing.T) {
+func TestRenderRowSystemPort(t *testing.T) {
 	m := NewModel()
 	m.SetSize(80, 24)
 
 	// System port (< 1024)
 	port := ports.PortInfo{Port: 80, PID: 100, Process: "nginx", User: "root", Proto: "tcp"}
-	line := m.formatPortLine(port, false)
+	line := renderOnlyRow(m, port, false)
 
 	if !strings.Contains(line, "80") {
 		t.Error("Line should contain port number")
 	}
 }
 
-func TestFormatPortLineEphemeralPort(t *testing.T) {
+func TestRenderRowEphemeralPort(t *testing.T) {
 	m := NewModel()
 	m.SetSize(80, 24)
 
 	// Ephemeral port (> 49151)
 	port := ports.PortInfo{Port: 50000, PID: 100, Process: "app", User: "user", Proto: "tcp"}
-	line := m.formatPortLine(port, false)
+	line := renderOnlyRow(m, port, false)
 
 	if !strings.Contains(line, "50000") {
 		t.Error("Line should contain port number")
 	}
 }
+
+func TestStartKillEntersKillingState(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 999999999, Process: "node", User: "user", Proto: "tcp"},
+	})
+	m.EnterConfirm()
+
+	cmd := m.startKill(m.Confirm())
+
+	if m.state != StateKilling {
+		t.Errorf("state = %v, expected StateKilling", m.state)
+	}
+	if m.escalation == nil {
+		t.Error("escalation should be set while killing")
+	}
+	if cmd == nil {
+		t.Error("startKill should return a command")
+	}
+}
+
+func TestStartKillUsesOptions(t *testing.T) {
+	m := NewModel()
+	m.ApplyOptions(Options{Timeout: 5 * time.Second})
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 999999999, Process: "node", Proto: "tcp"}})
+	m.EnterConfirm()
+	m.startKill(m.Confirm())
+	if m.escalation == nil || m.escalation.Timeout != 5*time.Second {
+		t.Fatalf("escalation = %+v, want a 5s timeout", m.escalation)
+	}
+
+	// Other signals are sent once, without an escalation to interrupt
+	m = NewModel()
+	m.SetSize(80, 24)
+	m.ApplyOptions(Options{Signal: killer.SIGKILL})
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 999999999, Process: "node", Proto: "tcp"}})
+	m.EnterConfirm()
+	if cmd := m.startKill(m.Confirm()); cmd == nil || m.escalation != nil {
+		t.Fatalf("escalation = %+v, want a single signal", m.escalation)
+	}
+	if view := m.View(); strings.Contains(view, "k kill now") {
+		t.Errorf("a single signal cannot be escalated:\n%s", view)
+	}
+}
+
+func TestSignalProcess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping process test in short mode")
+	}
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer child.Process.Kill()
+
+	msg := signalProcess(child.Process.Pid, killer.SIGKILL)().(killResultMsg)
+	if !msg.success || msg.err != nil {
+		t.Fatalf("signalProcess = %+v", msg)
+	}
+	if err := child.Wait(); err == nil {
+		t.Error("the child should have been killed")
+	}
+
+	if msg := signalProcess(999999999, killer.SIGKILL)().(killResultMsg); msg.success {
+		t.Error("signalling a missing process should fail")
+	}
+}
+
+// dockerProxy is a docker-proxy listener publishing the "db" container
+var dockerProxy = ports.PortInfo{Port: 5432, PID: 900, Process: "docker-proxy", User: "root", Proto: "tcp",
+	Cmdline:   "/usr/bin/docker-proxy -proto tcp -host-port 5432 -container-ip 172.17.0.2 -container-port 5432",
+	Container: &ports.Container{Runtime: "docker", ID: "4f1c2d3e4a5b", Name: "db", Image: "postgres:16"}}
+
+func TestStartKillStopsContainer(t *testing.T) {
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{dockerProxy})
+	m.EnterConfirm()
+	if view := m.View(); !strings.Contains(view, "STOP CONTAINER?") || !strings.Contains(view, "postgres:16") {
+		t.Errorf("confirm view should offer to stop the container:\n%s", view)
+	}
+
+	cmd := m.startKill(m.Confirm())
+	if m.state != StateKilling || cmd == nil {
+		t.Fatalf("state = %v, expected StateKilling with a command", m.state)
+	}
+	if m.escalation != nil {
+		t.Error("a container stop should not start an escalation")
+	}
+	if view := m.View(); !strings.Contains(view, "Stopping container db (postgres:16)") {
+		t.Errorf("killing view = %q", view)
+	}
+
+	newModel, _ := m.Update(killResultMsg{success: true})
+	if got := newModel.(Model).message; got != "Stopped container db (postgres:16) on port 5432" {
+		t.Errorf("message = %q", got)
+	}
+}
+
+func TestStopContainerSignal(t *testing.T) {
+	// Unix socket paths are limited to ~100 bytes, shorter than some TempDirs
+	dir, err := os.MkdirTemp("", "tsdock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("cannot listen on a Unix socket: %v", err)
+	}
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	t.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	c := *dockerProxy.Container
+	for _, sig := range []killer.Signal{killer.SIGTERM, killer.SIGKILL} {
+		if msg := stopContainer(context.Background(), c, sig, 3*time.Second)().(killResultMsg); !msg.success {
+			t.Errorf("stopContainer(%s) = %+v", sig, msg)
+		}
+	}
+	want := []string{"POST /containers/4f1c2d3e4a5b/stop?t=3", "POST /containers/4f1c2d3e4a5b/kill?signal=KILL"}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+}
+
+func TestUnidentifiedProxyIsRefused(t *testing.T) {
+	proxy := dockerProxy
+	proxy.Container = nil
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{proxy})
+	m.EnterConfirm()
+
+	err := m.Protection(proxy)
+	if err == nil || !strings.Contains(err.Error(), "could not be identified") {
+		t.Errorf("Protection = %v, expected the unknown container to block the kill", err)
+	}
+	if view := m.View(); strings.Contains(view, "[ Yes ]") {
+		t.Error("the dialog should not offer to kill the proxy")
+	}
+
+	// A scan that could not ask the daemon explains why
+	newModel, _ := m.Update(portsScannedMsg{ports: []ports.PortInfo{proxy}, dockerErr: errors.New("docker: permission denied")})
+	m = newModel.(Model)
+	if err := m.Protection(proxy); err == nil || !strings.Contains(err.Error(), "(docker: permission denied)") {
+		t.Errorf("Protection = %v, expected the daemon error", err)
+	}
+}
+
+func TestViewConfirmShowsCgroupContainer(t *testing.T) {
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{{Port: 8080, PID: 400, Process: "java", User: "ci", Proto: "tcp",
+		Slice:     "kubepods-besteffort.slice",
+		Container: &ports.Container{Runtime: "cri-o", ID: "9a8b7c6d5e4f3a2b1c0d", Pod: "0d3c6f2a-7b1e"}}})
+	m.EnterConfirm()
+
+	view := m.View()
+	if !strings.Contains(view, "KILL PROCESS?") {
+		t.Error("a process inside a container is killed, not stopped")
+	}
+	for _, want := range []string{"Container: 9a8b7c6d5e4f (cri-o)", "Pod:      0d3c6f2a-7b1e", "Slice:    kubepods-besteffort.slice"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("confirm view should contain %q:\n%s", want, view)
+		}
+	}
+}
+
+func TestStartKillStopsUnit(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\necho \"$*\" >> " + log + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{{Port: 80, PID: 800, Process: "nginx", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "nginx.service", Restart: "always"}}})
+	m.EnterConfirm()
+	view := m.View()
+	for _, want := range []string{"STOP UNIT?", "Unit:     nginx.service", "Restart:  always"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("confirm view should contain %q:\n%s", want, view)
+		}
+	}
+
+	cmd := m.startKill(m.Confirm())
+	if m.state != StateKilling || cmd == nil || m.escalation != nil {
+		t.Fatalf("state = %v, escalation = %v; expected a unit stop", m.state, m.escalation)
+	}
+	if view := m.View(); !strings.Contains(view, "Stopping unit nginx.service") {
+		t.Errorf("killing view = %q", view)
+	}
+	// the first command of the batch is the stop itself
+	msg := cmd().(tea.BatchMsg)[0]()
+	if res, ok := msg.(killResultMsg); !ok || !res.success {
+		t.Fatalf("stop result = %#v", msg)
+	}
+	if data, _ := os.ReadFile(log); strings.TrimSpace(string(data)) != "stop -- nginx.service" {
+		t.Errorf("systemctl calls = %q", data)
+	}
+
+	newModel, _ := m.Update(msg)
+	if got := newModel.(Model).message; got != "Stopped unit nginx.service on port 80" {
+		t.Errorf("message = %q", got)
+	}
+}
+
+func TestStopUnitSignal(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := "#!/bin/sh\necho \"$*\" >> " + log + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	m := NewModel()
+	m.ApplyOptions(Options{Signal: killer.SIGHUP})
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{{Port: 80, PID: 800, Process: "nginx", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "nginx.service", Restart: "always"}}})
+	m.EnterConfirm()
+	cmd := m.startKill(m.Confirm())
+	if res, ok := cmd().(tea.BatchMsg)[0]().(killResultMsg); !ok || !res.success {
+		t.Fatalf("stop result = %#v", res)
+	}
+	if data, _ := os.ReadFile(log); strings.TrimSpace(string(data)) != "kill --signal=SIGHUP -- nginx.service" {
+		t.Errorf("systemctl calls = %q", data)
+	}
+}
+
+func TestConfirmKillProcessOnly(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.SetPorts([]ports.PortInfo{{Port: 80, PID: 800, Process: "nginx", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "nginx.service", Restart: "always"}}})
+	m.EnterConfirm()
+	if view := m.View(); !strings.Contains(view, "p kill process only") {
+		t.Errorf("confirm view should offer to kill the process only:\n%s", view)
+	}
+
+	// The kill command is not run: PID 800 may exist
+	newModel, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	m = newModel.(Model)
+	if m.state != StateKilling || cmd == nil || m.escalation == nil || m.escalation.PID != 800 {
+		t.Fatalf("state = %v, escalation = %+v; expected the process to be killed", m.state, m.escalation)
+	}
+	if view := m.View(); !strings.Contains(view, "Killing nginx (PID 800)") {
+		t.Errorf("killing view = %q", view)
+	}
+
+	// A socket unit's listener is the service manager itself
+	m = NewModel()
+	m.SetSize(100, 24)
+	m.SetPorts([]ports.PortInfo{{Port: 631, PID: 1, Process: "systemd", User: "root", Proto: "tcp",
+		Unit: &ports.Unit{Name: "cups.socket"}}})
+	m.EnterConfirm()
+	if view := m.View(); strings.Contains(view, "p kill process only") {
+		t.Errorf("confirm view offers to kill PID 1:\n%s", view)
+	}
+	newModel, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	if m = newModel.(Model); m.state != StateConfirm {
+		t.Errorf("state after p = %v, want StateConfirm", m.state)
+	}
+}
+
+func TestPortReleased(t *testing.T) {
+	node := ports.PortInfo{Port: 3000, PID: 100, Process: "node", Proto: "tcp"}
+	listening := []ports.PortInfo{node}
+	scan := func(context.Context) ([]ports.PortInfo, error) { return listening, nil }
+	released := portReleased(context.Background(), scan, node)
+	if released() {
+		t.Error("released while the process still listens")
+	}
+	// Another process taking the port over does not hold it for node
+	listening = []ports.PortInfo{{Port: 3000, PID: 200, Process: "node", Proto: "tcp"}}
+	if !released() {
+		t.Error("not released once the process stopped listening")
+	}
+
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{node})
+	m.EnterConfirm()
+	m.startKill(m.Confirm())
+	if m.escalation == nil || m.escalation.Released == nil {
+		t.Errorf("escalation = %+v, want a Released check", m.escalation)
+	}
+}
+
+func TestUpdateProgress(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+	})
+	m.EnterConfirm()
+	m.state = StateKilling
+
+	events := make(chan killer.Event, 1)
+	msg := progressMsg{
+		event:  killer.Event{Kind: killer.EventWaiting, PID: 100, Elapsed: time.Second, Timeout: 2 * time.Second},
+		events: events,
+	}
+	newModel, cmd := m.Update(msg)
+	updated := newModel.(Model)
+
+	if updated.progress == nil || updated.progress.Kind != killer.EventWaiting {
+		t.Error("progress should record the latest event")
+	}
+	if cmd == nil {
+		t.Error("progress should schedule the next read")
+	}
+
+	updated.SetSize(80, 24)
+	view := updated.View()
+	if !strings.Contains(view, "SIGKILL in 1.0s") {
+		t.Errorf("killing view should show countdown, got %q", view)
+	}
+}
+
+func TestForwardEvent(t *testing.T) {
+	events := make(chan killer.Event, 2)
+	forward := forwardEvent(context.Background(), events)
+
+	// A full buffer drops countdown updates without blocking
+	forward(killer.Event{Kind: killer.EventWaiting})
+	forward(killer.Event{Kind: killer.EventWaiting})
+	forward(killer.Event{Kind: killer.EventWaiting})
+	if len(events) != 2 {
+		t.Fatalf("buffered %d events, want 2", len(events))
+	}
+
+	// The exit waits for room instead of being lost
+	sent := make(chan struct{})
+	go func() {
+		forward(killer.Event{Kind: killer.EventExited, PID: 100})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("the exit was dropped or sent into a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-events
+	<-events
+	<-sent
+	if e := <-events; e.Kind != killer.EventExited {
+		t.Errorf("last event = %v, want the exit", e)
+	}
+
+	// Once the kill is interrupted nothing blocks
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	full := make(chan killer.Event)
+	forwardEvent(ctx, full)(killer.Event{Kind: killer.EventPortReleased})
+}
+
+func TestWaitForProgressClosed(t *testing.T) {
+	events := make(chan killer.Event)
+	close(events)
+
+	if msg := waitForProgress(events)(); msg != nil {
+		t.Errorf("closed channel should yield nil message, got %v", msg)
+	}
+}
+
+func TestSpinnerTick(t *testing.T) {
+	m := NewModel()
+	m.state = StateKilling
+
+	newModel, cmd := m.Update(spinnerTickMsg{})
+	updated := newModel.(Model)
+
+	if updated.spinner != 1 {
+		t.Errorf("spinner = %d, expected 1", updated.spinner)
+	}
+	if cmd == nil {
+		t.Error("spinner should keep ticking while killing")
+	}
+
+	updated.state = StateList
+	_, cmd = updated.Update(spinnerTickMsg{})
+	if cmd != nil {
+		t.Error("spinner should stop ticking outside killing state")
+	}
+}
+
+func TestHandleKillingKeys(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+	})
+	m.EnterConfirm()
+	m.state = StateKilling
+
+	// Without an escalation, keys are ignored
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'k'}}); cmd != nil {
+		t.Error("killing keys should not return a command")
+	}
+
+	m.escalation = killer.NewEscalation(100, time.Second)
+	for _, key := range []tea.KeyMsg{
+		{Type: tea.KeyRunes, Runes: []rune{'k'}},
+		{Type: tea.KeyEsc},
+	} {
+		newModel, _ := m.Update(key)
+		if newModel.(Model).state != StateKilling {
+			t.Errorf("key %q should not leave killing state until the kill finishes", key.String())
+		}
+	}
+}
+
+func TestUpdateKillResultAborted(t *testing.T) {
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+	})
+	m.EnterConfirm()
+	m.state = StateKilling
+
+	newModel, cmd := m.Update(killResultMsg{err: killer.ErrAborted})
+	updated := newModel.(Model)
+
+	if updated.state != StateList {
+		t.Errorf("state after abort = %v, expected StateList", updated.state)
+	}
+	if cmd != nil {
+		t.Error("abort should not quit")
+	}
+	if !strings.Contains(updated.View(), "Stopped waiting") {
+		t.Error("list view should show the abort message")
+	}
+}
+
+func TestHandleListKeySort(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 300, Process: "node"},
+		{Port: 8080, PID: 100, Process: "apache"},
+	})
+
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	updated := newModel.(Model)
+	if updated.sortKey != ports.SortByPID {
+		t.Errorf("tab should cycle sort to pid, got %q", updated.sortKey)
+	}
+
+	newModel, _ = updated.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+	updated = newModel.(Model)
+	if updated.sortKey != ports.SortByPort {
+		t.Errorf("shift+tab should cycle sort back to port, got %q", updated.sortKey)
+	}
+
+	newModel, _ = updated.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	updated = newModel.(Model)
+	if !updated.reverse {
+		t.Error("ctrl+r should reverse the sort")
+	}
+	if updated.filter != "" {
+		t.Error("sort keys should not be added to the filter")
+	}
+}
+
+func TestViewListSortIndicator(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+	})
+
+	if !strings.Contains(m.View(), "PORT▲") {
+		t.Error("header should mark the sorted column ascending")
+	}
+
+	m.ToggleReverse()
+	if !strings.Contains(m.View(), "PORT▼") {
+		t.Error("header should mark the sorted column descending")
+	}
+
+	m.CycleSort(true)
+	if !strings.Contains(m.View(), "PID▼") {
+		t.Error("header should follow the sort key")
+	}
+}
+
+func TestViewListCustomColumns(t *testing.T) {
+	m := NewModel()
+	m.SetSize(120, 24)
+	cols, _ := columns.Parse("port,address,cmdline")
+	m.ApplyOptions(Options{Columns: cols})
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", Address: "127.0.0.1", Cmdline: "node server.js"},
+	})
+
+	view := m.View()
+	for _, want := range []string{"ADDRESS", "COMMAND", "127.0.0.1", "node server.js"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view should contain %q", want)
+		}
+	}
+	if strings.Contains(view, "USER") {
+		t.Error("view should only show configured columns")
+	}
+}
+
+func TestHandleListKeyMatchMode(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+
+	if !strings.Contains(m.View(), "[fuzzy]") {
+		t.Error("view should show the fuzzy match mode")
+	}
+
+	newModel, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	updated := newModel.(Model)
+	if !strings.Contains(updated.View(), "[exact]") {
+		t.Error("ctrl+t should switch to exact mode")
+	}
+}
+
+func TestViewListFilterError(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.matchMode = match.Regex
+	m.AddFilterChar('[')
+
+	if !strings.Contains(m.View(), "invalid regex") {
+		t.Error("view should show the regex error")
+	}
+}
+
+func TestRenderCellHighlight(t *testing.T) {
+	// Plain styles so the output can be compared directly
+	base := lipgloss.NewStyle()
+	hl := lipgloss.NewStyle()
+
+	if got := renderCell("node", 6, []int{0, 2}, base, hl); got != "node  " {
+		t.Errorf("renderCell = %q, expected padded text", got)
+	}
+	if got := renderCell("postgres", 6, []int{7}, base, hl); got != "pos..." {
+		t.Errorf("renderCell = %q, expected truncated text", got)
+	}
+	if got := renderCell("日本語", 6, []int{1}, base, hl); got != "日本語" {
+		t.Errorf("renderCell = %q, expected wide runes intact", got)
+	}
+}
+
+func TestViewListHighlightsMatches(t *testing.T) {
+	m := NewModel()
+	m.SetSize(100, 24)
+	m.SetPorts([]ports.PortInfo{
+		{Port: 3000, PID: 100, Process: "node", User: "user", Proto: "tcp"},
+		{Port: 4000, PID: 200, Process: "java", User: "user", Proto: "tcp"},
+	})
+	m.AddFilterChar('n')
+	m.AddFilterChar('d')
+
+	view := m.View()
+	if !strings.Contains(view, "node") {
+		t.Error("matched row should still show the full process name")
+	}
+	if strings.Contains(view, "java") {
+		t.Error("unmatched row should be filtered out")
+	}
+}
+
+// protectedModel returns a model whose policy protects port 22
+func protectedModel(t *testing.T) Model {
+	t.Helper()
+	rule, err := killer.ParseRule("port=22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewModel()
+	m.SetSize(80, 24)
+	m.ApplyOptions(Options{Policy: killer.NewPolicy(rule)})
+	m.SetPorts([]ports.PortInfo{
+		{Port: 22, PID: 9000100, Process: "dropbear", User: "root", Proto: "tcp"},
+		{Port: 3000, PID: 9000200, Process: "node", User: "user", Proto: "tcp"},
+	})
+	return m
+}
+
+func TestProtectedRowLock(t *testing.T) {
+	m := protectedModel(t)
+
+	if m.Protection(m.filtered[0]) == nil {
+		t.Fatal("port 22 should be protected")
+	}
+	if m.Protection(m.filtered[1]) != nil {
+		t.Error("port 3000 should not be protected")
+	}
+
+	view := m.View()
+	var lockLines []string
+	for _, line := range strings.Split(view, "\n") {
+		if strings.Contains(line, "🔒") {
+			lockLines = append(lockLines, line)
+		}
+	}
+	if len(lockLines) != 1 || !strings.Contains(lockLines[0], "dropbear") {
+		t.Errorf("expected a lock on the dropbear row only, got %q", lockLines)
+	}
+}
+
+func TestProtectedConfirmBlocked(t *testing.T) {
+	m := protectedModel(t)
+	m.EnterConfirm()
+
+	view := m.View()
+	if !strings.Contains(view, "PROTECTED PROCESS") || !strings.Contains(view, "protection rule port=22") {
+		t.Errorf("confirm view should explain the protection:\n%s", view)
+	}
+	if strings.Contains(view, "[ Yes ]") {
+		t.Error("confirm view should not offer Yes for a protected process")
+	}
+	if m.Confirm() != nil {
+		t.Error("Confirm() should never return a protected process")
+	}
+
+	newModel, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	updated := newModel.(Model)
+	if cmd != nil || updated.state != StateList {
+		t.Errorf("'y' on a protected process: state = %v, cmd = %v; expected back to list", updated.state, cmd)
+	}
+	if !strings.Contains(updated.message, "is protected") {
+		t.Errorf("message = %q, expected the protection reason", updated.message)
+	}
+}
+
+func TestNoPolicyProtectsNothing(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 22, PID: 1, Process: "init"}})
+	if m.Protection(m.filtered[0]) != nil {
+		t.Error("without a policy nothing should be protected")
+	}
+}
+
+func TestWaitForChanges(t *testing.T) {
+	changes := make(chan ports.Event, 3)
+	changes <- ports.Event{Kind: ports.Opened, Listener: ports.PortInfo{Port: 3000, PID: 100}}
+	changes <- ports.Event{Kind: ports.Closed, Listener: ports.PortInfo{Port: 5173, PID: 200}}
+
+	msg, ok := waitForChanges(context.Background(), changes, labels.New(nil))().(portsChangedMsg)
+	if !ok || len(msg.events) != 2 || msg.changes == nil {
+		t.Fatalf("waitForChanges = %+v, expected both events batched", msg)
+	}
+
+	close(changes)
+	if msg := waitForChanges(context.Background(), changes, labels.New(nil))(); msg != nil {
+		t.Errorf("closed channel gave %v, expected nil", msg)
+	}
+}
+
+func TestUpdatePortsChanged(t *testing.T) {
+	m := NewModel()
+	m.SetPorts([]ports.PortInfo{{Port: 3000, PID: 100, Process: "node", Proto: "tcp"}})
+
+	changes := make(chan ports.Event)
+	msg := portsChangedMsg{
+		events:  []ports.Event{{Kind: ports.Opened, Listener: ports.PortInfo{Port: 8080, PID: 300, Process: "java", Proto: "tcp"}}},
+		changes: changes,
+	}
+	newModel, cmd := m.Update(msg)
+	if got := len(newModel.(Model).filtered); got != 2 {
+		t.Errorf("len(filtered) = %d, expected 2", got)
+	}
+	if cmd == nil {
+		t.Error("expected the next read to be scheduled")
+	}
+
+	msg.changes = nil
+	if _, cmd := m.Update(msg); cmd != nil {
+		t.Error("a closed watch should not schedule another read")
+	}
+}
+
+func TestUpdatePortsScannedStartsWatch(t *testing.T) {
+	m := NewModel()
+	m.ctx = context.Background()
+	newModel, cmd := m.Update(portsScannedMsg{ports: nil})
+	if cmd == nil || !newModel.(Model).watching {
+		t.Error("the first scan should start watching")
+	}
+	if _, cmd := newModel.(Model).Update(portsScannedMsg{ports: nil}); cmd != nil {
+		t.Error("watching should only start once")
+	}
+}